@@ -0,0 +1,135 @@
+// Package artwork resizes album artwork for display and computes the
+// BlurHash placeholders shown while it loads.
+//
+// JPEG, PNG, GIF, WebP, BMP and TIFF images are read. Resized images
+// are written as JPEG, PNG or lossless WebP.
+package artwork
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// decoders for image.Decode
+	_ "image/gif"
+
+	xdraw "golang.org/x/image/draw"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrFormat is returned for output formats that cannot be
+	// written.
+	ErrFormat = errors.New("artwork: unsupported format")
+)
+
+// Format ...
+// An image format resized artwork is written in.
+type Format string
+
+// Formats resized artwork can be written in.
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+)
+
+// jpegQuality is the quality resized JPEGs are written with.
+const jpegQuality = 85
+
+// ParseFormat ...
+// Returns the format of a name, accepting "jpg" for JPEG.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case JPEG, "jpg":
+		return JPEG, nil
+	case PNG:
+		return PNG, nil
+	case WebP:
+		return WebP, nil
+	}
+	return "", ErrFormat
+}
+
+// Extension ...
+// The file extension of the format, without a dot.
+func (f Format) Extension() string {
+	if f == JPEG {
+		return "jpg"
+	}
+	return string(f)
+}
+
+// MIMEType ...
+func (f Format) MIMEType() string {
+	return "image/" + string(f)
+}
+
+// Decode ...
+// Reads an image in any supported format.
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// Resize ...
+// Scales an image down to fit in a size by size square, keeping its
+// aspect ratio. Images that already fit are returned as they are.
+func Resize(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if size <= 0 || (w <= size && h <= size) {
+		return img
+	}
+
+	if w >= h {
+		h = h * size / w
+		w = size
+	} else {
+		w = w * size / h
+		h = size
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Encode ...
+// Writes an image in a format.
+func Encode(w io.Writer, img image.Image, f Format) error {
+	switch f {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case PNG:
+		return png.Encode(w, img)
+	case WebP:
+		return encodeWebP(w, img)
+	}
+	return ErrFormat
+}
+
+// toNRGBA ...
+// Converts an image to non premultiplied 8 bit colour, which both
+// BlurHash and WebP work on.
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	n := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(n, n.Bounds(), img, b.Min, draw.Src)
+	return n
+}
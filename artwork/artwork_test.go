@@ -0,0 +1,163 @@
+package artwork
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testImage ...
+// Returns a noisy gradient, with some transparency if alpha is set.
+func testImage(w, h int, alpha bool) *image.NRGBA {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{
+				R: uint8(x * 255 / w),
+				G: uint8(y * 255 / h),
+				B: uint8(r.Intn(256)),
+				A: 0xff,
+			}
+			if alpha {
+				c.A = uint8(r.Intn(256))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// skewedImage ...
+// Returns an image whose residuals are exponentially distributed, so
+// that their Huffman codes would be longer than WebP allows.
+func skewedImage(w, h int) *image.NRGBA {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		v := 0
+		for v < 255 && r.Intn(2) == 0 {
+			v++
+		}
+		img.Pix[i] = uint8(v)
+	}
+	return img
+}
+
+// TestParseFormat ...
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		format Format
+		err    error
+	}{
+		{"jpeg", JPEG, nil},
+		{"jpg", JPEG, nil},
+		{"png", PNG, nil},
+		{"webp", WebP, nil},
+		{"gif", "", ErrFormat},
+		{"", "", ErrFormat},
+	}
+
+	for _, c := range cases {
+		f, err := ParseFormat(c.name)
+		if f != c.format || err != c.err {
+			t.Errorf("expected %q to parse as %q, %v, received %q, %v", c.name, c.format, c.err, f, err)
+		}
+	}
+
+	if JPEG.Extension() != "jpg" || WebP.MIMEType() != "image/webp" {
+		t.Errorf("unexpected extension %q or mime type %q", JPEG.Extension(), WebP.MIMEType())
+	}
+}
+
+// TestResize ...
+func TestResize(t *testing.T) {
+	cases := []struct {
+		w, h, size int
+		expected   image.Point
+	}{
+		{1000, 500, 256, image.Pt(256, 128)},
+		{500, 1000, 256, image.Pt(128, 256)},
+		{600, 600, 64, image.Pt(64, 64)},
+		{100, 50, 256, image.Pt(100, 50)},
+		{2000, 1, 100, image.Pt(100, 1)},
+	}
+
+	for _, c := range cases {
+		img := Resize(image.NewRGBA(image.Rect(0, 0, c.w, c.h)), c.size)
+		if size := img.Bounds().Size(); size != c.expected {
+			t.Errorf("expected %dx%d in %d to be %v, received %v", c.w, c.h, c.size, c.expected, size)
+		}
+	}
+}
+
+// TestEncodeWebP ...
+func TestEncodeWebP(t *testing.T) {
+	cases := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"pixel", testImage(1, 1, false)},
+		{"gradient", testImage(37, 21, false)},
+		{"alpha", testImage(16, 16, true)},
+		{"blocks", testImage(600, 3, false)},
+		{"flat", image.NewNRGBA(image.Rect(0, 0, 8, 8))},
+		{"skewed", skewedImage(512, 512)},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		err := Encode(&buf, c.img, WebP)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		decoded, err := webp.Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: decoding: %v", c.name, err)
+			continue
+		}
+		got := toNRGBA(decoded)
+		if got.Rect != c.img.Rect || !bytes.Equal(got.Pix, c.img.Pix) {
+			t.Errorf("%s: decoded image differs from the original", c.name)
+		}
+	}
+
+	err := Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, webpMaxSize+1, 1)), WebP)
+	if err != ErrTooLarge {
+		t.Errorf("expected %v, received %v", ErrTooLarge, err)
+	}
+}
+
+// TestBlurHash ...
+func TestBlurHash(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 0xff
+	}
+
+	hash, err := BlurHash(black, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "L00000fQfQfQfQfQfQfQfQfQfQfQ" {
+		t.Errorf("unexpected hash of a black image: %q", hash)
+	}
+
+	// a component for each direction, and 4 digits of DC
+	hash, err = BlurHash(testImage(100, 60, false), 1, 1)
+	if err != nil || len(hash) != 6 {
+		t.Errorf("expected a 6 character hash, received %q, %v", hash, err)
+	}
+
+	_, err = BlurHash(black, 0, 10)
+	if err != ErrComponents {
+		t.Errorf("expected %v, received %v", ErrComponents, err)
+	}
+}
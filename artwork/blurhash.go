@@ -0,0 +1,138 @@
+package artwork
+
+import (
+	"errors"
+	"image"
+	"math"
+	"strings"
+)
+
+var (
+	// ErrComponents is returned for a BlurHash of fewer than 1 or more
+	// than 9 components in either direction.
+	ErrComponents = errors.New("artwork: blurhash components must be between 1 and 9")
+)
+
+const (
+	base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+	// images are scaled down to this before a BlurHash is computed,
+	// it only describes their broad colours
+	blurHashSize = 32
+)
+
+// BlurHash ...
+// Computes the BlurHash of an image, a short string describing it as
+// a blend of x by y cosines that clients draw while the image loads.
+// See https://blurha.sh.
+func BlurHash(img image.Image, x, y int) (string, error) {
+	if x < 1 || x > 9 || y < 1 || y > 9 {
+		return "", ErrComponents
+	}
+
+	small := toNRGBA(Resize(img, blurHashSize))
+	w, h := small.Rect.Dx(), small.Rect.Dy()
+	if w == 0 || h == 0 {
+		return "", ErrComponents
+	}
+
+	// the image in linear light
+	linear := make([][3]float64, w*h)
+	for i := range linear {
+		for c := 0; c < 3; c++ {
+			linear[i][c] = sRGBToLinear(small.Pix[i*4+c])
+		}
+	}
+
+	factors := make([][3]float64, 0, x*y)
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var f [3]float64
+			for py := 0; py < h; py++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(py) / float64(h))
+				for px := 0; px < w; px++ {
+					basis := cy * math.Cos(math.Pi*float64(i)*float64(px)/float64(w))
+					l := linear[py*w+px]
+					for c := range f {
+						f[c] += basis * l[c]
+					}
+				}
+			}
+
+			scale := normalisation / float64(w*h)
+			for c := range f {
+				f[c] *= scale
+			}
+			factors = append(factors, f)
+		}
+	}
+
+	var hash strings.Builder
+	encode83(&hash, (x-1)+(y-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		var actual float64
+		for _, f := range ac {
+			for _, v := range f {
+				actual = math.Max(actual, math.Abs(v))
+			}
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		encode83(&hash, quantised, 1)
+	} else {
+		encode83(&hash, 0, 1)
+	}
+
+	encode83(&hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+
+	for _, f := range ac {
+		var q [3]int
+		for c, v := range f {
+			q[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(&hash, q[0]*19*19+q[1]*19+q[2], 2)
+	}
+
+	return hash.String(), nil
+}
+
+// encode83 ...
+// Writes n as length base 83 digits.
+func encode83(b *strings.Builder, n, length int) {
+	for i := length - 1; i >= 0; i-- {
+		digit := n / int(math.Pow(83, float64(i))) % 83
+		b.WriteByte(base83[digit])
+	}
+}
+
+// sRGBToLinear ...
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB ...
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// signPow ...
+// Raises the magnitude of v to exp, keeping its sign.
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
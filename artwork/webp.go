@@ -0,0 +1,479 @@
+package artwork
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+)
+
+// ErrTooLarge is returned when writing a WebP wider or taller than
+// the format allows.
+var ErrTooLarge = errors.New("artwork: image too large for webp")
+
+const (
+	webpMaxSize = 1 << 14
+
+	vp8lSignature = 0x2f
+
+	// transforms
+	vp8lPredictor     = 0
+	vp8lSubtractGreen = 2
+
+	// the predictor transform uses a single mode for the whole image
+	// in blocks of 1<<vp8lPredictorBits pixels
+	vp8lPredictorBits = 9
+	// ClampAddSubtractFull(L, T, TL), a gradient
+	vp8lPredictorMode = 12
+
+	// prefix codes are at most this long, their code lengths at most
+	// vp8lMaxCodeLengthLength
+	vp8lMaxCodeLength       = 15
+	vp8lMaxCodeLengthLength = 7
+)
+
+var (
+	// the size of the alphabets of the green, red, blue, alpha and
+	// distance prefix codes, without a colour cache
+	vp8lAlphabets = [5]int{256 + 24, 256, 256, 256, 40}
+
+	// the order code length code lengths are written in
+	vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+)
+
+// encodeWebP ...
+// Writes an image as a lossless WebP. Only the subtract green and
+// predictor transforms are used and there are no backward references,
+// which compresses photographs reasonably for the little code it
+// takes.
+func encodeWebP(w io.Writer, img image.Image) error {
+	px := toNRGBA(img)
+	width, height := px.Rect.Dx(), px.Rect.Dy()
+	if width > webpMaxSize || height > webpMaxSize {
+		return ErrTooLarge
+	}
+
+	argb := make([]uint32, width*height)
+	opaque := true
+	for i := range argb {
+		p := px.Pix[i*4 : i*4+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		opaque = opaque && p[3] == 0xff
+	}
+
+	var bw bitWriter
+	bw.buf = append(bw.buf, vp8lSignature)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // version
+
+	// transforms, inverted by decoders in the opposite order
+	bw.write(1, 1)
+	bw.write(vp8lSubtractGreen, 2)
+	subtractGreen(argb)
+
+	bw.write(1, 1)
+	bw.write(vp8lPredictor, 2)
+	bw.write(vp8lPredictorBits-2, 3)
+	block := 1 << vp8lPredictorBits
+	modes := make([]uint32, ((width+block-1)/block)*((height+block-1)/block))
+	for i := range modes {
+		modes[i] = vp8lPredictorMode << 8
+	}
+	writeImage(&bw, modes)
+	argb = predict(argb, width)
+
+	bw.write(0, 1)
+
+	// no meta prefix codes
+	bw.write(0, 1)
+	writeImage(&bw, argb)
+	bw.flush()
+
+	// RIFF container, chunks are padded to an even length
+	data := bw.buf
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+8+len(data)+pad))
+	copy(header[8:16], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(data)))
+
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	if pad == 1 {
+		_, err = w.Write([]byte{0})
+	}
+	return err
+}
+
+// subtractGreen ...
+// Subtracts the green of each pixel from its red and blue.
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict ...
+// Returns the difference of each pixel from its prediction. The first
+// pixel is predicted as opaque black, the rest of the first row from
+// the pixel to their left, the rest of the first column from the
+// pixel above them and every other pixel by vp8lPredictorMode.
+func predict(argb []uint32, width int) []uint32 {
+	residuals := make([]uint32, len(argb))
+	for i, p := range argb {
+		x, y := i%width, i/width
+
+		var pred uint32
+		switch {
+		case x == 0 && y == 0:
+			pred = 0xff000000
+		case y == 0:
+			pred = argb[i-1]
+		case x == 0:
+			pred = argb[i-width]
+		default:
+			pred = clampAddSubtractFull(argb[i-1], argb[i-width], argb[i-width-1])
+		}
+
+		residuals[i] = subPixels(p, pred)
+	}
+	return residuals
+}
+
+// clampAddSubtractFull ...
+// Predicts each channel as l+t-tl, clamped to a byte.
+func clampAddSubtractFull(l, t, tl uint32) (pred uint32) {
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int(l>>shift&0xff) + int(t>>shift&0xff) - int(tl>>shift&0xff)
+		if v < 0 {
+			v = 0
+		} else if v > 0xff {
+			v = 0xff
+		}
+		pred |= uint32(v) << shift
+	}
+	return pred
+}
+
+// subPixels ...
+// Subtracts each channel of b from a, modulo 256.
+func subPixels(a, b uint32) (diff uint32) {
+	for shift := uint(0); shift < 32; shift += 8 {
+		diff |= ((a>>shift - b>>shift) & 0xff) << shift
+	}
+	return diff
+}
+
+// writeImage ...
+// Writes the prefix codes and pixels of an entropy coded image that
+// uses no colour cache and no backward references.
+func writeImage(bw *bitWriter, argb []uint32) {
+	// no colour cache
+	bw.write(0, 1)
+
+	var counts [5][]int
+	for i, size := range vp8lAlphabets {
+		counts[i] = make([]int, size)
+	}
+	for _, p := range argb {
+		counts[0][p>>8&0xff]++
+		counts[1][p>>16&0xff]++
+		counts[2][p&0xff]++
+		counts[3][p>>24]++
+	}
+
+	var codes [5]prefixCode
+	for i := range codes {
+		codes[i] = newPrefixCode(counts[i], vp8lMaxCodeLength)
+		codes[i].writeTo(bw)
+	}
+
+	for _, p := range argb {
+		codes[0].put(bw, int(p>>8&0xff))
+		codes[1].put(bw, int(p>>16&0xff))
+		codes[2].put(bw, int(p&0xff))
+		codes[3].put(bw, int(p>>24))
+	}
+}
+
+// bitWriter ...
+// Writes values least significant bit first.
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+// write ...
+// Writes the n low bits of v.
+func (bw *bitWriter) write(v uint32, n uint) {
+	bw.bits |= uint64(v) << bw.n
+	bw.n += n
+	for bw.n >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.n -= 8
+	}
+}
+
+// flush ...
+// Writes any remaining bits, padded with zeros to a byte.
+func (bw *bitWriter) flush() {
+	if bw.n > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+	}
+	bw.bits, bw.n = 0, 0
+}
+
+// prefixCode ...
+// A canonical Huffman code.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32 // bit reversed, ready to be written
+	// the number of symbols with a code, a single symbol takes no
+	// bits at all
+	used int
+}
+
+// newPrefixCode ...
+// Builds the prefix code of the symbols counted, no longer than
+// limit bits.
+func newPrefixCode(counts []int, limit int) prefixCode {
+	c := prefixCode{lengths: huffmanLengths(counts, limit)}
+	c.codes = make([]uint32, len(counts))
+
+	var histogram [vp8lMaxCodeLength + 1]uint32
+	for _, l := range c.lengths {
+		if l > 0 {
+			histogram[l]++
+			c.used++
+		}
+	}
+	var next [vp8lMaxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + histogram[l-1]) << 1
+		next[l] = code
+	}
+	for sym, l := range c.lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[sym] = reverse(next[l], uint(l))
+		next[l]++
+	}
+
+	return c
+}
+
+// reverse ...
+// Reverses the n low bits of v.
+func reverse(v uint32, n uint) (r uint32) {
+	for i := uint(0); i < n; i++ {
+		r = r<<1 | v>>i&1
+	}
+	return r
+}
+
+// put ...
+// Writes the code of a symbol.
+func (c prefixCode) put(bw *bitWriter, sym int) {
+	if c.used > 1 {
+		bw.write(c.codes[sym], uint(c.lengths[sym]))
+	}
+}
+
+// writeTo ...
+// Writes the code lengths of the prefix code, as a simple code when
+// it has at most two symbols that fit in a byte.
+func (c prefixCode) writeTo(bw *bitWriter) {
+	var symbols []int
+	for sym, l := range c.lengths {
+		if l > 0 {
+			symbols = append(symbols, sym)
+		}
+	}
+	if len(symbols) == 0 {
+		// nothing is written with it, a code of one symbol is
+		// shortest
+		symbols = []int{0}
+	}
+
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(symbols)-1), 1)
+		if symbols[0] <= 1 {
+			bw.write(0, 1)
+			bw.write(uint32(symbols[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			bw.write(uint32(symbols[1]), 8)
+		}
+		return
+	}
+
+	// the code lengths are run length encoded then written with a
+	// prefix code of their own
+	type run struct {
+		sym   int
+		extra uint32
+	}
+	var runs []run
+	counts := make([]int, len(vp8lCodeLengthOrder))
+	for i := 0; i < len(c.lengths); {
+		l := c.lengths[i]
+		n := 1
+		for i+n < len(c.lengths) && c.lengths[i+n] == l {
+			n++
+		}
+		i += n
+
+		for l == 0 && n >= 3 {
+			r := run{17, 0}
+			switch {
+			case n >= 11:
+				k := n
+				if k > 138 {
+					k = 138
+				}
+				r = run{18, uint32(k - 11)}
+				n -= k
+			default:
+				k := n
+				if k > 10 {
+					k = 10
+				}
+				r.extra = uint32(k - 3)
+				n -= k
+			}
+			runs = append(runs, r)
+			counts[r.sym]++
+		}
+		for ; n > 0; n-- {
+			runs = append(runs, run{int(l), 0})
+			counts[l]++
+		}
+	}
+
+	lengthCode := newPrefixCode(counts, vp8lMaxCodeLengthLength)
+	num := len(vp8lCodeLengthOrder)
+	for num > 4 && lengthCode.lengths[vp8lCodeLengthOrder[num-1]] == 0 {
+		num--
+	}
+
+	bw.write(0, 1)
+	bw.write(uint32(num-4), 4)
+	for _, sym := range vp8lCodeLengthOrder[:num] {
+		bw.write(uint32(lengthCode.lengths[sym]), 3)
+	}
+	// every symbol of the alphabet has a length
+	bw.write(0, 1)
+
+	for _, r := range runs {
+		lengthCode.put(bw, r.sym)
+		switch r.sym {
+		case 17:
+			bw.write(r.extra, 3)
+		case 18:
+			bw.write(r.extra, 7)
+		}
+	}
+}
+
+// huffmanNode ...
+type huffmanNode struct {
+	count       int
+	sym         int // -1 for internal nodes
+	left, right *huffmanNode
+}
+
+// huffmanHeap ...
+// A min heap of nodes by count, ties broken by symbol so that codes
+// are deterministic.
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].sym < h[j].sym
+}
+func (h huffmanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x interface{}) { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths ...
+// Returns the lengths of the Huffman codes of the symbols counted, no
+// longer than limit bits. Rare symbols are counted as more common
+// until the code fits.
+func huffmanLengths(counts []int, limit int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	for floor := 1; ; floor *= 2 {
+		h := huffmanHeap{}
+		for sym, n := range counts {
+			if n == 0 {
+				continue
+			}
+			if n < floor {
+				n = floor
+			}
+			h = append(h, &huffmanNode{count: n, sym: sym})
+		}
+		switch len(h) {
+		case 0:
+			return lengths
+		case 1:
+			lengths[h[0].sym] = 1
+			return lengths
+		}
+
+		heap.Init(&h)
+		for h.Len() > 1 {
+			a := heap.Pop(&h).(*huffmanNode)
+			b := heap.Pop(&h).(*huffmanNode)
+			heap.Push(&h, &huffmanNode{count: a.count + b.count, sym: -1, left: a, right: b})
+		}
+
+		fits := true
+		var walk func(n *huffmanNode, depth int)
+		walk = func(n *huffmanNode, depth int) {
+			if n.sym >= 0 {
+				lengths[n.sym] = uint8(depth)
+				fits = fits && depth <= limit
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(h[0], 0)
+		if fits {
+			return lengths
+		}
+	}
+}
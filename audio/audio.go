@@ -0,0 +1,170 @@
+// Package audio reads the stream properties of audio files, their
+// duration, bitrate, sample rate, channels and bit depth, from their
+// headers without decoding them.
+//
+// Supported are MP3 (using Xing, Info, VBRI and LAME headers when
+// present), FLAC, Ogg Vorbis and Opus, MP4/M4A, WAV and AIFF.
+//
+// It also reads the text tags of ID3v2 and Vorbis comments with all
+// of their values, which other tag readers join or drop.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+var (
+	// ErrUnsupported is returned for files in a format that cannot be
+	// read.
+	ErrUnsupported = errors.New("audio: unsupported format")
+	// ErrInvalid is returned for files that claim to be in a
+	// supported format but whose headers are missing or corrupt.
+	ErrInvalid = errors.New("audio: invalid file")
+)
+
+// Properties ...
+// The properties of the audio stream in a file.
+type Properties struct {
+	Codec     string // mp3, flac, vorbis, opus, aac, alac, pcm...
+	Container string // mp3, flac, ogg, mp4, wav or aiff
+
+	Duration   float64 // seconds
+	Bitrate    int     // bits per second, the average if VBR
+	VBR        bool
+	SampleRate int // Hz
+	BitDepth   int // bits per sample, 0 for lossy codecs
+	Channels   int
+	Lossless   bool
+}
+
+// ReadFile ...
+// Reads the properties of the audio file at path.
+func ReadFile(path string) (Properties, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Properties{}, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read ...
+// Reads the properties of an audio file, detecting its format from
+// its contents.
+func Read(r io.ReadSeeker) (Properties, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Properties{}, err
+	}
+
+	// a file may start with an ID3v2 tag whatever its format
+	start, err := skipID3v2(r)
+	if err != nil {
+		return Properties{}, err
+	}
+
+	magic := make([]byte, 12)
+	_, err = r.Seek(start, io.SeekStart)
+	if err != nil {
+		return Properties{}, err
+	}
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Properties{}, ErrUnsupported
+	}
+	magic = magic[:n]
+
+	var read func(r io.ReadSeeker, start, size int64) (Properties, error)
+	switch {
+	case bytes.HasPrefix(magic, []byte("fLaC")):
+		read = readFLAC
+	case bytes.HasPrefix(magic, []byte("OggS")):
+		read = readOgg
+	case len(magic) >= 8 && bytes.Equal(magic[4:8], []byte("ftyp")):
+		read = readMP4
+	case len(magic) >= 12 && bytes.Equal(magic[:4], []byte("RIFF")) && bytes.Equal(magic[8:12], []byte("WAVE")):
+		read = readWAV
+	case len(magic) >= 12 && bytes.Equal(magic[:4], []byte("FORM")) &&
+		(bytes.Equal(magic[8:12], []byte("AIFF")) || bytes.Equal(magic[8:12], []byte("AIFC"))):
+		read = readAIFF
+	case len(magic) >= 2 && magic[0] == 0xff && magic[1]&0xe0 == 0xe0, start > 0:
+		// mp3 files often have junk between the tag and the first
+		// frame, the frame is searched for
+		read = readMP3
+	default:
+		return Properties{}, ErrUnsupported
+	}
+
+	_, err = r.Seek(start, io.SeekStart)
+	if err != nil {
+		return Properties{}, err
+	}
+	return read(r, start, size)
+}
+
+// skipID3v2 ...
+// Returns the offset of the end of the ID3v2 tag at the start of r,
+// 0 if there is none.
+func skipID3v2(r io.ReadSeeker) (int64, error) {
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 10)
+	_, err = io.ReadFull(r, header)
+	if err != nil || !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0, nil
+	}
+
+	size := int64(syncsafe(header[6:10])) + 10
+	// footer present
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+
+	return size, nil
+}
+
+// syncsafe ...
+// Decodes an ID3v2 syncsafe integer, 7 bits per byte.
+func syncsafe(b []byte) uint32 {
+	var n uint32
+	for _, c := range b {
+		n = n<<7 | uint32(c&0x7f)
+	}
+	return n
+}
+
+// readAt ...
+// Reads exactly len(buf) bytes at offset.
+func readAt(r io.ReadSeeker, offset int64, buf []byte) error {
+	_, err := r.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalid
+	}
+	return err
+}
+
+// bitrate ...
+// The average bitrate of n bytes of audio lasting duration seconds.
+func bitrate(n int64, duration float64) int {
+	if duration <= 0 {
+		return 0
+	}
+	return int(float64(n) * 8 / duration)
+}
+
+var (
+	be = binary.BigEndian
+	le = binary.LittleEndian
+)
@@ -0,0 +1,357 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// MPEG-1 layer III, 128 kbit/s, 44100 Hz, joint stereo, 417 bytes
+var mp3Header = []byte{0xff, 0xfb, 0x90, 0x64}
+
+// mp3Frames ...
+// Returns n silent frames, the first replaced by first if it is not
+// nil.
+func mp3Frames(n int, first []byte) []byte {
+	const frameSize = 417
+
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		frame := make([]byte, frameSize)
+		copy(frame, mp3Header)
+		if i == 0 && first != nil {
+			copy(frame, first)
+		}
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+// xingFrame ...
+func xingFrame(tag string, frames, size uint32, delay, padding int) []byte {
+	var b bytes.Buffer
+	b.Write(mp3Header)
+	b.Write(make([]byte, 32))
+	b.WriteString(tag)
+	binary.Write(&b, binary.BigEndian, uint32(0x3))
+	binary.Write(&b, binary.BigEndian, frames)
+	binary.Write(&b, binary.BigEndian, size)
+
+	b.WriteString("LAME3.99r")
+	b.Write(make([]byte, 12))
+	b.Write([]byte{byte(delay >> 4), byte(delay&0xf)<<4 | byte(padding>>8), byte(padding)})
+	return b.Bytes()
+}
+
+// vbriFrame ...
+func vbriFrame(frames, size uint32) []byte {
+	var b bytes.Buffer
+	b.Write(mp3Header)
+	b.Write(make([]byte, 32))
+	b.WriteString("VBRI")
+	binary.Write(&b, binary.BigEndian, []uint16{1, 0, 75})
+	binary.Write(&b, binary.BigEndian, size)
+	binary.Write(&b, binary.BigEndian, frames)
+	return b.Bytes()
+}
+
+// flacFile ...
+func flacFile(rate, channels, depth int, samples uint64, audio int) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	// a padding block then the last block, STREAMINFO
+	b.Write([]byte{0x01, 0, 0, 4, 0, 0, 0, 0})
+	b.Write([]byte{0x80, 0, 0, 34})
+	b.Write(make([]byte, 10))
+	bits := uint64(rate)<<44 | uint64(channels-1)<<41 | uint64(depth-1)<<36 | samples
+	binary.Write(&b, binary.BigEndian, bits)
+	b.Write(make([]byte, 16))
+	b.Write(make([]byte, audio))
+	return b.Bytes()
+}
+
+// oggPageBytes ...
+func oggPageBytes(granule int64, serial uint32, packet []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("OggS")
+	b.Write([]byte{0, 0})
+	binary.Write(&b, binary.LittleEndian, granule)
+	binary.Write(&b, binary.LittleEndian, serial)
+	b.Write(make([]byte, 8))
+	b.WriteByte(1)
+	b.WriteByte(byte(len(packet)))
+	b.Write(packet)
+	return b.Bytes()
+}
+
+// oggFile ...
+// An Ogg file with an identification packet, a page of another
+// stream after the last page of the first and some audio pages.
+func oggFile(id []byte, granule int64) []byte {
+	var b bytes.Buffer
+	b.Write(oggPageBytes(0, 1, id))
+	b.Write(oggPageBytes(granule/2, 1, make([]byte, 200)))
+	b.Write(oggPageBytes(granule, 1, make([]byte, 200)))
+	b.Write(oggPageBytes(-1, 1, nil))
+	b.Write(oggPageBytes(99999999, 2, make([]byte, 10)))
+	return b.Bytes()
+}
+
+// vorbisID ...
+func vorbisID(channels byte, rate uint32) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x01vorbis")
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.WriteByte(channels)
+	binary.Write(&b, binary.LittleEndian, rate)
+	b.Write(make([]byte, 14))
+	return b.Bytes()
+}
+
+// opusID ...
+func opusID(channels byte, preSkip uint16) []byte {
+	var b bytes.Buffer
+	b.WriteString("OpusHead")
+	b.WriteByte(1)
+	b.WriteByte(channels)
+	binary.Write(&b, binary.LittleEndian, preSkip)
+	binary.Write(&b, binary.LittleEndian, uint32(44100))
+	b.Write(make([]byte, 3))
+	return b.Bytes()
+}
+
+// box ...
+func box(kind string, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], kind)
+	return append(b, body...)
+}
+
+// be32 ...
+func be32(values ...uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, values)
+	return b.Bytes()
+}
+
+// mp4File ...
+func mp4File(entry []byte) []byte {
+	mvhd := box("mvhd", be32(0, 0, 0, 1000, 10500), make([]byte, 80))
+	mdhd := box("mdhd", be32(0, 0, 0, 44100, 441000), make([]byte, 4))
+	hdlr := box("hdlr", be32(0, 0), []byte("soun"), make([]byte, 13))
+	stsd := box("stsd", be32(0, 1), entry)
+	video := box("trak", box("mdia", box("hdlr", be32(0, 0), []byte("vide"), make([]byte, 13))))
+	sound := box("trak", box("mdia", mdhd, hdlr, box("minf", box("stbl", stsd))))
+
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("M4A "), be32(0), []byte("M4A mp42isom")),
+		box("mdat", make([]byte, 100000)),
+		box("moov", mvhd, video, sound),
+	}, nil)
+}
+
+// audioEntry ...
+func audioEntry(kind string, channels, depth uint16, rate uint32, children ...[]byte) []byte {
+	var b bytes.Buffer
+	b.Write(make([]byte, 6))
+	binary.Write(&b, binary.BigEndian, uint16(1))
+	b.Write(make([]byte, 8))
+	binary.Write(&b, binary.BigEndian, []uint16{channels, depth, 0, 0})
+	binary.Write(&b, binary.BigEndian, rate<<16)
+	return box(kind, append([][]byte{b.Bytes()}, children...)...)
+}
+
+// esds ...
+func esds(maxBitrate, avgBitrate uint32) []byte {
+	config := append([]byte{0x40, 0x15, 0, 0, 0}, be32(maxBitrate, avgBitrate)...)
+	config = append([]byte{0x04, byte(len(config))}, config...)
+	es := append([]byte{0, 1, 0}, config...)
+	es = append([]byte{0x03, 0x80, 0x80, byte(len(es))}, es...)
+	return box("esds", be32(0), es)
+}
+
+// alacBox ...
+func alacBox(depth, channels byte, avgBitrate, rate uint32) []byte {
+	var b bytes.Buffer
+	b.Write(be32(0, 4096))
+	b.Write([]byte{0, depth, 40, 10, 14, channels})
+	binary.Write(&b, binary.BigEndian, uint16(255))
+	b.Write(be32(0, avgBitrate, rate))
+	return box("alac", b.Bytes())
+}
+
+// wavFile ...
+func wavFile(format, channels uint16, rate uint32, depth uint16, data int) []byte {
+	fmtChunk := new(bytes.Buffer)
+	binary.Write(fmtChunk, binary.LittleEndian, format)
+	binary.Write(fmtChunk, binary.LittleEndian, channels)
+	binary.Write(fmtChunk, binary.LittleEndian, rate)
+	binary.Write(fmtChunk, binary.LittleEndian, rate*uint32(channels)*uint32(depth)/8)
+	binary.Write(fmtChunk, binary.LittleEndian, channels*depth/8)
+	binary.Write(fmtChunk, binary.LittleEndian, depth)
+
+	chunk := func(id string, body []byte) []byte {
+		b := make([]byte, 8, 8+len(body)+1)
+		copy(b, id)
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(body)))
+		b = append(b, body...)
+		if len(body)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+
+	body := bytes.Join([][]byte{
+		[]byte("WAVE"),
+		chunk("fmt ", fmtChunk.Bytes()),
+		chunk("LIST", make([]byte, 7)),
+		chunk("data", make([]byte, data)),
+	}, nil)
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(body)))
+	return bytes.Join([][]byte{[]byte("RIFF"), size, body}, nil)
+}
+
+// aiffFile ...
+func aiffFile(form, compression string, channels uint16, frames uint32, depth uint16, rate float64) []byte {
+	comm := new(bytes.Buffer)
+	binary.Write(comm, binary.BigEndian, channels)
+	binary.Write(comm, binary.BigEndian, frames)
+	binary.Write(comm, binary.BigEndian, depth)
+
+	// 80 bit extended precision
+	mant, exp := math.Frexp(rate)
+	binary.Write(comm, binary.BigEndian, uint16(exp-1+16383))
+	binary.Write(comm, binary.BigEndian, uint64(math.Ldexp(mant, 64)))
+	if compression != "" {
+		comm.WriteString(compression)
+		comm.Write([]byte{0, 0})
+	}
+
+	body := bytes.Join([][]byte{
+		[]byte(form),
+		[]byte("COMM"), be32(uint32(comm.Len())), comm.Bytes(),
+		[]byte("SSND"), be32(8 + 400), make([]byte, 408),
+	}, nil)
+	return append(append([]byte("FORM"), be32(uint32(len(body)))...), body...)
+}
+
+// TestRead ...
+func TestRead(t *testing.T) {
+	id3 := []byte("ID3\x03\x00\x00\x00\x00\x01\x00")
+	id3 = append(id3, make([]byte, 128)...)
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected Properties
+	}{
+		{"mp3 constant bitrate", mp3Frames(100, nil),
+			Properties{Codec: "mp3", Container: "mp3", Duration: 100 * 417 * 8 / 128000.0,
+				Bitrate: 128000, SampleRate: 44100, Channels: 2}},
+		{"mp3 with tags", append(append(id3, mp3Frames(100, nil)...), id3v1...),
+			Properties{Codec: "mp3", Container: "mp3", Duration: 100 * 417 * 8 / 128000.0,
+				Bitrate: 128000, SampleRate: 44100, Channels: 2}},
+		{"mp3 xing", mp3Frames(101, xingFrame("Xing", 100, 100*417, 576, 1000)),
+			Properties{Codec: "mp3", Container: "mp3", Duration: (100*1152 - 1576) / 44100.0,
+				Bitrate: 129477, VBR: true, SampleRate: 44100, Channels: 2}},
+		{"mp3 info", mp3Frames(101, xingFrame("Info", 100, 0, 0, 0)),
+			Properties{Codec: "mp3", Container: "mp3", Duration: 100 * 1152 / 44100.0,
+				Bitrate: 127706, SampleRate: 44100, Channels: 2}},
+		{"mp3 vbri", mp3Frames(51, vbriFrame(50, 50*417)),
+			Properties{Codec: "mp3", Container: "mp3", Duration: 50 * 1152 / 44100.0,
+				Bitrate: 127706, VBR: true, SampleRate: 44100, Channels: 2}},
+		{"flac", flacFile(44100, 2, 16, 441000, 100000),
+			Properties{Codec: "flac", Container: "flac", Duration: 10, Bitrate: 80000,
+				SampleRate: 44100, BitDepth: 16, Channels: 2, Lossless: true}},
+		{"flac with id3", append(id3, flacFile(96000, 1, 24, 96000*3, 0)...),
+			Properties{Codec: "flac", Container: "flac", Duration: 3,
+				SampleRate: 96000, BitDepth: 24, Channels: 1, Lossless: true}},
+		{"ogg vorbis", oggFile(vorbisID(2, 44100), 441000),
+			Properties{Codec: "vorbis", Container: "ogg", Duration: 10, Bitrate: 580 * 8 / 10,
+				VBR: true, SampleRate: 44100, Channels: 2}},
+		{"ogg opus", oggFile(opusID(1, 312), 480312),
+			Properties{Codec: "opus", Container: "ogg", Duration: 10, Bitrate: 569 * 8 / 10,
+				VBR: true, SampleRate: 48000, Channels: 1}},
+		{"mp4 aac", mp4File(audioEntry("mp4a", 2, 16, 44100, esds(160000, 128000))),
+			Properties{Codec: "aac", Container: "mp4", Duration: 10, Bitrate: 128000,
+				VBR: true, SampleRate: 44100, Channels: 2}},
+		{"mp4 aac without esds", mp4File(audioEntry("mp4a", 2, 16, 44100)),
+			Properties{Codec: "aac", Container: "mp4", Duration: 10, Bitrate: 80000,
+				VBR: true, SampleRate: 44100, Channels: 2}},
+		{"mp4 alac", mp4File(audioEntry("alac", 2, 16, 44100, alacBox(24, 2, 2000000, 96000))),
+			Properties{Codec: "alac", Container: "mp4", Duration: 10, Bitrate: 2000000,
+				SampleRate: 96000, BitDepth: 24, Channels: 2, Lossless: true}},
+		{"wav", wavFile(wavePCM, 2, 44100, 16, 176400*2),
+			Properties{Codec: "pcm", Container: "wav", Duration: 2, Bitrate: 1411200,
+				SampleRate: 44100, BitDepth: 16, Channels: 2, Lossless: true}},
+		{"wav odd chunk", wavFile(wavePCM, 1, 8000, 8, 8001),
+			Properties{Codec: "pcm", Container: "wav", Duration: 8001 / 8000.0, Bitrate: 64000,
+				SampleRate: 8000, BitDepth: 8, Channels: 1, Lossless: true}},
+		{"aiff", aiffFile("AIFF", "", 2, 88200, 16, 44100),
+			Properties{Codec: "pcm", Container: "aiff", Duration: 2, Bitrate: 1411200,
+				SampleRate: 44100, BitDepth: 16, Channels: 2, Lossless: true}},
+		{"aifc little endian", aiffFile("AIFC", "sowt", 1, 48000, 24, 48000),
+			Properties{Codec: "pcm", Container: "aiff", Duration: 1, Bitrate: 1152000,
+				SampleRate: 48000, BitDepth: 24, Channels: 1, Lossless: true}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Read(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if math.Abs(p.Duration-test.expected.Duration) > 1e-9 {
+				t.Errorf("expected duration %v, received %v", test.expected.Duration, p.Duration)
+			}
+			p.Duration = test.expected.Duration
+			if p != test.expected {
+				t.Errorf("unexpected properties\n\texpected: %+v\n\treceived: %+v", test.expected, p)
+			}
+		})
+	}
+}
+
+// TestReadFile ...
+func TestReadFile(t *testing.T) {
+	p, err := ReadFile(filepath.Join("..", "db", "test_lib", "Simpsons", "Thermo", "01 Obey.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 55170 bytes of audio between the ID3v2 and ID3v1 tags
+	expected := Properties{Codec: "mp3", Container: "mp3", Duration: 3.448125,
+		Bitrate: 128000, SampleRate: 44100, Channels: 2}
+	if p != expected {
+		t.Errorf("unexpected properties\n\texpected: %+v\n\treceived: %+v", expected, p)
+	}
+}
+
+// TestReadErrors ...
+func TestReadErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrUnsupported},
+		{"text", []byte("not an audio file at all"), ErrUnsupported},
+		{"truncated flac", []byte("fLaC\x80\x00\x00\x22\x00"), ErrInvalid},
+		{"wav without data", wavFile(wavePCM, 2, 44100, 16, 0)[:36], ErrInvalid},
+		{"ogg theora", oggFile([]byte("\x80theora"), 100), ErrUnsupported},
+	}
+
+	for _, test := range testCases {
+		_, err := Read(bytes.NewReader(test.data))
+		if err != test.err {
+			t.Errorf("%s: expected %v, received %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package audio
+
+import (
+	"io"
+)
+
+const flacStreamInfo = 0
+
+// readFLAC ...
+// Reads the STREAMINFO block of a FLAC file.
+func readFLAC(r io.ReadSeeker, start, size int64) (p Properties, err error) {
+	p.Container = "flac"
+	p.Codec = "flac"
+	p.Lossless = true
+
+	// skip "fLaC"
+	offset := start + 4
+	header := make([]byte, 4)
+	haveInfo := false
+	for {
+		err = readAt(r, offset, header)
+		if err != nil {
+			return p, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4
+
+		if blockType == flacStreamInfo {
+			if length < 34 {
+				return p, ErrInvalid
+			}
+			info := make([]byte, 34)
+			err = readAt(r, offset, info)
+			if err != nil {
+				return p, err
+			}
+			parseStreamInfo(info, &p)
+			haveInfo = true
+		}
+
+		offset += length
+		if last {
+			break
+		}
+	}
+
+	if !haveInfo {
+		return p, ErrInvalid
+	}
+	p.Bitrate = bitrate(size-offset, p.Duration)
+
+	return p, nil
+}
+
+// parseStreamInfo ...
+// Decodes a 34 byte STREAMINFO block, also used by FLAC in MP4.
+func parseStreamInfo(info []byte, p *Properties) {
+	// 20 bits sample rate, 3 bits channels - 1, 5 bits bits per
+	// sample - 1 and 36 bits total samples
+	bits := be.Uint64(info[10:18])
+	p.SampleRate = int(bits >> 44)
+	p.Channels = int(bits>>41&0x7) + 1
+	p.BitDepth = int(bits>>36&0x1f) + 1
+	samples := bits & 0xfffffffff
+
+	if p.SampleRate > 0 {
+		p.Duration = float64(samples) / float64(p.SampleRate)
+	}
+}
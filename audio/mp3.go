@@ -0,0 +1,266 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+)
+
+// how far past the ID3v2 tag the first frame is searched for
+const mp3SyncSearch = 64 * 1024
+
+var (
+	// kbit/s by version (MPEG-1, MPEG-2 and 2.5) and layer
+	mp3Bitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	// Hz for MPEG-1, divided by 2 for MPEG-2 and 4 for MPEG-2.5
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3Frame ...
+// A decoded MPEG audio frame header.
+type mp3Frame struct {
+	version    int // 1 for MPEG-1, 2 for MPEG-2 and MPEG-2.5
+	layer      int
+	bitrate    int // bits per second
+	sampleRate int
+	channels   int
+	samples    int // per frame
+	size       int // bytes, including the header
+}
+
+// parseMP3Frame ...
+// Decodes the 4 byte frame header in b, reporting whether it is
+// valid.
+func parseMP3Frame(b []byte) (f mp3Frame, ok bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return f, false
+	}
+
+	versionBits := b[1] >> 3 & 0x3
+	layerBits := b[1] >> 1 & 0x3
+	bitrateIdx := b[2] >> 4
+	rateIdx := b[2] >> 2 & 0x3
+	padding := int(b[2] >> 1 & 0x1)
+	mode := b[3] >> 6
+
+	if versionBits == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return f, false
+	}
+
+	f.version = 1
+	f.sampleRate = mp3SampleRates[rateIdx]
+	switch versionBits {
+	case 2:
+		f.version = 2
+		f.sampleRate /= 2
+	case 0:
+		// MPEG-2.5
+		f.version = 2
+		f.sampleRate /= 4
+	}
+	f.layer = 4 - int(layerBits)
+	f.bitrate = mp3Bitrates[f.version-1][f.layer-1][bitrateIdx] * 1000
+
+	f.channels = 2
+	if mode == 3 {
+		f.channels = 1
+	}
+
+	switch {
+	case f.layer == 1:
+		f.samples = 384
+		f.size = (12*f.bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && f.version == 2:
+		f.samples = 576
+		f.size = 72*f.bitrate/f.sampleRate + padding
+	default:
+		f.samples = 1152
+		f.size = 144*f.bitrate/f.sampleRate + padding
+	}
+
+	return f, true
+}
+
+// sideInfoSize ...
+// The size of the side information following the header of a layer
+// III frame, where a Xing header is written.
+func (f mp3Frame) sideInfoSize() int {
+	switch {
+	case f.version == 1 && f.channels == 1:
+		return 17
+	case f.version == 1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// findMP3Frame ...
+// Returns the first frame in buf that is followed by another valid
+// frame, and its offset.
+func findMP3Frame(buf []byte) (f mp3Frame, offset int, ok bool) {
+	for i := 0; i+4 <= len(buf); i++ {
+		f, ok = parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+
+		next := i + f.size
+		if next+4 > len(buf) {
+			// nothing to confirm it against
+			return f, i, true
+		}
+		g, ok := parseMP3Frame(buf[next:])
+		if ok && g.version == f.version && g.layer == f.layer && g.sampleRate == f.sampleRate {
+			return f, i, true
+		}
+	}
+
+	return f, 0, false
+}
+
+// mp3AudioEnd ...
+// Returns the offset of the end of the audio in an mp3 file, before
+// any ID3v1 or APEv2 tags.
+func mp3AudioEnd(r io.ReadSeeker, size int64) (int64, error) {
+	end := size
+
+	tag := make([]byte, 3)
+	if end >= 128 {
+		err := readAt(r, end-128, tag)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(tag, []byte("TAG")) {
+			end -= 128
+		}
+	}
+
+	ape := make([]byte, 32)
+	if end >= 32 {
+		err := readAt(r, end-32, ape)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.HasPrefix(ape, []byte("APETAGEX")) {
+			// the size includes the footer but not the header
+			end -= int64(le.Uint32(ape[12:16]))
+			if le.Uint32(ape[20:24])&0x80000000 != 0 {
+				end -= 32
+			}
+		}
+	}
+
+	return end, nil
+}
+
+// readMP3 ...
+func readMP3(r io.ReadSeeker, start, size int64) (p Properties, err error) {
+	buf := make([]byte, mp3SyncSearch)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return p, ErrUnsupported
+	}
+	buf = buf[:n]
+
+	f, offset, ok := findMP3Frame(buf)
+	if !ok {
+		return p, ErrUnsupported
+	}
+	frame := buf[offset:]
+
+	p.Container = "mp3"
+	p.Codec = "mp3"
+	if f.layer != 3 {
+		p.Container = "mpeg"
+		p.Codec = []string{"", "mp1", "mp2"}[f.layer]
+	}
+	p.SampleRate = f.sampleRate
+	p.Channels = f.channels
+
+	end, err := mp3AudioEnd(r, size)
+	if err != nil {
+		return p, err
+	}
+	audioStart := start + int64(offset)
+	audioBytes := end - audioStart
+
+	// the first frame of a VBR file describes the rest of it
+	var (
+		frames, bytesCount int64
+		delay, padding     int
+		found              bool
+	)
+
+	xing := 4 + f.sideInfoSize()
+	if f.layer == 3 && len(frame) >= xing+8 &&
+		(bytes.Equal(frame[xing:xing+4], []byte("Xing")) || bytes.Equal(frame[xing:xing+4], []byte("Info"))) {
+		found = true
+		p.VBR = frame[xing] == 'X'
+		flags := be.Uint32(frame[xing+4:])
+		pos := xing + 8
+
+		if flags&0x1 != 0 && len(frame) >= pos+4 {
+			frames = int64(be.Uint32(frame[pos:]))
+			pos += 4
+		}
+		if flags&0x2 != 0 && len(frame) >= pos+4 {
+			bytesCount = int64(be.Uint32(frame[pos:]))
+			pos += 4
+		}
+		if flags&0x4 != 0 {
+			pos += 100
+		}
+		if flags&0x8 != 0 {
+			pos += 4
+		}
+
+		// the encoder delay and padding are in the LAME tag
+		if len(frame) >= pos+24 && bytes.Equal(frame[pos:pos+4], []byte("LAME")) {
+			d := frame[pos+21:]
+			delay = int(d[0])<<4 | int(d[1])>>4
+			padding = int(d[1]&0xf)<<8 | int(d[2])
+		}
+
+		// the header frame holds no audio
+		audioBytes -= int64(f.size)
+	}
+
+	vbri := 4 + 32
+	if !found && len(frame) >= vbri+18 && bytes.Equal(frame[vbri:vbri+4], []byte("VBRI")) {
+		found = true
+		p.VBR = true
+		bytesCount = int64(be.Uint32(frame[vbri+10:]))
+		frames = int64(be.Uint32(frame[vbri+14:]))
+		audioBytes -= int64(f.size)
+	}
+
+	if bytesCount > 0 {
+		audioBytes = bytesCount
+	}
+
+	switch {
+	case frames > 0:
+		samples := frames*int64(f.samples) - int64(delay+padding)
+		p.Duration = float64(samples) / float64(f.sampleRate)
+		p.Bitrate = bitrate(audioBytes, p.Duration)
+	default:
+		// constant bitrate, estimated from the size of the audio
+		p.Bitrate = f.bitrate
+		p.Duration = float64(audioBytes) * 8 / float64(f.bitrate)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,382 @@
+package audio
+
+import (
+	"io"
+)
+
+// mp4Box ...
+// The header of an MP4 box.
+type mp4Box struct {
+	kind   string
+	offset int64 // of the box's contents
+	size   int64 // of the box's contents
+}
+
+// mp4Boxes ...
+// Returns the boxes between offset and end.
+func mp4Boxes(r io.ReadSeeker, offset, end int64) (boxes []mp4Box, err error) {
+	header := make([]byte, 8)
+	for offset+8 <= end {
+		err = readAt(r, offset, header)
+		if err != nil {
+			return nil, err
+		}
+
+		size := int64(be.Uint32(header))
+		box := mp4Box{kind: string(header[4:8]), offset: offset + 8}
+		switch size {
+		case 0:
+			// extends to the end of the file
+			size = end - offset
+		case 1:
+			large := make([]byte, 8)
+			_, err = io.ReadFull(r, large)
+			if err != nil {
+				return nil, ErrInvalid
+			}
+			size = int64(be.Uint64(large))
+			box.offset += 8
+		}
+		if size < box.offset-offset || offset+size > end {
+			return nil, ErrInvalid
+		}
+
+		box.size = size - (box.offset - offset)
+		boxes = append(boxes, box)
+		offset += size
+	}
+
+	return boxes, nil
+}
+
+// mp4Child ...
+// Returns the first box of a kind in a list of boxes.
+func mp4Child(boxes []mp4Box, kind string) (mp4Box, bool) {
+	for _, b := range boxes {
+		if b.kind == kind {
+			return b, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// mp4Path ...
+// Follows a path of box kinds down from parent.
+func mp4Path(r io.ReadSeeker, parent mp4Box, kinds ...string) (mp4Box, bool, error) {
+	box := parent
+	for _, kind := range kinds {
+		children, err := mp4Boxes(r, box.offset, box.offset+box.size)
+		if err != nil {
+			return box, false, err
+		}
+		var ok bool
+		box, ok = mp4Child(children, kind)
+		if !ok {
+			return box, false, nil
+		}
+	}
+	return box, true, nil
+}
+
+// readBox ...
+// Reads the contents of a box, at least min bytes of it.
+func readBox(r io.ReadSeeker, box mp4Box, min int64) ([]byte, error) {
+	if box.size < min {
+		return nil, ErrInvalid
+	}
+	buf := make([]byte, box.size)
+	return buf, readAt(r, box.offset, buf)
+}
+
+// mp4Duration ...
+// Decodes the timescale and duration of an mvhd or mdhd box.
+func mp4Duration(r io.ReadSeeker, box mp4Box) (float64, error) {
+	b, err := readBox(r, box, 20)
+	if err != nil {
+		return 0, err
+	}
+
+	var timescale, duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0, ErrInvalid
+		}
+		timescale = uint64(be.Uint32(b[20:24]))
+		duration = be.Uint64(b[24:32])
+	} else {
+		timescale = uint64(be.Uint32(b[12:16]))
+		duration = uint64(be.Uint32(b[16:20]))
+	}
+	if timescale == 0 {
+		return 0, ErrInvalid
+	}
+
+	return float64(duration) / float64(timescale), nil
+}
+
+// readMP4 ...
+// Reads the first sound track of an MP4 file.
+func readMP4(r io.ReadSeeker, start, size int64) (p Properties, err error) {
+	p.Container = "mp4"
+
+	top, err := mp4Boxes(r, start, size)
+	if err != nil {
+		return p, err
+	}
+
+	moov, ok := mp4Child(top, "moov")
+	if !ok {
+		return p, ErrInvalid
+	}
+
+	var mediaBytes int64
+	for _, b := range top {
+		if b.kind == "mdat" {
+			mediaBytes += b.size
+		}
+	}
+
+	mvhd, ok, err := mp4Path(r, moov, "mvhd")
+	if err != nil {
+		return p, err
+	}
+	if ok {
+		p.Duration, err = mp4Duration(r, mvhd)
+		if err != nil {
+			return p, err
+		}
+	}
+
+	traks, err := mp4Boxes(r, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return p, err
+	}
+
+	for _, trak := range traks {
+		if trak.kind != "trak" {
+			continue
+		}
+
+		hdlr, ok, err := mp4Path(r, trak, "mdia", "hdlr")
+		if err != nil {
+			return p, err
+		}
+		if !ok {
+			continue
+		}
+		h, err := readBox(r, hdlr, 12)
+		if err != nil {
+			return p, err
+		}
+		if string(h[8:12]) != "soun" {
+			continue
+		}
+
+		mdhd, ok, err := mp4Path(r, trak, "mdia", "mdhd")
+		if err != nil {
+			return p, err
+		}
+		if ok {
+			p.Duration, err = mp4Duration(r, mdhd)
+			if err != nil {
+				return p, err
+			}
+		}
+
+		stsd, ok, err := mp4Path(r, trak, "mdia", "minf", "stbl", "stsd")
+		if err != nil {
+			return p, err
+		}
+		if !ok {
+			return p, ErrInvalid
+		}
+
+		avg, err := readSampleEntry(r, stsd, &p)
+		if err != nil {
+			return p, err
+		}
+
+		p.Bitrate = avg
+		if p.Bitrate == 0 {
+			p.Bitrate = bitrate(mediaBytes, p.Duration)
+		}
+		return p, nil
+	}
+
+	return p, ErrUnsupported
+}
+
+// readSampleEntry ...
+// Reads the first audio sample entry of an stsd box. Returns the
+// average bitrate if the entry records one.
+func readSampleEntry(r io.ReadSeeker, stsd mp4Box, p *Properties) (avgBitrate int, err error) {
+	// version, flags and entry count
+	const entriesOffset = 8
+	// reserved, data reference index, version, revision, vendor,
+	// channels, sample size, compression id, packet size and sample
+	// rate
+	const audioEntrySize = 28
+
+	entries, err := mp4Boxes(r, stsd.offset+entriesOffset, stsd.offset+stsd.size)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, ErrInvalid
+	}
+	entry := entries[0]
+
+	b, err := readBox(r, entry, audioEntrySize)
+	if err != nil {
+		return 0, err
+	}
+	p.Channels = int(be.Uint16(b[16:18]))
+	p.BitDepth = int(be.Uint16(b[18:20]))
+	p.SampleRate = int(be.Uint32(b[24:28]) >> 16)
+
+	version := be.Uint16(b[8:10])
+	childOffset := int64(audioEntrySize)
+	switch version {
+	case 1:
+		childOffset += 16
+	case 2:
+		childOffset += 36
+	}
+	children, err := mp4Boxes(r, entry.offset+childOffset, entry.offset+entry.size)
+	if err != nil {
+		// some encoders write entries without children
+		children = nil
+	}
+
+	switch entry.kind {
+	case "mp4a":
+		p.Codec = "aac"
+		p.BitDepth = 0
+		p.VBR = true
+		if esds, ok := mp4Child(children, "esds"); ok {
+			var maxBitrate int
+			maxBitrate, avgBitrate, err = readESDS(r, esds)
+			if err != nil {
+				return 0, err
+			}
+			p.VBR = maxBitrate != avgBitrate
+		}
+
+	case "alac":
+		p.Codec = "alac"
+		p.Lossless = true
+		if alac, ok := mp4Child(children, "alac"); ok {
+			a, err := readBox(r, alac, 28)
+			if err != nil {
+				return 0, err
+			}
+			p.BitDepth = int(a[9])
+			p.Channels = int(a[13])
+			avgBitrate = int(be.Uint32(a[20:24]))
+			p.SampleRate = int(be.Uint32(a[24:28]))
+		}
+
+	case "fLaC":
+		p.Codec = "flac"
+		p.Lossless = true
+		if dfla, ok := mp4Child(children, "dfLa"); ok {
+			// version and flags then metadata blocks, the first is
+			// STREAMINFO
+			d, err := readBox(r, dfla, 4+4+34)
+			if err != nil {
+				return 0, err
+			}
+			duration := p.Duration
+			parseStreamInfo(d[8:], p)
+			if p.Duration == 0 {
+				p.Duration = duration
+			}
+		}
+
+	case "Opus":
+		p.Codec = "opus"
+		p.BitDepth = 0
+		p.SampleRate = opusSampleRate
+		p.VBR = true
+
+	case "ac-3":
+		p.Codec = "ac3"
+		p.BitDepth = 0
+
+	case "ec-3":
+		p.Codec = "eac3"
+		p.BitDepth = 0
+
+	default:
+		return 0, ErrUnsupported
+	}
+
+	return avgBitrate, nil
+}
+
+// readESDS ...
+// Reads the maximum and average bitrate from the decoder config
+// descriptor of an esds box.
+func readESDS(r io.ReadSeeker, esds mp4Box) (maxBitrate, avgBitrate int, err error) {
+	const (
+		esDescrTag            = 0x03
+		decoderConfigDescrTag = 0x04
+	)
+
+	b, err := readBox(r, esds, 4)
+	if err != nil {
+		return 0, 0, err
+	}
+	// version and flags
+	b = b[4:]
+
+	// descriptor sizes are written 7 bits per byte
+	descriptor := func(b []byte) (tag byte, body []byte, ok bool) {
+		if len(b) < 2 {
+			return 0, nil, false
+		}
+		tag = b[0]
+		size, i := 0, 1
+		for ; i < len(b) && i <= 4; i++ {
+			size = size<<7 | int(b[i]&0x7f)
+			if b[i]&0x80 == 0 {
+				break
+			}
+		}
+		i++
+		if i+size > len(b) {
+			return 0, nil, false
+		}
+		return tag, b[i : i+size], true
+	}
+
+	tag, es, ok := descriptor(b)
+	if !ok || tag != esDescrTag || len(es) < 3 {
+		return 0, 0, nil
+	}
+	// ES id then flags that add optional fields
+	skip := func(n int) {
+		if n > len(es) {
+			n = len(es)
+		}
+		es = es[n:]
+	}
+	flags := es[2]
+	skip(3)
+	if flags&0x80 != 0 {
+		skip(2)
+	}
+	if flags&0x40 != 0 && len(es) > 0 {
+		skip(1 + int(es[0]))
+	}
+	if flags&0x20 != 0 {
+		skip(2)
+	}
+
+	tag, config, ok := descriptor(es)
+	if !ok || tag != decoderConfigDescrTag || len(config) < 13 {
+		return 0, 0, nil
+	}
+
+	return int(be.Uint32(config[5:9])), int(be.Uint32(config[9:13])), nil
+}
@@ -0,0 +1,131 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	oggPageHeaderSize = 27
+	// the last page is searched for in this many bytes at the end of
+	// the file, pages are at most 65307 bytes
+	oggLastPageSearch = 65536 + oggPageHeaderSize
+
+	opusSampleRate = 48000
+)
+
+// oggPage ...
+// The header of an Ogg page.
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+}
+
+// readOggPage ...
+// Reads the header of the Ogg page at offset.
+func readOggPage(r io.ReadSeeker, offset int64) (page oggPage, err error) {
+	header := make([]byte, oggPageHeaderSize)
+	err = readAt(r, offset, header)
+	if err != nil {
+		return page, err
+	}
+	if !bytes.HasPrefix(header, []byte("OggS")) {
+		return page, ErrInvalid
+	}
+
+	page.granule = int64(le.Uint64(header[6:14]))
+	page.serial = le.Uint32(header[14:18])
+	page.segments = make([]byte, header[26])
+	_, err = io.ReadFull(r, page.segments)
+	if err != nil {
+		return page, ErrInvalid
+	}
+
+	return page, nil
+}
+
+// readOgg ...
+// Reads the identification header of the first stream in an Ogg
+// file and the granule position of its last page.
+func readOgg(r io.ReadSeeker, start, size int64) (p Properties, err error) {
+	p.Container = "ogg"
+	p.VBR = true
+
+	first, err := readOggPage(r, start)
+	if err != nil {
+		return p, err
+	}
+
+	// the identification header is the only packet on the first page
+	var length int
+	for _, s := range first.segments {
+		length += int(s)
+	}
+	packet := make([]byte, length)
+	_, err = io.ReadFull(r, packet)
+	if err != nil {
+		return p, ErrInvalid
+	}
+
+	var preSkip int64
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 30:
+		p.Codec = "vorbis"
+		p.Channels = int(packet[11])
+		p.SampleRate = int(le.Uint32(packet[12:16]))
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 19:
+		p.Codec = "opus"
+		p.Channels = int(packet[9])
+		p.SampleRate = opusSampleRate
+		preSkip = int64(le.Uint16(packet[10:12]))
+	default:
+		return p, ErrUnsupported
+	}
+	if p.SampleRate == 0 {
+		return p, ErrInvalid
+	}
+
+	granule, err := lastOggGranule(r, first.serial, size)
+	if err != nil {
+		return p, err
+	}
+
+	p.Duration = float64(granule-preSkip) / float64(p.SampleRate)
+	if p.Duration < 0 {
+		p.Duration = 0
+	}
+	p.Bitrate = bitrate(size-start, p.Duration)
+
+	return p, nil
+}
+
+// lastOggGranule ...
+// Returns the granule position of the last page of a stream, which
+// is the number of samples in it.
+func lastOggGranule(r io.ReadSeeker, serial uint32, size int64) (int64, error) {
+	offset := size - oggLastPageSearch
+	if offset < 0 {
+		offset = 0
+	}
+
+	buf := make([]byte, size-offset)
+	err := readAt(r, offset, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+		if i+oggPageHeaderSize > len(buf) {
+			continue
+		}
+		page := buf[i:]
+		granule := int64(le.Uint64(page[6:14]))
+		// -1 marks pages on which no packet ends
+		if le.Uint32(page[14:18]) == serial && granule != -1 {
+			return granule, nil
+		}
+	}
+
+	return 0, ErrInvalid
+}
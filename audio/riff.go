@@ -0,0 +1,199 @@
+package audio
+
+import (
+	"io"
+	"math"
+	"strings"
+)
+
+// WAVE format tags
+const (
+	wavePCM        = 0x0001
+	waveFloat      = 0x0003
+	waveALaw       = 0x0006
+	waveMuLaw      = 0x0007
+	waveMP3        = 0x0055
+	waveExtensible = 0xfffe
+)
+
+// iffChunk ...
+// A chunk of a RIFF or IFF file.
+type iffChunk struct {
+	id     string
+	offset int64 // of the chunk's contents
+	size   int64
+}
+
+// iffChunks ...
+// Returns the chunks between offset and end. RIFF sizes are little
+// endian and IFF sizes are big endian, both are padded to an even
+// number of bytes.
+func iffChunks(r io.ReadSeeker, offset, end int64, littleEndian bool) (chunks []iffChunk, err error) {
+	header := make([]byte, 8)
+	for offset+8 <= end {
+		err = readAt(r, offset, header)
+		if err != nil {
+			return nil, err
+		}
+
+		c := iffChunk{id: string(header[:4]), offset: offset + 8}
+		if littleEndian {
+			c.size = int64(le.Uint32(header[4:8]))
+		} else {
+			c.size = int64(be.Uint32(header[4:8]))
+		}
+		// a streamed file may not know the size of its data
+		if c.offset+c.size > end {
+			c.size = end - c.offset
+		}
+		chunks = append(chunks, c)
+
+		offset = c.offset + c.size + c.size%2
+	}
+
+	return chunks, nil
+}
+
+// readWAV ...
+func readWAV(r io.ReadSeeker, start, size int64) (p Properties, err error) {
+	p.Container = "wav"
+
+	chunks, err := iffChunks(r, start+12, size, true)
+	if err != nil {
+		return p, err
+	}
+
+	var (
+		byteRate   int64
+		format     uint16
+		haveFormat bool
+		dataSize   int64 = -1
+	)
+	for _, c := range chunks {
+		switch c.id {
+		case "fmt ":
+			if c.size < 16 {
+				return p, ErrInvalid
+			}
+			b := make([]byte, c.size)
+			err = readAt(r, c.offset, b)
+			if err != nil {
+				return p, err
+			}
+			format = le.Uint16(b[0:2])
+			p.Channels = int(le.Uint16(b[2:4]))
+			p.SampleRate = int(le.Uint32(b[4:8]))
+			byteRate = int64(le.Uint32(b[8:12]))
+			p.BitDepth = int(le.Uint16(b[14:16]))
+			// the real format is the start of the subformat guid
+			if format == waveExtensible && len(b) >= 26 {
+				format = le.Uint16(b[24:26])
+			}
+			haveFormat = true
+		case "data":
+			dataSize = c.size
+		}
+	}
+	if !haveFormat || dataSize < 0 {
+		return p, ErrInvalid
+	}
+
+	switch format {
+	case wavePCM, waveFloat:
+		p.Codec = "pcm"
+		p.Lossless = true
+	case waveALaw:
+		p.Codec = "alaw"
+	case waveMuLaw:
+		p.Codec = "ulaw"
+	case waveMP3:
+		p.Codec = "mp3"
+		p.BitDepth = 0
+	default:
+		return p, ErrUnsupported
+	}
+
+	if byteRate == 0 {
+		return p, ErrInvalid
+	}
+	p.Duration = float64(dataSize) / float64(byteRate)
+	p.Bitrate = int(byteRate * 8)
+
+	return p, nil
+}
+
+// readAIFF ...
+func readAIFF(r io.ReadSeeker, start, size int64) (p Properties, err error) {
+	p.Container = "aiff"
+	p.Codec = "pcm"
+	p.Lossless = true
+
+	form := make([]byte, 12)
+	err = readAt(r, start, form)
+	if err != nil {
+		return p, err
+	}
+	compressed := string(form[8:12]) == "AIFC"
+
+	chunks, err := iffChunks(r, start+12, size, false)
+	if err != nil {
+		return p, err
+	}
+
+	comm, ok := iffChunk{}, false
+	for _, c := range chunks {
+		if c.id == "COMM" {
+			comm, ok = c, true
+			break
+		}
+	}
+	if !ok || comm.size < 18 {
+		return p, ErrInvalid
+	}
+
+	b := make([]byte, comm.size)
+	err = readAt(r, comm.offset, b)
+	if err != nil {
+		return p, err
+	}
+	p.Channels = int(be.Uint16(b[0:2]))
+	frames := be.Uint32(b[2:6])
+	p.BitDepth = int(be.Uint16(b[6:8]))
+	rate := extended(b[8:18])
+	p.SampleRate = int(rate)
+
+	if compressed && len(b) >= 22 {
+		switch compression := string(b[18:22]); compression {
+		case "NONE", "sowt", "twos", "fl32", "fl64", "in24", "in32":
+		default:
+			p.Codec = strings.ToLower(strings.TrimSpace(compression))
+			p.Lossless = false
+		}
+	}
+
+	if rate <= 0 {
+		return p, ErrInvalid
+	}
+	p.Duration = float64(frames) / rate
+	p.Bitrate = p.SampleRate * p.Channels * p.BitDepth
+
+	return p, nil
+}
+
+// extended ...
+// Decodes an 80 bit IEEE 754 extended precision number, used by AIFF
+// for sample rates.
+func extended(b []byte) float64 {
+	sign := 1.0
+	if b[0]&0x80 != 0 {
+		sign = -1
+	}
+	exponent := int(be.Uint16(b[0:2]) & 0x7fff)
+	mantissa := be.Uint64(b[2:10])
+
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+
+	return sign * float64(mantissa) * math.Pow(2, float64(exponent-16383-63))
+}
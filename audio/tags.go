@@ -0,0 +1,435 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	flacVorbisComment = 4
+
+	// tags larger than this are not read, they are mostly artwork
+	maxTagSize = 16 << 20
+)
+
+// id3v2Names ...
+// The names ID3v2 text frames are read as, those of the equivalent
+// Vorbis comments. Both the ID3v2.3/2.4 and ID3v2.2 frame ids are
+// listed.
+var id3v2Names = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TPE2": "albumartist", "TP2": "albumartist",
+	"TPE3": "conductor", "TP3": "conductor",
+	"TPE4": "remixer", "TP4": "remixer",
+	"TCOM": "composer", "TCM": "composer",
+	"TEXT": "lyricist", "TXT": "lyricist",
+	"TALB": "album", "TAL": "album",
+}
+
+// userTagNames ...
+// The names user defined ID3v2 frames and MP4 atoms are read as, by
+// their lowercase description, where the equivalent Vorbis comment is
+// named differently.
+var userTagNames = map[string]string{
+	"musicbrainz artist id":        "musicbrainz_artistid",
+	"musicbrainz album artist id":  "musicbrainz_albumartistid",
+	"musicbrainz album id":         "musicbrainz_albumid",
+	"musicbrainz release group id": "musicbrainz_releasegroupid",
+	"musicbrainz track id":         "musicbrainz_trackid",
+	"musicbrainz release track id": "musicbrainz_releasetrackid",
+}
+
+// MusicBrainzOwner is the owner of the UFID frame holding the
+// MusicBrainz recording id.
+const MusicBrainzOwner = "http://musicbrainz.org"
+
+// TagName ...
+// Returns the name a user defined ID3v2 frame or MP4 atom is read as
+// from its description.
+func TagName(description string) string {
+	name := strings.ToLower(description)
+	if n, ok := userTagNames[name]; ok {
+		return n
+	}
+	return name
+}
+
+// Tags ...
+// The text tags of a file by lowercase name, with every value of
+// tags that have several. ID3v2 frames are named like the Vorbis
+// comments they correspond to, user defined TXXX frames by their
+// description (see TagName), the people of involvement lists (TIPL,
+// TMCL and IPLS) by their role and the MusicBrainz UFID frame as
+// musicbrainz_trackid.
+type Tags map[string][]string
+
+// Get ...
+// Returns the first value of a tag, empty if it has none.
+func (t Tags) Get(name string) string {
+	if v := t[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// add ...
+// Appends the non empty values of a tag.
+func (t Tags) add(name string, values ...string) {
+	name = strings.ToLower(name)
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			t[name] = append(t[name], v)
+		}
+	}
+}
+
+// ReadTagsFile ...
+// Reads the tags of the audio file at path.
+func ReadTagsFile(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadTags(f)
+}
+
+// ReadTags ...
+// Reads the ID3v2 tag at the start of a file and the Vorbis comments
+// of FLAC and Ogg files. Files without either have no tags.
+func ReadTags(r io.ReadSeeker) (Tags, error) {
+	tags := Tags{}
+
+	start, err := readID3v2(r, tags)
+	if err != nil {
+		return tags, err
+	}
+
+	magic := make([]byte, 4)
+	err = readAt(r, start, magic)
+	if err == ErrInvalid {
+		return tags, nil
+	}
+	if err != nil {
+		return tags, err
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte("fLaC")):
+		err = readFLACComments(r, start, tags)
+	case bytes.Equal(magic, []byte("OggS")):
+		err = readOggComments(r, start, tags)
+	}
+	return tags, err
+}
+
+// readID3v2 ...
+// Reads the text frames of the ID3v2 tag at the start of r into tags
+// and returns the offset of its end, 0 if there is none.
+func readID3v2(r io.ReadSeeker, tags Tags) (int64, error) {
+	end, err := skipID3v2(r)
+	if err != nil || end == 0 {
+		return end, err
+	}
+
+	header := make([]byte, 10)
+	err = readAt(r, 0, header)
+	if err != nil {
+		return 0, err
+	}
+	version, flags := header[3], header[5]
+	size := int64(syncsafe(header[6:10]))
+	if size > maxTagSize || version < 2 || version > 4 {
+		return end, nil
+	}
+
+	tag := make([]byte, size)
+	err = readAt(r, 10, tag)
+	if err != nil {
+		return end, err
+	}
+
+	// before 2.4 the whole tag is unsynchronised
+	if flags&0x80 != 0 && version < 4 {
+		tag = bytes.Replace(tag, []byte{0xff, 0x00}, []byte{0xff}, -1)
+	}
+
+	// the extended header is skipped, its size only includes itself
+	// from 2.4
+	if flags&0x40 != 0 && version > 2 && len(tag) >= 4 {
+		skip := int(be.Uint32(tag[:4])) + 4
+		if version == 4 {
+			skip = int(syncsafe(tag[:4]))
+		}
+		if skip > len(tag) {
+			return end, nil
+		}
+		tag = tag[skip:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(be.Uint32(tag[4:8]))
+		case 4:
+			frameSize = int(syncsafe(tag[4:8]))
+		}
+		if frameSize < 0 || headerSize+frameSize > len(tag) {
+			break
+		}
+		data := tag[headerSize : headerSize+frameSize]
+		var frameFlags byte
+		if version > 2 {
+			frameFlags = tag[9]
+		}
+		tag = tag[headerSize+frameSize:]
+
+		data, ok := id3v2FrameData(version, frameFlags, data)
+		if !ok || len(data) == 0 {
+			continue
+		}
+
+		switch {
+		case id == "TXXX" || id == "TXX":
+			values := id3v2Text(data)
+			if len(values) > 1 {
+				tags.add(TagName(values[0]), values[1:]...)
+			}
+		case id == "UFID" || id == "UFI":
+			// the owner is null terminated, the identifier binary
+			owner := bytes.IndexByte(data, 0)
+			if owner > 0 && string(data[:owner]) == MusicBrainzOwner {
+				tags.add("musicbrainz_trackid", string(data[owner+1:]))
+			}
+		case id == "TIPL" || id == "TMCL" || id == "IPLS" || id == "IPL":
+			values := id3v2Text(data)
+			for i := 0; i+1 < len(values); i += 2 {
+				tags.add(values[i], values[i+1])
+			}
+		case id3v2Names[id] != "":
+			tags.add(id3v2Names[id], id3v2Text(data)...)
+		}
+	}
+
+	return end, nil
+}
+
+// id3v2FrameData ...
+// Returns the contents of a frame without the data its flags add.
+// Compressed and encrypted frames are not read.
+func id3v2FrameData(version, flags byte, data []byte) ([]byte, bool) {
+	switch version {
+	case 3:
+		if flags&0xc0 != 0 {
+			return nil, false
+		}
+		// group id
+		if flags&0x20 != 0 && len(data) > 0 {
+			data = data[1:]
+		}
+	case 4:
+		if flags&0x0c != 0 {
+			return nil, false
+		}
+		if flags&0x40 != 0 && len(data) > 0 {
+			data = data[1:]
+		}
+		// data length indicator
+		if flags&0x01 != 0 && len(data) >= 4 {
+			data = data[4:]
+		}
+		if flags&0x02 != 0 {
+			data = bytes.Replace(data, []byte{0xff, 0x00}, []byte{0xff}, -1)
+		}
+	}
+	return data, true
+}
+
+// id3v2Text ...
+// Decodes the null separated strings of a text frame, which starts
+// with their encoding.
+func id3v2Text(data []byte) []string {
+	enc, data := data[0], data[1:]
+
+	var text string
+	switch enc {
+	case 1, 2:
+		text = decodeUTF16(data, enc == 2)
+	case 3:
+		text = string(data)
+	default:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	return strings.Split(strings.TrimRight(text, "\x00"), "\x00")
+}
+
+// decodeUTF16 ...
+// Decodes UTF-16, big endian unless a byte order mark says
+// otherwise. Each string of a frame may have its own mark.
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		switch {
+		case data[i] == 0xfe && data[i+1] == 0xff:
+			bigEndian = true
+			continue
+		case data[i] == 0xff && data[i+1] == 0xfe:
+			bigEndian = false
+			continue
+		}
+		if bigEndian {
+			units = append(units, be.Uint16(data[i:]))
+		} else {
+			units = append(units, le.Uint16(data[i:]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// parseVorbisComments ...
+// Reads a Vorbis comment header, without its packet type, into tags.
+func parseVorbisComments(b []byte, tags Tags) error {
+	if len(b) < 4 {
+		return ErrInvalid
+	}
+	vendor := int64(le.Uint32(b))
+	if vendor > int64(len(b)-8) {
+		return ErrInvalid
+	}
+	b = b[4+vendor:]
+	n := int(le.Uint32(b))
+	b = b[4:]
+
+	for i := 0; i < n; i++ {
+		if len(b) < 4 {
+			return ErrInvalid
+		}
+		length := int64(le.Uint32(b))
+		if length > int64(len(b)-4) {
+			return ErrInvalid
+		}
+		comment := string(b[4 : 4+length])
+		b = b[4+length:]
+
+		if eq := strings.IndexByte(comment, '='); eq > 0 {
+			tags.add(comment[:eq], comment[eq+1:])
+		}
+	}
+
+	return nil
+}
+
+// readFLACComments ...
+// Reads the VORBIS_COMMENT block of a FLAC file.
+func readFLACComments(r io.ReadSeeker, start int64, tags Tags) error {
+	offset := start + 4
+	header := make([]byte, 4)
+	for {
+		err := readAt(r, offset, header)
+		if err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4
+
+		if blockType == flacVorbisComment {
+			block := make([]byte, length)
+			err = readAt(r, offset, block)
+			if err != nil {
+				return err
+			}
+			return parseVorbisComments(block, tags)
+		}
+
+		offset += length
+		if last {
+			return nil
+		}
+	}
+}
+
+// readOggComments ...
+// Reads the comment header of the first stream of an Ogg file, its
+// second packet, which may span several pages.
+func readOggComments(r io.ReadSeeker, start int64, tags Tags) error {
+	var (
+		packet  []byte
+		packets int
+		offset  = start
+		serial  uint32
+	)
+	for first := true; ; first = false {
+		page, err := readOggPage(r, offset)
+		if err != nil {
+			return err
+		}
+		if first {
+			serial = page.serial
+		}
+		offset += oggPageHeaderSize + int64(len(page.segments))
+
+		if page.serial != serial {
+			for _, s := range page.segments {
+				offset += int64(s)
+			}
+			continue
+		}
+
+		for _, s := range page.segments {
+			if packets == 1 {
+				segment := make([]byte, s)
+				err = readAt(r, offset, segment)
+				if err != nil {
+					return err
+				}
+				packet = append(packet, segment...)
+				if len(packet) > maxTagSize {
+					return nil
+				}
+			}
+			offset += int64(s)
+
+			// a packet ends with a segment shorter than 255 bytes
+			if s < 255 {
+				packets++
+				if packets == 2 {
+					return parseOggComments(packet, tags)
+				}
+			}
+		}
+	}
+}
+
+// parseOggComments ...
+// Reads a Vorbis or Opus comment header packet.
+func parseOggComments(packet []byte, tags Tags) error {
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		return parseVorbisComments(packet[7:], tags)
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		return parseVorbisComments(packet[8:], tags)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// id3v2Tag ...
+// An ID3v2 tag of a version with frames, given as id and contents.
+func id3v2Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	header := []byte{'I', 'D', '3', version, 0, 0, 0, 0, 0, 0}
+	for i, n := 9, len(body); i >= 6; i, n = i-1, n>>7 {
+		header[i] = byte(n & 0x7f)
+	}
+	return append(header, body...)
+}
+
+// id3v2Frame ...
+func id3v2Frame(version byte, id string, data []byte) []byte {
+	f := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	if version == 4 {
+		for i, n := 7, len(data); i >= 4; i, n = i-1, n>>7 {
+			f[i] = byte(n & 0x7f)
+		}
+	} else {
+		binary.BigEndian.PutUint32(f[4:8], uint32(len(data)))
+	}
+	return append(f, data...)
+}
+
+// utf16Text ...
+// Encodes null separated strings as UTF-16 with byte order marks.
+func utf16Text(values ...string) []byte {
+	b := []byte{1}
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, 0, 0)
+		}
+		b = append(b, 0xff, 0xfe)
+		for _, u := range utf16.Encode([]rune(v)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+// vorbisComments ...
+func vorbisComments(comments ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(6))
+	b.WriteString("warble")
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// oggPages ...
+// Splits a packet across pages of at most one full segment each, so
+// that it spans several.
+func oggPages(serial uint32, packet []byte) []byte {
+	var b bytes.Buffer
+	for {
+		n := len(packet)
+		if n > 255 {
+			n = 255
+		}
+		b.Write(oggPageBytes(-1, serial, packet[:n]))
+		packet = packet[n:]
+		if n < 255 {
+			return b.Bytes()
+		}
+	}
+}
+
+// TestReadTags ...
+func TestReadTags(t *testing.T) {
+	long := string(bytes.Repeat([]byte("a"), 300))
+
+	var flac bytes.Buffer
+	flac.WriteString("fLaC")
+	flac.Write([]byte{0x00, 0, 0, 34})
+	flac.Write(make([]byte, 34))
+	comments := vorbisComments("ARTIST=Kendrick Lamar", "artist=SZA", "Composer=Someone", "=ignored", "bad")
+	flac.Write([]byte{0x80 | flacVorbisComment, 0, 0, byte(len(comments))})
+	flac.Write(comments)
+
+	var ogg bytes.Buffer
+	ogg.Write(oggPageBytes(0, 1, opusID(2, 0)))
+	ogg.Write(oggPageBytes(0, 2, vorbisID(2, 44100)))
+	ogg.Write(oggPages(1, append([]byte("OpusTags"), vorbisComments("TITLE="+long, "PRODUCER=Rick Rubin")...)))
+
+	cases := []struct {
+		name     string
+		file     []byte
+		expected Tags
+	}{
+		{"id3v2.4 multiple values", append(id3v2Tag(4,
+			id3v2Frame(4, "TPE1", []byte("\x03Daft Punk\x00Pharrell Williams\x00")),
+			id3v2Frame(4, "TIPL", []byte("\x03producer\x00Thomas Bangalter\x00mix\x00Mick Guzauski")),
+			id3v2Frame(4, "TXXX", []byte("\x03ARTISTS\x00Daft Punk\x00Pharrell Williams")),
+			id3v2Frame(4, "COMM", []byte("\x03eng\x00not text")),
+		), mp3Frames(1, nil)...), Tags{
+			"artist":   {"Daft Punk", "Pharrell Williams"},
+			"producer": {"Thomas Bangalter"},
+			"mix":      {"Mick Guzauski"},
+			"artists":  {"Daft Punk", "Pharrell Williams"},
+		}},
+		{"id3v2.3 utf-16", id3v2Tag(3,
+			id3v2Frame(3, "TPE2", utf16Text("Sigur Rós")),
+			id3v2Frame(3, "TCOM", []byte("\x00J\xf3nsi")),
+			id3v2Frame(3, "TPE4", utf16Text("Alex Somers", "Kjartan")),
+		), Tags{
+			"albumartist": {"Sigur Rós"},
+			"composer":    {"Jónsi"},
+			"remixer":     {"Alex Somers", "Kjartan"},
+		}},
+		{"id3v2.3 musicbrainz", id3v2Tag(3,
+			id3v2Frame(3, "TXXX", []byte("\x00MusicBrainz Album Id\x00e8f70201-8899-3f0c-9e07-5d6495bc8046")),
+			id3v2Frame(3, "TXXX", []byte("\x00MusicBrainz Artist Id\x00056e4f3e-d505-4dad-8ec1-d04f521cbb56")),
+			id3v2Frame(3, "UFID", []byte("http://musicbrainz.org\x00ca1a3a2c-d6ff-4a4b-bd3c-4f4a3d4c8d3e")),
+			id3v2Frame(3, "UFID", []byte("http://www.cddb.com/id3/taginfo1.html\x00ignored")),
+		), Tags{
+			"musicbrainz_albumid":  {"e8f70201-8899-3f0c-9e07-5d6495bc8046"},
+			"musicbrainz_artistid": {"056e4f3e-d505-4dad-8ec1-d04f521cbb56"},
+			"musicbrainz_trackid":  {"ca1a3a2c-d6ff-4a4b-bd3c-4f4a3d4c8d3e"},
+		}},
+		{"id3v2.2", id3v2Tag(2,
+			[]byte("TP1\x00\x00\x05\x00Blur"),
+		), Tags{"artist": {"Blur"}}},
+		{"flac", flac.Bytes(), Tags{
+			"artist":   {"Kendrick Lamar", "SZA"},
+			"composer": {"Someone"},
+		}},
+		{"ogg across pages", ogg.Bytes(), Tags{
+			"title":    {long},
+			"producer": {"Rick Rubin"},
+		}},
+		{"untagged", mp3Frames(2, nil), Tags{}},
+		{"empty", nil, Tags{}},
+	}
+
+	for _, c := range cases {
+		tags, err := ReadTags(bytes.NewReader(c.file))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(tags, c.expected) {
+			t.Errorf("%s: expected %q, received %q", c.name, c.expected, tags)
+		}
+	}
+
+	if tags := (Tags{"artist": {"A", "B"}}); tags.Get("artist") != "A" || tags.Get("title") != "" {
+		t.Errorf("unexpected first values of %v", tags)
+	}
+}
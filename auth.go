@@ -0,0 +1,438 @@
+// auth.go
+//
+// This file describes how requests are authenticated. Users log in
+// with their name and password and are given a session token, which is
+// sent back either as the session cookie or in an Authorization:
+// Bearer header.
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+const (
+	// sessionCookie is the name of the cookie holding a session token.
+	sessionCookie = "warbler_session"
+
+	// defaultSessionTTL is how long a login lasts by default.
+	defaultSessionTTL = 30 * 24 * time.Hour
+)
+
+// contextKey ...
+// The type of the keys of values added to a request's context.
+type contextKey int
+
+const (
+	// userKey is the key of the user a request is made by.
+	userKey contextKey = iota
+)
+
+// routeScopes are the scopes API tokens need for the routes, by the
+// first part of their path, that need more than reading. Other requests
+// that change anything need ScopeAdmin.
+var routeScopes = map[string]warblerDB.TokenScope{
+	"stream":    warblerDB.ScopeStream,
+	"imageFile": warblerDB.ScopeStream,
+	"albumArt":  warblerDB.ScopeStream,
+	"scrobble":  warblerDB.ScopeStream,
+	"token":     warblerDB.ScopeAdmin,
+	"scrobbler": warblerDB.ScopeAdmin,
+}
+
+// credentials ...
+// The name and password a user logs in with.
+type credentials struct {
+	Name     string `edn:"name"     json:"name"`
+	Password string `edn:"password" json:"password"`
+}
+
+// newUser ...
+// A user to create.
+type newUser struct {
+	Name     string `edn:"name"     json:"name"`
+	Email    string `edn:"email"    json:"email"`
+	Password string `edn:"password" json:"password"`
+	Admin    bool   `edn:"admin"    json:"admin"`
+}
+
+// session ...
+// The response to logging in.
+type session struct {
+	Token   string         `edn:"token"   json:"token"`
+	Expires time.Time      `edn:"expires" json:"expires"`
+	User    warblerDB.User `edn:"user"    json:"user"`
+}
+
+// unauthorized ...
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// sessionToken ...
+// Returns the session token sent with a request, from the
+// Authorization header or else the session cookie. It is empty when
+// there is none.
+func sessionToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+			return strings.TrimSpace(auth[len("Bearer "):])
+		}
+		return ""
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requestUser ...
+// Returns the user a request was authenticated as, nil when it was let
+// through anonymously.
+func requestUser(r *http.Request) *warblerDB.User {
+	user, _ := r.Context().Value(userKey).(*warblerDB.User)
+	return user
+}
+
+// isAdmin ...
+// Reports whether a request may manage the server, its libraries and
+// users, writing an error response when it may not. Only admins that
+// are logged in may.
+func (serv *server) isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user := requestUser(r)
+	if user == nil {
+		unauthorized(w)
+		return false
+	}
+	if !user.Admin {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requiredScope ...
+// Returns the scope an API token needs for a request.
+func requiredScope(r *http.Request) warblerDB.TokenScope {
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ := route.GetPathTemplate()
+		// templates are /{format}/{route}/...
+		parts := strings.SplitN(strings.TrimPrefix(template, "/"), "/", 3)
+		if len(parts) > 1 {
+			if scope, ok := routeScopes[parts[1]]; ok {
+				return scope
+			}
+		}
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return warblerDB.ScopeAdmin
+	}
+	return warblerDB.ScopeRead
+}
+
+// authenticate ...
+// Middleware that only lets through requests with a valid session or
+// API token, adding its user to the request's context. API tokens
+// must have the scope the request needs. When the server is anonymous
+// requests without a token are let through too, but a token that is
+// sent must still be valid.
+func (serv *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := sessionToken(r)
+		if token == "" {
+			if serv.anonymous {
+				next.ServeHTTP(w, r)
+				return
+			}
+			unauthorized(w)
+			return
+		}
+
+		var (
+			user  warblerDB.User
+			scope = warblerDB.ScopeAdmin
+			err   error
+		)
+		if strings.HasPrefix(token, warblerDB.APITokenPrefix) {
+			user, scope, err = serv.wdb.APITokenUser(token)
+		} else {
+			user, err = serv.wdb.SessionUser(token)
+		}
+		if err == warblerDB.ErrInvalidSession {
+			unauthorized(w)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		if !scope.Allows(requiredScope(r)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, &user)))
+	})
+}
+
+// newLoginRoute ...
+// Logs a user in with the name and password in the body. Responds with
+// the session, whose token is also set as the session cookie.
+func (serv *server) newLoginRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		var creds credentials
+		err = enc.dec(data, &creds)
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
+
+		user, err := serv.wdb.Authenticate(creds.Name, creds.Password)
+		if err == warblerDB.ErrInvalidCredentials {
+			unauthorized(w)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		ttl := serv.sessionTTL
+		if ttl == 0 {
+			ttl = defaultSessionTTL
+		}
+		token, expires, err := serv.wdb.CreateSession(user.ID, ttl)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(session{token, expires, user})
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newLogoutRoute ...
+// Ends the session a request is made with and clears the session
+// cookie.
+func (serv *server) newLogoutRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := sessionToken(r); token != "" {
+			err := serv.wdb.DeleteSession(token)
+			if err != nil {
+				internalServerError(w)
+				return
+			}
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newUserCreator ...
+// Creates the user in the body. Only admins can create users, the
+// first is created with the user add command.
+func (serv *server) newUserCreator(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		var u newUser
+		err = enc.dec(data, &u)
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
+
+		user, err := serv.wdb.CreateUser(u.Name, u.Email, u.Password, u.Admin)
+		switch {
+		case err == warblerDB.ErrInvalidUserName || err == warblerDB.ErrInvalidPassword:
+			badRequestErr(w, err)
+			return
+		case err == warblerDB.ErrUserExists:
+			w.WriteHeader(http.StatusConflict)
+			return
+		case err != nil:
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(response)
+	}
+}
+
+// newCurrentUserRoute ...
+// Responds with the user a request is made by.
+func (serv *server) newCurrentUserRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		response, err := enc.enc(user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// userLibraryIDs ...
+// Returns the user and library ids in a request's url. Writes an error
+// response and returns false if they are not ids.
+func userLibraryIDs(w http.ResponseWriter, r *http.Request) (user, library int64, ok bool) {
+	params := mux.Vars(r)
+	user, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		badRequestErr(w, errors.New("invalid id"))
+		return 0, 0, false
+	}
+	if params["library"] == "" {
+		return user, 0, true
+	}
+	library, err = strconv.ParseInt(params["library"], 10, 64)
+	if err != nil {
+		badRequestErr(w, errors.New("invalid library"))
+		return 0, 0, false
+	}
+	return user, library, true
+}
+
+// newUserLibrariesRoute ...
+// Lists the ids of the libraries a user has been granted.
+func (serv *server) newUserLibrariesRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+		user, _, ok := userLibraryIDs(w, r)
+		if !ok {
+			return
+		}
+
+		libraries, err := serv.wdb.UserLibraries(user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(libraries)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newLibraryGranter ...
+// Lets a user see the records of a library.
+func (serv *server) newLibraryGranter(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+		user, library, ok := userLibraryIDs(w, r)
+		if !ok {
+			return
+		}
+
+		err := serv.wdb.GrantLibrary(user, library)
+		if err == warblerDB.ErrNotPresent {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newLibraryRevoker ...
+// Stops a user from seeing the records of a library.
+func (serv *server) newLibraryRevoker(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+		user, library, ok := userLibraryIDs(w, r)
+		if !ok {
+			return
+		}
+
+		err := serv.wdb.RevokeLibrary(user, library)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
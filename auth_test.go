@@ -0,0 +1,223 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// authedRequester ...
+// Returns a function making requests of a server that needs users to
+// log in.
+func authedRequester(t *testing.T) func(method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+	authed := &server{wdb: serv.wdb, router: mux.NewRouter(), forwarder: serv.forwarder}
+	authed.addRoutes()
+
+	return func(method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		authed.router.ServeHTTP(rr, req)
+		return rr
+	}
+}
+
+// TestAuthentication ...
+func TestAuthentication(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	// every route needs a session
+	for _, url := range []string{"/json/genre/1", "/edn/song", "/json/stream/1", "/edn/user"} {
+		if rr := do(http.MethodGet, url, "", nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d, received %d", url, http.StatusUnauthorized, rr.Code)
+		}
+	}
+	rr := do(http.MethodPost, "/json/scanLibrary/1", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("scanLibrary: expected status %d, received %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	for _, body := range []string{`{"name":"admin","password":"wrong"}`, `{"name":"nobody","password":"correct horse"}`} {
+		if rr := do(http.MethodPost, "/json/login", body, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d, received %d", body, http.StatusUnauthorized, rr.Code)
+		}
+	}
+	if rr := do(http.MethodPost, "/json/login", `[`, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, received %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = do(http.MethodPost, "/json/login", `{"name":"admin","password":"correct horse"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login: expected status %d, received %d %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	var s session
+	err := jsonE.dec(rr.Body.Bytes(), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Token == "" || s.User.ID != 1 || strings.Contains(rr.Body.String(), "password") {
+		t.Errorf("unexpected session %s", rr.Body)
+	}
+	cookie := rr.Result().Cookies()
+	if len(cookie) != 1 || cookie[0].Name != sessionCookie || cookie[0].Value != s.Token || !cookie[0].HttpOnly {
+		t.Fatalf("expected the session cookie, received %v", cookie)
+	}
+
+	bearer := map[string]string{"Authorization": "Bearer " + s.Token}
+	var tests = []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		headers  map[string]string
+		rCode    int
+		response string
+	}{
+		{"bearer", http.MethodGet, "/json/genre/1", "", bearer, http.StatusOK, `{"id":1,"name":"Jazz"}`},
+		{"cookie", http.MethodGet, "/edn/genre/1", "", map[string]string{"Cookie": cookie[0].String()}, http.StatusOK, `{:id 1 :name"Jazz"}`},
+		{"invalid bearer", http.MethodGet, "/json/genre/1", "", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized, ""},
+		{"basic", http.MethodGet, "/json/genre/1", "", map[string]string{"Authorization": "Basic YWRtaW4="}, http.StatusUnauthorized, ""},
+		{"current user", http.MethodGet, "/json/user", "", bearer, http.StatusOK, `{"id":1,"name":"admin","email":"admin@example.com","admin":true}`},
+		{"create user", http.MethodPost, "/edn/user", `{:name "guest" :email "guest@example.com" :password "battery staple"}`, bearer,
+			http.StatusCreated, `{:id 10001 :name"guest":email"guest@example.com":admin false}`},
+		{"existing user", http.MethodPost, "/json/user", `{"name":"guest","password":"battery staple"}`, bearer, http.StatusConflict, ""},
+		{"weak password", http.MethodPost, "/json/user", `{"name":"other","password":"horse"}`, bearer,
+			http.StatusBadRequest, "wdb: password must be 8 to 72 bytes long"},
+		{"logout", http.MethodPost, "/json/logout", "", bearer, http.StatusNoContent, ""},
+		{"logged out", http.MethodGet, "/json/genre/1", "", bearer, http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, test.body, test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d", test.name, test.rCode, rr.Code)
+		}
+		if test.response != "" && rr.Body.String() != test.response {
+			t.Errorf("%s: expected %s, received %s", test.name, test.response, rr.Body)
+		}
+	}
+
+	// the created user can log in
+	rr = do(http.MethodPost, "/edn/login", `{:name "guest" :password "battery staple"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("guest login: expected status %d, received %d", http.StatusOK, rr.Code)
+	}
+}
+
+// TestRoles ...
+func TestRoles(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	login := func(name string) map[string]string {
+		rr := do(http.MethodPost, "/json/login", `{"name":"`+name+`","password":"correct horse"}`, nil)
+		var s session
+		err := jsonE.dec(rr.Body.Bytes(), &s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"Authorization": "Bearer " + s.Token}
+	}
+	admin, listener := login("admin"), login("listener")
+
+	var tests = []struct {
+		name     string
+		method   string
+		url      string
+		headers  map[string]string
+		rCode    int
+		response string
+	}{
+		// the listener only sees library 2
+		{"listener libraries", http.MethodGet, "/json/library", listener, http.StatusOK, `[[{"id":2,"name":"My Music","path":"/home/tests/MyMusic"}]]`},
+		{"listener song", http.MethodGet, "/json/song/1", listener, http.StatusNotFound, ""},
+		{"listener stream", http.MethodGet, "/json/stream/1", listener, http.StatusNotFound, ""},
+		{"listener album art", http.MethodGet, "/json/albumArt/1", listener, http.StatusNotFound, ""},
+		{"listener artist", http.MethodGet, "/json/artist/3", listener, http.StatusOK, `{"id":3,"name":"Iron Maiden","mbid":null}`},
+		{"listener appears on", http.MethodGet, "/json/appearsOn/1", listener, http.StatusNotFound, ""},
+		{"listener search", http.MethodGet, "/json/search?q=badbadnotgood", listener, http.StatusOK,
+			`{"artists":[],"albums":[],"songs":[],"genres":[]}`},
+
+		// only admins manage libraries and users
+		{"listener scan", http.MethodPost, "/json/scanLibrary/1", listener, http.StatusForbidden, ""},
+		{"listener update", http.MethodPut, "/json/library", listener, http.StatusForbidden, ""},
+		{"listener create", http.MethodPost, "/json/library", listener, http.StatusForbidden, ""},
+		{"listener create user", http.MethodPost, "/json/user", listener, http.StatusForbidden, ""},
+		{"listener grant", http.MethodPut, "/json/user/2/library/1", listener, http.StatusForbidden, ""},
+
+		{"admin song", http.MethodGet, "/json/song/1", admin, http.StatusOK, ""},
+		// song 5 is in no library, kept only for its history
+		{"admin song in no library", http.MethodGet, "/json/song/5", admin, http.StatusNotFound, ""},
+		{"admin stream in no library", http.MethodGet, "/json/stream/5", admin, http.StatusNotFound, ""},
+		{"grant", http.MethodPut, "/json/user/2/library/1", admin, http.StatusNoContent, ""},
+		{"granted", http.MethodGet, "/edn/user/2/library", admin, http.StatusOK, `[1 2]`},
+		{"granted song", http.MethodGet, "/json/song/1", listener, http.StatusOK, ""},
+		{"revoke", http.MethodDelete, "/json/user/2/library/2", admin, http.StatusNoContent, ""},
+		{"revoked song", http.MethodGet, "/json/song/3", listener, http.StatusNotFound, ""},
+		{"grant missing user", http.MethodPut, "/json/user/99/library/1", admin, http.StatusNotFound, ""},
+		{"grant invalid library", http.MethodPut, "/json/user/2/library/all", admin, http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, "", test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d", test.name, test.rCode, rr.Code)
+		}
+		if test.response != "" && rr.Body.String() != test.response {
+			t.Errorf("%s: expected %s, received %s", test.name, test.response, rr.Body)
+		}
+	}
+
+	// pages are counted within the visible songs, 1, 2 and 4 of library 1
+	rr := do(http.MethodGet, "/json/song?limit=1&orderby=id", "", listener)
+	if count := rr.Header().Get("X-Total-Count"); count != "3" {
+		t.Errorf("expected a count of 3, received %q", count)
+	}
+}
+
+// TestAnonymous ...
+func TestAnonymous(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		method string
+		url    string
+		body   string
+		auth   string
+		rCode  int
+	}{
+		{http.MethodGet, "/json/genre/1", "", "", http.StatusOK},
+		{http.MethodGet, "/json/genre/1", "", "Bearer nope", http.StatusUnauthorized},
+		{http.MethodGet, "/json/user", "", "", http.StatusUnauthorized},
+		{http.MethodPost, "/json/user", `{"name":"guest","password":"battery staple"}`, "", http.StatusUnauthorized},
+		// shared playlists are read but not changed without logging in
+		{http.MethodGet, "/json/playlist/3/songs", "", "", http.StatusOK},
+		{http.MethodGet, "/json/playlist/1/songs", "", "", http.StatusNotFound},
+		{http.MethodPost, "/json/playlist/3/songs", `{"songs":[1]}`, "", http.StatusUnauthorized},
+		{http.MethodPost, "/json/playlist", `{"name":"Gym"}`, "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+		if rr.Code != test.rCode {
+			t.Errorf("%s %s %q: expected status %d, received %d", test.method, test.url, test.auth, test.rCode, rr.Code)
+		}
+	}
+}
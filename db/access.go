@@ -0,0 +1,213 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// grantedLibraries selects the ids of the libraries user $1 has been
+// granted.
+const grantedLibraries = "SELECT library_id FROM config.library_access WHERE user_id = $1"
+
+// anonymousLibraries selects the ids of the libraries requests made
+// without logging in can see.
+const anonymousLibraries = "SELECT library_id FROM config.anonymous_access"
+
+// libraryIDs ...
+// Returns the subqueries selecting the ids of the records of each type
+// that are in the libraries a subquery selects. Types that are not
+// here are seen by everyone.
+func libraryIDs(libraries string) map[reflect.Type]string {
+	songs := "SELECT sil.song_id FROM music.songs_in_library AS sil WHERE sil.library_id IN (" + libraries + ")"
+	albums := "SELECT songs.album FROM music.songs AS songs WHERE songs.id IN (" + songs + ")"
+
+	return map[reflect.Type]string{
+		reflect.TypeOf(Library{}): libraries,
+		reflect.TypeOf(Song{}):    songs,
+		reflect.TypeOf(Album{}):   albums,
+		// artists credited on visible songs and those of visible albums
+		reflect.TypeOf(Artist{}): "SELECT sa.artist_id FROM music.song_artists AS sa WHERE sa.song_id IN (" + songs + ") " +
+			"UNION SELECT albums.artist FROM music.albums AS albums WHERE albums.id IN (" + albums + ")",
+		reflect.TypeOf(Image{}): "SELECT iia.image_id FROM music.images_in_album AS iia WHERE iia.album_id IN (" + albums + ")",
+	}
+}
+
+// visibleIDs are the subqueries selecting the ids of the records of
+// each type that user $1 can see.
+var visibleIDs = libraryIDs(grantedLibraries)
+
+// anonymousIDs are the subqueries selecting the ids of the records of
+// each type that requests made without logging in can see.
+var anonymousIDs = libraryIDs(anonymousLibraries)
+
+// libraryRecordIDs are the subqueries selecting the ids of the records
+// of each type that are in any library, which admins see. Songs kept
+// for their plays or playlist entries after their files were deleted
+// are in none.
+var libraryRecordIDs = libraryIDs("SELECT id FROM music.libraries")
+
+// personalIDs are like visibleIDs for the records users make, which
+// admins do not see either unless they are shared.
+var personalIDs = map[reflect.Type]string{
+	// shared playlists imported from a library are seen by those that
+	// see the library
+	reflect.TypeOf(Playlist{}): "SELECT id FROM music.playlists WHERE owner = $1 OR sharing <> 'private' AND " +
+		"(library_id IS NULL OR library_id IN (SELECT library_id FROM config.library_access WHERE user_id = $1) " +
+		"OR EXISTS (SELECT 1 FROM config.users WHERE id = $1 AND admin))",
+	reflect.TypeOf(SmartPlaylist{}): "SELECT id FROM music.smart_playlists WHERE owner = $1 OR sharing <> 'private'",
+	// plays are never shared
+	reflect.TypeOf(Play{}): "SELECT id FROM music.plays WHERE user_id = $1",
+}
+
+// sharedIDs are like personalIDs for requests made without logging in,
+// which only see what is shared. They see none of the records of the
+// types that are not here, such as plays.
+var sharedIDs = map[reflect.Type]string{
+	reflect.TypeOf(Playlist{}): "SELECT id FROM music.playlists WHERE sharing <> 'private' AND " +
+		"(library_id IS NULL OR library_id IN (" + anonymousLibraries + "))",
+	reflect.TypeOf(SmartPlaylist{}): "SELECT id FROM music.smart_playlists WHERE sharing <> 'private'",
+}
+
+// accessFilter ...
+// Filters records to the ids selected by a subquery of user $1.
+type accessFilter struct {
+	ids  string
+	user int64
+}
+
+func (f accessFilter) where(idx *int) (string, []interface{}) {
+	param := "$" + strconv.Itoa(*idx)
+	*idx++
+	return "id IN (" + strings.Replace(f.ids, "$1", param, -1) + ")", []interface{}{f.user}
+}
+
+// idsFilter ...
+// Filters records to the ids selected by a subquery without parameters.
+type idsFilter struct {
+	ids string
+}
+
+func (f idsFilter) where(idx *int) (string, []interface{}) {
+	return "id IN (" + f.ids + ")", nil
+}
+
+// Visible ...
+// Returns the filter of the records of the query type that a user can
+// see, those in the libraries they have been granted, the playlists
+// they own or that are shared and their plays. Admins see every record
+// in any library. A nil user, which is used for requests made without
+// logging in when the server allows them, sees the records in the
+// libraries opened to anonymous requests and the shared playlists.
+func Visible(queryType interface{}, user *User) Filter {
+	if ids, ok := personalIDs[indirectType(queryType)]; ok {
+		if user != nil {
+			return accessFilter{ids, user.ID}
+		}
+		if ids, ok = sharedIDs[indirectType(queryType)]; ok {
+			return idsFilter{ids}
+		}
+		return AnyOf{}
+	}
+	if user == nil {
+		ids, ok := anonymousIDs[indirectType(queryType)]
+		if !ok {
+			return AllOf{}
+		}
+		return idsFilter{ids}
+	}
+	if user.Admin {
+		ids, ok := libraryRecordIDs[indirectType(queryType)]
+		if !ok {
+			return AllOf{}
+		}
+		return idsFilter{ids}
+	}
+	ids, ok := visibleIDs[indirectType(queryType)]
+	if !ok {
+		return AllOf{}
+	}
+	return accessFilter{ids, user.ID}
+}
+
+// CanSee ...
+// Reports whether a user can see the record of the query type with an
+// id.
+func (wdb *WarblerDB) CanSee(queryType interface{}, id int64, user *User) (bool, error) {
+	count, err := wdb.Count(queryType, AllOf{Condition{"id", OpEqual, id}, Visible(queryType, user)})
+	return count > 0, err
+}
+
+// GrantLibrary ...
+// Lets a user see the records of a library. Granting a library twice
+// does nothing. Fails with ErrNotPresent when there is no such user or
+// library.
+func (wdb *WarblerDB) GrantLibrary(user, library int64) error {
+	var found int
+	err := wdb.QueryRow("SELECT (SELECT COUNT(1) FROM config.users WHERE id = $1) + "+
+		"(SELECT COUNT(1) FROM music.libraries WHERE id = $2)", user, library).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 2 {
+		return ErrNotPresent
+	}
+
+	_, err = wdb.Exec("INSERT INTO config.library_access (user_id, library_id) VALUES ($1, $2) "+
+		"ON CONFLICT DO NOTHING", user, library)
+	return err
+}
+
+// RevokeLibrary ...
+// Stops a user from seeing the records of a library.
+func (wdb *WarblerDB) RevokeLibrary(user, library int64) error {
+	_, err := wdb.Exec("DELETE FROM config.library_access WHERE user_id = $1 AND library_id = $2", user, library)
+	return err
+}
+
+// UserLibraries ...
+// Returns the ids of the libraries a user has been granted, in order.
+func (wdb *WarblerDB) UserLibraries(user int64) (libraries []int64, err error) {
+	rows, err := wdb.Query("SELECT library_id FROM config.library_access WHERE user_id = $1 ORDER BY library_id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	libraries = []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		libraries = append(libraries, id)
+	}
+	return libraries, rows.Err()
+}
+
+// GrantAnonymousLibrary ...
+// Lets requests made without logging in see the records of a library.
+// Granting a library twice does nothing. Fails with ErrNotPresent when
+// there is no such library.
+func (wdb *WarblerDB) GrantAnonymousLibrary(library int64) error {
+	var found int
+	err := wdb.QueryRow("SELECT COUNT(1) FROM music.libraries WHERE id = $1", library).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 1 {
+		return ErrNotPresent
+	}
+
+	_, err = wdb.Exec("INSERT INTO config.anonymous_access (library_id) VALUES ($1) ON CONFLICT DO NOTHING", library)
+	return err
+}
+
+// RevokeAnonymousLibrary ...
+// Stops requests made without logging in from seeing the records of a
+// library.
+func (wdb *WarblerDB) RevokeAnonymousLibrary(library int64) error {
+	_, err := wdb.Exec("DELETE FROM config.anonymous_access WHERE library_id = $1", library)
+	return err
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestVisible ...
+func TestVisible(t *testing.T) {
+	prepareDB()
+
+	admin := &User{ID: 1, Admin: true}
+	listener := &User{ID: 2}
+
+	var tests = []struct {
+		query    interface{}
+		user     *User
+		expected []int64
+	}{
+		{Library{}, nil, []int64{1, 2}},
+		{Library{}, admin, []int64{1, 2}},
+		{Library{}, listener, []int64{2}},
+		// songs 5 and 6 are in no library, so not even admins see them
+		{Song{}, admin, []int64{1, 2, 3, 4}},
+		{Song{}, listener, []int64{3}},
+		{Album{}, listener, []int64{3}},
+		{Artist{}, listener, []int64{3}},
+		{Image{}, listener, []int64{}},
+		// genres are seen by everyone
+		{Genre{}, listener, []int64{1, 2, 3, 4}},
+	}
+
+	ids := func(results []interface{}) []int64 {
+		ids := make([]int64, len(results))
+		for i, r := range results {
+			ids[i] = reflect.ValueOf(r).FieldByName("ID").Int()
+		}
+		return ids
+	}
+
+	for _, test := range tests {
+		results, err := wdb.ReadFilter(test.query, Visible(test.query, test.user), []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received := ids(results); !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%T %+v: expected %v, received %v", test.query, test.user, test.expected, received)
+		}
+	}
+
+	err := wdb.GrantLibrary(listener.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// granting twice does nothing
+	err = wdb.GrantLibrary(listener.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libraries, err := wdb.UserLibraries(listener.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(libraries, []int64{1, 2}) {
+		t.Errorf("expected the libraries [1 2], received %v", libraries)
+	}
+
+	for _, test := range []struct {
+		query    interface{}
+		expected []int64
+	}{
+		{Song{}, []int64{1, 2, 3, 4}},
+		{Album{}, []int64{1, 2, 3, 4}},
+		{Artist{}, []int64{1, 2, 3, 4}},
+		{Image{}, []int64{1, 2}},
+	} {
+		results, err := wdb.ReadFilter(test.query, Visible(test.query, listener), []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received := ids(results); !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%T granted: expected %v, received %v", test.query, test.expected, received)
+		}
+	}
+
+	err = wdb.RevokeLibrary(listener.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		id      int64
+		visible bool
+	}{{1, true}, {3, false}, {5, false}} {
+		visible, err := wdb.CanSee(Song{}, test.id, listener)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if visible != test.visible {
+			t.Errorf("song %d: expected visible %v, received %v", test.id, test.visible, visible)
+		}
+	}
+
+	for _, grant := range [][2]int64{{99, 1}, {2, 99}} {
+		if err := wdb.GrantLibrary(grant[0], grant[1]); err != ErrNotPresent {
+			t.Errorf("%v: expected %v, received %v", grant, ErrNotPresent, err)
+		}
+	}
+}
+
+// TestAnonymousAccess ...
+func TestAnonymousAccess(t *testing.T) {
+	prepareDB()
+
+	// requests made without logging in only see the libraries opened
+	// to them
+	err := wdb.RevokeAnonymousLibrary(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		query    interface{}
+		expected []int64
+	}{
+		{Library{}, []int64{2}},
+		{Song{}, []int64{3}},
+		{Album{}, []int64{3}},
+		{Artist{}, []int64{3}},
+		{Genre{}, []int64{1, 2, 3, 4}},
+		// and shared playlists
+		{Playlist{}, []int64{2, 3}},
+		{SmartPlaylist{}, []int64{2}},
+	} {
+		results, err := wdb.ReadFilter(test.query, Visible(test.query, nil), []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := []int64{}
+		for _, r := range results {
+			received = append(received, reflect.ValueOf(r).FieldByName("ID").Int())
+		}
+		if !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%T: expected %v, received %v", test.query, test.expected, received)
+		}
+	}
+
+	// shared playlists imported from a library are only seen when the
+	// library is
+	_, err = wdb.Exec("UPDATE music.playlists SET library_id = 1 WHERE id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visible, err := wdb.CanSee(Playlist{}, 2, nil); err != nil || visible {
+		t.Errorf("expected playlist 2 not to be seen, received %v %v", visible, err)
+	}
+
+	err = wdb.RevokeAnonymousLibrary(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visible, err := wdb.CanSee(Song{}, 3, nil); err != nil || visible {
+		t.Errorf("expected song 3 not to be seen, received %v %v", visible, err)
+	}
+
+	// granting twice does nothing
+	for i := 0; i < 2; i++ {
+		err = wdb.GrantAnonymousLibrary(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if visible, err := wdb.CanSee(Song{}, 1, nil); err != nil || !visible {
+		t.Errorf("expected song 1 to be seen, received %v %v", visible, err)
+	}
+	if err := wdb.GrantAnonymousLibrary(99); err != ErrNotPresent {
+		t.Errorf("expected %v, received %v", ErrNotPresent, err)
+	}
+}
+
+// TestVisibleReads ...
+func TestVisibleReads(t *testing.T) {
+	prepareDB()
+	listener := &User{ID: 2}
+
+	results, err := wdb.Search("badbadnotgood", 0, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Artists) != 0 || len(results.Albums) != 0 {
+		t.Errorf("expected to find nothing, received %+v", results)
+	}
+	results, err = wdb.Search("maiden", 0, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Artists) != 1 || results.Artists[0].ID != 3 {
+		t.Errorf("expected to find Iron Maiden, received %+v", results.Artists)
+	}
+
+	albums, err := wdb.AppearsOn(1, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 0 {
+		t.Errorf("expected no albums, received %+v", albums)
+	}
+
+	_, err = wdb.ReadMBID("0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11", listener)
+	if err != ErrNotPresent {
+		t.Errorf("expected %v, received %v", ErrNotPresent, err)
+	}
+
+	genre := Genre{ID: 1}
+	withSongs, err := wdb.Include(genre, []interface{}{genre}, []string{"songs"}, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if songs := reflect.ValueOf(withSongs[0]).FieldByName("Songs").Interface().([]Song); len(songs) != 0 {
+		t.Errorf("expected no songs, received %+v", songs)
+	}
+}
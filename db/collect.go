@@ -0,0 +1,134 @@
+package db
+
+// removeMissing ...
+// Removes songs from a library whose files were not seen by the last
+// scan of it, either because they were deleted or because the path
+// of the library changed. Songs that are in no other library are
+// deleted. Returns the number of songs removed from the library.
+func (wdb *WarblerDB) removeMissing(lib Library, seen map[string]struct{}, states map[string]fileState) (removed int, err error) {
+	return wdb.removeFromLibrary(lib, func(fsPath string) bool {
+		_, ok := seen[fsPath]
+		return !ok
+	}, states)
+}
+
+// unusedSong holds for song $1 when it is in no library, was never
+// played and is in no playlist.
+const unusedSong = "NOT EXISTS (SELECT 1 FROM music.songs_in_library WHERE song_id = $1) AND " +
+	"NOT EXISTS (SELECT 1 FROM music.plays WHERE song_id = $1) AND " +
+	"NOT EXISTS (SELECT 1 FROM music.playlist_songs WHERE song_id = $1)"
+
+// removeFromLibrary ...
+// Removes the songs and file states of a library whose paths gone
+// reports as removed from disk. Songs that are in no other library
+// are deleted, unless they were played or are in a playlist, which are
+// kept out of every library with their plays and playlist entries.
+// Returns the number of songs removed from the library.
+func (wdb *WarblerDB) removeFromLibrary(lib Library, gone func(fsPath string) bool, states map[string]fileState) (removed int, err error) {
+	rows, err := wdb.Query("SELECT songs.id, songs.fs_path FROM music.songs AS songs "+
+		"JOIN music.songs_in_library AS sil ON sil.song_id = songs.id "+
+		"WHERE sil.library_id = $1", lib.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var missing []int64
+	for rows.Next() {
+		var (
+			id     int64
+			fsPath string
+		)
+		err = rows.Scan(&id, &fsPath)
+		if err != nil {
+			return 0, err
+		}
+		if gone(fsPath) {
+			missing = append(missing, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	for _, id := range missing {
+		_, err = wdb.Exec("DELETE FROM music.songs_in_library WHERE song_id = $1 AND library_id = $2", id, lib.ID)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+
+		_, err = wdb.Exec("DELETE FROM music.song_artists WHERE song_id = $1 AND "+unusedSong, id)
+		if err != nil {
+			return removed, err
+		}
+		_, err = wdb.Exec("DELETE FROM music.songs WHERE id = $1 AND "+unusedSong, id)
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	for fsPath, state := range states {
+		if !gone(fsPath) {
+			continue
+		}
+		switch state.FileType {
+		case imageType:
+			err = wdb.removeImageFile(fsPath)
+		case playlistType:
+			err = wdb.removePlaylistFile(lib, fsPath)
+		}
+		if err != nil {
+			return removed, err
+		}
+		err = wdb.deleteFileState(lib, fsPath)
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// collectGarbage ...
+// Deletes albums, artists, genres and extracted artwork that no
+// longer belong to any song. Artists are kept while they are
+// credited on a song. Returns the number of rows deleted.
+func (wdb *WarblerDB) collectGarbage() (collected int64, err error) {
+	const orphanedAlbums = "SELECT id FROM music.albums WHERE id NOT IN " +
+		"(SELECT album FROM music.songs WHERE album IS NOT NULL)"
+
+	queries := []struct {
+		query string
+		count bool
+	}{
+		{"DELETE FROM music.images_in_album WHERE album_id IN (" + orphanedAlbums + ")", false},
+		{"DELETE FROM music.albums WHERE id IN (" + orphanedAlbums + ")", true},
+		{"DELETE FROM music.artists WHERE id NOT IN " +
+			"(SELECT artist FROM music.albums WHERE artist IS NOT NULL) AND id NOT IN " +
+			"(SELECT artist_id FROM music.song_artists)", true},
+		{"DELETE FROM music.genres WHERE id NOT IN " +
+			"(SELECT genre FROM music.songs WHERE genre IS NOT NULL)", true},
+	}
+
+	for _, q := range queries {
+		res, err := wdb.Exec(q.query)
+		if err != nil {
+			return collected, err
+		}
+
+		if !q.count {
+			continue
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return collected, err
+		}
+		collected += n
+	}
+
+	images, err := wdb.collectImages()
+	collected += images
+	return collected, err
+}
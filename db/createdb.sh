@@ -5,7 +5,7 @@ createDB () {
     if [ -z $DB_DATABASE_EXISTS ]; then
 	echo "Creating $1"
 	createdb -U postgres -O warbler $1 "The database for the warbler web server"
-	psql -U warbler $1 -f music_schema.sql
+	(cd .. && go run . -dsn "dbname=$1 user=warbler sslmode=disable" migrate up)
     else
 	echo "Database $1 exists"
     fi
@@ -0,0 +1,257 @@
+package db
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"gitlab.stergianis.ca/michael/warbler/audio"
+)
+
+// The roles artists are credited on songs with.
+const (
+	RolePrimary  = "primary"
+	RoleFeatured = "featured"
+	RoleComposer = "composer"
+	RoleRemixer  = "remixer"
+	RoleProducer = "producer"
+)
+
+var (
+	// featuring matches the artists featured in a title or artist
+	// name, "(feat. X)", "[ft. X & Y]", "(with X)" or a trailing
+	// "feat. X". Without brackets the abbreviations need their dot so
+	// that titles like "Feat of Strength" are left alone.
+	featuring = regexp.MustCompile(`(?i)\s*[(\[]\s*(?:feat\.?|ft\.?|featuring|with)\s+([^)\]]+)[)\]]` +
+		`|\s+(?:feat\.|ft\.|featuring)\s+(.+)$`)
+
+	// nameSeparators separate the names in a list of featured
+	// artists.
+	nameSeparators = regexp.MustCompile(`\s*,\s*|\s+&\s+|\s+and\s+`)
+)
+
+// Credit ...
+// An artist credited on a song and the role they are credited with.
+type Credit struct {
+	Artist int64  `edn:"artist" json:"artist"`
+	Name   string `edn:"name"   json:"name"`
+	Role   string `edn:"role"   json:"role"`
+
+	// the MusicBrainz id of the artist when the song is tagged with it
+	mbid NullString
+}
+
+// splitFeatured ...
+// Removes the featured artists from a title or artist name, returning
+// what is left and the names of the artists featured.
+func splitFeatured(s string) (rest string, featured []string) {
+	for _, m := range featuring.FindAllStringSubmatch(s, -1) {
+		list := m[1]
+		if list == "" {
+			list = m[2]
+		}
+		featured = append(featured, nameSeparators.Split(strings.TrimSpace(list), -1)...)
+	}
+	return strings.TrimSpace(featuring.ReplaceAllString(s, "")), featured
+}
+
+// splitNames ...
+// Splits the values of a tag on semicolons, which separate names in
+// formats without multiple values.
+func splitNames(values ...string) (names []string) {
+	for _, v := range values {
+		names = append(names, strings.Split(v, ";")...)
+	}
+	return names
+}
+
+// parseCredits ...
+// Returns the artists credited on a song from its tags, in the order
+// they are credited. Primary artists come from the artist tag, or the
+// ARTISTS tag listing each of them when there is one, and featured
+// artists from "feat." in the artist and title. Metadata is used for
+// the files tags cannot be read from.
+func parseCredits(metadata tag.Metadata, tags audio.Tags) (credits []Credit) {
+	seen := map[string]struct{}{}
+	add := func(role string, names ...string) {
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			key := strings.ToLower(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := seen[key+"\x00"+role]; ok {
+				continue
+			}
+			// featured artists are not also primary
+			if _, ok := seen[key+"\x00"+RoleFeatured]; ok && role == RolePrimary {
+				continue
+			}
+			seen[key+"\x00"+role] = struct{}{}
+			credits = append(credits, Credit{Name: name, Role: role})
+		}
+	}
+
+	artists := tags["artist"]
+	if len(artists) == 0 && metadata.Artist() != "" {
+		artists = []string{metadata.Artist()}
+	}
+	title := tags.Get("title")
+	if title == "" {
+		title = metadata.Title()
+	}
+
+	var primary, featured []string
+	for _, a := range artists {
+		rest, f := splitFeatured(a)
+		primary = append(primary, splitNames(rest)...)
+		featured = append(featured, f...)
+	}
+	_, f := splitFeatured(title)
+	featured = append(featured, f...)
+	if multi := tags["artists"]; len(multi) > 0 {
+		primary = multi
+	}
+
+	composers := tags["composer"]
+	if len(composers) == 0 && metadata.Composer() != "" {
+		composers = []string{metadata.Composer()}
+	}
+
+	add(RoleFeatured, featured...)
+	add(RolePrimary, primary...)
+	add(RoleComposer, splitNames(composers...)...)
+	add(RoleRemixer, splitNames(tags["remixer"]...)...)
+	add(RoleProducer, splitNames(tags["producer"]...)...)
+
+	// primary artists are credited first
+	ordered := make([]Credit, 0, len(credits))
+	for _, role := range []string{RolePrimary, RoleFeatured} {
+		for _, c := range credits {
+			if c.Role == role {
+				ordered = append(ordered, c)
+			}
+		}
+	}
+	for _, c := range credits {
+		if c.Role != RolePrimary && c.Role != RoleFeatured {
+			ordered = append(ordered, c)
+		}
+	}
+
+	return ordered
+}
+
+// setCredits ...
+// Replaces the artists credited on a song, creating any that are new.
+func (wdb *WarblerDB) setCredits(song int64, credits []Credit) error {
+	for i, c := range credits {
+		artist := &Artist{Name: c.Name, MBID: c.mbid}
+		err := wdb.createArtist(artist)
+		if err != nil {
+			return err
+		}
+		credits[i].Artist = artist.ID
+	}
+
+	_, err := wdb.Exec("DELETE FROM music.song_artists WHERE song_id = $1", song)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range credits {
+		_, err = wdb.Exec("INSERT INTO music.song_artists (song_id, artist_id, role, position) "+
+			"VALUES ($1, $2, $3, $4) ON CONFLICT (song_id, artist_id, role) DO NOTHING",
+			song, c.Artist, c.Role, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadCredits ...
+// Fills in the artists credited on songs.
+func (wdb *WarblerDB) loadCredits(songs ...*Song) error {
+	if len(songs) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64][]*Song, len(songs))
+	ids := make([]string, 0, len(songs))
+	for _, s := range songs {
+		s.Artists = []Credit{}
+		if _, ok := byID[s.ID]; !ok {
+			ids = append(ids, strconv.FormatInt(s.ID, 10))
+		}
+		byID[s.ID] = append(byID[s.ID], s)
+	}
+
+	rows, err := wdb.Query("SELECT sa.song_id, artists.id, artists.name, sa.role " +
+		"FROM music.song_artists AS sa JOIN music.artists AS artists ON artists.id = sa.artist_id " +
+		"WHERE sa.song_id IN (" + strings.Join(ids, ", ") + ") ORDER BY sa.song_id, sa.position")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			song int64
+			c    Credit
+		)
+		err = rows.Scan(&song, &c.Artist, &c.Name, &c.Role)
+		if err != nil {
+			return err
+		}
+		for _, s := range byID[song] {
+			s.Artists = append(s.Artists, c)
+		}
+	}
+
+	return rows.Err()
+}
+
+// AppearsOn ...
+// Returns the albums of other artists that an artist is credited on,
+// by release year then title. Only albums the user can see are
+// returned.
+func (wdb *WarblerDB) AppearsOn(artist int64, user *User) (albums []Album, err error) {
+	idx := 2
+	visible, vals := Visible(Album{}, user).where(&idx)
+	rows, err := wdb.Query("SELECT id FROM music.albums WHERE (artist IS NULL OR artist <> $1) AND id IN "+
+		"(SELECT songs.album FROM music.songs AS songs "+
+		"JOIN music.song_artists AS sa ON sa.song_id = songs.id WHERE sa.artist_id = $1) "+
+		"AND "+visible+" ORDER BY release_year, title", append([]interface{}{artist}, vals...)...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	albums = make([]Album, 0, len(ids))
+	for _, id := range ids {
+		album := Album{ID: id}
+		err = wdb.ReadUnique(&album)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+
+	return albums, nil
+}
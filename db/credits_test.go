@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"gitlab.stergianis.ca/michael/warbler/audio"
+)
+
+// testMetadata ...
+// The metadata of a file as read by dhowden/tag, only the fields
+// credits and MusicBrainz ids are read from are set.
+type testMetadata struct {
+	tag.Metadata
+	title, artist, composer string
+	raw                     map[string]interface{}
+}
+
+func (m testMetadata) Title() string               { return m.title }
+func (m testMetadata) Artist() string              { return m.artist }
+func (m testMetadata) Composer() string            { return m.composer }
+func (m testMetadata) Raw() map[string]interface{} { return m.raw }
+
+// TestSplitFeatured ...
+func TestSplitFeatured(t *testing.T) {
+	var tests = []struct {
+		in       string
+		rest     string
+		featured []string
+	}{
+		{"Obey", "Obey", nil},
+		{"Obey (feat. Bart)", "Obey", []string{"Bart"}},
+		{"Obey [ft Bart & Lisa]", "Obey", []string{"Bart", "Lisa"}},
+		{"Obey (with Bart, Lisa and Maggie)", "Obey", []string{"Bart", "Lisa", "Maggie"}},
+		{"Simpsons feat. Bart", "Simpsons", []string{"Bart"}},
+		{"Simpsons Featuring Bart", "Simpsons", []string{"Bart"}},
+		{"Feat of Strength", "Feat of Strength", nil},
+		{"Simpsons ft Bart", "Simpsons ft Bart", nil},
+		{"Obey (Remix)", "Obey (Remix)", nil},
+	}
+
+	for _, test := range tests {
+		rest, featured := splitFeatured(test.in)
+		if rest != test.rest || !reflect.DeepEqual(featured, test.featured) {
+			t.Errorf("splitFeatured(%q): expected %q %q, received %q %q",
+				test.in, test.rest, test.featured, rest, featured)
+		}
+	}
+}
+
+// TestParseCredits ...
+func TestParseCredits(t *testing.T) {
+	var tests = []struct {
+		name     string
+		metadata testMetadata
+		tags     audio.Tags
+		expected []Credit
+	}{
+		{
+			name:     "no artist",
+			metadata: testMetadata{title: "Obey"},
+			tags:     audio.Tags{},
+			expected: []Credit{},
+		},
+		{
+			name:     "metadata",
+			metadata: testMetadata{title: "Obey", artist: "Simpsons", composer: "Danny Elfman"},
+			tags:     audio.Tags{},
+			expected: []Credit{
+				{Name: "Simpsons", Role: RolePrimary},
+				{Name: "Danny Elfman", Role: RoleComposer},
+			},
+		},
+		{
+			name:     "featured in the artist and title",
+			metadata: testMetadata{title: "Obey (feat. Lisa)", artist: "Simpsons feat. Bart"},
+			tags:     audio.Tags{},
+			expected: []Credit{
+				{Name: "Simpsons", Role: RolePrimary},
+				{Name: "Bart", Role: RoleFeatured},
+				{Name: "Lisa", Role: RoleFeatured},
+			},
+		},
+		{
+			name:     "multiple values",
+			metadata: testMetadata{title: "Obey", artist: "Homer; Marge"},
+			tags: audio.Tags{
+				"title":    {"Obey (ft. Bart)"},
+				"artist":   {"Homer", "Marge feat. bart"},
+				"composer": {"Danny Elfman; Alf Clausen"},
+				"remixer":  {"Lisa"},
+				"producer": {"Maggie", "maggie"},
+			},
+			expected: []Credit{
+				{Name: "Homer", Role: RolePrimary},
+				{Name: "Marge", Role: RolePrimary},
+				{Name: "bart", Role: RoleFeatured},
+				{Name: "Danny Elfman", Role: RoleComposer},
+				{Name: "Alf Clausen", Role: RoleComposer},
+				{Name: "Lisa", Role: RoleRemixer},
+				{Name: "Maggie", Role: RoleProducer},
+			},
+		},
+		{
+			name:     "artists tag",
+			metadata: testMetadata{title: "Obey", artist: "Homer & Marge"},
+			tags: audio.Tags{
+				"artist":  {"Homer & Marge"},
+				"artists": {"Homer", "Marge"},
+			},
+			expected: []Credit{
+				{Name: "Homer", Role: RolePrimary},
+				{Name: "Marge", Role: RolePrimary},
+			},
+		},
+		{
+			name:     "featured artist in artists",
+			metadata: testMetadata{title: "Obey (feat. Bart)"},
+			tags: audio.Tags{
+				"artists": {"Simpsons", "Bart"},
+			},
+			expected: []Credit{
+				{Name: "Simpsons", Role: RolePrimary},
+				{Name: "Bart", Role: RoleFeatured},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		credits := parseCredits(test.metadata, test.tags)
+		if !reflect.DeepEqual(credits, test.expected) {
+			t.Errorf("%s: expected %+v, received %+v", test.name, test.expected, credits)
+		}
+	}
+}
+
+// TestAppearsOn ...
+func TestAppearsOn(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		artist   int64
+		expected []int64
+	}{
+		// composer of a song on Sour Soul
+		{1, []int64{2}},
+		{2, []int64{}},
+		{100, []int64{}},
+	}
+
+	for _, test := range tests {
+		albums, err := wdb.AppearsOn(test.artist, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]int64, len(albums))
+		for i, a := range albums {
+			ids[i] = a.ID
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("artist %d: expected albums %v, received %v", test.artist, test.expected, ids)
+		}
+	}
+}
+
+// TestScanLibraryCredits ...
+func TestScanLibraryCredits(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Credits")
+	defer cleanup()
+
+	song, err := ioutil.ReadFile(path.Join(testLib, testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	song = withID3v2(song,
+		id3v2TextFrame("TIT2", "Obey (feat. Lisa)"),
+		id3v2TextFrame("TALB", "Credits"),
+		id3v2TextFrame("TPE1", "Simpsons feat. Bart", "Milhouse"),
+		id3v2TextFrame("TCOM", "Danny Elfman"),
+		id3v2TextFrame("TXXX", "PRODUCER", "Alf Clausen"))
+	file := path.Join(lib.Path, "01 Obey.mp3")
+	err = ioutil.WriteFile(file, song, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func() {
+		t.Helper()
+		stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Errors != 0 {
+			t.Fatalf("unexpected errors scanning: %+v", stats)
+		}
+	}
+	scan()
+
+	songs, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != 1 {
+		t.Fatalf("expected one song, received: %v", songs)
+	}
+	s := Song{ID: songs[0].ID}
+	err = wdb.ReadUnique(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type credit struct{ name, role string }
+	expected := []credit{
+		{"Simpsons", RolePrimary},
+		{"Milhouse", RolePrimary},
+		{"Bart", RoleFeatured},
+		{"Lisa", RoleFeatured},
+		{"Danny Elfman", RoleComposer},
+		{"Alf Clausen", RoleProducer},
+	}
+	received := make([]credit, len(s.Artists))
+	for i, c := range s.Artists {
+		received[i] = credit{c.Name, c.Role}
+		if c.Artist == 0 {
+			t.Errorf("expected %q to be linked to an artist", c.Name)
+		}
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected credits %v, received %v", expected, received)
+	}
+
+	// the artists are removed with the last song crediting them
+	err = os.Remove(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan()
+
+	for _, c := range s.Artists {
+		err = wdb.ReadUnique(&Artist{ID: c.Artist})
+		if err != ErrNotPresent {
+			t.Errorf("expected %q to be removed, received: %v", c.Name, err)
+		}
+	}
+}
@@ -5,30 +5,46 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
-	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dhowden/tag"
+	"gitlab.stergianis.ca/michael/warbler/audio"
+	"gitlab.stergianis.ca/michael/warbler/playlist"
 	// pq is used behind the scenes, but never explicitly used
 	_ "github.com/lib/pq"
 
 	ft "github.com/h2non/filetype"
 )
 
-// TODO: fix update of library to delete old items on update.
-
 // WarblerDB ...
 // A type for interfacing with the warbler db
 type WarblerDB struct {
 	*sql.DB
+	dialect dialect
+
+	// CacheDir is where artwork embedded in songs is extracted to and
+	// resized artwork is kept. Embedded artwork is ignored and artwork
+	// is not resized when it is empty.
+	CacheDir string
+
+	// serializes Create
+	createMu sync.Mutex
+	// serializes linking images to albums
+	imageMu sync.Mutex
+	// serializes resizing artwork
+	resizeMu sync.Mutex
+	// serializes changing the entries of playlists
+	playlistMu sync.Mutex
 }
 
 // check ...
@@ -39,23 +55,98 @@ func check(e error) {
 }
 
 // Open ...
-// Creates the connection to the db as a WarblerDB pointer.
-func Open(connStr string) (*WarblerDB, error) {
-	sqldb, err := sql.Open("postgres", connStr)
+// Creates the connection to the db as a WarblerDB pointer. driver is
+// the name of a supported database/sql driver, either "postgres" or
+// "sqlite3", and dataSource is passed to that driver.
+func Open(driver, dataSource string) (*WarblerDB, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, ErrInvalidDriver
+	}
+
+	if d.driver == sqliteDialect.driver {
+		dataSource = sqliteDataSource(dataSource)
+	}
+
+	sqldb, err := sql.Open(d.sqlDriver, dataSource)
 	if err != nil {
 		return nil, err
 	}
 
 	wdb := &WarblerDB{
-		sqldb,
+		DB:      sqldb,
+		dialect: d,
 	}
 	return wdb, nil
 }
 
-// duration ...
-// Uses ffmpeg to get songs duration.
-func duration(song Song) (d float64, err error) {
-	cmd := exec.Command("ffprobe", song.Path)
+// sqliteDataSource ...
+// Turns on foreign key enforcement for sqlite connections unless the
+// data source already configures it, so that sqlite behaves like
+// postgres.
+func sqliteDataSource(dataSource string) string {
+	if strings.Contains(dataSource, "_foreign_keys=") || strings.Contains(dataSource, "_fk=") {
+		return dataSource
+	}
+	if strings.Contains(dataSource, "?") {
+		return dataSource + "&_foreign_keys=1"
+	}
+	return dataSource + "?_foreign_keys=1"
+}
+
+// Driver ...
+// Returns the name of the database/sql driver in use.
+func (wdb *WarblerDB) Driver() string {
+	return wdb.dialect.driver
+}
+
+// Query ...
+// Rebinds query for the database in use and executes it.
+func (wdb *WarblerDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return wdb.DB.Query(wdb.dialect.rebind(query), args...)
+}
+
+// QueryRow ...
+// Rebinds query for the database in use and executes it.
+func (wdb *WarblerDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return wdb.DB.QueryRow(wdb.dialect.rebind(query), args...)
+}
+
+// Exec ...
+// Rebinds query for the database in use and executes it.
+func (wdb *WarblerDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return wdb.DB.Exec(wdb.dialect.rebind(query), args...)
+}
+
+// Prepare ...
+// Rebinds query for the database in use and prepares it.
+func (wdb *WarblerDB) Prepare(query string) (*sql.Stmt, error) {
+	return wdb.DB.Prepare(wdb.dialect.rebind(query))
+}
+
+// properties ...
+// Reads the properties of a song's audio stream from the headers of
+// its file. For files in formats that cannot be read only the
+// duration is found, using ffprobe if it is installed.
+func properties(song Song) (props audio.Properties, err error) {
+	props, err = audio.ReadFile(song.Path)
+	if err == nil {
+		return props, nil
+	}
+
+	if _, lookErr := exec.LookPath("ffprobe"); lookErr != nil {
+		return props, err
+	}
+
+	props = audio.Properties{}
+	props.Duration, err = ffprobeDuration(song.Path)
+	return props, err
+}
+
+// ffprobeDuration ...
+// Uses ffmpeg to get a file's duration.
+func ffprobeDuration(fsPath string) (d float64, err error) {
+	cmd := exec.Command("ffprobe", fsPath)
 	stderr := bytes.Buffer{}
 	cmd.Stderr = &stderr
 
@@ -114,6 +205,10 @@ func GetValidTable(table string) bool {
 		"music.albums":    empty{},
 		"music.songs":     empty{},
 		"music.libraries": empty{},
+		"music.playlists": empty{},
+
+		"music.smart_playlists": empty{},
+		"music.plays":           empty{},
 
 		// config schema
 		// "config.preferences": empty{},
@@ -176,10 +271,10 @@ func (wdb *WarblerDB) GetLibraries() (libs map[string]Library, err error) {
 
 	// query
 	rows, err := wdb.Query("SELECT id, name, fs_path from " + tableName + " ORDER BY id;")
-	defer rows.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	libs = make(map[string]Library, count)
 	for i := 0; rows.Next(); i++ {
@@ -195,17 +290,33 @@ func (wdb *WarblerDB) GetLibraries() (libs map[string]Library, err error) {
 	return libs, nil
 }
 
-// checkFileType ...
-func fileType(file string) int {
-	buf, err := ioutil.ReadFile(file)
-	check(err)
+// fileType ...
+// Determines the type of a file from its header. Playlists, which are
+// text, are known by their extension.
+func fileType(file string) (int, error) {
+	if _, ok := playlist.FormatOf(file); ok {
+		return playlistType, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return unknownType, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, fileHeaderSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return unknownType, err
+	}
+	buf = buf[:n]
 
 	if ft.IsAudio(buf) {
-		return musicType
+		return musicType, nil
 	} else if ft.IsImage(buf) {
-		return imageType
+		return imageType, nil
 	} else {
-		return unknownType
+		return unknownType, nil
 	}
 }
 
@@ -216,12 +327,19 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
 	metadata, err := tag.ReadFrom(f)
 	if err != nil {
 		return err
 	}
 
+	// tags the metadata reader joins or drops every value but one of
+	// are read again, a tag that cannot be leaves the song credited
+	// from its metadata
+	tags, _ := audio.ReadTags(f)
+	mbids := readMusicBrainzIDs(metadata, tags)
+
 	stats, err := f.Stat()
 	if err != nil {
 		return err
@@ -233,15 +351,11 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 		Size:   stats.Size(),
 		Artist: NewNullString(metadata.Artist()),
 	}
-
-	// Check to see if the song is in the database
-	inLib, err := wdb.songInLibrary(*s, lib)
-	if err != nil {
-		return err
+	if mbids.recording != "" {
+		s.MBID = NewNullString(mbids.recording)
 	}
-
-	if inLib {
-		return nil
+	if year := metadata.Year(); year != 0 {
+		s.Year = NewNullInt64(int64(year))
 	}
 
 	t, nT := metadata.Track()
@@ -254,10 +368,15 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 		}
 	}
 
-	s.Duration, err = duration(*s)
+	props, err := properties(*s)
 	if err != nil {
 		return err
 	}
+	if props.Codec != "" {
+		s.setProperties(props)
+	} else {
+		s.Duration = props.Duration
+	}
 
 	// add genre information
 	genre := &Genre{
@@ -274,9 +393,12 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 	artist := &Artist{
 		Name: metadata.AlbumArtist(),
 	}
+	if mbids.albumArtist != "" {
+		artist.MBID = NewNullString(mbids.albumArtist)
+	}
 	if artist.Name != "" {
-		err = wdb.Create(artist, []string{"id"})
-		if err != nil && err != ErrAlreadyExists {
+		err = wdb.createArtist(artist)
+		if err != nil {
 			return err
 		}
 	}
@@ -296,6 +418,12 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 		NumDisks:  s.NumDisks,
 		Title:     metadata.Album(),
 	}
+	if mbids.release != "" {
+		album.MBID = NewNullString(mbids.release)
+	}
+	if mbids.releaseGroup != "" {
+		album.ReleaseGroup = NewNullString(mbids.releaseGroup)
+	}
 
 	err = wdb.Create(album, []string{"id"})
 	if err != nil && err != ErrAlreadyExists {
@@ -314,8 +442,39 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 		}
 	}
 
-	err = wdb.Create(s, []string{"id"})
-	if err != nil && err != ErrAlreadyExists {
+	// a song already at this path has changed on disk, update it in
+	// place so it keeps its id. Every column read from the file is
+	// written, so tags removed from it are cleared.
+	var songID int64
+	err = wdb.QueryRow("SELECT id FROM music.songs WHERE fs_path = $1", s.Path).Scan(&songID)
+	switch {
+	case err == sql.ErrNoRows:
+		s.Added = NewNullInt64(time.Now().Unix())
+		err = wdb.Create(s, []string{"id"})
+		if err != nil && err != ErrAlreadyExists {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		s.ID = songID
+		_, err = wdb.Exec("UPDATE music.songs SET album = $1, genre = $2, title = $3, song_size = $4, duration = $5, "+
+			"track = $6, num_tracks = $7, disk = $8, num_disks = $9, artist = $10, release_year = $11, "+
+			"codec = $12, container = $13, bitrate = $14, vbr = $15, sample_rate = $16, bit_depth = $17, "+
+			"channels = $18, lossless = $19, mbid = $20 WHERE id = $21",
+			s.Album, s.Genre, s.Title, s.Size, s.Duration,
+			s.Track, s.NumTracks, s.Disk, s.NumDisks, s.Artist, s.Year,
+			s.Codec, s.Container, s.Bitrate, s.VBR, s.SampleRate, s.BitDepth,
+			s.Channels, s.Lossless, s.MBID, songID)
+		if err != nil {
+			return err
+		}
+	}
+
+	credits := parseCredits(metadata, tags)
+	mbids.setArtistIDs(credits)
+	err = wdb.setCredits(s.ID, credits)
+	if err != nil {
 		return err
 	}
 
@@ -324,6 +483,13 @@ func (wdb *WarblerDB) processMedia(fsPath string, lib Library) (err error) {
 		return err
 	}
 
+	if album.ID != 0 {
+		err = wdb.addAlbumImages(album.ID, s.Path, metadata.Picture())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -377,18 +543,20 @@ func (wdb *WarblerDB) GetSongsInLibrary(lib Library) (songs []Song, err error) {
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for idx := 0; rows.Next(); idx++ {
-		var s Song
-		err = rows.Scan(&s.ID)
+		err = rows.Scan(&songs[idx].ID)
 		if err != nil {
 			return nil, err
 		}
+	}
+	rows.Close()
 
-		err := wdb.ReadUnique(&s)
+	for idx := range songs {
+		err := wdb.ReadUnique(&songs[idx])
 		if err != nil {
 			return nil, err
 		}
-		songs[idx] = s
 	}
 
 	return songs, nil
@@ -410,6 +578,7 @@ func (wdb *WarblerDB) addSongToLibrary(song Song, lib Library) error {
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
 	_, err = stmt.Exec(&song.ID, &lib.ID)
 	if err != nil {
@@ -419,56 +588,6 @@ func (wdb *WarblerDB) addSongToLibrary(song Song, lib Library) error {
 	return nil
 }
 
-// addImageFile ...
-func (wdb *WarblerDB) addImageFile(fsPath string) {
-
-}
-
-// ScanLibrary ...
-// Scans the library. If some media is already in the library, it will not add it again.
-func (wdb *WarblerDB) ScanLibrary(lib Library) (err error) {
-	walkFn := func(fsPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Encountered the following error while traversing %q: %v", fsPath, err)
-			return err
-		}
-		if info.IsDir() {
-			return err
-		}
-		switch fileType(fsPath) {
-		case musicType:
-			{
-				err = wdb.processMedia(fsPath, lib)
-				if err != nil {
-					log.Printf("%v", err)
-				}
-			}
-		case imageType:
-			wdb.addImageFile(fsPath)
-		}
-		return err
-	}
-
-	err = filepath.Walk(lib.Path, walkFn)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// ScanLibraries ...
-// Scans all available libraries
-func (wdb *WarblerDB) ScanLibraries() {
-	libs, err := wdb.GetLibraries()
-
-	check(err)
-
-	for _, lib := range libs {
-		wdb.ScanLibrary(lib)
-	}
-}
-
 // NewFromQueryable ...
 func NewFromQueryable(q Queryable) Queryable {
 	t := reflect.TypeOf(q)
@@ -488,13 +607,19 @@ func NewFromInterface(i interface{}) interface{} {
 }
 
 // ConvertTags ...
+// Converts tags with a converter, keeping the - of those in descending
+// order.
 func ConvertTags(tags []string, converter map[string]string) (convertedTags []string, err error) {
 	convertedTags = make([]string, len(tags))
 	for i, tag := range tags {
+		tag, desc := orderColumn(tag)
 		convT, ok := converter[tag]
-		if !ok {
+		if !ok || tag == "-" || tag == "" {
 			return nil, ErrInvalidTag
 		}
+		if desc {
+			convT = "-" + convT
+		}
 		convertedTags[i] = convT
 	}
 	return convertedTags, nil
@@ -546,6 +671,10 @@ func GetTableFromType(q interface{}) (table string, ok bool) {
 		reflect.TypeOf(&Album{}):   "music.albums",
 		reflect.TypeOf(&Song{}):    "music.songs",
 
+		reflect.TypeOf(&Playlist{}):      "music.playlists",
+		reflect.TypeOf(&SmartPlaylist{}): "music.smart_playlists",
+		reflect.TypeOf(&Play{}):          "music.plays",
+
 		reflect.TypeOf(&SongInLibrary{}): "music.songs_in_library",
 		reflect.TypeOf(&ImageInAlbum{}):  "music.images_in_album",
 	}
@@ -555,6 +684,14 @@ func GetTableFromType(q interface{}) (table string, ok bool) {
 	return table, ok
 }
 
+// isColumn ...
+// Reports whether a struct field is stored in a column. Exported
+// fields without an sql tag are filled some other way.
+func isColumn(f reflect.StructField) bool {
+	_, ok := f.Tag.Lookup("sql")
+	return ok && f.PkgPath == ""
+}
+
 // prepareDest ...
 func prepareDest(rdest reflect.Value) (destArr []interface{}) {
 	if rdest.Kind() == reflect.Ptr {
@@ -562,7 +699,7 @@ func prepareDest(rdest reflect.Value) (destArr []interface{}) {
 	}
 	destArr = make([]interface{}, 0)
 	for i := 0; i < rdest.NumField(); i++ {
-		if rdest.Field(i).CanInterface() {
+		if isColumn(rdest.Type().Field(i)) {
 			destArr = append(destArr, rdest.Field(i).Addr().Interface())
 		}
 	}
@@ -599,53 +736,73 @@ func querySelection(rQuery reflect.Value) (query string, values []interface{}, e
 	return query, values, nil
 }
 
-// prepareQuery ...
-func prepareQuery(table string, rQuery reflect.Value, orderBy []string) (query string, vals []interface{}, err error) {
+// queryFilter ...
+// Returns the filter of the fields of a query with a value, each equal
+// to it.
+func queryFilter(rQuery reflect.Value) Filter {
 	rType := rQuery.Type()
-	vals = make([]interface{}, 0)
+	filter := AllOf{}
+	for i := 0; i < rQuery.NumField(); i++ {
+		f := rQuery.Field(i)
+		// if corresponding value is a non zero value, use it as part
+		// of the "where query"
+		if isColumn(rType.Field(i)) && !IsZero(f) {
+			filter = append(filter, Condition{rType.Field(i).Tag.Get("sql"), OpEqual, f.Interface()})
+		}
+	}
+	return filter
+}
+
+// prepareQuery ...
+func prepareQuery(table string, rType reflect.Type, filter Filter, orderBy []string, page Page) (query string, vals []interface{}, err error) {
 	selectQ := "SELECT "
 	fromQ := "FROM " + table + " "
-	whereQ := "WHERE "
+	whereQ := ""
 
 	// selection
-	idx := 1
-	for i := 0; i < rQuery.NumField(); i++ {
-		f := rQuery.Field(i)
-		if tag, ok := rType.Field(i).Tag.Lookup("sql"); ok {
-			// add tag to selection query
-			selectQ += tag + " "
-			if i < rQuery.NumField()-1 {
-				selectQ += ", "
-			}
-
-			// if corresponding value is a non zero value, use it as
-			// part of the "where query"
-			if !IsZero(f) {
-				vals = append(vals, f.Interface())
-				if idx > 1 {
-					whereQ += "AND "
-				}
-				whereQ += tag + " = " + fmt.Sprintf("$%d", idx) + " "
-				idx++
-			}
+	var columns []string
+	for i := 0; i < rType.NumField(); i++ {
+		if isColumn(rType.Field(i)) {
+			columns = append(columns, rType.Field(i).Tag.Get("sql"))
 		}
 	}
-	if len(vals) < 1 {
-		// no where clause necessary if no data provided
-		whereQ = ""
+	selectQ += strings.Join(columns, ", ") + " "
+
+	// no where clause necessary if there is nothing to filter by
+	if all, ok := filter.(AllOf); !ok || len(all) > 0 {
+		idx := 1
+		var where string
+		where, vals = filter.where(&idx)
+		whereQ = "WHERE " + where + " "
 	}
 
+	// nulls are ordered last, then first when descending, the same
+	// in every database
 	orderQuery := ""
 	if len(orderBy) > 0 {
 		orderQuery += "ORDER BY "
 		for i, tag := range orderBy {
-			orderQuery += tag
+			column, desc := orderColumn(tag)
+			direction := ""
+			if desc {
+				direction = " DESC"
+			}
+			if isNullable(rType, column) {
+				orderQuery += column + " IS NULL" + direction + ", "
+			}
+			orderQuery += column + direction
 			if i < len(orderBy)-1 {
 				orderQuery += ", "
 			}
 		}
+		orderQuery += " "
 	}
-	query = selectQ + fromQ + whereQ + orderQuery + ";"
+
+	pageQuery := ""
+	if page.Limit > 0 {
+		pageQuery = fmt.Sprintf("LIMIT %d OFFSET %d", page.Limit, page.Offset)
+	}
+	query = selectQ + fromQ + whereQ + orderQuery + pageQuery + ";"
 	return query, vals, nil
 }
 
@@ -656,14 +813,14 @@ func prepareUniqueQuery(table string, rquery reflect.Value) (query string, args
 	}
 	rqueryT := rquery.Type()
 
-	selections := make([]string, rquery.NumField())
+	selections := make([]string, 0, rquery.NumField())
 	args = make([]interface{}, 1)
 	args[0] = rquery.FieldByName("ID").Interface()
 
 	for i := 0; i < rquery.NumField(); i++ {
 		f := rqueryT.Field(i)
-		if tag, ok := f.Tag.Lookup("sql"); ok {
-			selections[i] = tag
+		if isColumn(f) {
+			selections = append(selections, f.Tag.Get("sql"))
 		}
 	}
 
@@ -698,6 +855,9 @@ func (wdb *WarblerDB) ReadUnique(query Queryable) (err error) {
 		return err
 	}
 
+	if song, ok := query.(*Song); ok {
+		return wdb.loadCredits(song)
+	}
 	return nil
 }
 
@@ -708,26 +868,97 @@ func (wdb *WarblerDB) ReadUnique(query Queryable) (err error) {
 // Order by is optional. You must provide the sql names, you can use
 // the provided tag conversion functions to convert from json or
 // edn. If you pass an empty array it will be ignored. Otherwise it
-// will pass the column names to the sql service.
+// will pass the column names to the sql service, those prefixed by -
+// in descending order.
 func (wdb *WarblerDB) Read(queryType interface{}, orderBy []string) ([]interface{}, error) {
+	rQuery := reflect.ValueOf(queryType)
+	if rQuery.Kind() == reflect.Ptr {
+		rQuery = rQuery.Elem()
+	}
+	return wdb.ReadFilter(queryType, queryFilter(rQuery), orderBy)
+}
 
-	table, ok := GetTableFromType(queryType)
-	if !ok {
-		return nil, ErrInvalidTable
+// ReadFilter ...
+// Searches the database like Read for the items of the query type
+// meeting a filter, regardless of the values of the query's fields.
+func (wdb *WarblerDB) ReadFilter(queryType interface{}, filter Filter, orderBy []string) ([]interface{}, error) {
+	return wdb.ReadPage(queryType, filter, orderBy, Page{})
+}
+
+// loadResultCredits ...
+// Fills in the credits of the songs read for a query type.
+func (wdb *WarblerDB) loadResultCredits(queryType interface{}, results []interface{}) ([]interface{}, error) {
+	// songs are returned with their credits, results are all of the
+	// same type
+	switch queryType.(type) {
+	case Song, *Song:
+	default:
+		return results, nil
+	}
+	songs := make([]*Song, len(results))
+	for i, r := range results {
+		song := r.(Song)
+		songs[i] = &song
+	}
+	err := wdb.loadCredits(songs...)
+	if err != nil {
+		return nil, err
 	}
+	for i, song := range songs {
+		results[i] = *song
+	}
+
+	return results, nil
+}
 
+// read ...
+// Searches the database like Read, without filling in the fields
+// that are not columns.
+func (wdb *WarblerDB) read(queryType interface{}, orderBy []string) ([]interface{}, error) {
 	rQuery := reflect.ValueOf(queryType)
 	if rQuery.Kind() == reflect.Ptr {
 		rQuery = rQuery.Elem()
 	}
-	rType := rQuery.Type()
+	return wdb.readPage(queryType, queryFilter(rQuery), orderBy, Page{})
+}
+
+// readPage ...
+// Searches the database like ReadPage, without filling in the fields
+// that are not columns.
+func (wdb *WarblerDB) readPage(queryType interface{}, filter Filter, orderBy []string, page Page) ([]interface{}, error) {
+	table, ok := GetTableFromType(queryType)
+	if !ok {
+		return nil, ErrInvalidTable
+	}
 
-	query, vals, err := prepareQuery(table, rQuery, orderBy)
+	rType := reflect.TypeOf(queryType)
+	if rType.Kind() == reflect.Ptr {
+		rType = rType.Elem()
+	}
+
+	if !page.isZero() {
+		if page.Limit < 0 || page.Offset < 0 || (page.Offset > 0 && page.Limit == 0) {
+			return nil, ErrInvalidPage
+		}
+		orderBy = pageOrder(rType, orderBy)
+	}
+	if page.After != nil {
+		if len(page.After) != len(orderBy) {
+			return nil, ErrInvalidCursor
+		}
+		filter = AllOf{filter, afterFilter(rType, orderBy, page.After)}
+	}
+
+	query, vals, err := prepareQuery(table, rType, filter, orderBy, page)
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := wdb.Query(query, vals...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var results = []interface{}{}
 	for rows.Next() {
@@ -736,12 +967,15 @@ func (wdb *WarblerDB) Read(queryType interface{}, orderBy []string) ([]interface
 
 		destArr := prepareDest(r)
 
-		rows.Scan(destArr...)
+		err = rows.Scan(destArr...)
+		if err != nil {
+			return nil, err
+		}
 
 		results = append(results, r.Interface())
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
 // setMissingValues is a helper function when creating a new row in
@@ -762,7 +996,7 @@ func setMissingValues(src interface{}, dest interface{}) error {
 	for i := 0; i < s.NumField(); i++ {
 		sf := s.Field(i)
 		df := d.Field(i)
-		if df.CanInterface() && sf.CanInterface() {
+		if isColumn(s.Type().Field(i)) {
 			if df.Interface() != sf.Interface() {
 				df.Set(sf)
 			}
@@ -776,20 +1010,39 @@ func setMissingValues(src interface{}, dest interface{}) error {
 // string, in which case it will return nothing. Otherwise it must be
 // a valid interfaceable field for the query type and it will be
 // placed into that query and returned.
+//
+// Create is safe for concurrent use, the lookup and insert are done
+// while holding a lock so that two callers creating the same item
+// cannot both insert it.
 func (wdb *WarblerDB) Create(query interface{}, returning []string) (err error) {
-	// check for existence
-	results, err := wdb.Read(query, []string{})
-	if err != nil {
-		return
-	}
-	// got more than one result, non unique information provided
-	if len(results) > 1 {
-		return ErrNonUnique{query}
-	}
-	// got exactly one, probable match, return
-	if len(results) == 1 {
-		setMissingValues(results[0], query)
-		return ErrAlreadyExists
+	wdb.createMu.Lock()
+	defer wdb.createMu.Unlock()
+
+	if id, ok := query.(musicBrainzIdentified); ok && id.musicBrainzID().Valid {
+		// records with a MusicBrainz id are the same record only when
+		// their ids are
+		found, err := wdb.findIdentified(query)
+		if err != nil {
+			return err
+		}
+		if found {
+			return ErrAlreadyExists
+		}
+	} else {
+		// check for existence
+		results, err := wdb.read(query, []string{})
+		if err != nil {
+			return err
+		}
+		// got more than one result, non unique information provided
+		if len(results) > 1 {
+			return ErrNonUnique{query}
+		}
+		// got exactly one, probable match, return
+		if len(results) == 1 {
+			setMissingValues(results[0], query)
+			return ErrAlreadyExists
+		}
 	}
 
 	// make a map of sql tags to sql tags to make lookup easy
@@ -812,25 +1065,18 @@ func (wdb *WarblerDB) Create(query interface{}, returning []string) (err error)
 
 	insertVals := make([]interface{}, 0)
 	returnVal := make([]interface{}, 0)
+	returnCols := make([]string, 0)
 	insertQ := "INSERT INTO " + table + " ("
 	valueQ := "VALUES ("
 
-	var returningQ string
-	if len(returning) > 0 {
-		returningQ += " RETURNING "
-	}
-
 	valNum := 1
 	for i := 0; i < rQuery.NumField(); i++ {
 		f := rQuery.Field(i)
 		if _, ok := returnTags[rType.Field(i).Tag.Get("sql")]; ok {
 			returnVal = append(returnVal, f.Addr().Interface())
-			returningQ += rType.Field(i).Tag.Get("sql")
-			if len(returnVal) < len(returning) {
-				returningQ += ", "
-			}
+			returnCols = append(returnCols, rType.Field(i).Tag.Get("sql"))
 		}
-		if !IsZero(f) && f.CanInterface() {
+		if isColumn(rType.Field(i)) && !IsZero(f) {
 			// insert the field name
 			if len(insertVals) > 0 {
 				insertQ += ", "
@@ -845,22 +1091,32 @@ func (wdb *WarblerDB) Create(query interface{}, returning []string) (err error)
 	insertQ += ") "
 	valueQ += ")"
 
-	q := insertQ + valueQ + returningQ
-	row := wdb.QueryRow(q, insertVals...)
+	q := insertQ + valueQ
 
-	if len(returnVal) > 0 {
-		err = row.Scan(returnVal...)
-	} else {
-		err = row.Scan()
-		if err == sql.ErrNoRows {
-			err = nil
-		}
+	if len(returnVal) == 0 {
+		_, err = wdb.Exec(q, insertVals...)
+		return err
+	}
+
+	if wdb.dialect.returning {
+		q += " RETURNING " + strings.Join(returnCols, ", ")
+		return wdb.QueryRow(q, insertVals...).Scan(returnVal...)
 	}
+
+	// without RETURNING, read the requested columns back from the
+	// row that was just inserted
+	res, err := wdb.Exec(q, insertVals...)
 	if err != nil {
-		return
+		return err
 	}
 
-	return nil
+	rowID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	q = "SELECT " + strings.Join(returnCols, ", ") + " FROM " + table + " WHERE rowid = $1"
+	return wdb.QueryRow(q, rowID).Scan(returnVal...)
 }
 
 func setString(statementNum int, set reflect.Value) (int, string, []interface{}) {
@@ -868,7 +1124,7 @@ func setString(statementNum int, set reflect.Value) (int, string, []interface{})
 	setVals := make([]interface{}, 0)
 	for i := 0; i < set.NumField(); i++ {
 		f := set.Field(i)
-		if f.CanInterface() && !IsZero(f) {
+		if isColumn(set.Type().Field(i)) && !IsZero(f) {
 			tag := set.Type().Field(i).Tag.Get("sql")
 			if len(setVals) > 0 {
 				setStr += ", "
@@ -888,7 +1144,7 @@ func whereString(statementNum int, where reflect.Value) (int, string, []interfac
 
 	for i := 0; i < where.NumField(); i++ {
 		f := where.Field(i)
-		if f.CanInterface() && !IsZero(f) {
+		if isColumn(where.Type().Field(i)) && !IsZero(f) {
 			tag := where.Type().Field(i).Tag.Get("sql")
 			if len(whereVals) > 0 {
 				whereStr += " AND "
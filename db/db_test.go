@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -19,7 +21,6 @@ var (
 
 const (
 	testLibName = "Test"
-	dbName      = "warbler_test"
 	testSongLoc = "Simpsons/Thermo/"
 	testSong    = "Simpsons/Thermo/01 Obey.mp3"
 )
@@ -54,8 +55,11 @@ func prepareTestLibrary() {
 }
 
 func TestMain(m *testing.M) {
-	var err error
-	wdb, err = Open("dbname=" + dbName + " user=warbler sslmode=disable")
+	var (
+		err     error
+		cleanup func()
+	)
+	wdb, cleanup, err = OpenTestDatabase()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -65,9 +69,15 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	wdb.Close()
+	cleanup()
+	os.Exit(code)
 }
 
+// badbadnotgood is the credit of the BADBADNOTGOOD fixture songs.
+var badbadnotgood = []Credit{{Artist: 1, Name: "BADBADNOTGOOD", Role: RolePrimary}}
+
 // TestCountTable ...
 func TestCountTable(t *testing.T) {
 	prepareDB()
@@ -101,7 +111,7 @@ func TestAddLibrary(t *testing.T) {
 		t.Error(err)
 	}
 
-	row := wdb.QueryRow("SELECT libraries.name, libraries.fs_path FROM music.libraries WHERE (libraries.name = $1)",
+	row := wdb.QueryRow("SELECT name, fs_path FROM music.libraries WHERE (name = $1)",
 		expected.Name)
 
 	var result Library
@@ -213,20 +223,24 @@ func TestDuration(t *testing.T) {
 	prepareDB()
 	prepareTestLibrary()
 
-	expectedDuration := 3.46
+	// the audio between the ID3v2 and ID3v1 tags at 128 kbit/s
+	expectedDuration := 3.448125
 
 	song := Song{
 		Path: path.Join(testLib, testSong),
 	}
 
-	d, err := duration(song)
+	props, err := properties(song)
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	if d != expectedDuration {
-		t.Error("unexpected return value")
+	if props.Duration != expectedDuration {
+		t.Errorf("unexpected duration\n\texpected: %v\n\treceived: %v", expectedDuration, props.Duration)
+	}
+	if props.Codec != "mp3" || props.Bitrate != 128000 || props.SampleRate != 44100 || props.Channels != 2 {
+		t.Errorf("unexpected stream properties: %+v", props)
 	}
 }
 
@@ -267,7 +281,7 @@ func TestScanLibrary(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = wdb.ScanLibrary(libs[testLibName])
+	_, err = wdb.ScanLibrary(context.Background(), libs[testLibName], ScanOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -282,16 +296,30 @@ func TestScanLibrary(t *testing.T) {
 	}
 
 	expectedSong := Song{ID: 10001,
-		Album: NullInt64{NullInt64: sql.NullInt64{10001, true}},
-		Genre: NullInt64{NullInt64: sql.NullInt64{0, false}},
-		Path:  path.Join(testLib, testSong), Title: "Obey", Size: 56417, Duration: 3.46,
-		Track:     NullInt64{NullInt64: sql.NullInt64{1, true}},
-		NumTracks: NullInt64{NullInt64: sql.NullInt64{1, true}},
-		Disk:      NullInt64{NullInt64: sql.NullInt64{0, false}},
-		NumDisks:  NullInt64{NullInt64: sql.NullInt64{0, false}},
-		Artist:    NullString{NullString: sql.NullString{"Simpsons", true}}}
-
-	if songs[0] != expectedSong {
+		Album: NullInt64{NullInt64: sql.NullInt64{Int64: 10001, Valid: true}},
+		Genre: NullInt64{NullInt64: sql.NullInt64{Int64: 0, Valid: false}},
+		Path:  path.Join(testLib, testSong), Title: "Obey", Size: 56417, Duration: 3.448125,
+		Track:      NullInt64{NullInt64: sql.NullInt64{Int64: 1, Valid: true}},
+		NumTracks:  NullInt64{NullInt64: sql.NullInt64{Int64: 1, Valid: true}},
+		Disk:       NullInt64{NullInt64: sql.NullInt64{Int64: 0, Valid: false}},
+		NumDisks:   NullInt64{NullInt64: sql.NullInt64{Int64: 0, Valid: false}},
+		Artist:     NullString{NullString: sql.NullString{String: "Simpsons", Valid: true}},
+		Codec:      NewNullString("mp3"),
+		Container:  NewNullString("mp3"),
+		Bitrate:    NewNullInt64(128000),
+		VBR:        NewNullBool(false),
+		SampleRate: NewNullInt64(44100),
+		Channels:   NewNullInt64(2),
+		Lossless:   NewNullBool(false),
+		Artists:    []Credit{{Artist: 10001, Name: "Simpsons", Role: RolePrimary}}}
+
+	// songs are added when they are first scanned
+	if !songs[0].Added.Valid || time.Since(time.Unix(songs[0].Added.Int64, 0)) > time.Minute {
+		t.Errorf("expected the song to have just been added, received %v", songs[0].Added)
+	}
+	expectedSong.Added = songs[0].Added
+
+	if !reflect.DeepEqual(songs[0], expectedSong) {
 		t.Errorf("unexpected song parsed\n\texpected: %v\n\tresult: %v\n", expectedSong, songs[0])
 	}
 
@@ -306,11 +334,11 @@ func TestQuerySelection(t *testing.T) {
 		nullValues []sql.Scanner
 		err        error
 	}{
-		{reflect.ValueOf(&Artist{}), "SELECT id, name",
+		{reflect.ValueOf(&Artist{}), "SELECT id, name, mbid",
 			[]interface{}{
 				new(int64),
 				new(string),
-				new(string),
+				new(NullString),
 			},
 			[]sql.Scanner{
 				&sql.NullInt64{},
@@ -360,6 +388,7 @@ func TestGetUniqueItem(t *testing.T) {
 	verify := Artist{
 		ID:   1,
 		Name: "BADBADNOTGOOD",
+		MBID: NewNullString("0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"),
 	}
 
 	err := wdb.ReadUnique(query)
@@ -389,20 +418,33 @@ func TestRead(t *testing.T) {
 					Track: NewNullInt64(1), NumTracks: NewNullInt64(20),
 					Disk: NewNullInt64(1), NumDisks: NewNullInt64(1),
 					Size: 204192, Duration: 1993,
-					Artist: NewNullString("BADBADNOTGOOD")},
+					Artist:  NewNullString("BADBADNOTGOOD"),
+					Year:    NewNullInt64(2011),
+					Artists: badbadnotgood,
+					Codec:   NewNullString("flac"), Container: NewNullString("flac"),
+					Bitrate: NewNullInt64(2304000), VBR: NewNullBool(false),
+					SampleRate: NewNullInt64(96000), BitDepth: NewNullInt64(24),
+					Channels: NewNullInt64(2), Lossless: NewNullBool(true),
+					MBID:  NewNullString("6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09"),
+					Plays: 2, LastPlayed: NewNullInt64(1580602200)},
 				Song{ID: 5, Album: NewNullInt64(1), Genre: NewNullInt64(1),
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/02 Triangle.mp3",
 					Title: "Triangle",
 					Size:  204299, Duration: 1999,
 					Track: NewNullInt64(2), NumTracks: NewNullInt64(20),
 					Disk: NewNullInt64(1), NumDisks: NewNullInt64(1),
-					Artist: NewNullString("BADBADNOTGOOD")},
+					Artist:  NewNullString("BADBADNOTGOOD"),
+					Year:    NewNullInt64(2011),
+					Artists: badbadnotgood,
+					Plays:   1, LastPlayed: NewNullInt64(1580515800)},
 				Song{ID: 6, Album: NewNullInt64(1), Genre: NewNullInt64(1),
 					Path:     "/home/test/Music/BADBADNOTGOOD/III/04 Something.mp3",
 					Title:    "Something",
 					Size:     91841,
 					Duration: 9381,
-					Artist:   NewNullString("BADBADNOTGOOD")}}},
+					Artist:   NewNullString("BADBADNOTGOOD"),
+					Year:     NewNullInt64(2011),
+					Artists:  badbadnotgood}}},
 
 		// order by single element
 		{"lookup albums by album-artist", Album{Artist: NewNullInt64(1)}, []string{"num_tracks"},
@@ -412,7 +454,10 @@ func TestRead(t *testing.T) {
 					Duration: NewNullFloat64(1688), Title: "IV"},
 				Album{ID: 1, Artist: NewNullInt64(1), Year: NewNullInt64(2011),
 					NumTracks: NewNullInt64(20), NumDisks: NewNullInt64(1),
-					Duration: NewNullFloat64(1688), Title: "III"},
+					Duration: NewNullFloat64(1688), Title: "III",
+					BlurHash:     NewNullString("LEHV6nWB2yk8pyo0adR*.7kCMdnj"),
+					MBID:         NewNullString("4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56"),
+					ReleaseGroup: NewNullString("9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21")},
 			},
 		},
 
@@ -425,13 +470,17 @@ func TestRead(t *testing.T) {
 					Duration: NewNullFloat64(1688), Title: "IV"},
 				Album{ID: 1, Artist: NewNullInt64(1), Year: NewNullInt64(2011),
 					NumTracks: NewNullInt64(20), NumDisks: NewNullInt64(1),
-					Duration: NewNullFloat64(1688), Title: "III"},
+					Duration: NewNullFloat64(1688), Title: "III",
+					BlurHash:     NewNullString("LEHV6nWB2yk8pyo0adR*.7kCMdnj"),
+					MBID:         NewNullString("4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56"),
+					ReleaseGroup: NewNullString("9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21")},
 				Album{ID: 4, Artist: NewNullInt64(4), Year: NewNullInt64(1985),
 					NumTracks: NewNullInt64(13), NumDisks: NewNullInt64(1),
 					Duration: NewNullFloat64(1756), Title: "Rust in Peace"},
 				Album{ID: 2, Artist: NewNullInt64(2), Year: NewNullInt64(2001),
 					NumTracks: NewNullInt64(10), NumDisks: NewNullInt64(1),
-					Duration: NewNullFloat64(1800), Title: "Sour Soul"},
+					Duration: NewNullFloat64(1800), Title: "Sour Soul",
+					BlurHash: NewNullString("LKO2?U%2Tw=w]~RBVZRi};RPxuwH")},
 				Album{ID: 3, Artist: NewNullInt64(3), Year: NewNullInt64(1980),
 					NumTracks: NewNullInt64(8), NumDisks: NewNullInt64(1),
 					Duration: NewNullFloat64(15440), Title: "Killers"},
@@ -442,7 +491,10 @@ func TestRead(t *testing.T) {
 			[]interface{}{
 				Album{ID: 1, Artist: NewNullInt64(1), Year: NewNullInt64(2011),
 					NumTracks: NewNullInt64(20), NumDisks: NewNullInt64(1),
-					Duration: NewNullFloat64(1688), Title: "III"},
+					Duration: NewNullFloat64(1688), Title: "III",
+					BlurHash:     NewNullString("LEHV6nWB2yk8pyo0adR*.7kCMdnj"),
+					MBID:         NewNullString("4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56"),
+					ReleaseGroup: NewNullString("9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21")},
 				Album{ID: 5, Artist: NewNullInt64(1), Year: NewNullInt64(2012),
 					NumTracks: NewNullInt64(19), NumDisks: NewNullInt64(1),
 					Duration: NewNullFloat64(1688), Title: "IV"},
@@ -451,24 +503,47 @@ func TestRead(t *testing.T) {
 					Duration: NewNullFloat64(1756), Title: "Rust in Peace"},
 				Album{ID: 2, Artist: NewNullInt64(2), Year: NewNullInt64(2001),
 					NumTracks: NewNullInt64(10), NumDisks: NewNullInt64(1),
-					Duration: NewNullFloat64(1800), Title: "Sour Soul"},
+					Duration: NewNullFloat64(1800), Title: "Sour Soul",
+					BlurHash: NewNullString("LKO2?U%2Tw=w]~RBVZRi};RPxuwH")},
 				Album{ID: 3, Artist: NewNullInt64(3), Year: NewNullInt64(1980),
 					NumTracks: NewNullInt64(8), NumDisks: NewNullInt64(1),
 					Duration: NewNullFloat64(15440), Title: "Killers"},
 			}},
 
+		// technical properties
+		{"lookup lossless songs, order by bitrate", Song{Lossless: NewNullBool(true)}, []string{"bitrate"},
+			[]interface{}{
+				Song{ID: 1, Album: NewNullInt64(1), Genre: NewNullInt64(1),
+					Path:  "/home/test/Music/BADBADNOTGOOD/III/01 In the Night.mp3",
+					Title: "In the Night",
+					Track: NewNullInt64(1), NumTracks: NewNullInt64(20),
+					Disk: NewNullInt64(1), NumDisks: NewNullInt64(1),
+					Size: 204192, Duration: 1993,
+					Artist:  NewNullString("BADBADNOTGOOD"),
+					Year:    NewNullInt64(2011),
+					Artists: badbadnotgood,
+					Codec:   NewNullString("flac"), Container: NewNullString("flac"),
+					Bitrate: NewNullInt64(2304000), VBR: NewNullBool(false),
+					SampleRate: NewNullInt64(96000), BitDepth: NewNullInt64(24),
+					Channels: NewNullInt64(2), Lossless: NewNullBool(true),
+					MBID:  NewNullString("6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09"),
+					Plays: 2, LastPlayed: NewNullInt64(1580602200)},
+			}},
+
 		{"lookup songs by size and genre, order by id",
 			Song{Size: 91841, Genre: NewNullInt64(1)}, []string{"id"},
 			[]interface{}{
-				Song{ID: 6, Album: NullInt64{sql.NullInt64{1, true}},
-					Genre: NullInt64{sql.NullInt64{1, true}},
+				Song{ID: 6, Album: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Genre: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/04 Something.mp3",
 					Title: "Something", Size: 91841, Duration: 9381,
-					Track:     NullInt64{sql.NullInt64{0, false}},
-					NumTracks: NullInt64{sql.NullInt64{0, false}},
-					Disk:      NullInt64{sql.NullInt64{0, false}},
-					NumDisks:  NullInt64{sql.NullInt64{0, false}},
-					Artist:    NullString{sql.NullString{"BADBADNOTGOOD", true}}},
+					Track:     NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					NumTracks: NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					Disk:      NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					NumDisks:  NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					Artist:    NullString{sql.NullString{String: "BADBADNOTGOOD", Valid: true}},
+					Year:      NewNullInt64(2011),
+					Artists:   badbadnotgood},
 			}},
 	}
 
@@ -486,7 +561,7 @@ func TestRead(t *testing.T) {
 			}
 
 			for i := range results {
-				if test.answer[i] != results[i] {
+				if !reflect.DeepEqual(test.answer[i], results[i]) {
 					t.Error(fmt.Errorf("test %s failed\n\t%9s %+v\n\t%-9s %+v",
 						test.name, "expected:", test.answer[i], "result:", results[i]))
 				}
@@ -587,7 +662,7 @@ func TestAddItem(t *testing.T) {
 		// reflection is the only way to compare these as they are pointers
 		rQ := reflect.ValueOf(test.query)
 		rA := reflect.ValueOf(test.answer)
-		if rQ.Elem().Interface() != rA.Elem().Interface() {
+		if !reflect.DeepEqual(rQ.Elem().Interface(), rA.Elem().Interface()) {
 			t.Errorf("test case %d failed:\n\texpected: %v\n\tresult:   %v\n", testCase, test.answer, test.query)
 		}
 	}
@@ -608,15 +683,23 @@ func TestUpdate(t *testing.T) {
 			Song{ID: 1},
 			1,
 			[]interface{}{
-				Song{ID: 1, Album: NullInt64{sql.NullInt64{1, true}},
-					Genre: NullInt64{sql.NullInt64{1, true}},
+				Song{ID: 1, Album: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Genre: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/01 In the Night.mp3",
 					Title: "My Knight", Size: 204192, Duration: 1993,
-					Track:     NullInt64{sql.NullInt64{1, true}},
-					NumTracks: NullInt64{sql.NullInt64{20, true}},
-					Disk:      NullInt64{sql.NullInt64{1, true}},
-					NumDisks:  NullInt64{sql.NullInt64{1, true}},
-					Artist:    NullString{sql.NullString{"BADBADNOTGOOD", true}}},
+					Track:     NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					NumTracks: NullInt64{sql.NullInt64{Int64: 20, Valid: true}},
+					Disk:      NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					NumDisks:  NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Artist:    NullString{sql.NullString{String: "BADBADNOTGOOD", Valid: true}},
+					Year:      NewNullInt64(2011),
+					Artists:   badbadnotgood,
+					Codec:     NewNullString("flac"), Container: NewNullString("flac"),
+					Bitrate: NewNullInt64(2304000), VBR: NewNullBool(false),
+					SampleRate: NewNullInt64(96000), BitDepth: NewNullInt64(24),
+					Channels: NewNullInt64(2), Lossless: NewNullBool(true),
+					MBID:  NewNullString("6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09"),
+					Plays: 2, LastPlayed: NewNullInt64(1580602200)},
 			}},
 
 		{"update multiple fields", Song{NumTracks: NewNullInt64(20), Track: NewNullInt64(4)},
@@ -624,15 +707,17 @@ func TestUpdate(t *testing.T) {
 			Song{Size: 91841, Genre: NewNullInt64(1)},
 			1,
 			[]interface{}{
-				Song{ID: 6, Album: NullInt64{sql.NullInt64{1, true}},
-					Genre: NullInt64{sql.NullInt64{1, true}},
+				Song{ID: 6, Album: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Genre: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/04 Something.mp3",
 					Title: "Something", Size: 91841, Duration: 9381,
-					Track:     NullInt64{sql.NullInt64{4, true}},
-					NumTracks: NullInt64{sql.NullInt64{20, true}},
-					Disk:      NullInt64{sql.NullInt64{0, false}},
-					NumDisks:  NullInt64{sql.NullInt64{0, false}},
-					Artist:    NullString{sql.NullString{"BADBADNOTGOOD", true}}},
+					Track:     NullInt64{sql.NullInt64{Int64: 4, Valid: true}},
+					NumTracks: NullInt64{sql.NullInt64{Int64: 20, Valid: true}},
+					Disk:      NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					NumDisks:  NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					Artist:    NullString{sql.NullString{String: "BADBADNOTGOOD", Valid: true}},
+					Year:      NewNullInt64(2011),
+					Artists:   badbadnotgood},
 			}},
 
 		{"update multiple songs' artist using artist as query", Song{Artist: NewNullString("BED BED NUT GUD")},
@@ -640,33 +725,46 @@ func TestUpdate(t *testing.T) {
 			Song{Artist: NewNullString("BED BED NUT GUD")},
 			3,
 			[]interface{}{
-				Song{ID: 1, Album: NullInt64{sql.NullInt64{1, true}},
-					Genre: NullInt64{sql.NullInt64{1, true}},
+				Song{ID: 1, Album: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Genre: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/01 In the Night.mp3",
 					Title: "In the Night", Size: 204192, Duration: 1993,
-					Track:     NullInt64{sql.NullInt64{1, true}},
-					NumTracks: NullInt64{sql.NullInt64{20, true}},
-					Disk:      NullInt64{sql.NullInt64{1, true}},
-					NumDisks:  NullInt64{sql.NullInt64{1, true}},
-					Artist:    NullString{sql.NullString{"BED BED NUT GUD", true}}},
-				Song{ID: 5, Album: NullInt64{sql.NullInt64{1, true}},
-					Genre: NullInt64{sql.NullInt64{1, true}},
+					Track:     NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					NumTracks: NullInt64{sql.NullInt64{Int64: 20, Valid: true}},
+					Disk:      NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					NumDisks:  NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Artist:    NullString{sql.NullString{String: "BED BED NUT GUD", Valid: true}},
+					Year:      NewNullInt64(2011),
+					Artists:   badbadnotgood,
+					Codec:     NewNullString("flac"), Container: NewNullString("flac"),
+					Bitrate: NewNullInt64(2304000), VBR: NewNullBool(false),
+					SampleRate: NewNullInt64(96000), BitDepth: NewNullInt64(24),
+					Channels: NewNullInt64(2), Lossless: NewNullBool(true),
+					MBID:  NewNullString("6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09"),
+					Plays: 2, LastPlayed: NewNullInt64(1580602200)},
+				Song{ID: 5, Album: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Genre: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/02 Triangle.mp3",
 					Title: "Triangle", Size: 204299, Duration: 1999,
-					Track:     NullInt64{sql.NullInt64{2, true}},
-					NumTracks: NullInt64{sql.NullInt64{20, true}},
-					Disk:      NullInt64{sql.NullInt64{1, true}},
-					NumDisks:  NullInt64{sql.NullInt64{1, true}},
-					Artist:    NullString{sql.NullString{"BED BED NUT GUD", true}}},
-				Song{ID: 6, Album: NullInt64{sql.NullInt64{1, true}},
-					Genre: NullInt64{sql.NullInt64{1, true}},
+					Track:     NullInt64{sql.NullInt64{Int64: 2, Valid: true}},
+					NumTracks: NullInt64{sql.NullInt64{Int64: 20, Valid: true}},
+					Disk:      NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					NumDisks:  NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Artist:    NullString{sql.NullString{String: "BED BED NUT GUD", Valid: true}},
+					Year:      NewNullInt64(2011),
+					Artists:   badbadnotgood,
+					Plays:     1, LastPlayed: NewNullInt64(1580515800)},
+				Song{ID: 6, Album: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					Genre: NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
 					Path:  "/home/test/Music/BADBADNOTGOOD/III/04 Something.mp3",
 					Title: "Something", Size: 91841, Duration: 9381,
-					Track:     NullInt64{sql.NullInt64{0, false}},
-					NumTracks: NullInt64{sql.NullInt64{0, false}},
-					Disk:      NullInt64{sql.NullInt64{0, false}},
-					NumDisks:  NullInt64{sql.NullInt64{0, false}},
-					Artist:    NullString{sql.NullString{"BED BED NUT GUD", true}}}},
+					Track:     NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					NumTracks: NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					Disk:      NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					NumDisks:  NullInt64{sql.NullInt64{Int64: 0, Valid: false}},
+					Artist:    NullString{sql.NullString{String: "BED BED NUT GUD", Valid: true}},
+					Year:      NewNullInt64(2011),
+					Artists:   badbadnotgood}},
 		},
 	}
 
@@ -692,7 +790,7 @@ func TestUpdate(t *testing.T) {
 			}
 
 			for i := range result {
-				if result[i] != test.answer[i] {
+				if !reflect.DeepEqual(result[i], test.answer[i]) {
 					t.Errorf("result %d did not match answer\n\texpected: %v\n\treceived: %v\n",
 						i, test.answer[i], result[i])
 				}
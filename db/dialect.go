@@ -0,0 +1,99 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Queries in this package are written for postgres: schema qualified
+// table names and numbered $n placeholders. Before a query is sent to
+// the database it is rebound for the dialect of the driver in use.
+
+var (
+	placeholderRe = regexp.MustCompile(`\$([0-9]+)`)
+	tableRe       = regexp.MustCompile(`\b(?:music|config)\.[a-z_]+\b`)
+)
+
+// dialect ...
+// Describes the differences between the supported sql backends.
+type dialect struct {
+	// name of the database/sql driver
+	driver string
+
+	// sqlDriver is the database/sql driver opened for driver, sqlite
+	// connections are opened with the functions search needs
+	sqlDriver string
+
+	// returning is true when the backend supports INSERT ... RETURNING
+	returning bool
+
+	// placeholder formats the nth bind parameter
+	placeholder func(n int) string
+
+	// table formats a schema qualified table name
+	table func(name string) string
+
+	// fold formats the accent and case folded form of a column that
+	// searches are matched against
+	fold func(column string) string
+
+	// wordMatch formats the condition that a search, in a parameter,
+	// is similar enough to the words of a folded column
+	wordMatch func(param, column string) string
+
+	// searchSetup is run in the transaction of a search before it,
+	// when not empty
+	searchSetup string
+}
+
+var (
+	postgresDialect = dialect{
+		driver:      "postgres",
+		sqlDriver:   "postgres",
+		returning:   true,
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		table:       func(name string) string { return name },
+
+		// the <% operator can use the trigram indexes of the folded
+		// columns, its threshold is set for the search
+		fold:        func(column string) string { return "music.search_text(" + column + ")" },
+		wordMatch:   func(param, column string) string { return param + " <% " + column },
+		searchSetup: fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %g", searchThreshold),
+	}
+
+	// sqlite has no schemas, so tables are named after the postgres
+	// table, dot included, and must always be quoted.
+	sqliteDialect = dialect{
+		driver:      "sqlite3",
+		sqlDriver:   sqliteSearchDriver,
+		returning:   false,
+		placeholder: func(n int) string { return fmt.Sprintf("?%d", n) },
+		table:       func(name string) string { return `"` + name + `"` },
+
+		fold: func(column string) string { return "search_text(" + column + ")" },
+		wordMatch: func(param, column string) string {
+			return fmt.Sprintf("word_similarity(%s, %s) >= %g", param, column, searchThreshold)
+		},
+	}
+
+	dialects = map[string]dialect{
+		postgresDialect.driver: postgresDialect,
+		sqliteDialect.driver:   sqliteDialect,
+	}
+)
+
+// rebind ...
+// Converts a postgres style query into the form expected by the dialect.
+func (d dialect) rebind(query string) string {
+	if d.driver == postgresDialect.driver {
+		return query
+	}
+
+	query = placeholderRe.ReplaceAllStringFunc(query, func(p string) string {
+		var n int
+		fmt.Sscanf(p, "$%d", &n)
+		return d.placeholder(n)
+	})
+
+	return tableRe.ReplaceAllStringFunc(query, d.table)
+}
@@ -0,0 +1,35 @@
+package db
+
+import "testing"
+
+// TestRebind ...
+func TestRebind(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dialect  dialect
+		query    string
+		expected string
+	}{
+		{"postgres unchanged", postgresDialect,
+			"SELECT id FROM music.songs WHERE fs_path = $1",
+			"SELECT id FROM music.songs WHERE fs_path = $1"},
+		{"sqlite placeholders and tables", sqliteDialect,
+			"SELECT COUNT(1) FROM music.songs_in_library where song_id = $1 AND library_id = $2;",
+			`SELECT COUNT(1) FROM "music.songs_in_library" where song_id = ?1 AND library_id = ?2;`},
+		{"sqlite repeated placeholder", sqliteDialect,
+			"UPDATE config.users SET user_name = $2 WHERE id = $1 OR preference_id = $1",
+			`UPDATE "config.users" SET user_name = ?2 WHERE id = ?1 OR preference_id = ?1`},
+		{"sqlite qualified columns untouched", sqliteDialect,
+			"SELECT songs.id FROM music.songs AS songs",
+			`SELECT songs.id FROM "music.songs" AS songs`},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.dialect.rebind(test.query)
+			if result != test.expected {
+				t.Errorf("unexpected rebind\n\texpected: %s\n\treceived: %s", test.expected, result)
+			}
+		})
+	}
+}
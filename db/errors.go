@@ -3,6 +3,7 @@ package db
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -35,6 +36,110 @@ var (
 	// ErrInvalidScanner is returned when given an unkown type to
 	// create a sql.Scanner object.
 	ErrInvalidScanner = errors.New("wdb: invalid type given to ValueToScanner")
+
+	// ErrInvalidDriver is returned when opening a database with an
+	// unsupported driver.
+	ErrInvalidDriver = errors.New("wdb: unsupported database driver")
+
+	// ErrSchemaOutdated is returned when the database has not had
+	// every migration applied.
+	ErrSchemaOutdated = errors.New("wdb: database schema is out of date, run migrate up")
+
+	// ErrIrreversibleMigration is returned when reverting a migration
+	// that has no down migration.
+	ErrIrreversibleMigration = errors.New("wdb: migration cannot be reverted")
+
+	// ErrInvalidMBID is returned when looking up something that is not
+	// a MusicBrainz id.
+	ErrInvalidMBID = errors.New("wdb: invalid MusicBrainz id")
+
+	// ErrInvalidPage is returned when reading a page with a negative
+	// limit or offset, or an offset without a limit.
+	ErrInvalidPage = errors.New("wdb: invalid page")
+
+	// ErrInvalidCursor is returned when reading from a cursor that was
+	// not made by Cursor for the same order.
+	ErrInvalidCursor = errors.New("wdb: invalid cursor")
+
+	// ErrInvalidUserName is returned when creating a user without a
+	// name.
+	ErrInvalidUserName = errors.New("wdb: user name cannot be empty")
+
+	// ErrInvalidPassword is returned when creating a user with a
+	// password that is too short or too long.
+	ErrInvalidPassword = fmt.Errorf("wdb: password must be %d to %d bytes long", MinPasswordLength, MaxPasswordLength)
+
+	// ErrUserExists is returned when creating a user with the name of
+	// another.
+	ErrUserExists = errors.New("wdb: a user with that name already exists")
+
+	// ErrInvalidCredentials is returned when logging in with a user
+	// name or password that is wrong.
+	ErrInvalidCredentials = errors.New("wdb: invalid user name or password")
+
+	// ErrInvalidSession is returned for a session token that was never
+	// issued, was logged out of or has expired.
+	ErrInvalidSession = errors.New("wdb: invalid or expired session")
+
+	// ErrInvalidTokenName is returned when creating an API token
+	// without a name.
+	ErrInvalidTokenName = errors.New("wdb: API token name cannot be empty")
+
+	// ErrInvalidScope is returned when creating an API token with a
+	// scope other than read, stream or admin.
+	ErrInvalidScope = errors.New("wdb: API token scope must be read, stream or admin")
+
+	// ErrInvalidPlaylistName is returned when creating or renaming a
+	// playlist without a name.
+	ErrInvalidPlaylistName = errors.New("wdb: playlist name cannot be empty")
+
+	// ErrInvalidSharing is returned when sharing a playlist other than
+	// privately, read only or collaboratively.
+	ErrInvalidSharing = errors.New("wdb: playlist sharing must be private, read or collaborative")
+
+	// ErrInvalidOrder is returned when reordering a playlist by entries
+	// that are not in it or are given twice.
+	ErrInvalidOrder = errors.New("wdb: playlist order must list each entry of it at most once")
+
+	// ErrNoPlaylistOwner is returned when importing a playlist file
+	// while there is no admin to own it.
+	ErrNoPlaylistOwner = errors.New("wdb: no admin to own imported playlists")
+
+	// ErrInvalidSmartSharing is returned when sharing a smart playlist
+	// collaboratively, its songs are those of its rules.
+	ErrInvalidSmartSharing = errors.New("wdb: smart playlist sharing must be private or read")
+
+	// ErrInvalidSongOrder is returned when ordering a smart playlist by
+	// something other than song fields or random.
+	ErrInvalidSongOrder = errors.New("wdb: smart playlist order must be song fields or random")
+
+	// ErrInvalidSongLimit is returned when limiting a smart playlist to
+	// fewer than one song.
+	ErrInvalidSongLimit = errors.New("wdb: smart playlist limit must be at least one song")
+
+	// ErrInvalidPlayTime is returned when recording a play that has not
+	// happened yet.
+	ErrInvalidPlayTime = errors.New("wdb: plays cannot be in the future")
+
+	// ErrInvalidPlayDuration is returned when recording a play lasting
+	// less than no time.
+	ErrInvalidPlayDuration = errors.New("wdb: play duration cannot be negative")
+
+	// ErrInvalidPlayGroup is returned when counting plays of something
+	// other than songs, albums, artists or genres.
+	ErrInvalidPlayGroup = errors.New("wdb: plays are counted by songs, albums, artists or genres")
+
+	// ErrInvalidPeriod is returned when summing listening time over
+	// something other than weeks or months.
+	ErrInvalidPeriod = errors.New("wdb: listening time is summed by week or month")
+
+	// ErrInvalidScrobbler is returned when forwarding plays to a service
+	// other than ListenBrainz or Last.fm.
+	ErrInvalidScrobbler = errors.New("wdb: plays are forwarded to listenbrainz or lastfm")
+
+	// ErrInvalidScrobbleToken is returned when forwarding plays to a
+	// service without a token.
+	ErrInvalidScrobbleToken = errors.New("wdb: scrobbler token cannot be empty")
 )
 
 // ErrNonUnique occurs When non unique information is given for a
@@ -49,3 +154,49 @@ func (e ErrNonUnique) Error() string {
 	}
 	return "wdb: information given for query was non-unique"
 }
+
+// ErrInvalidMigration occurs when a migration built into the binary
+// is misnamed or incomplete.
+type ErrInvalidMigration struct {
+	Name string
+}
+
+func (e ErrInvalidMigration) Error() string {
+	return fmt.Sprintf("wdb: invalid migration %q", e.Name)
+}
+
+// ErrMigrationFailed occurs when the sql of a migration could not be
+// executed. The migration is rolled back.
+type ErrMigrationFailed struct {
+	Version int64
+	Err     error
+}
+
+func (e ErrMigrationFailed) Error() string {
+	return fmt.Sprintf("wdb: migration %d failed: %v", e.Version, e.Err)
+}
+
+// ErrInvalidFilter occurs when the data of a filter names a field that
+// cannot be filtered on or cannot be compared to its values.
+type ErrInvalidFilter struct {
+	Field  string
+	Reason string
+}
+
+func (e ErrInvalidFilter) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("wdb: invalid filter on %q: %s", e.Field, e.Reason)
+	}
+	return "wdb: invalid filter: " + e.Reason
+}
+
+// ErrInvalidInclude occurs when including records that are not related
+// to those of a type.
+type ErrInvalidInclude struct {
+	Type string
+	Name string
+}
+
+func (e ErrInvalidInclude) Error() string {
+	return fmt.Sprintf("wdb: cannot include %q with %s records", e.Name, strings.ToLower(e.Type))
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"os"
+)
+
+// fileState ...
+// The size, modification time and inode of a file when it was last
+// scanned. A file whose state has not changed since the last scan of
+// its library is not read again.
+type fileState struct {
+	LibraryID int64  `sql:"library_id"`
+	Path      string `sql:"fs_path"`
+	Size      int64  `sql:"file_size"` // bytes
+	ModTime   int64  `sql:"mod_time"`  // nanoseconds since the unix epoch
+	Inode     int64  `sql:"inode"`
+	FileType  int    `sql:"file_type"`
+}
+
+// newFileState ...
+// Creates the state of a file from its os.FileInfo.
+func newFileState(lib Library, fsPath string, info os.FileInfo) fileState {
+	return fileState{
+		LibraryID: lib.ID,
+		Path:      fsPath,
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		Inode:     inode(info),
+	}
+}
+
+// unchanged ...
+// Reports whether the file described by s is the same as it was when
+// prev was recorded.
+func (s fileState) unchanged(prev fileState) bool {
+	return s.Size == prev.Size && s.ModTime == prev.ModTime && s.Inode == prev.Inode
+}
+
+// fileStates ...
+// Returns the recorded state of every file in a library by path.
+func (wdb *WarblerDB) fileStates(lib Library) (states map[string]fileState, err error) {
+	rows, err := wdb.Query("SELECT library_id, fs_path, file_size, mod_time, inode, file_type "+
+		"FROM music.file_states WHERE library_id = $1", lib.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states = map[string]fileState{}
+	for rows.Next() {
+		var s fileState
+		err = rows.Scan(&s.LibraryID, &s.Path, &s.Size, &s.ModTime, &s.Inode, &s.FileType)
+		if err != nil {
+			return nil, err
+		}
+		states[s.Path] = s
+	}
+
+	return states, rows.Err()
+}
+
+// saveFileState ...
+// Records the state of a file, replacing any previous state.
+func (wdb *WarblerDB) saveFileState(s fileState) error {
+	_, err := wdb.Exec("INSERT INTO music.file_states "+
+		"(library_id, fs_path, file_size, mod_time, inode, file_type) VALUES ($1, $2, $3, $4, $5, $6) "+
+		"ON CONFLICT (library_id, fs_path) DO UPDATE SET "+
+		"file_size = excluded.file_size, mod_time = excluded.mod_time, "+
+		"inode = excluded.inode, file_type = excluded.file_type",
+		s.LibraryID, s.Path, s.Size, s.ModTime, s.Inode, s.FileType)
+	return err
+}
+
+// deleteFileState ...
+// Forgets the state of a file.
+func (wdb *WarblerDB) deleteFileState(lib Library, fsPath string) error {
+	_, err := wdb.Exec("DELETE FROM music.file_states WHERE library_id = $1 AND fs_path = $2", lib.ID, fsPath)
+	return err
+}
@@ -0,0 +1,386 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operators a Condition compares a column to its value with.
+const (
+	OpEqual        = "="
+	OpNotEqual     = "!="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLike         = "like"   // a pattern, % and _ are wildcards
+	OpPrefix       = "prefix" // text the column starts with
+	OpIn           = "in"     // a list of values
+	OpNull         = "null"   // true for null, false for not null
+	OpWithin       = "within" // days before now, of seconds since the unix epoch
+)
+
+// Keys of the data given to ParseFilter that combine filters rather
+// than name a field.
+const (
+	filterOr  = "or"
+	filterNot = "not"
+)
+
+// Filter ...
+// A condition the records read by ReadFilter meet.
+type Filter interface {
+	// where formats the condition, numbering its parameters from
+	// *idx on, and returns their values
+	where(idx *int) (string, []interface{})
+}
+
+// AllOf ...
+// A filter met by records meeting all of its filters, every record
+// when there are none.
+type AllOf []Filter
+
+// AnyOf ...
+// A filter met by records meeting any of its filters, no record when
+// there are none.
+type AnyOf []Filter
+
+// Not ...
+// A filter met by records that do not meet its filter.
+type Not struct {
+	Filter Filter
+}
+
+// Condition ...
+// A filter comparing a column to a value with one of the operators.
+// A nil value is null, equal only to null.
+type Condition struct {
+	Column string
+	Op     string
+	Value  interface{} // a []interface{} for OpIn, a bool for OpNull
+}
+
+// combine ...
+// Joins the conditions of filters with an sql operator.
+func combine(filters []Filter, op string, idx *int) (string, []interface{}) {
+	if len(filters) == 1 {
+		return filters[0].where(idx)
+	}
+	conditions := make([]string, len(filters))
+	var vals []interface{}
+	for i, f := range filters {
+		c, v := f.where(idx)
+		conditions[i] = "(" + c + ")"
+		vals = append(vals, v...)
+	}
+	return strings.Join(conditions, " "+op+" "), vals
+}
+
+func (f AllOf) where(idx *int) (string, []interface{}) {
+	if len(f) == 0 {
+		return "1 = 1", nil
+	}
+	return combine(f, "AND", idx)
+}
+
+func (f AnyOf) where(idx *int) (string, []interface{}) {
+	if len(f) == 0 {
+		return "1 = 0", nil
+	}
+	return combine(f, "OR", idx)
+}
+
+func (f Not) where(idx *int) (string, []interface{}) {
+	c, vals := f.Filter.where(idx)
+	return "NOT (" + c + ")", vals
+}
+
+func (c Condition) where(idx *int) (string, []interface{}) {
+	param := func() string {
+		p := fmt.Sprintf("$%d", *idx)
+		*idx++
+		return p
+	}
+
+	switch {
+	case c.Op == OpEqual && c.Value == nil:
+		return c.Column + " IS NULL", nil
+	case c.Op == OpNotEqual && c.Value == nil:
+		return c.Column + " IS NOT NULL", nil
+	case c.Op == OpNull:
+		if c.Value == true {
+			return c.Column + " IS NULL", nil
+		}
+		return c.Column + " IS NOT NULL", nil
+	case c.Op == OpNotEqual:
+		return c.Column + " <> " + param(), []interface{}{c.Value}
+	case c.Op == OpLike:
+		return "LOWER(" + c.Column + ") LIKE LOWER(" + param() + `) ESCAPE '\'`, []interface{}{c.Value}
+	case c.Op == OpPrefix:
+		prefix := likeEscaper.Replace(fmt.Sprint(c.Value)) + "%"
+		return "LOWER(" + c.Column + ") LIKE LOWER(" + param() + `) ESCAPE '\'`, []interface{}{prefix}
+	case c.Op == OpIn:
+		values, _ := c.Value.([]interface{})
+		if len(values) == 0 {
+			return "1 = 0", nil
+		}
+		params := make([]string, len(values))
+		for i := range values {
+			params[i] = param()
+		}
+		return c.Column + " IN (" + strings.Join(params, ", ") + ")", values
+	default:
+		return c.Column + " " + c.Op + " " + param(), []interface{}{c.Value}
+	}
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// filterField ...
+// A field of a record that can be filtered on.
+type filterField struct {
+	column string
+	t      reflect.Type
+}
+
+// ParseFilter ...
+// Builds a filter from data decoded from edn or json into an
+// interface{}. data is a map of the fields of queryType, named by tag,
+// to the value they equal or to a map of operators to their values,
+// all of which must be met. The "or" key holds a list of such maps,
+// any of which must be met, and "not" a map that must not be.
+//
+//	{"year": {">=": 1990, "<": 2000}, "or": [{"genre": 1}, {"genre": null}]}
+//
+// Times are seconds since the unix epoch, within compares them to a
+// number of days before the filter is parsed.
+//
+// Fields are checked against ValidFields and must be columns.
+func ParseFilter(tag string, queryType interface{}, data interface{}) (Filter, error) {
+	valid, err := ValidFields(tag, queryType)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]filterField{}
+	qType := reflect.TypeOf(queryType)
+	if qType.Kind() == reflect.Ptr {
+		qType = qType.Elem()
+	}
+	for i := 0; i < qType.NumField(); i++ {
+		f := qType.Field(i)
+		name := f.Tag.Get(tag)
+		if _, ok := valid[name]; ok && name != "-" && isColumn(f) {
+			fields[name] = filterField{f.Tag.Get("sql"), f.Type}
+		}
+	}
+
+	return parseFilter(fields, data)
+}
+
+// parseFilter ...
+func parseFilter(fields map[string]filterField, data interface{}) (Filter, error) {
+	m, err := filterMap(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// sorted so that the same data always makes the same query
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	filter := AllOf{}
+	for _, k := range keys {
+		v := m[k]
+		switch k {
+		case filterOr:
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, ErrInvalidFilter{k, "expected a list of filters"}
+			}
+			anyOf := AnyOf{}
+			for _, d := range list {
+				f, err := parseFilter(fields, d)
+				if err != nil {
+					return nil, err
+				}
+				anyOf = append(anyOf, f)
+			}
+			filter = append(filter, anyOf)
+		case filterNot:
+			f, err := parseFilter(fields, v)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, Not{f})
+		default:
+			field, ok := fields[k]
+			if !ok {
+				return nil, ErrInvalidFilter{k, "no such field"}
+			}
+			conditions, err := parseConditions(field, k, v)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, conditions...)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseConditions ...
+// Parses the value a field is filtered by, either a value it equals or
+// a map of operators to values.
+func parseConditions(field filterField, name string, v interface{}) ([]Filter, error) {
+	ops, err := filterMap(v)
+	if err != nil {
+		ops = map[string]interface{}{OpEqual: v}
+	}
+
+	var conditions []Filter
+	for op, v := range ops {
+		var err error
+		switch op {
+		case OpEqual, OpNotEqual:
+			if v != nil {
+				v, err = filterValue(field.t, v)
+			}
+		case OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+			v, err = filterValue(field.t, v)
+		case OpLike, OpPrefix:
+			if filterKind(field.t) != reflect.String {
+				return nil, ErrInvalidFilter{name, op + " needs a text field"}
+			}
+			v, err = filterValue(field.t, v)
+		case OpIn:
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, ErrInvalidFilter{name, "in needs a list of values"}
+			}
+			values := make([]interface{}, len(list))
+			for i, item := range list {
+				values[i], err = filterValue(field.t, item)
+				if err != nil {
+					break
+				}
+			}
+			v = values
+		case OpNull:
+			if _, ok := v.(bool); !ok {
+				return nil, ErrInvalidFilter{name, "null needs true or false"}
+			}
+		case OpWithin:
+			// the time is that of the parse, so stored filters are
+			// relative to when they are read
+			if filterKind(field.t) != reflect.Int64 {
+				return nil, ErrInvalidFilter{name, "within needs an integer field"}
+			}
+			v, err = filterValue(reflect.TypeOf(float64(0)), v)
+			if err == nil {
+				op = OpGreaterEqual
+				v = time.Now().Unix() - int64(v.(float64)*24*60*60)
+			}
+		default:
+			return nil, ErrInvalidFilter{name, fmt.Sprintf("unknown operator %q", op)}
+		}
+		if err != nil {
+			return nil, ErrInvalidFilter{name, err.Error()}
+		}
+		conditions = append(conditions, Condition{field.column, op, v})
+	}
+
+	// sorted so that the same data always makes the same query
+	sort.Slice(conditions, func(i, j int) bool {
+		return conditions[i].(Condition).Op < conditions[j].(Condition).Op
+	})
+	return conditions, nil
+}
+
+// filterMap ...
+// Returns a decoded map with its keys as strings. edn keys are
+// keywords, json keys are strings.
+func filterMap(data interface{}) (map[string]interface{}, error) {
+	rData := reflect.ValueOf(data)
+	if rData.Kind() != reflect.Map {
+		return nil, ErrInvalidFilter{Reason: fmt.Sprintf("expected a map, received %T", data)}
+	}
+
+	m := make(map[string]interface{}, rData.Len())
+	for _, k := range rData.MapKeys() {
+		key := k
+		if key.Kind() == reflect.Interface {
+			key = key.Elem()
+		}
+		if key.Kind() != reflect.String {
+			return nil, ErrInvalidFilter{Reason: fmt.Sprintf("expected a field name, received %v", k)}
+		}
+		m[key.String()] = rData.MapIndex(k).Interface()
+	}
+	return m, nil
+}
+
+// filterKind ...
+// Returns the kind of the values of a field, those of the nullable
+// types being the kind they hold.
+func filterKind(t reflect.Type) reflect.Kind {
+	switch t {
+	case reflect.TypeOf(NullInt64{}):
+		return reflect.Int64
+	case reflect.TypeOf(NullFloat64{}):
+		return reflect.Float64
+	case reflect.TypeOf(NullString{}):
+		return reflect.String
+	case reflect.TypeOf(NullBool{}):
+		return reflect.Bool
+	}
+	return t.Kind()
+}
+
+// filterValue ...
+// Converts a decoded value to the one compared to a field of type t.
+// json decodes every number as a float64, which integer fields accept
+// when it is whole.
+func filterValue(t reflect.Type, v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("expected a value, received null")
+	}
+
+	switch kind := filterKind(t); kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Float32, reflect.Float64:
+			if f := rv.Float(); f == math.Trunc(f) {
+				return int64(f), nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), nil
+		case reflect.Float32, reflect.Float64:
+			return rv.Float(), nil
+		}
+	case reflect.String:
+		if rv.Kind() == reflect.String {
+			return rv.String(), nil
+		}
+	case reflect.Bool:
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("expected a value of kind %v, received %#v", filterKind(t), v)
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"olympos.io/encoding/edn"
+)
+
+// TestParseFilter ...
+func TestParseFilter(t *testing.T) {
+	var tests = []struct {
+		tag, data string
+		where     string
+		vals      []interface{}
+		err       error
+	}{
+		{"json", `{}`, "1 = 1", nil, nil},
+		{"json", `{"title": "", "year": 0}`,
+			"(title = $1) AND (release_year = $2)", []interface{}{"", int64(0)}, nil},
+		{"edn", `{:year {:>= 1990 :< 2000}}`,
+			"(release_year < $1) AND (release_year >= $2)", []interface{}{int64(2000), int64(1990)}, nil},
+		{"json", `{"duration": {">": 1700}, "blurhash": null}`,
+			"(blurhash IS NULL) AND (duration > $1)", []interface{}{float64(1700)}, nil},
+		{"edn", `{:mbid {:null false :!= "x"}}`,
+			"(mbid <> $1) AND (mbid IS NOT NULL)", []interface{}{"x"}, nil},
+		{"json", `{"title": {"like": "k%s"}}`,
+			`LOWER(title) LIKE LOWER($1) ESCAPE '\'`, []interface{}{"k%s"}, nil},
+		{"json", `{"title": {"prefix": "100%_"}}`,
+			`LOWER(title) LIKE LOWER($1) ESCAPE '\'`, []interface{}{`100\%\_%`}, nil},
+		{"edn", `{:id {:in [1 2.0 3]}}`,
+			"id IN ($1, $2, $3)", []interface{}{int64(1), int64(2), int64(3)}, nil},
+		{"json", `{"id": {"in": []}}`, "1 = 0", nil, nil},
+		{"edn", `{:or [{:artist 1} {:not {:title "III"}}]}`,
+			"(artist = $1) OR (NOT (title = $2))", []interface{}{int64(1), "III"}, nil},
+		{"json", `{"or": []}`, "1 = 0", nil, nil},
+
+		{"json", `[]`, "", nil, ErrInvalidFilter{Reason: "expected a map, received []interface {}"}},
+		{"json", `{"name": "III"}`, "", nil, ErrInvalidFilter{"name", "no such field"}},
+		{"json", `{"year": {"between": [1990, 2000]}}`, "", nil, ErrInvalidFilter{"year", `unknown operator "between"`}},
+		{"json", `{"year": {"like": "19%"}}`, "", nil, ErrInvalidFilter{"year", "like needs a text field"}},
+		{"json", `{"year": 1990.5}`, "", nil, ErrInvalidFilter{"year", "expected a value of kind int64, received 1990.5"}},
+		{"json", `{"year": {"<": null}}`, "", nil, ErrInvalidFilter{"year", "expected a value, received null"}},
+		{"json", `{"id": {"in": 1}}`, "", nil, ErrInvalidFilter{"id", "in needs a list of values"}},
+		{"json", `{"mbid": {"null": "yes"}}`, "", nil, ErrInvalidFilter{"mbid", "null needs true or false"}},
+		{"json", `{"or": {"id": 1}}`, "", nil, ErrInvalidFilter{"or", "expected a list of filters"}},
+		{"json", `{"title": {"within": 30}}`, "", nil, ErrInvalidFilter{"title", "within needs an integer field"}},
+	}
+
+	decoders := map[string]func([]byte, interface{}) error{
+		"edn":  edn.Unmarshal,
+		"json": json.Unmarshal,
+	}
+
+	for _, test := range tests {
+		var data interface{}
+		err := decoders[test.tag]([]byte(test.data), &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := ParseFilter(test.tag, Album{}, data)
+		if err != test.err {
+			t.Errorf("%s: expected error %v, received %v", test.data, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		idx := 1
+		where, vals := filter.where(&idx)
+		if where != test.where || !reflect.DeepEqual(vals, test.vals) {
+			t.Errorf("%s: expected %s %v, received %s %v", test.data, test.where, test.vals, where, vals)
+		}
+	}
+}
+
+// TestParseWithin ...
+func TestParseWithin(t *testing.T) {
+	before := time.Now().Unix()
+	filter, err := ParseFilter("json", Song{}, map[string]interface{}{"added": map[string]interface{}{"within": 1.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := 1
+	where, vals := filter.where(&idx)
+	if where != "added_at >= $1" || len(vals) != 1 {
+		t.Fatalf("expected a condition on the time added, received %s %v", where, vals)
+	}
+	// a day and a half before the filter was parsed
+	since := vals[0].(int64)
+	if since < before-36*60*60 || since > time.Now().Unix()-36*60*60 {
+		t.Errorf("expected a day and a half ago, received %v", time.Unix(since, 0))
+	}
+}
+
+// TestReadFilter ...
+func TestReadFilter(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		query    interface{}
+		filter   Filter
+		expected []int64
+	}{
+		{Album{}, AllOf{}, []int64{1, 2, 3, 4, 5}},
+		{Album{}, AllOf{
+			Condition{"release_year", OpGreaterEqual, int64(1985)},
+			Condition{"release_year", OpLess, int64(2012)},
+		}, []int64{1, 2, 4}},
+		{Album{}, AnyOf{
+			Condition{"title", OpPrefix, "i"},
+			Condition{"blurhash", OpNull, false},
+		}, []int64{1, 2, 5}},
+		{Album{}, Not{Condition{"artist", OpIn, []interface{}{int64(1), int64(2)}}}, []int64{3, 4}},
+		{Song{}, Condition{"lossless", OpEqual, false}, []int64{3}},
+		{Song{}, Condition{"title", OpLike, "%the%"}, []int64{1, 3}},
+		{Artist{}, Condition{"mbid", OpEqual, nil}, []int64{2, 3, 4}},
+	}
+
+	for _, test := range tests {
+		results, err := wdb.ReadFilter(test.query, test.filter, []string{"id"})
+		if err != nil {
+			t.Errorf("%T %+v: %v", test.query, test.filter, err)
+			continue
+		}
+		ids := make([]int64, len(results))
+		for i, r := range results {
+			ids[i] = reflect.ValueOf(r).FieldByName("ID").Int()
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%T %+v: expected %v, received %v", test.query, test.filter, test.expected, ids)
+		}
+	}
+}
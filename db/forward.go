@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
+)
+
+// forwardBatch is how many queued listens are read at once.
+const forwardBatch = 100
+
+// ForwardOptions ...
+// Configures a scrobble forwarder.
+type ForwardOptions struct {
+	// Scrobble configures the services listens are submitted to.
+	Scrobble scrobble.Options
+
+	// Interval is how often the queue is checked for listens due to be
+	// sent again. Defaults to a minute.
+	Interval time.Duration
+
+	// Backoff is how long a listen that could not be sent waits before
+	// it is sent again, doubling each time it fails up to MaxBackoff.
+	// Defaults to 30 seconds and 6 hours.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// MaxAttempts is how many times a listen is sent before it is
+	// dropped. Defaults to 50, a little over 10 days of attempts.
+	MaxAttempts int
+}
+
+// Forwarder ...
+// Submits the plays queued by RecordPlay to the scrobblers of their
+// users, sending those that fail again later, and tells them what
+// users are playing now.
+type Forwarder struct {
+	wdb  *WarblerDB
+	s    *scrobble.Scrobbler
+	opts ForwardOptions
+
+	wake chan struct{}
+	now  func() time.Time
+
+	// mu keeps queued listens from being sent twice at once
+	mu sync.Mutex
+}
+
+// NewForwarder ...
+// Creates a forwarder. Call Run to start sending queued listens.
+func (wdb *WarblerDB) NewForwarder(opts ForwardOptions) *Forwarder {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 6 * time.Hour
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 50
+	}
+
+	return &Forwarder{
+		wdb:  wdb,
+		s:    scrobble.New(opts.Scrobble),
+		opts: opts,
+		wake: make(chan struct{}, 1),
+		now:  time.Now,
+	}
+}
+
+// Supports ...
+// Reports whether listens can be forwarded to a service.
+func (f *Forwarder) Supports(service scrobble.Service) bool {
+	return f.s.Supports(service)
+}
+
+// Wake ...
+// Has Run send queued listens now rather than at its next interval,
+// called once plays were recorded.
+func (f *Forwarder) Wake() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run ...
+// Sends queued listens as they are queued and as they become due to be
+// sent again until ctx is cancelled.
+func (f *Forwarder) Run(ctx context.Context) error {
+	ticker := time.NewTicker(f.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := f.Flush(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error forwarding plays: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// queuedListen ...
+// A listen waiting to be sent to a scrobbler.
+type queuedListen struct {
+	id       int64
+	service  scrobble.Service
+	token    string
+	listen   scrobble.Listen
+	attempts int
+}
+
+// due ...
+// Returns the queued listens that are due to be sent, oldest first.
+func (f *Forwarder) due(now int64) ([]queuedListen, error) {
+	rows, err := f.wdb.Query("SELECT q.id, s.service, s.token, q.listen, q.attempts "+
+		"FROM config.scrobble_queue AS q JOIN config.scrobblers AS s ON s.id = q.scrobbler_id "+
+		"WHERE q.next_attempt_at <= $1 ORDER BY q.id LIMIT $2", now, forwardBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queued []queuedListen
+	for rows.Next() {
+		var (
+			q    queuedListen
+			data string
+		)
+		err = rows.Scan(&q.id, &q.service, &q.token, &data, &q.attempts)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(data), &q.listen)
+		if err != nil {
+			return nil, err
+		}
+		queued = append(queued, q)
+	}
+	return queued, rows.Err()
+}
+
+// backoff ...
+// Returns how long to wait before sending a listen again after it
+// failed for the nth time.
+func (f *Forwarder) backoff(attempts int) time.Duration {
+	d := f.opts.Backoff
+	for i := 1; i < attempts && d < f.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > f.opts.MaxBackoff {
+		d = f.opts.MaxBackoff
+	}
+	return d
+}
+
+// Flush ...
+// Sends every queued listen that is due and returns how many were sent.
+// Listens the scrobbler refused, or that failed MaxAttempts times, are
+// dropped. The others are sent again after a backoff.
+func (f *Forwarder) Flush(ctx context.Context) (sent int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		now := f.now()
+		queued, err := f.due(now.Unix())
+		if err != nil || len(queued) == 0 {
+			return sent, err
+		}
+
+		for _, q := range queued {
+			if ctx.Err() != nil {
+				return sent, ctx.Err()
+			}
+
+			sendErr := f.s.Submit(ctx, q.service, q.token, q.listen)
+			if sendErr != scrobble.ErrUnsupported {
+				q.attempts++
+			}
+			switch {
+			case sendErr == nil:
+				sent++
+				_, err = f.wdb.Exec("DELETE FROM config.scrobble_queue WHERE id = $1", q.id)
+			case sendErr == scrobble.ErrUnsupported:
+				// listens for a service the server has stopped being
+				// configured for wait until it is again, without
+				// counting as attempts
+				_, err = f.wdb.Exec("UPDATE config.scrobble_queue SET next_attempt_at = $1, last_error = $2 WHERE id = $3",
+					now.Add(f.opts.MaxBackoff).Unix(), sendErr.Error(), q.id)
+			case !scrobble.Retry(sendErr) || q.attempts >= f.opts.MaxAttempts:
+				log.Printf("Dropping a play of %q queued for %s after %d attempts: %v",
+					q.listen.Track, q.service, q.attempts, sendErr)
+				_, err = f.wdb.Exec("DELETE FROM config.scrobble_queue WHERE id = $1", q.id)
+			default:
+				next := now.Add(f.backoff(q.attempts)).Unix()
+				_, err = f.wdb.Exec("UPDATE config.scrobble_queue SET attempts = $1, next_attempt_at = $2, last_error = $3 "+
+					"WHERE id = $4", q.attempts, next, sendErr.Error(), q.id)
+			}
+			if err != nil {
+				return sent, err
+			}
+		}
+
+		if len(queued) < forwardBatch {
+			return sent, nil
+		}
+	}
+}
+
+// NowPlaying ...
+// Tells each of a user's scrobblers that they are playing a song. What
+// is playing is not queued, as it is no longer true by the time a
+// scrobbler could be sent it again.
+func (f *Forwarder) NowPlaying(ctx context.Context, user, song int64) error {
+	rows, err := f.wdb.Query("SELECT service, token FROM config.scrobblers WHERE user_id = $1 ORDER BY service", user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type scrobbler struct {
+		service scrobble.Service
+		token   string
+	}
+	var scrobblers []scrobbler
+	for rows.Next() {
+		var s scrobbler
+		err = rows.Scan(&s.service, &s.token)
+		if err != nil {
+			return err
+		}
+		scrobblers = append(scrobblers, s)
+	}
+	err = rows.Err()
+	if err != nil || len(scrobblers) == 0 {
+		return err
+	}
+	rows.Close()
+
+	l, err := f.wdb.songListen(f.wdb.DB.QueryRow, song)
+	if err != nil || l.Artist == "" {
+		return err
+	}
+
+	var failed error
+	for _, s := range scrobblers {
+		if !f.s.Supports(s.service) {
+			continue
+		}
+		err = f.s.NowPlaying(ctx, s.service, s.token, l)
+		if err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
+)
+
+// TestForwarder ...
+func TestForwarder(t *testing.T) {
+	prepareDB()
+
+	// a stand-in for ListenBrainz responding with each status in turn
+	var (
+		statuses []int
+		received []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(data))
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	// Last.fm is not configured, so the admin's plays wait for it as
+	// long as a play can wait, without it counting as an attempt
+	now := time.Now()
+	f := wdb.NewForwarder(ForwardOptions{Scrobble: scrobble.Options{ListenBrainzURL: ts.URL, LastFMURL: ts.URL}})
+	f.now = func() time.Time { return now }
+	_, err := wdb.RecordPlay(Play{User: 1, Song: 1, Played: 1600000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type entry struct {
+		attempts  int
+		next      int64
+		lastError string
+	}
+	entries := func() map[int64]entry {
+		rows, err := wdb.Query("SELECT id, attempts, next_attempt_at, COALESCE(last_error, '') FROM config.scrobble_queue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		m := map[int64]entry{}
+		for rows.Next() {
+			var (
+				id int64
+				e  entry
+			)
+			err = rows.Scan(&id, &e.attempts, &e.next, &e.lastError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[id] = e
+		}
+		return m
+	}
+
+	var tests = []struct {
+		name     string
+		after    time.Duration
+		statuses []int
+		sent     int
+		requests int
+		expected map[int64]entry
+	}{
+		// the queued play has failed twice, it waits twice as long as
+		// the last time
+		{"unavailable", 0, []int{http.StatusServiceUnavailable}, 0, 1, map[int64]entry{
+			1:     {3, now.Add(2 * time.Minute).Unix(), "scrobble: listenbrainz responded 503"},
+			10001: {0, now.Add(6 * time.Hour).Unix(), "scrobble: unsupported service"},
+		}},
+		{"not due", time.Minute, nil, 0, 0, map[int64]entry{
+			1:     {3, now.Add(2 * time.Minute).Unix(), "scrobble: listenbrainz responded 503"},
+			10001: {0, now.Add(6 * time.Hour).Unix(), "scrobble: unsupported service"},
+		}},
+		{"sent", time.Minute, nil, 1, 1, map[int64]entry{
+			10001: {0, now.Add(6 * time.Hour).Unix(), "scrobble: unsupported service"},
+		}},
+	}
+
+	for _, test := range tests {
+		now = now.Add(test.after)
+		statuses, received = test.statuses, nil
+		sent, err := f.Flush(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != test.sent || len(received) != test.requests {
+			t.Errorf("%s: expected %d sent in %d requests, received %d in %d", test.name, test.sent, test.requests, sent, len(received))
+		}
+		if e := entries(); len(e) != len(test.expected) || e[1] != test.expected[1] || e[10001] != test.expected[10001] {
+			t.Errorf("%s: expected %v, received %v", test.name, test.expected, e)
+		}
+	}
+	if len(received) != 1 || !strings.Contains(received[0], `"listened_at":1580518800`) {
+		t.Errorf("expected the queued play, received %v", received)
+	}
+
+	// plays the scrobbler refuses are not sent again
+	_, err = wdb.RecordPlay(Play{User: 2, Song: 3, Played: 1600000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses = []int{http.StatusBadRequest}
+	sent, err := f.Flush(context.Background())
+	if err != nil || sent != 0 {
+		t.Errorf("expected nothing sent, received %d %v", sent, err)
+	}
+	if e := entries(); len(e) != 1 {
+		t.Errorf("expected the refused play to be dropped, received %v", e)
+	}
+
+	// what is playing now is sent straight away
+	received = nil
+	err = f.NowPlaying(context.Background(), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || !strings.Contains(received[0], `"listen_type":"playing_now"`) {
+		t.Errorf("expected the song playing now, received %v", received)
+	}
+	err = f.NowPlaying(context.Background(), 1, 1)
+	if err != nil || len(received) != 1 {
+		t.Errorf("expected nothing sent to Last.fm, received %v %v", err, received[1:])
+	}
+}
+
+// TestBackoff ...
+func TestBackoff(t *testing.T) {
+	f := wdb.NewForwarder(ForwardOptions{Backoff: time.Minute, MaxBackoff: time.Hour})
+
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, test := range tests {
+		if d := f.backoff(test.attempts); d != test.expected {
+			t.Errorf("%d attempts: expected %v, received %v", test.attempts, test.expected, d)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+	ft "github.com/h2non/filetype"
+
+	"gitlab.stergianis.ca/michael/warbler/artwork"
+)
+
+// image sources
+const (
+	folderImage   = "folder"
+	embeddedImage = "embedded"
+)
+
+// the number of BlurHash components across and down
+const (
+	blurHashX = 4
+	blurHashY = 3
+)
+
+// coverNames ...
+// The names, without extension, of the images in an album's directory
+// that are preferred as its primary image, most preferred first.
+var coverNames = []string{"cover", "folder", "front", "album", "albumart"}
+
+// imagePriority ...
+// Ranks an image of an album, the image with the lowest priority is
+// the album's primary image. Images named like covers come first,
+// then artwork embedded in the album's songs, then any other images
+// in the album's directory.
+func imagePriority(img Image) int {
+	if img.Source == embeddedImage {
+		return len(coverNames)
+	}
+
+	base := strings.ToLower(filepath.Base(img.Path))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	for i, name := range coverNames {
+		if base == name {
+			return i
+		}
+	}
+
+	return len(coverNames) + 1
+}
+
+// hashImage ...
+// Returns the sha256 of an image and its mime type, which is empty if
+// the contents are not an image.
+func hashImage(r io.Reader) (hash, mimeType string, err error) {
+	header := make([]byte, fileHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", err
+	}
+	header = header[:n]
+
+	h := sha256.New()
+	h.Write(header)
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", "", err
+	}
+
+	kind, _ := ft.Match(header)
+	if ft.IsImage(header) {
+		mimeType = kind.MIME.Value
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), mimeType, nil
+}
+
+// imageBlurHash ...
+// Returns the BlurHash of an image, which is null if it cannot be
+// decoded.
+func imageBlurHash(data []byte) NullString {
+	img, err := artwork.Decode(bytes.NewReader(data))
+	if err != nil {
+		return NullString{}
+	}
+	hash, err := artwork.BlurHash(img, blurHashX, blurHashY)
+	if err != nil {
+		return NullString{}
+	}
+	return NewNullString(hash)
+}
+
+// likeDir ...
+// A LIKE pattern matching every path below dir, escaped with '\'.
+func likeDir(dir string) string {
+	return likeEscaper.Replace(dir) + "/%"
+}
+
+// imagesInDir ...
+// Returns the ids of the folder images directly in dir.
+func (wdb *WarblerDB) imagesInDir(dir string) (ids []int64, err error) {
+	rows, err := wdb.Query(`SELECT id, fs_path FROM music.images WHERE source = $1 AND fs_path LIKE $2 ESCAPE '\'`,
+		folderImage, likeDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id     int64
+			fsPath string
+		)
+		err = rows.Scan(&id, &fsPath)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Dir(fsPath) == dir {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, rows.Err()
+}
+
+// albumsInDir ...
+// Returns the ids of the albums of the songs directly in dir.
+func (wdb *WarblerDB) albumsInDir(dir string) (ids []int64, err error) {
+	rows, err := wdb.Query(`SELECT album, fs_path FROM music.songs WHERE album IS NOT NULL AND fs_path LIKE $1 ESCAPE '\'`,
+		likeDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[int64]struct{}{}
+	for rows.Next() {
+		var (
+			id     int64
+			fsPath string
+		)
+		err = rows.Scan(&id, &fsPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[id]; ok || filepath.Dir(fsPath) != dir {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// addImageFile ...
+// Records an image found in a library and links it to the albums of
+// the songs in its directory.
+func (wdb *WarblerDB) addImageFile(fsPath string) error {
+	data, err := ioutil.ReadFile(fsPath)
+	if err != nil {
+		return err
+	}
+
+	hash, mimeType, err := hashImage(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	img := Image{
+		Path:     fsPath,
+		Hash:     NewNullString(hash),
+		MIMEType: NewNullString(mimeType),
+		Source:   folderImage,
+		BlurHash: imageBlurHash(data),
+	}
+
+	wdb.imageMu.Lock()
+	defer wdb.imageMu.Unlock()
+
+	// an image already at this path has changed on disk
+	var oldHash NullString
+	err = wdb.QueryRow("SELECT id, hash FROM music.images WHERE fs_path = $1", fsPath).Scan(&img.ID, &oldHash)
+	switch {
+	case err == sql.ErrNoRows:
+		err = wdb.Create(&img, []string{"id"})
+		if err != nil && err != ErrAlreadyExists {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		_, err = wdb.Exec("UPDATE music.images SET hash = $1, mime_type = $2, blurhash = $3 WHERE id = $4",
+			img.Hash, img.MIMEType, img.BlurHash, img.ID)
+		if err != nil {
+			return err
+		}
+		if oldHash.Valid && oldHash.String != hash {
+			err = wdb.removeResizedImages(oldHash.String)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	albums, err := wdb.albumsInDir(filepath.Dir(fsPath))
+	if err != nil {
+		return err
+	}
+	for _, album := range albums {
+		err = wdb.linkImages(album, img.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeImageFile ...
+// Deletes an image that was removed from a library. Albums it was the
+// primary image of choose another.
+func (wdb *WarblerDB) removeImageFile(fsPath string) error {
+	wdb.imageMu.Lock()
+	defer wdb.imageMu.Unlock()
+
+	var (
+		id   int64
+		hash NullString
+	)
+	err := wdb.QueryRow("SELECT id, hash FROM music.images WHERE fs_path = $1 AND source = $2",
+		fsPath, folderImage).Scan(&id, &hash)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := wdb.Query("SELECT album_id FROM music.images_in_album WHERE image_id = $1", id)
+	if err != nil {
+		return err
+	}
+	var albums []int64
+	for rows.Next() {
+		var album int64
+		err = rows.Scan(&album)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		albums = append(albums, album)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = wdb.Exec("DELETE FROM music.images_in_album WHERE image_id = $1", id)
+	if err != nil {
+		return err
+	}
+	_, err = wdb.Exec("DELETE FROM music.images WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if hash.Valid {
+		err = wdb.removeResizedImages(hash.String)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, album := range albums {
+		err = wdb.choosePrimaryImage(album)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addEmbeddedImage ...
+// Extracts artwork embedded in a song into the cache directory,
+// unless artwork with the same contents already was. Returns nothing
+// if the artwork is not an image.
+func (wdb *WarblerDB) addEmbeddedImage(pic *tag.Picture) (*Image, error) {
+	hash, mimeType, err := hashImage(bytes.NewReader(pic.Data))
+	if err != nil || mimeType == "" {
+		return nil, err
+	}
+	kind, _ := ft.Match(pic.Data)
+
+	img := &Image{
+		Path:     filepath.Join(wdb.CacheDir, "images", hash[:2], hash+"."+kind.Extension),
+		Hash:     NewNullString(hash),
+		MIMEType: NewNullString(mimeType),
+		Source:   embeddedImage,
+	}
+
+	wdb.imageMu.Lock()
+	defer wdb.imageMu.Unlock()
+
+	// the cache may have been cleared since the artwork was extracted
+	if _, err = os.Stat(img.Path); os.IsNotExist(err) {
+		err = writeFileAtomic(img.Path, pic.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = wdb.Create(img, []string{"id"})
+	if err != nil && err != ErrAlreadyExists {
+		return nil, err
+	}
+
+	// artwork extracted before placeholders were computed has none
+	if !img.BlurHash.Valid {
+		img.BlurHash = imageBlurHash(pic.Data)
+		_, err = wdb.Exec("UPDATE music.images SET blurhash = $1 WHERE id = $2", img.BlurHash, img.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return img, nil
+}
+
+// writeFileAtomic ...
+// Writes data to a new file at fsPath, creating its directory. Readers
+// never see a partially written file.
+func writeFileAtomic(fsPath string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(fsPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fsPath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fsPath)
+}
+
+// addAlbumImages ...
+// Links an album to the artwork embedded in one of its songs, if any,
+// and to the images in the song's directory.
+func (wdb *WarblerDB) addAlbumImages(album int64, songPath string, pic *tag.Picture) error {
+	var images []int64
+	if pic != nil && wdb.CacheDir != "" {
+		img, err := wdb.addEmbeddedImage(pic)
+		if err != nil {
+			return err
+		}
+		if img != nil {
+			images = append(images, img.ID)
+		}
+	}
+
+	wdb.imageMu.Lock()
+	defer wdb.imageMu.Unlock()
+
+	inDir, err := wdb.imagesInDir(filepath.Dir(songPath))
+	if err != nil {
+		return err
+	}
+
+	return wdb.linkImages(album, append(images, inDir...)...)
+}
+
+// linkImages ...
+// Links images to an album and chooses its primary image again. The
+// caller must hold imageMu.
+func (wdb *WarblerDB) linkImages(album int64, images ...int64) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	for _, img := range images {
+		_, err := wdb.Exec("INSERT INTO music.images_in_album (album_id, image_id, primary_image) "+
+			"VALUES ($1, $2, $3) ON CONFLICT (album_id, image_id) DO NOTHING", album, img, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return wdb.choosePrimaryImage(album)
+}
+
+// choosePrimaryImage ...
+// Marks the image of an album with the lowest priority as its primary
+// image, the first one linked among equals, and copies its BlurHash
+// to the album.
+func (wdb *WarblerDB) choosePrimaryImage(album int64) error {
+	rows, err := wdb.Query("SELECT images.id, images.fs_path, images.source FROM music.images AS images "+
+		"JOIN music.images_in_album AS iia ON iia.image_id = images.id "+
+		"WHERE iia.album_id = $1 ORDER BY images.id", album)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var primary *Image
+	for rows.Next() {
+		var img Image
+		err = rows.Scan(&img.ID, &img.Path, &img.Source)
+		if err != nil {
+			return err
+		}
+		if primary == nil || imagePriority(img) < imagePriority(*primary) {
+			primary = &img
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if primary == nil {
+		_, err = wdb.Exec("UPDATE music.albums SET blurhash = NULL WHERE id = $1", album)
+		return err
+	}
+
+	_, err = wdb.Exec("UPDATE music.images_in_album SET primary_image = (image_id = $1) WHERE album_id = $2",
+		primary.ID, album)
+	if err != nil {
+		return err
+	}
+
+	_, err = wdb.Exec("UPDATE music.albums SET blurhash = "+
+		"(SELECT blurhash FROM music.images WHERE id = $1) WHERE id = $2", primary.ID, album)
+	return err
+}
+
+// collectImages ...
+// Deletes artwork extracted into the cache that belongs to no album,
+// along with its file. Images in libraries are kept until their file
+// is removed, songs added to their directory later are linked to
+// them. Returns the number of images deleted.
+func (wdb *WarblerDB) collectImages() (collected int64, err error) {
+	wdb.imageMu.Lock()
+	defer wdb.imageMu.Unlock()
+
+	rows, err := wdb.Query("SELECT id, fs_path, hash FROM music.images WHERE source = $1 AND id NOT IN "+
+		"(SELECT image_id FROM music.images_in_album WHERE image_id IS NOT NULL)", embeddedImage)
+	if err != nil {
+		return 0, err
+	}
+	var orphans []Image
+	for rows.Next() {
+		var img Image
+		err = rows.Scan(&img.ID, &img.Path, &img.Hash)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orphans = append(orphans, img)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, img := range orphans {
+		_, err = wdb.Exec("DELETE FROM music.images WHERE id = $1", img.ID)
+		if err != nil {
+			return collected, err
+		}
+		collected++
+
+		err = os.Remove(img.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return collected, err
+		}
+		if img.Hash.Valid {
+			err = wdb.removeResizedImages(img.Hash.String)
+			if err != nil {
+				return collected, err
+			}
+		}
+	}
+
+	return collected, nil
+}
+
+// PrimaryImage ...
+// Returns the primary image of an album. Returns ErrNotPresent if the
+// album has no images.
+func (wdb *WarblerDB) PrimaryImage(album int64) (img Image, err error) {
+	err = wdb.QueryRow("SELECT images.id FROM music.images AS images "+
+		"JOIN music.images_in_album AS iia ON iia.image_id = images.id "+
+		"WHERE iia.album_id = $1 AND iia.primary_image", album).Scan(&img.ID)
+	if err == sql.ErrNoRows {
+		return img, ErrNotPresent
+	}
+	if err != nil {
+		return img, err
+	}
+
+	err = wdb.ReadUnique(&img)
+	return img, err
+}
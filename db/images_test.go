@@ -0,0 +1,283 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// testPNG ...
+// Encodes a single pixel png of a colour.
+func testPNG(t *testing.T, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, c)
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// id3v2Frame ...
+// Encodes an ID3v2.3 frame.
+func id3v2Frame(id string, data []byte) []byte {
+	f := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(f[4:8], uint32(len(data)))
+	return append(f, data...)
+}
+
+// id3v2TextFrame ...
+// Encodes an ID3v2.3 text frame of latin1 values.
+func id3v2TextFrame(id string, values ...string) []byte {
+	return id3v2Frame(id, append([]byte{0}, strings.Join(values, "\x00")...))
+}
+
+// withID3v2 ...
+// Replaces the ID3v2 tag of an mp3 with one of frames.
+func withID3v2(song []byte, frames ...[]byte) []byte {
+	data := bytes.Join(frames, nil)
+
+	// the size of the tag is syncsafe, 7 bits per byte
+	header := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 0}
+	for i, n := 9, len(data); i >= 6; i, n = i-1, n>>7 {
+		header[i] = byte(n & 0x7f)
+	}
+
+	// drop the existing tag
+	if bytes.HasPrefix(song, []byte("ID3")) {
+		size := 0
+		for _, b := range song[6:10] {
+			size = size<<7 | int(b&0x7f)
+		}
+		song = song[10+size:]
+	}
+
+	return append(append(header, data...), song...)
+}
+
+// withPicture ...
+// Replaces the ID3v2 tag of an mp3 with one naming its album and
+// embedding a front cover.
+func withPicture(song []byte, album string, pic []byte) []byte {
+	apic := append([]byte("\x00image/png\x00\x03\x00"), pic...)
+	return withID3v2(song,
+		id3v2TextFrame("TIT2", "Obey"),
+		id3v2TextFrame("TALB", album),
+		id3v2TextFrame("TPE2", "Simpsons"),
+		id3v2Frame("APIC", apic))
+}
+
+// albumImages ...
+// Returns the images linked to an album and the id of its primary
+// image.
+func albumImages(t *testing.T, album int64) (images []Image, primary int64) {
+	t.Helper()
+
+	rows, err := wdb.Query("SELECT image_id, primary_image FROM music.images_in_album "+
+		"WHERE album_id = $1 ORDER BY image_id", album)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var (
+			id    int64
+			isPri bool
+		)
+		err = rows.Scan(&id, &isPri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if isPri {
+			primary = id
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		img := Image{ID: id}
+		err = wdb.ReadUnique(&img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, img)
+	}
+
+	return images, primary
+}
+
+// TestImagePriority ...
+func TestImagePriority(t *testing.T) {
+	cases := []struct {
+		img      Image
+		priority int
+	}{
+		{Image{Path: "/m/a/cover.jpg", Source: folderImage}, 0},
+		{Image{Path: "/m/a/Cover.PNG", Source: folderImage}, 0},
+		{Image{Path: "/m/a/folder.jpg", Source: folderImage}, 1},
+		{Image{Path: "/m/a/front.gif", Source: folderImage}, 2},
+		{Image{Path: "/m/a/AlbumArt.jpg", Source: folderImage}, 4},
+		{Image{Path: "/c/images/ab/abcd.jpg", Source: embeddedImage}, 5},
+		{Image{Path: "/m/a/back.jpg", Source: folderImage}, 6},
+		{Image{Path: "/m/a/cover-back.jpg", Source: folderImage}, 6},
+	}
+
+	for _, c := range cases {
+		if p := imagePriority(c.img); p != c.priority {
+			t.Errorf("expected %s to have priority %d, received %d", c.img.Path, c.priority, p)
+		}
+	}
+}
+
+// TestScanLibraryImages ...
+func TestScanLibraryImages(t *testing.T) {
+	prepareDB()
+
+	cacheDir, err := ioutil.TempDir("", "warbler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	wdb.CacheDir = cacheDir
+	defer func() { wdb.CacheDir = "" }()
+
+	lib, cleanup := prepareScanLibrary(t, "Artwork")
+	defer cleanup()
+
+	song, err := ioutil.ReadFile(path.Join(testLib, testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := testPNG(t, color.White)
+	song = withPicture(song, "Artwork", embedded)
+
+	dir := path.Join(lib.Path, "Artwork")
+	files := map[string][]byte{
+		"01 Obey.mp3":  song,
+		"02 Again.mp3": song,
+		"cover.png":    testPNG(t, color.Black),
+		"back.png":     testPNG(t, color.Gray{Y: 0x80}),
+	}
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		err = ioutil.WriteFile(path.Join(dir, name), data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func() {
+		t.Helper()
+		stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Errors != 0 {
+			t.Fatalf("unexpected errors scanning: %+v", stats)
+		}
+	}
+	scan()
+
+	songs, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != 2 || songs[0].Album != songs[1].Album {
+		t.Fatalf("expected two songs in one album, received: %v", songs)
+	}
+	album := songs[0].Album.Int64
+
+	// both songs embed the same artwork, it is extracted once
+	images, primary := albumImages(t, album)
+	if len(images) != 3 {
+		t.Fatalf("expected 3 images, received: %v", images)
+	}
+	byName := map[string]Image{}
+	for _, img := range images {
+		byName[path.Base(img.Path)] = img
+	}
+	cover, ok := byName["cover.png"]
+	if !ok || primary != cover.ID {
+		t.Errorf("expected cover.png to be the primary image, received %d of %v", primary, images)
+	}
+	if cover.MIMEType.String != "image/png" || !cover.Hash.Valid || !cover.BlurHash.Valid {
+		t.Errorf("expected the cover to be hashed and typed, received: %+v", cover)
+	}
+	albumRow := Album{ID: album}
+	err = wdb.ReadUnique(&albumRow)
+	if err != nil || albumRow.BlurHash != cover.BlurHash {
+		t.Errorf("expected the album to have the BlurHash of its cover, received %+v: %v", albumRow, err)
+	}
+
+	var extracted Image
+	for _, img := range images {
+		if img.Source == embeddedImage {
+			extracted = img
+		}
+	}
+	cached, err := ioutil.ReadFile(extracted.Path)
+	if err != nil || !bytes.Equal(cached, embedded) {
+		t.Fatalf("expected the embedded artwork to be cached at %q: %v", extracted.Path, err)
+	}
+
+	// without a cover the embedded artwork is preferred
+	err = os.Remove(path.Join(dir, "cover.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan()
+
+	images, primary = albumImages(t, album)
+	if len(images) != 2 || primary != extracted.ID {
+		t.Errorf("expected the embedded artwork to be the primary image, received %d of %v", primary, images)
+	}
+
+	// the artwork of a removed album is deleted
+	for _, name := range []string{"01 Obey.mp3", "02 Again.mp3"} {
+		err = os.Remove(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan()
+
+	images, _ = albumImages(t, album)
+	if len(images) != 0 {
+		t.Errorf("expected no images, received: %v", images)
+	}
+	if _, err = os.Stat(extracted.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the cached artwork to be removed, received: %v", err)
+	}
+
+	// images left in the directory belong to songs added to it later
+	err = ioutil.WriteFile(path.Join(dir, "01 Obey.mp3"), song, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan()
+
+	songs, err = wdb.GetSongsInLibrary(lib)
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("expected one song, received %v: %v", songs, err)
+	}
+	images, primary = albumImages(t, songs[0].Album.Int64)
+	if len(images) != 2 || images[0].ID != byName["back.png"].ID || images[1].ID != primary {
+		t.Errorf("expected the back and embedded artwork, received %d of %v", primary, images)
+	}
+}
@@ -0,0 +1,302 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// relation ...
+// Records related to another that can be included with it.
+type relation struct {
+	// name of the relation, the edn and json name of its records
+	name string
+
+	// field holds the id of the related record, which replaces it.
+	// When empty the related records are of the record's id and are
+	// added in a new field.
+	field string
+
+	// t is the type of the included records, a pointer to one record or
+	// a slice of them
+	t reflect.Type
+
+	// read returns the related records of a set of ids that a user can
+	// see
+	read func(wdb *WarblerDB, ids []int64, user *User) (map[int64]interface{}, error)
+}
+
+// relations are those of each type that can be included.
+var relations = map[reflect.Type][]relation{
+	reflect.TypeOf(Album{}): {
+		{"artist", "Artist", reflect.TypeOf(&Artist{}), readByID(Artist{})},
+		{"songs", "", reflect.TypeOf([]Song{}), readSongsBy("album", "disk", "track", "id")},
+		{"images", "", reflect.TypeOf([]Image{}), readAlbumImages},
+	},
+	reflect.TypeOf(Song{}): {
+		{"album", "Album", reflect.TypeOf(&Album{}), readByID(Album{})},
+		{"genre", "Genre", reflect.TypeOf(&Genre{}), readByID(Genre{})},
+	},
+	reflect.TypeOf(Genre{}): {
+		{"songs", "", reflect.TypeOf([]Song{}), readSongsBy("genre", "title", "id")},
+	},
+	reflect.TypeOf(Playlist{}): {
+		{"entries", "", reflect.TypeOf([]PlaylistEntry{}), readPlaylistEntries},
+	},
+	reflect.TypeOf(SmartPlaylist{}): {
+		{"songs", "", reflect.TypeOf([]Song{}), readSmartPlaylistSongs},
+	},
+	reflect.TypeOf(Play{}): {
+		{"song", "Song", reflect.TypeOf(&Song{}), readByID(Song{})},
+	},
+}
+
+// idList ...
+// Returns ids as a list of values for OpIn.
+func idList(ids []int64) []interface{} {
+	list := make([]interface{}, len(ids))
+	for i, id := range ids {
+		list[i] = id
+	}
+	return list
+}
+
+// readByID ...
+// Returns a relation reader of the records of a type by their id.
+func readByID(queryType interface{}) func(*WarblerDB, []int64, *User) (map[int64]interface{}, error) {
+	return func(wdb *WarblerDB, ids []int64, user *User) (map[int64]interface{}, error) {
+		filter := AllOf{Condition{"id", OpIn, idList(ids)}, Visible(queryType, user)}
+		results, err := wdb.ReadFilter(queryType, filter, []string{})
+		if err != nil {
+			return nil, err
+		}
+
+		related := make(map[int64]interface{}, len(results))
+		for _, r := range results {
+			v := reflect.New(reflect.TypeOf(r))
+			v.Elem().Set(reflect.ValueOf(r))
+			related[v.Elem().FieldByName("ID").Int()] = v.Interface()
+		}
+		return related, nil
+	}
+}
+
+// readSongsBy ...
+// Returns a relation reader of the songs with a column in a set of
+// ids, in order.
+func readSongsBy(column string, orderBy ...string) func(*WarblerDB, []int64, *User) (map[int64]interface{}, error) {
+	return func(wdb *WarblerDB, ids []int64, user *User) (map[int64]interface{}, error) {
+		filter := AllOf{Condition{column, OpIn, idList(ids)}, Visible(Song{}, user)}
+		results, err := wdb.ReadFilter(Song{}, filter, orderBy)
+		if err != nil {
+			return nil, err
+		}
+
+		songs := make(map[int64][]Song, len(ids))
+		for _, r := range results {
+			s := r.(Song)
+			var id NullInt64
+			switch column {
+			case "album":
+				id = s.Album
+			case "genre":
+				id = s.Genre
+			}
+			songs[id.Int64] = append(songs[id.Int64], s)
+		}
+
+		related := make(map[int64]interface{}, len(ids))
+		for _, id := range ids {
+			if songs[id] == nil {
+				songs[id] = []Song{}
+			}
+			related[id] = songs[id]
+		}
+		return related, nil
+	}
+}
+
+// readAlbumImages ...
+// Reads the images of albums, the primary image first. The images of
+// an album are seen by everyone that can see it.
+func readAlbumImages(wdb *WarblerDB, ids []int64, user *User) (map[int64]interface{}, error) {
+	rType := reflect.TypeOf(Image{})
+	var columns []string
+	for i := 0; i < rType.NumField(); i++ {
+		if isColumn(rType.Field(i)) {
+			columns = append(columns, "images."+rType.Field(i).Tag.Get("sql"))
+		}
+	}
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatInt(id, 10)
+	}
+
+	rows, err := wdb.Query("SELECT iia.album_id, " + strings.Join(columns, ", ") + " " +
+		"FROM music.images AS images JOIN music.images_in_album AS iia ON iia.image_id = images.id " +
+		"WHERE iia.album_id IN (" + strings.Join(list, ", ") + ") " +
+		"ORDER BY iia.album_id, iia.primary_image IS NULL, iia.primary_image DESC, images.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[int64][]Image, len(ids))
+	for rows.Next() {
+		var (
+			album int64
+			img   Image
+		)
+		err = rows.Scan(append([]interface{}{&album}, prepareDest(reflect.ValueOf(&img))...)...)
+		if err != nil {
+			return nil, err
+		}
+		images[album] = append(images[album], img)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	related := make(map[int64]interface{}, len(ids))
+	for _, id := range ids {
+		if images[id] == nil {
+			images[id] = []Image{}
+		}
+		related[id] = images[id]
+	}
+	return related, nil
+}
+
+// fieldName ...
+// Returns the name of the field holding the included records.
+func (rel relation) fieldName() string {
+	if rel.field != "" {
+		return rel.field
+	}
+	return strings.ToUpper(rel.name[:1]) + rel.name[1:]
+}
+
+// indirectType ...
+func indirectType(i interface{}) reflect.Type {
+	t := reflect.TypeOf(i)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Include ...
+// Returns records of the query type with their related records, those
+// named by includes, nested in them. An included record takes the
+// place of its id, null when there is none, and lists of records are
+// added under their name. The related records of every record are read
+// together, leaving out those the user cannot see.
+func (wdb *WarblerDB) Include(queryType interface{}, records []interface{}, includes []string, user *User) ([]interface{}, error) {
+	rType := indirectType(queryType)
+
+	var rels []relation
+	named := map[string]bool{}
+	for _, name := range includes {
+		found := false
+		for _, rel := range relations[rType] {
+			if rel.name == name {
+				if !named[name] {
+					rels = append(rels, rel)
+				}
+				named[name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrInvalidInclude{rType.Name(), name}
+		}
+	}
+	if len(rels) == 0 || len(records) == 0 {
+		return records, nil
+	}
+
+	// the type of the records with their relations
+	var fields []reflect.StructField
+	for i := 0; i < rType.NumField(); i++ {
+		f := rType.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		for _, rel := range rels {
+			if rel.field == f.Name {
+				f.Type = rel.t
+			}
+		}
+		fields = append(fields, f)
+	}
+	for _, rel := range rels {
+		if rel.field == "" {
+			fields = append(fields, reflect.StructField{
+				Name: rel.fieldName(),
+				Type: rel.t,
+				Tag:  reflect.StructTag(`edn:"` + rel.name + `" json:"` + rel.name + `"`),
+			})
+		}
+	}
+	included := reflect.StructOf(fields)
+
+	values := make([]reflect.Value, len(records))
+	for i, r := range records {
+		values[i] = reflect.Indirect(reflect.ValueOf(r))
+	}
+
+	results := make([]reflect.Value, len(records))
+	for i, v := range values {
+		results[i] = reflect.New(included).Elem()
+		for j := 0; j < rType.NumField(); j++ {
+			f := results[i].FieldByName(rType.Field(j).Name)
+			if f.IsValid() && f.Type() == rType.Field(j).Type {
+				f.Set(v.Field(j))
+			}
+		}
+	}
+
+	for _, rel := range rels {
+		// the id each record's related records are read by
+		keys := make([]NullInt64, len(values))
+		var ids []int64
+		seen := map[int64]bool{}
+		for i, v := range values {
+			if rel.field == "" {
+				keys[i] = NewNullInt64(v.FieldByName("ID").Int())
+			} else {
+				switch key := v.FieldByName(rel.field).Interface().(type) {
+				case NullInt64:
+					keys[i] = key
+				case int64:
+					keys[i] = NewNullInt64(key)
+				}
+			}
+			if keys[i].Valid && !seen[keys[i].Int64] {
+				seen[keys[i].Int64] = true
+				ids = append(ids, keys[i].Int64)
+			}
+		}
+
+		related := map[int64]interface{}{}
+		if len(ids) > 0 {
+			var err error
+			related, err = rel.read(wdb, ids, user)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for i, key := range keys {
+			if r, ok := related[key.Int64]; ok && key.Valid {
+				results[i].FieldByName(rel.fieldName()).Set(reflect.ValueOf(r))
+			}
+		}
+	}
+
+	withRelations := make([]interface{}, len(results))
+	for i, r := range results {
+		withRelations[i] = r.Interface()
+	}
+	return withRelations, nil
+}
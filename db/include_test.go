@@ -0,0 +1,99 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestInclude ...
+func TestInclude(t *testing.T) {
+	prepareDB()
+
+	albums, err := wdb.Read(Album{}, []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withRelations, err := wdb.Include(Album{}, albums, []string{"artist", "songs", "images", "artist"}, &User{ID: 1, Admin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withRelations) != len(albums) {
+		t.Fatalf("expected %d albums, received %d", len(albums), len(withRelations))
+	}
+
+	var tests = []struct {
+		artist string
+		songs  []int64
+		images []int64
+	}{
+		// songs 5 and 6 are in no library
+		{"BADBADNOTGOOD", []int64{1}, []int64{1}},
+		{"BADBADNOTGOOD & Ghostface Killah", []int64{2}, []int64{2}},
+		{"Iron Maiden", []int64{3}, []int64{}},
+		{"Megadeth", []int64{4}, []int64{}},
+		{"BADBADNOTGOOD", []int64{}, []int64{}},
+	}
+	for i, test := range tests {
+		album := reflect.ValueOf(withRelations[i])
+		if title := album.FieldByName("Title").String(); title != albums[i].(Album).Title {
+			t.Errorf("album %d: expected the title %q, received %q", i+1, albums[i].(Album).Title, title)
+		}
+
+		artist := album.FieldByName("Artist").Interface().(*Artist)
+		if artist == nil || artist.Name != test.artist {
+			t.Errorf("album %d: expected the artist %q, received %+v", i+1, test.artist, artist)
+		}
+
+		songs := []int64{}
+		for _, s := range album.FieldByName("Songs").Interface().([]Song) {
+			songs = append(songs, s.ID)
+			if len(s.Artists) == 0 {
+				t.Errorf("album %d: expected songs with their credits", i+1)
+			}
+		}
+		if !reflect.DeepEqual(songs, test.songs) {
+			t.Errorf("album %d: expected songs %v, received %v", i+1, test.songs, songs)
+		}
+
+		images := []int64{}
+		for _, img := range album.FieldByName("Images").Interface().([]Image) {
+			images = append(images, img.ID)
+		}
+		if !reflect.DeepEqual(images, test.images) {
+			t.Errorf("album %d: expected images %v, received %v", i+1, test.images, images)
+		}
+	}
+
+	// a song without an album has a null album
+	song := Song{ID: 6}
+	err = wdb.ReadUnique(&song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	song.Album = NullInt64{}
+	withRelations, err = wdb.Include(&song, []interface{}{&song}, []string{"album", "genre"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := reflect.ValueOf(withRelations[0])
+	if album := s.FieldByName("Album").Interface().(*Album); album != nil {
+		t.Errorf("expected no album, received %+v", album)
+	}
+	if genre := s.FieldByName("Genre").Interface().(*Genre); genre == nil || genre.Name != "Jazz" {
+		t.Errorf("expected the genre Jazz, received %+v", genre)
+	}
+
+	for _, test := range []struct {
+		query    interface{}
+		includes []string
+	}{
+		{Song{}, []string{"songs"}},
+		{Artist{}, []string{"album"}},
+		{Album{}, []string{"artist", ""}},
+	} {
+		_, err = wdb.Include(test.query, []interface{}{}, test.includes, nil)
+		if _, ok := err.(ErrInvalidInclude); !ok {
+			t.Errorf("%T %v: expected ErrInvalidInclude, received %v", test.query, test.includes, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package db
+
+import (
+	"os"
+)
+
+// inode ...
+// Windows has no inode numbers, files are compared by size and
+// modification time alone.
+func inode(info os.FileInfo) int64 {
+	return 0
+}
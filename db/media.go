@@ -2,14 +2,21 @@ package db
 
 import (
 	"reflect"
+
+	"gitlab.stergianis.ca/michael/warbler/audio"
 )
 
 const (
 	unknownType = iota
 	musicType
 	imageType
+	playlistType
 )
 
+// fileHeaderSize is the number of bytes read from the start of a file
+// to determine its type.
+const fileHeaderSize = 262
+
 // Queryable ...
 type Queryable interface {
 	GetID() int64
@@ -97,8 +104,9 @@ func (l *Library) SetID(ID int64) {
 // Artist ...
 // A representation of an artist.
 type Artist struct {
-	ID   int64  `edn:"id"   json:"id"   sql:"id"`
-	Name string `edn:"name" json:"name" sql:"name"`
+	ID   int64      `edn:"id"   json:"id"   sql:"id"`
+	Name string     `edn:"name" json:"name" sql:"name"`
+	MBID NullString `edn:"mbid" json:"mbid" sql:"mbid"` // MusicBrainz artist id
 }
 
 // GetID ...
@@ -144,6 +152,11 @@ type Album struct {
 	NumTracks NullInt64   `edn:"num-tracks" json:"num-tracks" sql:"num_tracks"`
 	NumDisks  NullInt64   `edn:"num-disks"  json:"num-disks"  sql:"num_disks"`
 	Duration  NullFloat64 `edn:"duration"   json:"duration"   sql:"duration"` // seconds
+	BlurHash  NullString  `edn:"blurhash"   json:"blurhash"   sql:"blurhash"` // of the primary image
+
+	// MusicBrainz release and release group ids
+	MBID         NullString `edn:"mbid"               json:"mbid"               sql:"mbid"`
+	ReleaseGroup NullString `edn:"release-group-mbid" json:"release-group-mbid" sql:"release_group_mbid"`
 }
 
 // GetID ...
@@ -178,6 +191,48 @@ type Song struct {
 	Disk      NullInt64  `edn:"disk"       json:"disk"       sql:"disk"`
 	NumDisks  NullInt64  `edn:"num-disks"  json:"num-disks"  sql:"num_disks"`
 	Artist    NullString `edn:"artist"     json:"artist"     sql:"artist"`
+	Year      NullInt64  `edn:"year"       json:"year"       sql:"release_year"`
+
+	// stream properties, null for songs scanned before they were
+	// recorded
+	Codec      NullString `edn:"codec"       json:"codec"       sql:"codec"`
+	Container  NullString `edn:"container"   json:"container"   sql:"container"`
+	Bitrate    NullInt64  `edn:"bitrate"     json:"bitrate"     sql:"bitrate"` // bits per second
+	VBR        NullBool   `edn:"vbr"         json:"vbr"         sql:"vbr"`
+	SampleRate NullInt64  `edn:"sample-rate" json:"sample-rate" sql:"sample_rate"` // Hz
+	BitDepth   NullInt64  `edn:"bit-depth"   json:"bit-depth"   sql:"bit_depth"`   // null for lossy codecs
+	Channels   NullInt64  `edn:"channels"    json:"channels"    sql:"channels"`
+	Lossless   NullBool   `edn:"lossless"    json:"lossless"    sql:"lossless"`
+
+	MBID NullString `edn:"mbid" json:"mbid" sql:"mbid"` // MusicBrainz recording id
+
+	// seconds since the unix epoch the song was first scanned, null
+	// for songs scanned before it was recorded
+	Added NullInt64 `edn:"added" json:"added" sql:"added_at"`
+
+	// how many times anyone played the song and the seconds since the
+	// unix epoch they last did, kept by RecordPlay
+	Plays      int64     `edn:"plays"       json:"plays"       sql:"play_count"`
+	LastPlayed NullInt64 `edn:"last-played" json:"last-played" sql:"last_played_at"`
+
+	// the artists credited on the song, from music.song_artists
+	Artists []Credit `edn:"artists" json:"artists"`
+}
+
+// setProperties ...
+// Records the properties of the song's audio stream.
+func (s *Song) setProperties(p audio.Properties) {
+	s.Duration = p.Duration
+	s.Codec = NewNullString(p.Codec)
+	s.Container = NewNullString(p.Container)
+	s.Bitrate = NewNullInt64(int64(p.Bitrate))
+	s.VBR = NewNullBool(p.VBR)
+	s.SampleRate = NewNullInt64(int64(p.SampleRate))
+	s.Channels = NewNullInt64(int64(p.Channels))
+	s.Lossless = NewNullBool(p.Lossless)
+	if p.BitDepth != 0 {
+		s.BitDepth = NewNullInt64(int64(p.BitDepth))
+	}
 }
 
 // GetID ...
@@ -192,14 +247,20 @@ func (s *Song) SetID(ID int64) {
 
 // SongInLibrary ...
 type SongInLibrary struct {
-	SongID    NullInt64 `edn:"song-id" json:"lib-id" sql:"song_id"`
+	SongID    NullInt64 `edn:"song-id" json:"song-id" sql:"song_id"`
 	LibraryID NullInt64 `edn:"lib-id" json:"lib-id" sql:"library_id"`
 }
 
 // Image ...
+// An image file in an album's directory, or artwork embedded in a
+// song that was extracted into the cache.
 type Image struct {
-	ID   int64  `edn:"id" json:"id" sql:"id"`
-	Path string `edn:"-"  json:"-"  sql:"fs_path"`
+	ID       int64      `edn:"id"        json:"id"        sql:"id"`
+	Path     string     `edn:"-"         json:"-"         sql:"fs_path"`
+	Hash     NullString `edn:"hash"      json:"hash"      sql:"hash"` // sha256 of the contents
+	MIMEType NullString `edn:"mime-type" json:"mime-type" sql:"mime_type"`
+	Source   string     `edn:"source"    json:"source"    sql:"source"` // folder or embedded
+	BlurHash NullString `edn:"blurhash"  json:"blurhash"  sql:"blurhash"`
 }
 
 // GetID ...
@@ -216,4 +277,5 @@ func (i *Image) SetID(ID int64) {
 type ImageInAlbum struct {
 	AlbumID NullInt64 `edn:"album-id" json:"album-id" sql:"album_id"`
 	ImageID NullInt64 `edn:"img-id"   json:"img-id"   sql:"image_id"`
+	Primary NullBool  `edn:"primary"  json:"primary"  sql:"primary_image"`
 }
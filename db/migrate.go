@@ -0,0 +1,286 @@
+package db
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are stored per driver in migrations/<driver> and named
+// <version>_<name>.up.sql and <version>_<name>.down.sql. Versions
+// must be increasing integers, each migration is applied in a single
+// transaction and recorded in the schema_migrations table.
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+       version BIGINT PRIMARY KEY,
+       name VARCHAR NOT NULL,
+       applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migration ...
+// A single version of the database schema.
+type Migration struct {
+	Version int64
+	Name    string
+
+	up   string
+	down string
+}
+
+// MigrationStatus ...
+// Reports whether a migration has been applied, and when.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations ...
+// Returns the migrations built into the binary for the database in
+// use, ordered by version.
+func (wdb *WarblerDB) Migrations() ([]Migration, error) {
+	dir := path.Join("migrations", wdb.dialect.driver)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		if !strings.HasSuffix(file, ".sql") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(file, ".sql"), "_", 2)
+		if len(parts) != 2 {
+			return nil, ErrInvalidMigration{file}
+		}
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidMigration{file}
+		}
+
+		direction := path.Ext(parts[1])
+		name := strings.TrimSuffix(parts[1], direction)
+
+		contents, err := migrationFiles.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, ErrInvalidMigration{file}
+		}
+
+		switch direction {
+		case ".up":
+			m.up = string(contents)
+		case ".down":
+			m.down = string(contents)
+		default:
+			return nil, ErrInvalidMigration{file}
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, ErrInvalidMigration{m.Name}
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// appliedMigrations ...
+// Returns the time each applied migration was applied, by version.
+func (wdb *WarblerDB) appliedMigrations() (map[int64]time.Time, error) {
+	_, err := wdb.Exec(createMigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := wdb.Query("SELECT version, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// SchemaVersion ...
+// Returns the version of the most recently applied migration, 0 if
+// none have been applied.
+func (wdb *WarblerDB) SchemaVersion() (version int64, err error) {
+	applied, err := wdb.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+
+	return version, nil
+}
+
+// MigrationStatus ...
+// Returns every known migration and whether it has been applied.
+func (wdb *WarblerDB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := wdb.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := wdb.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		status[i] = MigrationStatus{m, ok, appliedAt}
+	}
+
+	return status, nil
+}
+
+// CheckSchema ...
+// Returns ErrSchemaOutdated if any migration built into the binary
+// has not been applied to the database.
+func (wdb *WarblerDB) CheckSchema() error {
+	status, err := wdb.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range status {
+		if !s.Applied {
+			return ErrSchemaOutdated
+		}
+	}
+
+	return nil
+}
+
+// runMigration ...
+// Executes one direction of a migration and records the result.
+func (wdb *WarblerDB) runMigration(m Migration, up bool) (err error) {
+	tx, err := wdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// migrations are written for their dialect and are not rebound
+	stmt := m.down
+	if up {
+		stmt = m.up
+	}
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return ErrMigrationFailed{m.Version, err}
+	}
+
+	if up {
+		_, err = tx.Exec(wdb.dialect.rebind("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"),
+			m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(wdb.dialect.rebind("DELETE FROM schema_migrations WHERE version = $1"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp ...
+// Applies every migration that has not yet been applied, in order.
+// Returns the migrations that were applied.
+func (wdb *WarblerDB) MigrateUp() (applied []Migration, err error) {
+	status, err := wdb.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range status {
+		if s.Applied {
+			continue
+		}
+
+		err = wdb.runMigration(s.Migration, true)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, s.Migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown ...
+// Reverts the most recently applied migration and returns it.
+// Returns ErrNotPresent if no migrations have been applied.
+func (wdb *WarblerDB) MigrateDown() (reverted Migration, err error) {
+	status, err := wdb.MigrationStatus()
+	if err != nil {
+		return reverted, err
+	}
+
+	for i := len(status) - 1; i >= 0; i-- {
+		if !status[i].Applied {
+			continue
+		}
+
+		if status[i].down == "" {
+			return reverted, ErrIrreversibleMigration
+		}
+
+		err = wdb.runMigration(status[i].Migration, false)
+		if err != nil {
+			return reverted, err
+		}
+		return status[i].Migration, nil
+	}
+
+	return reverted, ErrNotPresent
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrationsMatch ...
+// Every migration must exist for every supported driver.
+func TestMigrationsMatch(t *testing.T) {
+	pg, err := (&WarblerDB{dialect: postgresDialect}).Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lite, err := (&WarblerDB{dialect: sqliteDialect}).Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pg) != len(lite) {
+		t.Fatalf("number of migrations differ\n\tpostgres: %d\n\tsqlite3:  %d", len(pg), len(lite))
+	}
+
+	for i := range pg {
+		if pg[i].Version != lite[i].Version || pg[i].Name != lite[i].Name {
+			t.Errorf("migration %d differs\n\tpostgres: %d %s\n\tsqlite3:  %d %s",
+				i, pg[i].Version, pg[i].Name, lite[i].Version, lite[i].Name)
+		}
+		if pg[i].down == "" || lite[i].down == "" {
+			t.Errorf("migration %d %s has no down migration", pg[i].Version, pg[i].Name)
+		}
+	}
+}
+
+// TestMigrateUpDown ...
+func TestMigrateUpDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warbler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mdb, err := Open("sqlite3", filepath.Join(dir, "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+
+	migrations, err := mdb.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	if err := mdb.CheckSchema(); err != ErrSchemaOutdated {
+		t.Errorf("expected an outdated schema, received: %v", err)
+	}
+
+	applied, err := mdb.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("expected %d migrations to be applied, %d were", len(migrations), len(applied))
+	}
+
+	if err := mdb.CheckSchema(); err != nil {
+		t.Errorf("expected an up to date schema, received: %v", err)
+	}
+
+	// applying again is a no-op
+	applied, err = mdb.MigrateUp()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("unexpected second migration: %v %v", applied, err)
+	}
+
+	reverted, err := mdb.MigrateDown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverted.Version != latest {
+		t.Errorf("expected to revert %d, reverted %d", latest, reverted.Version)
+	}
+
+	version, err := mdb.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version >= latest {
+		t.Errorf("unexpected schema version after revert: %d", version)
+	}
+
+	if err := mdb.CheckSchema(); err != ErrSchemaOutdated {
+		t.Errorf("expected an outdated schema, received: %v", err)
+	}
+
+	// every down migration must leave the database migratable
+	for {
+		_, err = mdb.MigrateDown()
+		if err == ErrNotPresent {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = mdb.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
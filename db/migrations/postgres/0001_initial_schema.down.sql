@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS config.users;
+DROP TABLE IF EXISTS config.preferences;
+DROP SCHEMA IF EXISTS config;
+
+DROP TABLE IF EXISTS music.songs_in_library;
+DROP TABLE IF EXISTS music.songs;
+DROP TABLE IF EXISTS music.images_in_album;
+DROP TABLE IF EXISTS music.albums;
+DROP TABLE IF EXISTS music.images;
+DROP TABLE IF EXISTS music.genres;
+DROP TABLE IF EXISTS music.artists;
+DROP TABLE IF EXISTS music.libraries;
+DROP SCHEMA IF EXISTS music;
@@ -0,0 +1,13 @@
+-- The state of every file seen by a library scan, used to skip
+-- unchanged files when rescanning.
+CREATE TABLE IF NOT EXISTS music.file_states (
+       library_id INTEGER NOT NULL REFERENCES music.libraries(id) ON DELETE CASCADE,
+       fs_path VARCHAR NOT NULL,
+
+       file_size BIGINT NOT NULL, -- bytes
+       mod_time BIGINT NOT NULL,  -- nanoseconds since the unix epoch
+       inode BIGINT NOT NULL,     -- 0 where unsupported
+       file_type INTEGER NOT NULL,
+
+       PRIMARY KEY (library_id, fs_path)
+);
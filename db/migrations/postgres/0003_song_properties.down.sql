@@ -0,0 +1,9 @@
+ALTER TABLE music.songs
+      DROP COLUMN IF EXISTS codec,
+      DROP COLUMN IF EXISTS container,
+      DROP COLUMN IF EXISTS bitrate,
+      DROP COLUMN IF EXISTS vbr,
+      DROP COLUMN IF EXISTS sample_rate,
+      DROP COLUMN IF EXISTS bit_depth,
+      DROP COLUMN IF EXISTS channels,
+      DROP COLUMN IF EXISTS lossless;
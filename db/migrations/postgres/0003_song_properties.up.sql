@@ -0,0 +1,11 @@
+-- The technical properties of the audio stream of each song, read
+-- from its headers. Null for songs scanned before they were recorded.
+ALTER TABLE music.songs
+      ADD COLUMN codec VARCHAR,
+      ADD COLUMN container VARCHAR,
+      ADD COLUMN bitrate INTEGER,     -- bits per second, the average if vbr
+      ADD COLUMN vbr BOOLEAN,
+      ADD COLUMN sample_rate INTEGER, -- Hz
+      ADD COLUMN bit_depth INTEGER,   -- null for lossy codecs
+      ADD COLUMN channels INTEGER,
+      ADD COLUMN lossless BOOLEAN;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS music.ux_images_in_album;
+DROP INDEX IF EXISTS music.ix_images_hash;
+
+ALTER TABLE music.images
+      DROP COLUMN IF EXISTS hash,
+      DROP COLUMN IF EXISTS mime_type,
+      DROP COLUMN IF EXISTS source;
@@ -0,0 +1,20 @@
+-- Where each image came from, a file in an album's directory or
+-- artwork embedded in a song and extracted into the cache, and the
+-- sha256 of its contents that embedded artwork is deduplicated by.
+ALTER TABLE music.images
+      ADD COLUMN hash VARCHAR,
+      ADD COLUMN mime_type VARCHAR,
+      ADD COLUMN source VARCHAR NOT NULL DEFAULT 'folder';
+
+CREATE INDEX IF NOT EXISTS ix_images_hash ON music.images (hash);
+
+-- an image is linked to an album once
+DELETE FROM music.images_in_album AS a USING music.images_in_album AS b
+       WHERE a.album_id = b.album_id AND a.image_id = b.image_id AND a.ctid > b.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_images_in_album
+       ON music.images_in_album (album_id, image_id);
+
+-- images were not recorded by earlier scans, they are read again by
+-- the next one
+DELETE FROM music.file_states WHERE file_type = 2;
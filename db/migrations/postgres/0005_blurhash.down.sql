@@ -0,0 +1,2 @@
+ALTER TABLE music.albums DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE music.images DROP COLUMN IF EXISTS blurhash;
@@ -0,0 +1,7 @@
+-- BlurHash placeholders drawn while artwork loads, each album keeps a
+-- copy of the one of its primary image.
+ALTER TABLE music.images ADD COLUMN blurhash VARCHAR;
+ALTER TABLE music.albums ADD COLUMN blurhash VARCHAR;
+
+-- images are read again by the next scan to compute theirs
+DELETE FROM music.file_states WHERE file_type = 2;
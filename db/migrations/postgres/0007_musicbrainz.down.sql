@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS music.ix_songs_mbid;
+DROP INDEX IF EXISTS music.ix_albums_release_group_mbid;
+DROP INDEX IF EXISTS music.ux_albums_mbid;
+DROP INDEX IF EXISTS music.ux_artists_mbid;
+
+ALTER TABLE music.songs DROP COLUMN IF EXISTS mbid;
+ALTER TABLE music.albums DROP COLUMN IF EXISTS release_group_mbid;
+ALTER TABLE music.albums DROP COLUMN IF EXISTS mbid;
+ALTER TABLE music.artists DROP COLUMN IF EXISTS mbid;
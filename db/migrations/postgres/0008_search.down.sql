@@ -0,0 +1,8 @@
+-- the extensions are left installed, other databases of the cluster
+-- may use them
+DROP INDEX IF EXISTS music.ix_genres_search;
+DROP INDEX IF EXISTS music.ix_songs_search;
+DROP INDEX IF EXISTS music.ix_albums_search;
+DROP INDEX IF EXISTS music.ix_artists_search;
+
+DROP FUNCTION IF EXISTS music.search_text(text);
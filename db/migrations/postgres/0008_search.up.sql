@@ -0,0 +1,18 @@
+-- Search matches the trigrams of names folded to lowercase without
+-- accents. unaccent is not immutable, so folding is wrapped in a
+-- function that can be indexed.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE OR REPLACE FUNCTION music.search_text(text) RETURNS text
+       AS $$ SELECT lower(public.unaccent('public.unaccent', $1)) $$
+       LANGUAGE sql IMMUTABLE STRICT;
+
+CREATE INDEX IF NOT EXISTS ix_artists_search
+       ON music.artists USING gin (music.search_text(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS ix_albums_search
+       ON music.albums USING gin (music.search_text(title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS ix_songs_search
+       ON music.songs USING gin (music.search_text(title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS ix_genres_search
+       ON music.genres USING gin (music.search_text(name) gin_trgm_ops);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS music.ix_songs_in_library_library;
+DROP TABLE IF EXISTS config.library_access;
+
+ALTER TABLE config.users DROP COLUMN IF EXISTS admin;
@@ -0,0 +1,13 @@
+-- Admins manage libraries and users and see every library. Other users
+-- only see the records of the libraries they have been granted. Users
+-- created before roles could do everything, so they are admins.
+ALTER TABLE config.users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT false;
+UPDATE config.users SET admin = true;
+
+CREATE TABLE IF NOT EXISTS config.library_access (
+       user_id INTEGER NOT NULL REFERENCES config.users(id),
+       library_id INTEGER NOT NULL REFERENCES music.libraries(id),
+       PRIMARY KEY (user_id, library_id)
+);
+
+CREATE INDEX IF NOT EXISTS ix_songs_in_library_library ON music.songs_in_library (library_id);
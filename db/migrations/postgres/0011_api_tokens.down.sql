@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS config.ix_api_tokens_user;
+DROP TABLE IF EXISTS config.api_tokens;
@@ -0,0 +1,26 @@
+-- Playlists are owned by a user and shared with everyone else either
+-- not at all, read only or collaboratively. sharing is private, read or
+-- collaborative.
+CREATE TABLE IF NOT EXISTS music.playlists (
+       id SERIAL PRIMARY KEY,
+       owner INTEGER NOT NULL REFERENCES config.users(id),
+
+       name VARCHAR NOT NULL,
+       sharing VARCHAR NOT NULL DEFAULT 'private'
+);
+
+CREATE INDEX IF NOT EXISTS ix_playlists_owner ON music.playlists (owner);
+
+-- The songs of playlists. A song can be in a playlist more than once,
+-- so entries have their own id. Entries are ordered by position, which
+-- can have gaps.
+CREATE TABLE IF NOT EXISTS music.playlist_songs (
+       id SERIAL PRIMARY KEY,
+       playlist_id INTEGER NOT NULL REFERENCES music.playlists(id),
+       song_id INTEGER NOT NULL REFERENCES music.songs(id),
+
+       position INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_playlist_songs_position ON music.playlist_songs (playlist_id, position);
+CREATE INDEX IF NOT EXISTS ix_playlist_songs_song ON music.playlist_songs (song_id);
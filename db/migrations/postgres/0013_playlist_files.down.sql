@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS music.ix_playlists_file;
+ALTER TABLE music.playlists DROP COLUMN fs_path;
+ALTER TABLE music.playlists DROP COLUMN library_id;
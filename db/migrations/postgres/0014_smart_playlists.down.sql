@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS music.ix_smart_playlists_owner;
+DROP TABLE IF EXISTS music.smart_playlists;
+ALTER TABLE music.songs DROP COLUMN release_year;
+ALTER TABLE music.songs DROP COLUMN added_at;
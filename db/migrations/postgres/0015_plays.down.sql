@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS music.ix_plays_song;
+DROP INDEX IF EXISTS music.ix_plays_user;
+DROP TABLE IF EXISTS music.plays;
+ALTER TABLE music.songs DROP COLUMN last_played_at;
+ALTER TABLE music.songs DROP COLUMN play_count;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS config.ix_scrobble_queue_scrobbler;
+DROP INDEX IF EXISTS config.ix_scrobble_queue_next_attempt;
+DROP TABLE IF EXISTS config.scrobble_queue;
+DROP INDEX IF EXISTS config.ux_scrobblers_user_service;
+DROP TABLE IF EXISTS config.scrobblers;
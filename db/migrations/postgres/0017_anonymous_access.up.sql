@@ -0,0 +1,5 @@
+-- The libraries requests made without logging in can see, when the
+-- server lets them through. They see no other library.
+CREATE TABLE IF NOT EXISTS config.anonymous_access (
+       library_id INTEGER PRIMARY KEY REFERENCES music.libraries(id)
+);
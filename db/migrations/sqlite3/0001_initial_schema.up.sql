@@ -0,0 +1,99 @@
+-- sqlite has no schemas, tables are named after their postgres
+-- counterparts in ../postgres and must be quoted.
+
+-- Music related
+
+CREATE TABLE IF NOT EXISTS "music.libraries" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       name VARCHAR UNIQUE NOT NULL,
+       fs_path VARCHAR UNIQUE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_libraries ON "music.libraries" (id, name);
+
+CREATE TABLE IF NOT EXISTS "music.artists" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       name VARCHAR NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_artists ON "music.artists" (id, name);
+
+CREATE TABLE IF NOT EXISTS "music.genres" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       name VARCHAR UNIQUE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_genres ON "music.genres" (id, name);
+
+CREATE TABLE IF NOT EXISTS "music.images" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       fs_path VARCHAR UNIQUE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_images ON "music.images" (id);
+
+CREATE TABLE IF NOT EXISTS "music.albums" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       artist INTEGER REFERENCES "music.artists"(id),
+
+       title VARCHAR NOT NULL,
+
+       release_year INTEGER,
+       num_tracks INTEGER, -- number of songs
+       num_disks INTEGER,  -- number of disks
+       duration REAL       -- seconds
+);
+
+CREATE INDEX IF NOT EXISTS ix_albums ON "music.albums" (id, title);
+
+CREATE TABLE IF NOT EXISTS "music.images_in_album" (
+       album_id INTEGER REFERENCES "music.albums"(id),
+       image_id INTEGER REFERENCES "music.images"(id),
+       primary_image BOOLEAN NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "music.songs" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       -- foreign keys
+       album INTEGER REFERENCES "music.albums"(id),
+       genre INTEGER REFERENCES "music.genres"(id),
+
+       -- not null
+       fs_path VARCHAR UNIQUE NOT NULL,
+       title VARCHAR NOT NULL,
+       song_size BIGINT NOT NULL, -- bytes
+       duration REAL NOT NULL,    -- seconds
+
+       -- nullable
+       track INTEGER,
+       num_tracks INTEGER,
+       disk INTEGER,
+       num_disks INTEGER,
+       artist VARCHAR
+);
+
+CREATE INDEX IF NOT EXISTS ix_songs ON "music.songs" (id, title);
+
+CREATE TABLE IF NOT EXISTS "music.songs_in_library" (
+       song_id INTEGER REFERENCES "music.songs"(id),
+       library_id INTEGER REFERENCES "music.libraries"(id),
+       PRIMARY KEY (song_id, library_id)
+);
+
+-- Settings related
+
+CREATE TABLE IF NOT EXISTS "config.preferences" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT
+);
+
+CREATE TABLE IF NOT EXISTS "config.users" (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+      preference_id INTEGER REFERENCES "config.preferences"(id),
+
+      user_name VARCHAR UNIQUE NOT NULL,
+      email VARCHAR NOT NULL,
+      password VARCHAR NOT NULL
+);
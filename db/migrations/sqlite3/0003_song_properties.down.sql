@@ -0,0 +1,36 @@
+-- sqlite cannot drop columns, the table is rebuilt without them. The
+-- rows referencing songs are only checked once they are back.
+PRAGMA defer_foreign_keys = ON;
+
+CREATE TABLE songs_backup AS
+       SELECT id, album, genre, fs_path, title, song_size, duration,
+              track, num_tracks, disk, num_disks, artist
+       FROM "music.songs";
+
+DROP TABLE "music.songs";
+
+CREATE TABLE "music.songs" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       -- foreign keys
+       album INTEGER REFERENCES "music.albums"(id),
+       genre INTEGER REFERENCES "music.genres"(id),
+
+       -- not null
+       fs_path VARCHAR UNIQUE NOT NULL,
+       title VARCHAR NOT NULL,
+       song_size BIGINT NOT NULL, -- bytes
+       duration REAL NOT NULL,    -- seconds
+
+       -- nullable
+       track INTEGER,
+       num_tracks INTEGER,
+       disk INTEGER,
+       num_disks INTEGER,
+       artist VARCHAR
+);
+
+INSERT INTO "music.songs" SELECT * FROM songs_backup;
+DROP TABLE songs_backup;
+
+CREATE INDEX IF NOT EXISTS ix_songs ON "music.songs" (id, title);
@@ -0,0 +1,10 @@
+-- The technical properties of the audio stream of each song, read
+-- from its headers. Null for songs scanned before they were recorded.
+ALTER TABLE "music.songs" ADD COLUMN codec VARCHAR;
+ALTER TABLE "music.songs" ADD COLUMN container VARCHAR;
+ALTER TABLE "music.songs" ADD COLUMN bitrate INTEGER;     -- bits per second, the average if vbr
+ALTER TABLE "music.songs" ADD COLUMN vbr BOOLEAN;
+ALTER TABLE "music.songs" ADD COLUMN sample_rate INTEGER; -- Hz
+ALTER TABLE "music.songs" ADD COLUMN bit_depth INTEGER;   -- null for lossy codecs
+ALTER TABLE "music.songs" ADD COLUMN channels INTEGER;
+ALTER TABLE "music.songs" ADD COLUMN lossless BOOLEAN;
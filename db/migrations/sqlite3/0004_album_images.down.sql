@@ -0,0 +1,21 @@
+DROP INDEX IF EXISTS ux_images_in_album;
+DROP INDEX IF EXISTS ix_images_hash;
+
+-- sqlite cannot drop columns, the table is rebuilt without them. The
+-- rows referencing images are only checked once they are back.
+PRAGMA defer_foreign_keys = ON;
+
+CREATE TABLE images_backup AS
+       SELECT id, fs_path FROM "music.images";
+
+DROP TABLE "music.images";
+
+CREATE TABLE "music.images" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       fs_path VARCHAR UNIQUE NOT NULL
+);
+
+INSERT INTO "music.images" SELECT * FROM images_backup;
+DROP TABLE images_backup;
+
+CREATE INDEX IF NOT EXISTS ix_images ON "music.images" (id);
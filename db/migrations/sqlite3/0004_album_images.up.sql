@@ -0,0 +1,19 @@
+-- Where each image came from, a file in an album's directory or
+-- artwork embedded in a song and extracted into the cache, and the
+-- sha256 of its contents that embedded artwork is deduplicated by.
+ALTER TABLE "music.images" ADD COLUMN hash VARCHAR;
+ALTER TABLE "music.images" ADD COLUMN mime_type VARCHAR;
+ALTER TABLE "music.images" ADD COLUMN source VARCHAR NOT NULL DEFAULT 'folder';
+
+CREATE INDEX IF NOT EXISTS ix_images_hash ON "music.images" (hash);
+
+-- an image is linked to an album once
+DELETE FROM "music.images_in_album" WHERE rowid NOT IN
+       (SELECT MIN(rowid) FROM "music.images_in_album" GROUP BY album_id, image_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_images_in_album
+       ON "music.images_in_album" (album_id, image_id);
+
+-- images were not recorded by earlier scans, they are read again by
+-- the next one
+DELETE FROM "music.file_states" WHERE file_type = 2;
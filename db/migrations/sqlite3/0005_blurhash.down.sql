@@ -0,0 +1,47 @@
+-- sqlite cannot drop columns, the tables are rebuilt without them.
+-- The rows referencing albums and images are only checked once they
+-- are back.
+PRAGMA defer_foreign_keys = ON;
+
+CREATE TABLE albums_backup AS
+       SELECT id, artist, title, release_year, num_tracks, num_disks, duration
+       FROM "music.albums";
+
+DROP TABLE "music.albums";
+
+CREATE TABLE "music.albums" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       artist INTEGER REFERENCES "music.artists"(id),
+
+       title VARCHAR NOT NULL,
+
+       release_year INTEGER,
+       num_tracks INTEGER, -- number of songs
+       num_disks INTEGER,  -- number of disks
+       duration REAL       -- seconds
+);
+
+INSERT INTO "music.albums" SELECT * FROM albums_backup;
+DROP TABLE albums_backup;
+
+CREATE INDEX IF NOT EXISTS ix_albums ON "music.albums" (id, title);
+
+CREATE TABLE images_backup AS
+       SELECT id, fs_path, hash, mime_type, source FROM "music.images";
+
+DROP TABLE "music.images";
+
+CREATE TABLE "music.images" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       fs_path VARCHAR UNIQUE NOT NULL,
+       hash VARCHAR,
+       mime_type VARCHAR,
+       source VARCHAR NOT NULL DEFAULT 'folder'
+);
+
+INSERT INTO "music.images" SELECT * FROM images_backup;
+DROP TABLE images_backup;
+
+CREATE INDEX IF NOT EXISTS ix_images ON "music.images" (id);
+CREATE INDEX IF NOT EXISTS ix_images_hash ON "music.images" (hash);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_song_artists_artist;
+DROP TABLE IF EXISTS "music.song_artists";
@@ -0,0 +1,26 @@
+-- Every artist credited on a song and their role, primary, featured,
+-- composer, remixer or producer, in the order they are credited.
+CREATE TABLE IF NOT EXISTS "music.song_artists" (
+       song_id INTEGER NOT NULL REFERENCES "music.songs"(id),
+       artist_id INTEGER NOT NULL REFERENCES "music.artists"(id),
+       role VARCHAR NOT NULL,
+       position INTEGER NOT NULL,
+
+       UNIQUE (song_id, artist_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS ix_song_artists_artist ON "music.song_artists" (artist_id);
+
+-- songs scanned before are credited to their artist until the next
+-- scan reads them again for the rest
+INSERT INTO "music.artists" (name)
+       SELECT DISTINCT artist FROM "music.songs"
+       WHERE artist IS NOT NULL AND artist <> ''
+             AND artist NOT IN (SELECT name FROM "music.artists");
+
+INSERT INTO "music.song_artists" (song_id, artist_id, role, position)
+       SELECT songs.id, MIN(artists.id), 'primary', 0
+       FROM "music.songs" AS songs JOIN "music.artists" AS artists ON artists.name = songs.artist
+       GROUP BY songs.id;
+
+DELETE FROM "music.file_states" WHERE file_type = 1;
@@ -0,0 +1,93 @@
+-- sqlite cannot drop columns, the tables are rebuilt without them.
+-- The rows referencing artists, albums and songs are only checked once
+-- they are back.
+PRAGMA defer_foreign_keys = ON;
+
+DROP INDEX IF EXISTS ix_songs_mbid;
+DROP INDEX IF EXISTS ix_albums_release_group_mbid;
+DROP INDEX IF EXISTS ux_albums_mbid;
+DROP INDEX IF EXISTS ux_artists_mbid;
+
+CREATE TABLE artists_backup AS SELECT id, name FROM "music.artists";
+
+DROP TABLE "music.artists";
+
+CREATE TABLE "music.artists" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       name VARCHAR NOT NULL
+);
+
+INSERT INTO "music.artists" SELECT * FROM artists_backup;
+DROP TABLE artists_backup;
+
+CREATE INDEX IF NOT EXISTS ix_artists ON "music.artists" (id, name);
+
+CREATE TABLE albums_backup AS
+       SELECT id, artist, title, release_year, num_tracks, num_disks, duration,
+              blurhash
+       FROM "music.albums";
+
+DROP TABLE "music.albums";
+
+CREATE TABLE "music.albums" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       artist INTEGER REFERENCES "music.artists"(id),
+
+       title VARCHAR NOT NULL,
+
+       release_year INTEGER,
+       num_tracks INTEGER, -- number of songs
+       num_disks INTEGER,  -- number of disks
+       duration REAL,      -- seconds
+       blurhash VARCHAR
+);
+
+INSERT INTO "music.albums" SELECT * FROM albums_backup;
+DROP TABLE albums_backup;
+
+CREATE INDEX IF NOT EXISTS ix_albums ON "music.albums" (id, title);
+
+CREATE TABLE songs_backup AS
+       SELECT id, album, genre, fs_path, title, song_size, duration,
+              track, num_tracks, disk, num_disks, artist,
+              codec, container, bitrate, vbr, sample_rate, bit_depth,
+              channels, lossless
+       FROM "music.songs";
+
+DROP TABLE "music.songs";
+
+CREATE TABLE "music.songs" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       -- foreign keys
+       album INTEGER REFERENCES "music.albums"(id),
+       genre INTEGER REFERENCES "music.genres"(id),
+
+       -- not null
+       fs_path VARCHAR UNIQUE NOT NULL,
+       title VARCHAR NOT NULL,
+       song_size BIGINT NOT NULL, -- bytes
+       duration REAL NOT NULL,    -- seconds
+
+       -- nullable
+       track INTEGER,
+       num_tracks INTEGER,
+       disk INTEGER,
+       num_disks INTEGER,
+       artist VARCHAR,
+
+       codec VARCHAR,
+       container VARCHAR,
+       bitrate INTEGER,     -- bits per second, the average if vbr
+       vbr BOOLEAN,
+       sample_rate INTEGER, -- Hz
+       bit_depth INTEGER,   -- null for lossy codecs
+       channels INTEGER,
+       lossless BOOLEAN
+);
+
+INSERT INTO "music.songs" SELECT * FROM songs_backup;
+DROP TABLE songs_backup;
+
+CREATE INDEX IF NOT EXISTS ix_songs ON "music.songs" (id, title);
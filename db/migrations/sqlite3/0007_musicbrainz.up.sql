@@ -0,0 +1,16 @@
+-- MusicBrainz identifiers read from tags: artists, albums (releases)
+-- and their release groups, and songs (recordings). Albums and artists
+-- with one are identified by it rather than by their other fields.
+ALTER TABLE "music.artists" ADD COLUMN mbid VARCHAR;
+ALTER TABLE "music.albums" ADD COLUMN mbid VARCHAR;
+ALTER TABLE "music.albums" ADD COLUMN release_group_mbid VARCHAR;
+ALTER TABLE "music.songs" ADD COLUMN mbid VARCHAR;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_artists_mbid ON "music.artists" (mbid);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_albums_mbid ON "music.albums" (mbid);
+CREATE INDEX IF NOT EXISTS ix_albums_release_group_mbid ON "music.albums" (release_group_mbid);
+-- a recording may be on several releases
+CREATE INDEX IF NOT EXISTS ix_songs_mbid ON "music.songs" (mbid);
+
+-- songs are read again by the next scan to record theirs
+DELETE FROM "music.file_states" WHERE file_type = 1;
@@ -0,0 +1 @@
+-- Nothing to do, see 0008_search.up.sql.
@@ -0,0 +1,4 @@
+-- Nothing to do: sqlite searches with functions registered on each
+-- connection in place of pg_trgm and unaccent, and scans the tables
+-- rather than indexing them. Indexes on those functions would leave
+-- the database unwritable by anything that does not register them.
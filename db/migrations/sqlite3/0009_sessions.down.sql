@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_sessions_user;
+DROP TABLE IF EXISTS "config.sessions";
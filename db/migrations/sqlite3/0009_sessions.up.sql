@@ -0,0 +1,11 @@
+-- The sessions users are logged in with. Only a hash of the token
+-- given to the client is kept.
+CREATE TABLE IF NOT EXISTS "config.sessions" (
+       token_hash VARCHAR PRIMARY KEY, -- hex sha256 of the token
+       user_id INTEGER NOT NULL REFERENCES "config.users"(id) ON DELETE CASCADE,
+
+       created_at BIGINT NOT NULL, -- seconds since the unix epoch
+       expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_sessions_user ON "config.sessions" (user_id);
@@ -0,0 +1,25 @@
+-- sqlite cannot drop columns, the users table is rebuilt without it.
+-- Dropping it logs every user out.
+PRAGMA defer_foreign_keys = ON;
+
+DROP INDEX IF EXISTS ix_songs_in_library_library;
+DROP TABLE IF EXISTS "config.library_access";
+
+CREATE TABLE users_backup AS
+       SELECT id, preference_id, user_name, email, password
+       FROM "config.users";
+
+DROP TABLE "config.users";
+
+CREATE TABLE "config.users" (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+      preference_id INTEGER REFERENCES "config.preferences"(id),
+
+      user_name VARCHAR UNIQUE NOT NULL,
+      email VARCHAR NOT NULL,
+      password VARCHAR NOT NULL
+);
+
+INSERT INTO "config.users" SELECT * FROM users_backup;
+DROP TABLE users_backup;
@@ -0,0 +1,16 @@
+-- Long lived tokens users make for scripts and other clients. Like
+-- sessions only a hash of the token is kept. scope is read, stream or
+-- admin.
+CREATE TABLE IF NOT EXISTS "config.api_tokens" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       user_id INTEGER NOT NULL REFERENCES "config.users"(id),
+
+       name VARCHAR NOT NULL,
+       scope VARCHAR NOT NULL,
+       token_hash VARCHAR UNIQUE NOT NULL, -- hex sha256 of the token
+
+       created_at BIGINT NOT NULL, -- seconds since the unix epoch
+       last_used_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS ix_api_tokens_user ON "config.api_tokens" (user_id);
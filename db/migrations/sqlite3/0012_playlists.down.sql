@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS ix_playlist_songs_song;
+DROP INDEX IF EXISTS ix_playlist_songs_position;
+DROP TABLE IF EXISTS "music.playlist_songs";
+DROP INDEX IF EXISTS ix_playlists_owner;
+DROP TABLE IF EXISTS "music.playlists";
@@ -0,0 +1,25 @@
+-- sqlite cannot drop columns, the playlists table is rebuilt without
+-- them. Imported playlists are kept as they are.
+PRAGMA defer_foreign_keys = ON;
+
+DROP INDEX IF EXISTS ix_playlists_file;
+
+CREATE TABLE playlists_backup AS
+       SELECT id, owner, name, sharing
+       FROM "music.playlists";
+
+DROP INDEX IF EXISTS ix_playlists_owner;
+DROP TABLE "music.playlists";
+
+CREATE TABLE "music.playlists" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       owner INTEGER NOT NULL REFERENCES "config.users"(id),
+
+       name VARCHAR NOT NULL,
+       sharing VARCHAR NOT NULL DEFAULT 'private'
+);
+
+CREATE INDEX IF NOT EXISTS ix_playlists_owner ON "music.playlists" (owner);
+
+INSERT INTO "music.playlists" SELECT * FROM playlists_backup;
+DROP TABLE playlists_backup;
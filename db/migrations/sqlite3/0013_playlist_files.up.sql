@@ -0,0 +1,6 @@
+-- Playlists imported from the playlist files of a library keep its id
+-- and the path of their file, so they are replaced when it changes.
+ALTER TABLE "music.playlists" ADD COLUMN library_id INTEGER REFERENCES "music.libraries"(id);
+ALTER TABLE "music.playlists" ADD COLUMN fs_path VARCHAR;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ix_playlists_file ON "music.playlists" (library_id, fs_path);
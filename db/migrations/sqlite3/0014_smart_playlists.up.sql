@@ -0,0 +1,26 @@
+-- When songs were first scanned, null for those scanned before it was
+-- recorded, and the year of their tags, so that smart playlists can
+-- select the songs added lately or of some years. Songs have the year of
+-- their album until they are scanned again.
+ALTER TABLE "music.songs" ADD COLUMN added_at BIGINT; -- seconds since the unix epoch
+ALTER TABLE "music.songs" ADD COLUMN release_year INTEGER;
+
+UPDATE "music.songs" SET release_year = (SELECT NULLIF(albums.release_year, 0) FROM "music.albums" AS albums WHERE albums.id = album);
+
+-- Smart playlists are the songs meeting their rules, a filter of songs
+-- kept as json, read again each time the playlist is. order_by is a
+-- comma separated list of song fields, or random, and max_songs the
+-- most songs read. sharing is private or read.
+CREATE TABLE IF NOT EXISTS "music.smart_playlists" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       owner INTEGER NOT NULL REFERENCES "config.users"(id),
+
+       name VARCHAR NOT NULL,
+       sharing VARCHAR NOT NULL DEFAULT 'private',
+
+       rules VARCHAR NOT NULL DEFAULT '{}',
+       order_by VARCHAR,
+       max_songs INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS ix_smart_playlists_owner ON "music.smart_playlists" (owner);
@@ -0,0 +1,59 @@
+-- sqlite cannot drop columns, the songs table is rebuilt without them.
+-- The rows referencing songs are only checked once they are back.
+PRAGMA defer_foreign_keys = ON;
+
+DROP INDEX IF EXISTS ix_plays_song;
+DROP INDEX IF EXISTS ix_plays_user;
+DROP TABLE IF EXISTS "music.plays";
+
+DROP INDEX IF EXISTS ix_songs_mbid;
+DROP INDEX IF EXISTS ix_songs;
+
+CREATE TABLE songs_backup AS
+       SELECT id, album, genre, fs_path, title, song_size, duration,
+              track, num_tracks, disk, num_disks, artist,
+              codec, container, bitrate, vbr, sample_rate, bit_depth,
+              channels, lossless, mbid, added_at, release_year
+       FROM "music.songs";
+
+DROP TABLE "music.songs";
+
+CREATE TABLE "music.songs" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+       -- foreign keys
+       album INTEGER REFERENCES "music.albums"(id),
+       genre INTEGER REFERENCES "music.genres"(id),
+
+       -- not null
+       fs_path VARCHAR UNIQUE NOT NULL,
+       title VARCHAR NOT NULL,
+       song_size BIGINT NOT NULL, -- bytes
+       duration REAL NOT NULL,    -- seconds
+
+       -- nullable
+       track INTEGER,
+       num_tracks INTEGER,
+       disk INTEGER,
+       num_disks INTEGER,
+       artist VARCHAR,
+
+       codec VARCHAR,
+       container VARCHAR,
+       bitrate INTEGER,     -- bits per second, the average if vbr
+       vbr BOOLEAN,
+       sample_rate INTEGER, -- Hz
+       bit_depth INTEGER,   -- null for lossy codecs
+       channels INTEGER,
+       lossless BOOLEAN,
+
+       mbid VARCHAR,
+       added_at BIGINT, -- seconds since the unix epoch
+       release_year INTEGER
+);
+
+INSERT INTO "music.songs" SELECT * FROM songs_backup;
+DROP TABLE songs_backup;
+
+CREATE INDEX IF NOT EXISTS ix_songs ON "music.songs" (id, title);
+CREATE INDEX IF NOT EXISTS ix_songs_mbid ON "music.songs" (mbid);
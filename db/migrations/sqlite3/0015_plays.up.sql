@@ -0,0 +1,20 @@
+-- Plays are the songs users listened to, either scrobbled by their
+-- player or recorded once enough of a song was streamed. duration is
+-- how long they listened and source scrobble or stream.
+CREATE TABLE IF NOT EXISTS "music.plays" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       user_id INTEGER NOT NULL REFERENCES "config.users"(id),
+       song_id INTEGER NOT NULL REFERENCES "music.songs"(id),
+
+       played_at BIGINT NOT NULL, -- seconds since the unix epoch
+       duration REAL NOT NULL,    -- seconds
+       source VARCHAR NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_plays_user ON "music.plays" (user_id, played_at);
+CREATE INDEX IF NOT EXISTS ix_plays_song ON "music.plays" (song_id);
+
+-- How many times songs were played by anyone and when they last were,
+-- kept with the songs so that they can be filtered and ordered by.
+ALTER TABLE "music.songs" ADD COLUMN play_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "music.songs" ADD COLUMN last_played_at BIGINT; -- seconds since the unix epoch
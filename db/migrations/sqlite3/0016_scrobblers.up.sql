@@ -0,0 +1,30 @@
+-- Scrobblers are the services users have their plays forwarded to.
+-- service is listenbrainz or lastfm, and token the user's ListenBrainz
+-- user token or Last.fm session key, kept as it is to be sent.
+CREATE TABLE IF NOT EXISTS "config.scrobblers" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       user_id INTEGER NOT NULL REFERENCES "config.users"(id),
+
+       service VARCHAR NOT NULL,
+       token VARCHAR NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_scrobblers_user_service ON "config.scrobblers" (user_id, service);
+
+-- The plays waiting to be forwarded to scrobblers, as the json of the
+-- listen to submit. Plays that could not be sent are tried again once
+-- next_attempt_at has passed, last_error saying why they failed.
+CREATE TABLE IF NOT EXISTS "config.scrobble_queue" (
+       id INTEGER PRIMARY KEY AUTOINCREMENT,
+       scrobbler_id INTEGER NOT NULL REFERENCES "config.scrobblers"(id),
+
+       listen VARCHAR NOT NULL,
+       created_at BIGINT NOT NULL, -- seconds since the unix epoch
+
+       attempts INTEGER NOT NULL DEFAULT 0,
+       next_attempt_at BIGINT NOT NULL, -- seconds since the unix epoch
+       last_error VARCHAR
+);
+
+CREATE INDEX IF NOT EXISTS ix_scrobble_queue_next_attempt ON "config.scrobble_queue" (next_attempt_at);
+CREATE INDEX IF NOT EXISTS ix_scrobble_queue_scrobbler ON "config.scrobble_queue" (scrobbler_id);
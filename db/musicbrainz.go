@@ -0,0 +1,276 @@
+package db
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"gitlab.stergianis.ca/michael/warbler/audio"
+)
+
+var (
+	// mbidPattern matches a MusicBrainz id, a lowercase UUID.
+	mbidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+	// mbidSeparators separate the ids in tags that hold several but
+	// cannot have multiple values, like ID3v2.3 and MP4 ones.
+	mbidSeparators = regexp.MustCompile(`\s*[;/]\s*`)
+)
+
+// ParseMBID ...
+// Returns a MusicBrainz id in its canonical lowercase form.
+func ParseMBID(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !mbidPattern.MatchString(s) {
+		return "", ErrInvalidMBID
+	}
+	return s, nil
+}
+
+// musicBrainzIDs ...
+// The MusicBrainz ids a file is tagged with, empty when it has none.
+type musicBrainzIDs struct {
+	artists      []string // of the artists in the ARTISTS tag, in order
+	albumArtist  string
+	release      string
+	releaseGroup string
+	recording    string
+}
+
+// readMusicBrainzIDs ...
+// Reads the MusicBrainz ids written by taggers like Picard. Tags that
+// cannot be read by ReadTags are looked for in the metadata instead.
+// Ids that are not valid are ignored.
+func readMusicBrainzIDs(metadata tag.Metadata, tags audio.Tags) (ids musicBrainzIDs) {
+	raw := rawTags(metadata)
+	values := func(name string) (mbids []string) {
+		v := tags[name]
+		if len(v) == 0 {
+			v = raw[name]
+		}
+		for _, s := range v {
+			for _, id := range mbidSeparators.Split(s, -1) {
+				if id, err := ParseMBID(id); err == nil {
+					mbids = append(mbids, id)
+				}
+			}
+		}
+		return mbids
+	}
+	single := func(name string) string {
+		if v := values(name); len(v) == 1 {
+			return v[0]
+		}
+		return ""
+	}
+
+	ids.artists = values("musicbrainz_artistid")
+	ids.albumArtist = single("musicbrainz_albumartistid")
+	ids.release = single("musicbrainz_albumid")
+	ids.releaseGroup = single("musicbrainz_releasegroupid")
+	ids.recording = single("musicbrainz_trackid")
+	return ids
+}
+
+// rawTags ...
+// Returns the text tags exposed by the metadata reader, named like
+// those of ReadTags.
+func rawTags(metadata tag.Metadata) audio.Tags {
+	tags := audio.Tags{}
+	for name, v := range metadata.Raw() {
+		switch v := v.(type) {
+		case string:
+			tags[audio.TagName(name)] = []string{v}
+		case *tag.Comm:
+			if strings.HasPrefix(name, "TXX") {
+				tags[audio.TagName(v.Description)] = []string{v.Text}
+			}
+		case *tag.UFID:
+			if v.Provider == audio.MusicBrainzOwner {
+				tags["musicbrainz_trackid"] = []string{string(v.Identifier)}
+			}
+		}
+	}
+	return tags
+}
+
+// setArtistIDs ...
+// Gives the primary artists credited on a song their ids, when there
+// is one for each of them.
+func (ids musicBrainzIDs) setArtistIDs(credits []Credit) {
+	var primary []int
+	for i, c := range credits {
+		if c.Role == RolePrimary {
+			primary = append(primary, i)
+		}
+	}
+	if len(primary) != len(ids.artists) {
+		return
+	}
+	for i, c := range primary {
+		credits[c].mbid = NewNullString(ids.artists[i])
+	}
+}
+
+// musicBrainzIdentified is implemented by the records that are
+// identified by their MusicBrainz id when they have one.
+type musicBrainzIdentified interface {
+	musicBrainzID() NullString
+}
+
+func (a Artist) musicBrainzID() NullString { return a.MBID }
+func (a Album) musicBrainzID() NullString  { return a.MBID }
+
+// isMusicBrainzColumn ...
+// Reports whether a field holds a MusicBrainz id.
+func isMusicBrainzColumn(f reflect.StructField) bool {
+	name := f.Tag.Get("sql")
+	return name == "mbid" || strings.HasSuffix(name, "_mbid")
+}
+
+// findIdentified ...
+// Looks for the record with the MusicBrainz id of query, filling in
+// query from it. Failing that a record from before ids were read that
+// matches the rest of query is given the ids of query. Must be called
+// holding createMu.
+func (wdb *WarblerDB) findIdentified(query interface{}) (found bool, err error) {
+	rQuery := reflect.ValueOf(query)
+	if rQuery.Kind() != reflect.Ptr {
+		return false, ErrReflection
+	}
+	rQuery = rQuery.Elem()
+	rType := rQuery.Type()
+
+	byID := reflect.New(rType)
+	without := reflect.New(rType)
+	without.Elem().Set(rQuery)
+	for i := 0; i < rType.NumField(); i++ {
+		if isMusicBrainzColumn(rType.Field(i)) {
+			without.Elem().Field(i).Set(reflect.Zero(rType.Field(i).Type))
+		}
+		if rType.Field(i).Tag.Get("sql") == "mbid" {
+			byID.Elem().Field(i).Set(rQuery.Field(i))
+		}
+	}
+
+	results, err := wdb.read(byID.Interface(), []string{})
+	if err != nil {
+		return false, err
+	}
+	if len(results) > 1 {
+		return false, ErrNonUnique{query}
+	}
+	if len(results) == 1 {
+		return true, setMissingValues(results[0], query)
+	}
+
+	results, err = wdb.read(without.Interface(), []string{})
+	if err != nil {
+		return false, err
+	}
+	var legacy []reflect.Value
+	for _, r := range results {
+		if !r.(musicBrainzIdentified).musicBrainzID().Valid {
+			legacy = append(legacy, reflect.ValueOf(r))
+		}
+	}
+	if len(legacy) != 1 {
+		return false, nil
+	}
+
+	// the ids of query are recorded on the row
+	row := reflect.New(rType).Elem()
+	row.Set(legacy[0])
+	set := reflect.New(rType)
+	where := reflect.New(rType)
+	for i := 0; i < rType.NumField(); i++ {
+		switch {
+		case isMusicBrainzColumn(rType.Field(i)) && !IsZero(rQuery.Field(i)):
+			set.Elem().Field(i).Set(rQuery.Field(i))
+			row.Field(i).Set(rQuery.Field(i))
+		case rType.Field(i).Tag.Get("sql") == "id":
+			where.Elem().Field(i).Set(row.Field(i))
+		}
+	}
+	_, err = wdb.Update(set.Interface(), where.Interface())
+	if err != nil {
+		return false, err
+	}
+
+	return true, setMissingValues(row.Interface(), query)
+}
+
+// createArtist ...
+// Creates an artist or finds the existing one. An artist without a
+// MusicBrainz id is the first with its name when several artists
+// share it.
+func (wdb *WarblerDB) createArtist(a *Artist) error {
+	err := wdb.Create(a, []string{"id"})
+	if _, ok := err.(ErrNonUnique); ok && !a.MBID.Valid {
+		err = wdb.QueryRow("SELECT id, mbid FROM music.artists WHERE name = $1 ORDER BY id",
+			a.Name).Scan(&a.ID, &a.MBID)
+	}
+	if err == ErrAlreadyExists {
+		return nil
+	}
+	return err
+}
+
+// MusicBrainzRecords ...
+// The records with a MusicBrainz id. Albums are those of a release or
+// release group and songs those of a recording.
+type MusicBrainzRecords struct {
+	Artists []Artist `edn:"artists" json:"artists"`
+	Albums  []Album  `edn:"albums"  json:"albums"`
+	Songs   []Song   `edn:"songs"   json:"songs"`
+}
+
+// ReadMBID ...
+// Returns the records with a MusicBrainz id, ErrNotPresent when there
+// are none. Ids are unique across the kinds of records, so at most one
+// kind is found. Only records the user can see are found.
+func (wdb *WarblerDB) ReadMBID(mbid string, user *User) (records MusicBrainzRecords, err error) {
+	mbid, err = ParseMBID(mbid)
+	if err != nil {
+		return records, err
+	}
+
+	records.Artists = []Artist{}
+	records.Albums = []Album{}
+	records.Songs = []Song{}
+
+	queries := []struct {
+		query  interface{}
+		column string
+	}{
+		{Artist{}, "mbid"},
+		{Album{}, "mbid"},
+		{Album{}, "release_group_mbid"},
+		{Song{}, "mbid"},
+	}
+	found := 0
+	for _, q := range queries {
+		filter := AllOf{Condition{q.column, OpEqual, mbid}, Visible(q.query, user)}
+		results, err := wdb.ReadFilter(q.query, filter, []string{"id"})
+		if err != nil {
+			return records, err
+		}
+		found += len(results)
+		for _, r := range results {
+			switch r := r.(type) {
+			case Artist:
+				records.Artists = append(records.Artists, r)
+			case Album:
+				records.Albums = append(records.Albums, r)
+			case Song:
+				records.Songs = append(records.Songs, r)
+			}
+		}
+	}
+	if found == 0 {
+		return records, ErrNotPresent
+	}
+
+	return records, nil
+}
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"gitlab.stergianis.ca/michael/warbler/audio"
+)
+
+const (
+	testArtistMBID  = "0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"
+	testReleaseMBID = "4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56"
+	testGroupMBID   = "9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21"
+	testSongMBID    = "6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09"
+)
+
+// TestParseMBID ...
+func TestParseMBID(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected string
+		err      error
+	}{
+		{testArtistMBID, testArtistMBID, nil},
+		{" 0E7A6E5D-7BD3-4F4A-9A1C-2F3E8C9D0B11\n", testArtistMBID, nil},
+		{"0e7a6e5d7bd34f4a9a1c2f3e8c9d0b11", "", ErrInvalidMBID},
+		{"0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b1", "", ErrInvalidMBID},
+		{"BADBADNOTGOOD", "", ErrInvalidMBID},
+		{"", "", ErrInvalidMBID},
+	}
+
+	for _, test := range tests {
+		mbid, err := ParseMBID(test.in)
+		if mbid != test.expected || err != test.err {
+			t.Errorf("ParseMBID(%q): expected %q %v, received %q %v", test.in, test.expected, test.err, mbid, err)
+		}
+	}
+}
+
+// TestReadMusicBrainzIDs ...
+func TestReadMusicBrainzIDs(t *testing.T) {
+	var tests = []struct {
+		name     string
+		metadata testMetadata
+		tags     audio.Tags
+		expected musicBrainzIDs
+	}{
+		{"untagged", testMetadata{}, audio.Tags{}, musicBrainzIDs{}},
+		{"tags", testMetadata{}, audio.Tags{
+			"musicbrainz_artistid":       {testArtistMBID, testSongMBID},
+			"musicbrainz_albumartistid":  {testArtistMBID},
+			"musicbrainz_albumid":        {testReleaseMBID},
+			"musicbrainz_releasegroupid": {testGroupMBID},
+			"musicbrainz_trackid":        {testSongMBID},
+		}, musicBrainzIDs{
+			artists:      []string{testArtistMBID, testSongMBID},
+			albumArtist:  testArtistMBID,
+			release:      testReleaseMBID,
+			releaseGroup: testGroupMBID,
+			recording:    testSongMBID,
+		}},
+		{"joined and invalid", testMetadata{}, audio.Tags{
+			"musicbrainz_artistid":      {testArtistMBID + "/" + testSongMBID},
+			"musicbrainz_albumartistid": {testArtistMBID + "; " + testSongMBID},
+			"musicbrainz_albumid":       {"not an id"},
+		}, musicBrainzIDs{
+			artists: []string{testArtistMBID, testSongMBID},
+		}},
+		{"metadata", testMetadata{raw: map[string]interface{}{
+			"MusicBrainz Album Id": testReleaseMBID,
+			"TXXX":                 &tag.Comm{Description: "MusicBrainz Release Group Id", Text: testGroupMBID},
+			"UFID":                 &tag.UFID{Provider: audio.MusicBrainzOwner, Identifier: []byte(testSongMBID)},
+			"UFID_0":               &tag.UFID{Provider: "http://www.cddb.com/id3/taginfo1.html", Identifier: []byte(testArtistMBID)},
+		}}, audio.Tags{}, musicBrainzIDs{
+			release:      testReleaseMBID,
+			releaseGroup: testGroupMBID,
+			recording:    testSongMBID,
+		}},
+		{"tags before metadata", testMetadata{raw: map[string]interface{}{
+			"musicbrainz_albumid": testGroupMBID,
+		}}, audio.Tags{
+			"musicbrainz_albumid": {testReleaseMBID},
+		}, musicBrainzIDs{
+			release: testReleaseMBID,
+		}},
+	}
+
+	for _, test := range tests {
+		ids := readMusicBrainzIDs(test.metadata, test.tags)
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%s: expected %+v, received %+v", test.name, test.expected, ids)
+		}
+	}
+}
+
+// TestSetArtistIDs ...
+func TestSetArtistIDs(t *testing.T) {
+	credits := func() []Credit {
+		return []Credit{
+			{Name: "Simpsons", Role: RolePrimary},
+			{Name: "Bart", Role: RoleFeatured},
+			{Name: "Milhouse", Role: RolePrimary},
+		}
+	}
+
+	ids := musicBrainzIDs{artists: []string{testArtistMBID, testSongMBID}}
+	c := credits()
+	ids.setArtistIDs(c)
+	if c[0].mbid != NewNullString(testArtistMBID) || c[1].mbid.Valid || c[2].mbid != NewNullString(testSongMBID) {
+		t.Errorf("expected the primary artists to be given the ids in order, received %+v", c)
+	}
+
+	// ids that cannot be matched to the artists are not used
+	ids = musicBrainzIDs{artists: []string{testArtistMBID}}
+	c = credits()
+	ids.setArtistIDs(c)
+	if !reflect.DeepEqual(c, credits()) {
+		t.Errorf("expected no ids to be given, received %+v", c)
+	}
+}
+
+// TestCreateMusicBrainz ...
+func TestCreateMusicBrainz(t *testing.T) {
+	prepareDB()
+
+	create := func(q interface{}) error {
+		t.Helper()
+		err := wdb.Create(q, []string{"id"})
+		if err != nil && err != ErrAlreadyExists {
+			t.Fatal(err)
+		}
+		return err
+	}
+
+	// albums with different ids are different albums
+	first := &Album{Title: "Greatest Hits", MBID: NewNullString(testSongMBID)}
+	create(first)
+	second := &Album{Title: "Greatest Hits", MBID: NewNullString(testGroupMBID)}
+	create(second)
+	if first.ID == 0 || first.ID == second.ID {
+		t.Errorf("expected two albums, received %d and %d", first.ID, second.ID)
+	}
+
+	// an album is found by its id alone
+	again := &Album{Title: "Greatest Hits", Year: NewNullInt64(1999), MBID: NewNullString(testSongMBID)}
+	if err := create(again); err != ErrAlreadyExists || again.ID != first.ID {
+		t.Errorf("expected album %d to exist, received %d: %v", first.ID, again.ID, err)
+	}
+	existing := &Album{Title: "Different", MBID: NewNullString(testReleaseMBID)}
+	if err := create(existing); err != ErrAlreadyExists || existing.ID != 1 || existing.Title != "III" {
+		t.Errorf("expected album 1 to exist, received %+v: %v", existing, err)
+	}
+
+	// records without an id are given the one of the first record
+	// found like them
+	killers := &Album{Title: "Killers", Artist: NewNullInt64(3),
+		MBID: NewNullString("11111111-2222-4333-8444-555555555555"), ReleaseGroup: NewNullString(testGroupMBID)}
+	if err := create(killers); err != ErrAlreadyExists || killers.ID != 3 {
+		t.Errorf("expected album 3 to be given an id, received %+v: %v", killers, err)
+	}
+	album := Album{ID: 3}
+	err := wdb.ReadUnique(&album)
+	if err != nil || album.MBID != killers.MBID || album.ReleaseGroup != killers.ReleaseGroup || album.Year != NewNullInt64(1980) {
+		t.Errorf("expected the ids of album 3 to be recorded, received %+v: %v", album, err)
+	}
+
+	// artists sharing a name are told apart by their ids
+	maiden := &Artist{Name: "Iron Maiden", MBID: NewNullString(testSongMBID)}
+	create(maiden)
+	if maiden.ID != 3 {
+		t.Errorf("expected artist 3 to be given an id, received %+v", maiden)
+	}
+	other := &Artist{Name: "Iron Maiden", MBID: NewNullString(testGroupMBID)}
+	create(other)
+	if other.ID == 0 || other.ID == maiden.ID {
+		t.Errorf("expected a second Iron Maiden, received %+v", other)
+	}
+
+	// without an id the first of them is used
+	plain := &Artist{Name: "Iron Maiden"}
+	err = wdb.Create(plain, []string{"id"})
+	if _, ok := err.(ErrNonUnique); !ok {
+		t.Errorf("expected the artist to be ambiguous, received %v", err)
+	}
+	plain = &Artist{Name: "Iron Maiden"}
+	err = wdb.createArtist(plain)
+	if err != nil || plain.ID != maiden.ID || plain.MBID != maiden.MBID {
+		t.Errorf("expected artist %d, received %+v: %v", maiden.ID, plain, err)
+	}
+}
+
+// TestReadMBID ...
+func TestReadMBID(t *testing.T) {
+	prepareDB()
+
+	ids := func(records MusicBrainzRecords) (artists, albums, songs []int64) {
+		artists, albums, songs = []int64{}, []int64{}, []int64{}
+		for _, a := range records.Artists {
+			artists = append(artists, a.ID)
+		}
+		for _, a := range records.Albums {
+			albums = append(albums, a.ID)
+		}
+		for _, s := range records.Songs {
+			songs = append(songs, s.ID)
+		}
+		return artists, albums, songs
+	}
+
+	var tests = []struct {
+		mbid                   string
+		artists, albums, songs []int64
+		err                    error
+	}{
+		{testArtistMBID, []int64{1}, []int64{}, []int64{}, nil},
+		{testReleaseMBID, []int64{}, []int64{1}, []int64{}, nil},
+		{testGroupMBID, []int64{}, []int64{1}, []int64{}, nil},
+		{testSongMBID, []int64{}, []int64{}, []int64{1}, nil},
+		{"11111111-2222-4333-8444-555555555555", nil, nil, nil, ErrNotPresent},
+		{"III", nil, nil, nil, ErrInvalidMBID},
+	}
+
+	for _, test := range tests {
+		records, err := wdb.ReadMBID(test.mbid, nil)
+		if err != test.err {
+			t.Errorf("%s: expected %v, received %v", test.mbid, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		artists, albums, songs := ids(records)
+		if !reflect.DeepEqual(artists, test.artists) || !reflect.DeepEqual(albums, test.albums) ||
+			!reflect.DeepEqual(songs, test.songs) {
+			t.Errorf("%s: expected %v %v %v, received %v %v %v", test.mbid,
+				test.artists, test.albums, test.songs, artists, albums, songs)
+		}
+	}
+}
+
+// TestScanLibraryMusicBrainz ...
+func TestScanLibraryMusicBrainz(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "MusicBrainz")
+	defer cleanup()
+
+	const (
+		group     = "44444444-5555-4666-8777-888888888888"
+		simpsons  = "55555555-6666-4777-8888-999999999999"
+		recording = "22222222-3333-4444-8555-666666666666"
+	)
+
+	song, err := ioutil.ReadFile(path.Join(testLib, testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged := func(release string) []byte {
+		return withID3v2(song,
+			id3v2TextFrame("TIT2", "Obey"),
+			id3v2TextFrame("TALB", "Greatest Hits"),
+			id3v2TextFrame("TPE1", "Simpsons"),
+			id3v2TextFrame("TPE2", "Simpsons"),
+			id3v2TextFrame("TXXX", "MusicBrainz Album Id", release),
+			id3v2TextFrame("TXXX", "MusicBrainz Release Group Id", group),
+			id3v2TextFrame("TXXX", "MusicBrainz Artist Id", simpsons),
+			id3v2TextFrame("TXXX", "MusicBrainz Album Artist Id", simpsons),
+			id3v2Frame("UFID", append([]byte(audio.MusicBrainzOwner+"\x00"), recording...)))
+	}
+	files := map[string][]byte{
+		"One/01 Obey.mp3": tagged("11111111-2222-4333-8444-555555555555"),
+		"Two/01 Obey.mp3": tagged("33333333-4444-4555-8666-777777777777"),
+	}
+	for name, data := range files {
+		err = os.MkdirAll(path.Dir(path.Join(lib.Path, name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path.Join(lib.Path, name), data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Errors != 0 {
+		t.Fatalf("unexpected errors scanning: %+v", stats)
+	}
+
+	// the releases are two albums of one artist
+	records, err := wdb.ReadMBID(group, &User{ID: 1, Admin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records.Albums) != 2 || records.Albums[0].Artist != records.Albums[1].Artist {
+		t.Fatalf("expected two albums in the release group, received %+v", records.Albums)
+	}
+	albumArtist := records.Albums[0].Artist
+
+	records, err = wdb.ReadMBID(simpsons, &User{ID: 1, Admin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records.Artists) != 1 || records.Artists[0].Name != "Simpsons" ||
+		NewNullInt64(records.Artists[0].ID) != albumArtist {
+		t.Fatalf("expected the album artist to have its id, received %+v", records.Artists)
+	}
+	artist := records.Artists[0].ID
+
+	records, err = wdb.ReadMBID(recording, &User{ID: 1, Admin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records.Songs) != 2 || records.Songs[0].Artists[0].Artist != artist {
+		t.Errorf("expected both songs of the recording crediting the artist, received %+v", records.Songs)
+	}
+}
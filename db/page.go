@@ -0,0 +1,195 @@
+package db
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Page ...
+// Which of the records matching a query are read. Records are either
+// skipped by Offset or read from After, the position of a cursor.
+type Page struct {
+	Limit  int           // most records read, all of them when 0
+	Offset int           // records skipped, needs a Limit
+	After  []interface{} // order by values of the record before the page
+}
+
+// isZero ...
+// Reports whether the page is all of the records.
+func (p Page) isZero() bool {
+	return p.Limit == 0 && p.Offset == 0 && p.After == nil
+}
+
+// orderColumn ...
+// Splits an order by column into its name and direction, columns
+// prefixed by - are in descending order.
+func orderColumn(tag string) (column string, desc bool) {
+	return strings.TrimPrefix(tag, "-"), strings.HasPrefix(tag, "-")
+}
+
+// isNullable ...
+// Reports whether a column of a record type can be null.
+func isNullable(rType reflect.Type, column string) bool {
+	for i := 0; i < rType.NumField(); i++ {
+		f := rType.Field(i)
+		if isColumn(f) && f.Tag.Get("sql") == column {
+			_, ok := reflect.New(f.Type).Interface().(driver.Valuer)
+			return ok
+		}
+	}
+	return false
+}
+
+// pageOrder ...
+// Returns the order of a page, the order by columns followed by id
+// when they do not already include it so that no two records are in
+// the same place.
+func pageOrder(rType reflect.Type, orderBy []string) []string {
+	for _, tag := range orderBy {
+		if column, _ := orderColumn(tag); column == "id" {
+			return orderBy
+		}
+	}
+	for i := 0; i < rType.NumField(); i++ {
+		if isColumn(rType.Field(i)) && rType.Field(i).Tag.Get("sql") == "id" {
+			return append(append([]string{}, orderBy...), "id")
+		}
+	}
+	return orderBy
+}
+
+// afterFilter ...
+// Returns the filter of the records after the values of a cursor.
+// Nulls are last in ascending order and first in descending order.
+func afterFilter(rType reflect.Type, order []string, after []interface{}) Filter {
+	anyOf := AnyOf{}
+	for i, tag := range order {
+		column, desc := orderColumn(tag)
+
+		allOf := AllOf{}
+		for j, previous := range order[:i] {
+			c, _ := orderColumn(previous)
+			allOf = append(allOf, Condition{c, OpEqual, after[j]})
+		}
+
+		var later Filter
+		switch {
+		case desc && after[i] == nil:
+			later = Condition{column, OpNull, false}
+		case desc:
+			later = Condition{column, OpLess, after[i]}
+		case after[i] == nil:
+			later = AnyOf{}
+		case isNullable(rType, column):
+			later = AnyOf{Condition{column, OpGreater, after[i]}, Condition{column, OpNull, true}}
+		default:
+			later = Condition{column, OpGreater, after[i]}
+		}
+		anyOf = append(anyOf, append(allOf, later))
+	}
+	return anyOf
+}
+
+// ReadPage ...
+// Searches the database like ReadFilter, reading a page of the
+// results. Pages are ordered by id after the order by columns.
+func (wdb *WarblerDB) ReadPage(queryType interface{}, filter Filter, orderBy []string, page Page) ([]interface{}, error) {
+	results, err := wdb.readPage(queryType, filter, orderBy, page)
+	if err != nil {
+		return nil, err
+	}
+	return wdb.loadResultCredits(queryType, results)
+}
+
+// Cursor ...
+// Returns the position of a record read by ReadPage, from which the
+// next page is read with the values of ParseCursor as Page.After.
+func Cursor(record interface{}, orderBy []string) (string, error) {
+	rRecord := reflect.ValueOf(record)
+	if rRecord.Kind() == reflect.Ptr {
+		rRecord = rRecord.Elem()
+	}
+	rType := rRecord.Type()
+
+	order := pageOrder(rType, orderBy)
+	values := make([]interface{}, len(order))
+	for i, tag := range order {
+		column, _ := orderColumn(tag)
+		found := false
+		for j := 0; j < rType.NumField(); j++ {
+			if !isColumn(rType.Field(j)) || rType.Field(j).Tag.Get("sql") != column {
+				continue
+			}
+			v := rRecord.Field(j).Interface()
+			if valuer, ok := v.(driver.Valuer); ok {
+				var err error
+				v, err = valuer.Value()
+				if err != nil {
+					return "", err
+				}
+			}
+			values[i] = v
+			found = true
+		}
+		if !found {
+			return "", ErrInvalidTag
+		}
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseCursor ...
+// Returns the values of a cursor made by Cursor.
+func ParseCursor(cursor string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var values []interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&values); err != nil || values == nil {
+		return nil, ErrInvalidCursor
+	}
+
+	for i, v := range values {
+		switch v := v.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				values[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				values[i] = f
+			} else {
+				return nil, ErrInvalidCursor
+			}
+		case string, bool, nil:
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
+
+// Count ...
+// Returns the number of records of the query type meeting a filter.
+func (wdb *WarblerDB) Count(queryType interface{}, filter Filter) (count int, err error) {
+	table, ok := GetTableFromType(queryType)
+	if !ok {
+		return 0, ErrInvalidTable
+	}
+
+	idx := 1
+	where, vals := filter.where(&idx)
+	err = wdb.QueryRow("SELECT COUNT(1) FROM "+table+" WHERE "+where, vals...).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestReadPage ...
+func TestReadPage(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		orderBy  []string
+		filter   Filter
+		expected []int64
+	}{
+		{[]string{}, AllOf{}, []int64{1, 2, 3, 4, 5, 6}},
+		// nulls are last in ascending order and first in descending
+		{[]string{"track"}, AllOf{}, []int64{1, 2, 3, 4, 5, 6}},
+		{[]string{"-track"}, AllOf{}, []int64{6, 5, 1, 2, 3, 4}},
+		{[]string{"-track", "-id"}, AllOf{}, []int64{6, 5, 4, 3, 2, 1}},
+		{[]string{"-title"}, AllOf{}, []int64{5, 3, 2, 6, 1, 4}},
+		{[]string{"codec", "-duration"}, AllOf{}, []int64{1, 3, 4, 6, 5, 2}},
+		{[]string{"title"}, Condition{"album", OpEqual, int64(1)}, []int64{1, 6, 5}},
+	}
+
+	ids := func(results []interface{}) []int64 {
+		ids := make([]int64, len(results))
+		for i, r := range results {
+			ids[i] = r.(Song).ID
+		}
+		return ids
+	}
+
+	for _, test := range tests {
+		results, err := wdb.ReadFilter(Song{}, test.filter, test.orderBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// without an order only pages are ordered, by id
+		if all := ids(results); len(test.orderBy) > 0 && !reflect.DeepEqual(all, test.expected) {
+			t.Errorf("%v: expected %v, received %v", test.orderBy, test.expected, all)
+		}
+
+		// read two at a time by offset and by cursor
+		var byOffset, byCursor []int64
+		page := Page{Limit: 2}
+		for {
+			results, err = wdb.ReadPage(Song{}, test.filter, test.orderBy, page)
+			if err != nil {
+				t.Fatalf("%v: %v", test.orderBy, err)
+			}
+			if len(results) == 0 {
+				break
+			}
+			byCursor = append(byCursor, ids(results)...)
+
+			cursor, err := Cursor(results[len(results)-1], test.orderBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page.After, err = ParseCursor(cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for page = (Page{Limit: 2}); ; page.Offset += page.Limit {
+			results, err = wdb.ReadPage(Song{}, test.filter, test.orderBy, page)
+			if err != nil {
+				t.Fatalf("%v: %v", test.orderBy, err)
+			}
+			if len(results) == 0 {
+				break
+			}
+			if len(results[0].(Song).Artists) == 0 {
+				t.Errorf("%v: expected songs with their credits", test.orderBy)
+			}
+			byOffset = append(byOffset, ids(results)...)
+		}
+
+		if !reflect.DeepEqual(byCursor, test.expected) {
+			t.Errorf("%v by cursor: expected %v, received %v", test.orderBy, test.expected, byCursor)
+		}
+		if !reflect.DeepEqual(byOffset, test.expected) {
+			t.Errorf("%v by offset: expected %v, received %v", test.orderBy, test.expected, byOffset)
+		}
+
+		count, err := wdb.Count(Song{}, test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(test.expected) {
+			t.Errorf("%v: expected a count of %d, received %d", test.filter, len(test.expected), count)
+		}
+	}
+
+	var errTests = []struct {
+		page Page
+		err  error
+	}{
+		{Page{Limit: -1}, ErrInvalidPage},
+		{Page{Offset: 2}, ErrInvalidPage},
+		{Page{Limit: 2, After: []interface{}{"Triangle"}}, ErrInvalidCursor},
+	}
+	for _, test := range errTests {
+		_, err := wdb.ReadPage(Song{}, AllOf{}, []string{"title"}, test.page)
+		if err != test.err {
+			t.Errorf("%+v: expected %v, received %v", test.page, test.err, err)
+		}
+	}
+}
+
+// TestParseCursor ...
+func TestParseCursor(t *testing.T) {
+	song := Song{ID: 9007199254740993, Title: "Obey", Duration: 1.5, VBR: NewNullBool(false)}
+	cursor, err := Cursor(song, []string{"title", "-track", "duration", "vbr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := ParseCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"Obey", nil, 1.5, false, int64(9007199254740993)}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %#v, received %#v", expected, values)
+	}
+
+	_, err = Cursor(song, []string{"artists"})
+	if err != ErrInvalidTag {
+		t.Errorf("expected %v, received %v", ErrInvalidTag, err)
+	}
+
+	for _, cursor := range []string{"", "not a cursor", "e30", "W3t9XQ"} {
+		_, err = ParseCursor(cursor)
+		if err != ErrInvalidCursor {
+			t.Errorf("%q: expected %v, received %v", cursor, ErrInvalidCursor, err)
+		}
+	}
+}
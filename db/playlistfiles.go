@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.stergianis.ca/michael/warbler/playlist"
+)
+
+// importPlaylistFile ...
+// Imports a playlist file in a library, replacing the entries and name
+// of the playlist imported from it before. New playlists belong to the
+// first admin and are shared read only. Entries are matched to the
+// songs of the library by their path, or when no song has it by the
+// artist and title of the entry. Entries of no song are left out.
+// Fails with ErrNoPlaylistOwner when there is no admin.
+func (wdb *WarblerDB) importPlaylistFile(fsPath string, lib Library) error {
+	format, ok := playlist.FormatOf(fsPath)
+	if !ok {
+		return playlist.ErrUnsupported
+	}
+	f, err := os.Open(fsPath)
+	if err != nil {
+		return err
+	}
+	p, err := playlist.Read(f, format)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(p.Title)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(fsPath), filepath.Ext(fsPath))
+	}
+
+	songs := make([]int64, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		song, err := wdb.resolveEntry(fsPath, e, lib)
+		if err == ErrNotPresent {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		songs = append(songs, song)
+	}
+
+	var owner int64
+	err = wdb.QueryRow("SELECT id FROM config.users WHERE admin ORDER BY id LIMIT 1").Scan(&owner)
+	if err == sql.ErrNoRows {
+		return ErrNoPlaylistOwner
+	}
+	if err != nil {
+		return err
+	}
+
+	wdb.playlistMu.Lock()
+	defer wdb.playlistMu.Unlock()
+
+	tx, err := wdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(wdb.dialect.rebind("SELECT id FROM music.playlists WHERE library_id = $1 AND fs_path = $2"),
+		lib.ID, fsPath).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		id, err = wdb.txInsertReturningID(tx, "INSERT INTO music.playlists (owner, name, sharing, library_id, fs_path) "+
+			"VALUES ($1, $2, $3, $4, $5)", owner, name, string(ShareRead), lib.ID, fsPath)
+	case err == nil:
+		// its owner may have changed its sharing, which is kept
+		_, err = tx.Exec(wdb.dialect.rebind("UPDATE music.playlists SET name = $1 WHERE id = $2"), name, id)
+		if err == nil {
+			_, err = tx.Exec(wdb.dialect.rebind("DELETE FROM music.playlist_songs WHERE playlist_id = $1"), id)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(wdb.dialect.rebind("INSERT INTO music.playlist_songs (playlist_id, song_id, position) " +
+		"VALUES ($1, $2, $3)"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, song := range songs {
+		_, err = stmt.Exec(id, song, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// resolveEntry ...
+// Returns the id of the song in a library an entry of the playlist
+// file at fsPath is of, ErrNotPresent when there is none.
+func (wdb *WarblerDB) resolveEntry(fsPath string, e playlist.Entry, lib Library) (song int64, err error) {
+	if songPath, ok := playlist.Resolve(fsPath, e.Location); ok {
+		err = wdb.QueryRow("SELECT songs.id FROM music.songs AS songs "+
+			"JOIN music.songs_in_library AS sil ON sil.song_id = songs.id "+
+			"WHERE sil.library_id = $1 AND songs.fs_path = $2", lib.ID, songPath).Scan(&song)
+		if err != sql.ErrNoRows {
+			return song, err
+		}
+	}
+	if e.Title == "" {
+		return 0, ErrNotPresent
+	}
+
+	// the playlist was made where the library has another path
+	err = wdb.QueryRow("SELECT songs.id FROM music.songs AS songs "+
+		"JOIN music.songs_in_library AS sil ON sil.song_id = songs.id "+
+		"WHERE sil.library_id = $1 AND LOWER(songs.title) = LOWER($2) "+
+		"AND ($3 = '' OR LOWER(songs.artist) = LOWER($3)) ORDER BY songs.id LIMIT 1",
+		lib.ID, e.Title, e.Artist).Scan(&song)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotPresent
+	}
+	return song, err
+}
+
+// removePlaylistFile ...
+// Deletes the playlist imported from a file in a library, if there is
+// one.
+func (wdb *WarblerDB) removePlaylistFile(lib Library, fsPath string) error {
+	var id int64
+	err := wdb.QueryRow("SELECT id FROM music.playlists WHERE library_id = $1 AND fs_path = $2", lib.ID, fsPath).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return wdb.DeletePlaylist(id)
+}
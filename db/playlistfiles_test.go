@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestImportPlaylistFiles ...
+func TestImportPlaylistFiles(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Playlists", "Thermo/01 Obey.mp3", "Thermo/02 Obey.mp3")
+	defer cleanup()
+
+	write := func(name, data string) {
+		fsPath := path.Join(lib.Path, name)
+		err := ioutil.WriteFile(fsPath, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// rewritten files must look changed to the next scan
+		later := time.Now().Add(time.Hour)
+		err = os.Chtimes(fsPath, later, later)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Thermo/mix.m3u", "#EXTM3U\n02 Obey.mp3\n../Thermo/01 Obey.mp3\nmissing.mp3\nhttp://radio.example/stream\n")
+	write("road.xspf", `<playlist version="1" xmlns="http://xspf.org/ns/0/"><title>Road Trip</title><trackList>`+
+		`<track><location>Thermo/01%20Obey.mp3</location></track></trackList></playlist>`)
+
+	stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Added != 4 || stats.Errors != 0 {
+		t.Errorf("expected two songs and two playlists to be added, received %+v", stats)
+	}
+
+	songs := map[string]int64{}
+	inLib, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range inLib {
+		songs[path.Base(s.Path)] = s.ID
+	}
+
+	// playlists returns the imported playlists by name and the songs
+	// of their entries
+	playlists := func() map[string][]int64 {
+		results, err := wdb.ReadFilter(Playlist{}, Condition{"library_id", OpEqual, lib.ID}, []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported := map[string][]int64{}
+		for _, r := range results {
+			p := r.(Playlist)
+			if p.Owner != 1 || p.Sharing != ShareRead {
+				t.Errorf("expected %q to belong to the admin and be shared, received %+v", p.Name, p)
+			}
+			entries, err := wdb.PlaylistEntries(p.ID, &User{ID: 1, Admin: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			imported[p.Name] = []int64{}
+			for _, e := range entries {
+				imported[p.Name] = append(imported[p.Name], e.Song.ID)
+			}
+		}
+		return imported
+	}
+
+	expected := map[string][]int64{
+		"mix":       {songs["02 Obey.mp3"], songs["01 Obey.mp3"]},
+		"Road Trip": {songs["01 Obey.mp3"]},
+	}
+	if received := playlists(); !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, received %v", expected, received)
+	}
+
+	// a listener that has not been granted the library does not see
+	// its playlists
+	count, err := wdb.Count(Playlist{}, AllOf{Condition{"library_id", OpEqual, lib.ID}, Visible(Playlist{}, &User{ID: 2})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected the listener to see no imported playlists, received %d", count)
+	}
+
+	// entries whose paths are not in the library are found by their
+	// title, the first song with it when the songs are copies
+	first := songs["01 Obey.mp3"]
+	if songs["02 Obey.mp3"] < first {
+		first = songs["02 Obey.mp3"]
+	}
+	song := Song{ID: first}
+	err = wdb.ReadUnique(&song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("Thermo/mix.m3u", "#EXTINF:61,"+song.Title+"\nC:\\Music\\elsewhere.mp3\n")
+	err = os.Remove(path.Join(lib.Path, "road.xspf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Updated != 1 {
+		t.Errorf("expected the playlist to be updated, received %+v", stats)
+	}
+	expected = map[string][]int64{"mix": {first}}
+	if received := playlists(); !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, received %v", expected, received)
+	}
+}
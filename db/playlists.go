@@ -0,0 +1,454 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// PlaylistSharing ...
+// Who other than its owner can see and change a playlist.
+type PlaylistSharing string
+
+const (
+	// SharePrivate playlists are only seen by their owner.
+	SharePrivate PlaylistSharing = "private"
+
+	// ShareRead playlists are seen by everyone and only changed by
+	// their owner.
+	ShareRead PlaylistSharing = "read"
+
+	// ShareCollaborative playlists are seen by everyone, who can change
+	// their songs.
+	ShareCollaborative PlaylistSharing = "collaborative"
+)
+
+// valid ...
+// Reports whether s is one of the kinds of sharing.
+func (s PlaylistSharing) valid() bool {
+	return s == SharePrivate || s == ShareRead || s == ShareCollaborative
+}
+
+// Playlist ...
+// An ordered list of songs made by a user, or imported from a playlist
+// file in a library.
+type Playlist struct {
+	ID      int64           `edn:"id"      json:"id"      sql:"id"`
+	Owner   int64           `edn:"owner"   json:"owner"   sql:"owner"`
+	Name    string          `edn:"name"    json:"name"    sql:"name"`
+	Sharing PlaylistSharing `edn:"sharing" json:"sharing" sql:"sharing"`
+
+	// the library and file of an imported playlist, null for the
+	// playlists of users
+	Library NullInt64  `edn:"library" json:"library" sql:"library_id"`
+	Path    NullString `edn:"-"       json:"-"       sql:"fs_path"`
+}
+
+// GetID ...
+func (p Playlist) GetID() int64 {
+	return p.ID
+}
+
+// SetID ...
+func (p *Playlist) SetID(ID int64) {
+	p.ID = ID
+}
+
+// CanEdit ...
+// Reports whether a user can add, move and remove the songs of the
+// playlist: its owner, or anyone when it is collaborative. Playlists
+// cannot be changed without logging in.
+func (p Playlist) CanEdit(user *User) bool {
+	return user != nil && (p.Owner == user.ID || p.Sharing == ShareCollaborative)
+}
+
+// CanManage ...
+// Reports whether a user can rename, share and delete the playlist,
+// which only its owner can.
+func (p Playlist) CanManage(user *User) bool {
+	return user != nil && p.Owner == user.ID
+}
+
+// PlaylistEntry ...
+// A song in a playlist. The same song can be in a playlist several
+// times, each entry has its own id. Position is the entry's index in
+// the playlist, counting entries the reader cannot see.
+type PlaylistEntry struct {
+	ID       int64 `edn:"id"       json:"id"`
+	Position int   `edn:"position" json:"position"`
+	Song     Song  `edn:"song"     json:"song"`
+}
+
+// CreatePlaylist ...
+// Makes a user a playlist with a name and sharing, private when it is
+// empty.
+func (wdb *WarblerDB) CreatePlaylist(owner int64, name string, sharing PlaylistSharing) (playlist Playlist, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return playlist, ErrInvalidPlaylistName
+	}
+	if sharing == "" {
+		sharing = SharePrivate
+	}
+	if !sharing.valid() {
+		return playlist, ErrInvalidSharing
+	}
+
+	playlist = Playlist{Owner: owner, Name: name, Sharing: sharing}
+	playlist.ID, err = wdb.insertReturningID("INSERT INTO music.playlists (owner, name, sharing) VALUES ($1, $2, $3)",
+		owner, name, string(sharing))
+	if err != nil {
+		return Playlist{}, err
+	}
+	return playlist, nil
+}
+
+// UpdatePlaylist ...
+// Renames a playlist and changes its sharing. Empty values are left
+// as they are.
+func (wdb *WarblerDB) UpdatePlaylist(id int64, name string, sharing PlaylistSharing) error {
+	if sharing != "" && !sharing.valid() {
+		return ErrInvalidSharing
+	}
+	set := Playlist{Name: strings.TrimSpace(name), Sharing: sharing}
+	if set.Name == "" && name != "" {
+		return ErrInvalidPlaylistName
+	}
+	if set == (Playlist{}) {
+		return nil
+	}
+
+	n, err := wdb.Update(set, Playlist{ID: id})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotPresent
+	}
+	return nil
+}
+
+// DeletePlaylist ...
+// Deletes a playlist and its entries.
+func (wdb *WarblerDB) DeletePlaylist(id int64) error {
+	wdb.playlistMu.Lock()
+	defer wdb.playlistMu.Unlock()
+
+	tx, err := wdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(wdb.dialect.rebind("DELETE FROM music.playlist_songs WHERE playlist_id = $1"), id)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(wdb.dialect.rebind("DELETE FROM music.playlists WHERE id = $1"), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotPresent
+	}
+	return tx.Commit()
+}
+
+// PlaylistEntries ...
+// Returns the entries of a playlist in order, leaving out the songs a
+// user cannot see.
+func (wdb *WarblerDB) PlaylistEntries(playlist int64, user *User) ([]PlaylistEntry, error) {
+	entries, err := readPlaylistEntries(wdb, []int64{playlist}, user)
+	if err != nil {
+		return nil, err
+	}
+	return entries[playlist].([]PlaylistEntry), nil
+}
+
+// readPlaylistEntries ...
+// Reads the entries of playlists in order, leaving out the songs a
+// user cannot see.
+func readPlaylistEntries(wdb *WarblerDB, ids []int64, user *User) (map[int64]interface{}, error) {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatInt(id, 10)
+	}
+
+	rows, err := wdb.Query("SELECT id, playlist_id, song_id FROM music.playlist_songs " +
+		"WHERE playlist_id IN (" + strings.Join(list, ", ") + ") ORDER BY playlist_id, position, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type row struct {
+		entry, playlist, song int64
+		position              int
+	}
+	var (
+		found []row
+		songs []int64
+		last  row
+	)
+	for rows.Next() {
+		var r row
+		err = rows.Scan(&r.entry, &r.playlist, &r.song)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 && last.playlist == r.playlist {
+			r.position = last.position + 1
+		}
+		found = append(found, r)
+		songs = append(songs, r.song)
+		last = r
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	visible := map[int64]Song{}
+	if len(songs) > 0 {
+		results, err := wdb.ReadFilter(Song{}, AllOf{Condition{"id", OpIn, idList(songs)}, Visible(Song{}, user)}, []string{})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			visible[r.(Song).ID] = r.(Song)
+		}
+	}
+
+	entries := make(map[int64][]PlaylistEntry, len(ids))
+	for _, r := range found {
+		if song, ok := visible[r.song]; ok {
+			entries[r.playlist] = append(entries[r.playlist], PlaylistEntry{r.entry, r.position, song})
+		}
+	}
+
+	related := make(map[int64]interface{}, len(ids))
+	for _, id := range ids {
+		if entries[id] == nil {
+			entries[id] = []PlaylistEntry{}
+		}
+		related[id] = entries[id]
+	}
+	return related, nil
+}
+
+// entryOrder ...
+// Returns the ids of the entries of a playlist in order, and their
+// positions.
+func (wdb *WarblerDB) entryOrder(tx *sql.Tx, playlist int64) (entries []int64, positions map[int64]int, err error) {
+	rows, err := tx.Query(wdb.dialect.rebind("SELECT id, position FROM music.playlist_songs "+
+		"WHERE playlist_id = $1 ORDER BY position, id"), playlist)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	positions = map[int64]int{}
+	for rows.Next() {
+		var (
+			id       int64
+			position int
+		)
+		err = rows.Scan(&id, &position)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, id)
+		positions[id] = position
+	}
+	return entries, positions, rows.Err()
+}
+
+// writeOrder ...
+// Numbers the entries of a playlist in order, writing the positions
+// that changed.
+func (wdb *WarblerDB) writeOrder(tx *sql.Tx, entries []int64, positions map[int64]int) error {
+	stmt, err := tx.Prepare(wdb.dialect.rebind("UPDATE music.playlist_songs SET position = $1 WHERE id = $2"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, id := range entries {
+		if position, ok := positions[id]; ok && position == i {
+			continue
+		}
+		_, err = stmt.Exec(i, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reorder ...
+// Changes the order of the entries of a playlist in a transaction.
+// change is given the ids of the entries in order and returns them in
+// their new order. Fails with ErrNotPresent when there is no such
+// playlist.
+func (wdb *WarblerDB) reorder(playlist int64, change func(tx *sql.Tx, entries []int64) ([]int64, error)) error {
+	wdb.playlistMu.Lock()
+	defer wdb.playlistMu.Unlock()
+
+	tx, err := wdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(wdb.dialect.rebind("SELECT COUNT(1) FROM music.playlists WHERE id = $1"), playlist).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrNotPresent
+	}
+
+	entries, positions, err := wdb.entryOrder(tx, playlist)
+	if err != nil {
+		return err
+	}
+	entries, err = change(tx, entries)
+	if err != nil {
+		return err
+	}
+	err = wdb.writeOrder(tx, entries, positions)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddToPlaylist ...
+// Inserts songs into a playlist at a position, in the order given.
+// Songs are appended when the position is negative or past the end.
+// Fails with ErrNotPresent when the playlist or one of the songs is
+// not there for the user.
+func (wdb *WarblerDB) AddToPlaylist(playlist int64, songs []int64, position int, user *User) error {
+	if len(songs) == 0 {
+		return nil
+	}
+
+	distinct := map[int64]struct{}{}
+	for _, song := range songs {
+		distinct[song] = struct{}{}
+	}
+	count, err := wdb.Count(Song{}, AllOf{Condition{"id", OpIn, idList(songs)}, Visible(Song{}, user)})
+	if err != nil {
+		return err
+	}
+	if count != len(distinct) {
+		return ErrNotPresent
+	}
+
+	return wdb.reorder(playlist, func(tx *sql.Tx, entries []int64) ([]int64, error) {
+		if position < 0 || position > len(entries) {
+			position = len(entries)
+		}
+
+		added := make([]int64, len(songs))
+		for i, song := range songs {
+			// the position is written with the rest of the order
+			id, err := wdb.txInsertReturningID(tx, "INSERT INTO music.playlist_songs (playlist_id, song_id, position) "+
+				"VALUES ($1, $2, $3)", playlist, song, -1)
+			if err != nil {
+				return nil, err
+			}
+			added[i] = id
+		}
+
+		order := make([]int64, 0, len(entries)+len(added))
+		order = append(order, entries[:position]...)
+		order = append(order, added...)
+		return append(order, entries[position:]...), nil
+	})
+}
+
+// indexOf ...
+// Returns the index of an entry, -1 when it is not there.
+func indexOf(entries []int64, entry int64) int {
+	for i, id := range entries {
+		if id == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+// MovePlaylistEntry ...
+// Moves an entry of a playlist to a position, the end when it is
+// negative or past the end. Fails with ErrNotPresent when the playlist
+// has no such entry.
+func (wdb *WarblerDB) MovePlaylistEntry(playlist, entry int64, position int) error {
+	return wdb.reorder(playlist, func(tx *sql.Tx, entries []int64) ([]int64, error) {
+		i := indexOf(entries, entry)
+		if i < 0 {
+			return nil, ErrNotPresent
+		}
+		entries = append(entries[:i], entries[i+1:]...)
+		if position < 0 || position > len(entries) {
+			position = len(entries)
+		}
+
+		order := make([]int64, 0, len(entries)+1)
+		order = append(order, entries[:position]...)
+		order = append(order, entry)
+		return append(order, entries[position:]...), nil
+	})
+}
+
+// RemovePlaylistEntry ...
+// Removes an entry from a playlist. Fails with ErrNotPresent when the
+// playlist has no such entry.
+func (wdb *WarblerDB) RemovePlaylistEntry(playlist, entry int64) error {
+	return wdb.reorder(playlist, func(tx *sql.Tx, entries []int64) ([]int64, error) {
+		i := indexOf(entries, entry)
+		if i < 0 {
+			return nil, ErrNotPresent
+		}
+		_, err := tx.Exec(wdb.dialect.rebind("DELETE FROM music.playlist_songs WHERE id = $1"), entry)
+		if err != nil {
+			return nil, err
+		}
+		return append(entries[:i], entries[i+1:]...), nil
+	})
+}
+
+// ReorderPlaylist ...
+// Puts entries of a playlist in the order given. The entries take the
+// positions they held between them, so the order of every entry is
+// given to reorder a whole playlist, while entries that are left out,
+// such as those of songs the user cannot see, stay where they are.
+// Fails with ErrInvalidOrder when an entry is given twice or is not in
+// the playlist.
+func (wdb *WarblerDB) ReorderPlaylist(playlist int64, order []int64) error {
+	return wdb.reorder(playlist, func(tx *sql.Tx, entries []int64) ([]int64, error) {
+		given := make(map[int64]bool, len(order))
+		for _, id := range order {
+			if given[id] || indexOf(entries, id) < 0 {
+				return nil, ErrInvalidOrder
+			}
+			given[id] = true
+		}
+
+		reordered := make([]int64, len(entries))
+		next := 0
+		for i, id := range entries {
+			if given[id] {
+				id = order[next]
+				next++
+			}
+			reordered[i] = id
+		}
+		return reordered, nil
+	})
+}
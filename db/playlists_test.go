@@ -0,0 +1,216 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPlaylists ...
+func TestPlaylists(t *testing.T) {
+	prepareDB()
+
+	admin := &User{ID: 1, Admin: true}
+	listener := &User{ID: 2}
+
+	// playlists are personal, admins only see those that are shared
+	for _, test := range []struct {
+		user     *User
+		expected []int64
+	}{
+		{nil, []int64{2, 3}},
+		{admin, []int64{2, 3, 4}},
+		{listener, []int64{1, 2, 3}},
+	} {
+		results, err := wdb.ReadFilter(Playlist{}, Visible(Playlist{}, test.user), []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := []int64{}
+		for _, r := range results {
+			received = append(received, r.(Playlist).ID)
+		}
+		if !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%+v: expected %v, received %v", test.user, test.expected, received)
+		}
+	}
+
+	var tests = []struct {
+		playlist Playlist
+		user     *User
+		edit     bool
+		manage   bool
+	}{
+		{Playlist{Owner: 2, Sharing: SharePrivate}, listener, true, true},
+		{Playlist{Owner: 1, Sharing: ShareRead}, listener, false, false},
+		{Playlist{Owner: 1, Sharing: ShareCollaborative}, listener, true, false},
+		{Playlist{Owner: 2, Sharing: ShareRead}, admin, false, false},
+		{Playlist{Owner: 1, Sharing: ShareCollaborative}, nil, false, false},
+	}
+	for _, test := range tests {
+		if edit := test.playlist.CanEdit(test.user); edit != test.edit {
+			t.Errorf("%+v %+v: expected edit %v, received %v", test.playlist, test.user, test.edit, edit)
+		}
+		if manage := test.playlist.CanManage(test.user); manage != test.manage {
+			t.Errorf("%+v %+v: expected manage %v, received %v", test.playlist, test.user, test.manage, manage)
+		}
+	}
+
+	// order returns the ids of the entries of a playlist, checking that
+	// their positions are their indices
+	order := func(playlist int64, user *User) []int64 {
+		entries, err := wdb.PlaylistEntries(playlist, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, e := range entries {
+			if user == nil && e.Position != len(ids) {
+				t.Errorf("entry %d: expected position %d, received %d", e.ID, len(ids), e.Position)
+			}
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	expectOrder := func(step string, expected []int64) {
+		if received := order(1, nil); !reflect.DeepEqual(received, expected) {
+			t.Errorf("%s: expected %v, received %v", step, expected, received)
+		}
+	}
+
+	expectOrder("fixtures", []int64{1, 2, 3})
+	// song 1 is in a library the listener has not been granted
+	entries, err := wdb.PlaylistEntries(1, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].ID != 3 || entries[1].Position != 2 || entries[1].Song.ID != 3 {
+		t.Errorf("expected entries 1 and 3 at 0 and 2, received %+v", entries)
+	}
+
+	err = wdb.AddToPlaylist(1, []int64{3}, 1, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrder("insert", []int64{1, 10001, 2, 3})
+	err = wdb.AddToPlaylist(1, []int64{4, 1}, -1, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrder("append", []int64{1, 10001, 2, 3, 10002, 10003})
+	if err = wdb.AddToPlaylist(1, []int64{1}, 0, listener); err != ErrNotPresent {
+		t.Errorf("invisible song: expected %v, received %v", ErrNotPresent, err)
+	}
+	if err = wdb.AddToPlaylist(99, []int64{1}, 0, nil); err != ErrNotPresent {
+		t.Errorf("missing playlist: expected %v, received %v", ErrNotPresent, err)
+	}
+
+	err = wdb.MovePlaylistEntry(1, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrder("move", []int64{3, 1, 10001, 2, 10002, 10003})
+	err = wdb.MovePlaylistEntry(1, 1, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrder("move to end", []int64{3, 10001, 2, 10002, 10003, 1})
+	if err = wdb.MovePlaylistEntry(1, 4, 0); err != ErrNotPresent {
+		t.Errorf("entry of another playlist: expected %v, received %v", ErrNotPresent, err)
+	}
+
+	// entries that are left out keep their positions
+	err = wdb.ReorderPlaylist(1, []int64{1, 10001, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrder("reorder", []int64{1, 10001, 2, 10002, 10003, 3})
+	for _, bad := range [][]int64{{1, 1}, {4}} {
+		if err = wdb.ReorderPlaylist(1, bad); err != ErrInvalidOrder {
+			t.Errorf("reorder %v: expected %v, received %v", bad, ErrInvalidOrder, err)
+		}
+	}
+
+	err = wdb.RemovePlaylistEntry(1, 10001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrder("remove", []int64{1, 2, 10002, 10003, 3})
+	if err = wdb.RemovePlaylistEntry(1, 10001); err != ErrNotPresent {
+		t.Errorf("removed twice: expected %v, received %v", ErrNotPresent, err)
+	}
+
+	playlist := Playlist{ID: 1}
+	included, err := wdb.Include(playlist, []interface{}{playlist}, []string{"entries"}, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := reflect.ValueOf(included[0]).FieldByName("Entries").Interface().([]PlaylistEntry); len(entries) != 2 {
+		t.Errorf("expected the two visible entries, received %+v", entries)
+	}
+
+	err = wdb.DeletePlaylist(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received := order(1, nil); len(received) != 0 {
+		t.Errorf("expected the entries to be deleted, received %v", received)
+	}
+	if err = wdb.DeletePlaylist(1); err != ErrNotPresent {
+		t.Errorf("deleted twice: expected %v, received %v", ErrNotPresent, err)
+	}
+}
+
+// TestCreatePlaylist ...
+func TestCreatePlaylist(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		name     string
+		sharing  PlaylistSharing
+		expected Playlist
+		err      error
+	}{
+		{" Gym ", "", Playlist{ID: 10001, Owner: 2, Name: "Gym", Sharing: SharePrivate}, nil},
+		{"Gym", ShareRead, Playlist{ID: 10002, Owner: 2, Name: "Gym", Sharing: ShareRead}, nil},
+		{" ", ShareRead, Playlist{}, ErrInvalidPlaylistName},
+		{"Gym", "public", Playlist{}, ErrInvalidSharing},
+	}
+
+	for _, test := range tests {
+		playlist, err := wdb.CreatePlaylist(2, test.name, test.sharing)
+		if err != test.err {
+			t.Errorf("%q %q: expected %v, received %v", test.name, test.sharing, test.err, err)
+		}
+		if playlist != test.expected {
+			t.Errorf("%q %q: expected %+v, received %+v", test.name, test.sharing, test.expected, playlist)
+		}
+	}
+
+	err := wdb.UpdatePlaylist(10001, "", ShareCollaborative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := Playlist{ID: 10001}
+	err = wdb.ReadUnique(&playlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Name != "Gym" || playlist.Sharing != ShareCollaborative {
+		t.Errorf("expected Gym to be collaborative, received %+v", playlist)
+	}
+
+	for _, test := range []struct {
+		id      int64
+		name    string
+		sharing PlaylistSharing
+		err     error
+	}{
+		{10001, " ", "", ErrInvalidPlaylistName},
+		{10001, "", "public", ErrInvalidSharing},
+		{99, "Run", "", ErrNotPresent},
+	} {
+		if err := wdb.UpdatePlaylist(test.id, test.name, test.sharing); err != test.err {
+			t.Errorf("%d %q %q: expected %v, received %v", test.id, test.name, test.sharing, test.err, err)
+		}
+	}
+}
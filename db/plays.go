@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PlaySource ...
+// How a play was recorded.
+type PlaySource string
+
+const (
+	// SourceScrobble plays were sent by the user's player.
+	SourceScrobble PlaySource = "scrobble"
+
+	// SourceStream plays were recorded once enough of a song was
+	// streamed.
+	SourceStream PlaySource = "stream"
+)
+
+// Play ...
+// A user listening to a song. Played is the seconds since the unix
+// epoch they did and Duration how many seconds they listened for.
+type Play struct {
+	ID       int64      `edn:"id"       json:"id"       sql:"id"`
+	User     int64      `edn:"user"     json:"user"     sql:"user_id"`
+	Song     int64      `edn:"song"     json:"song"     sql:"song_id"`
+	Played   int64      `edn:"played"   json:"played"   sql:"played_at"`
+	Duration float64    `edn:"duration" json:"duration" sql:"duration"`
+	Source   PlaySource `edn:"source"   json:"source"   sql:"source"`
+}
+
+// GetID ...
+func (p Play) GetID() int64 {
+	return p.ID
+}
+
+// SetID ...
+func (p *Play) SetID(ID int64) {
+	p.ID = ID
+}
+
+// RecordPlay ...
+// Saves a play of a song, counting it on the song and queueing it to be
+// forwarded to the user's scrobblers. Plays without a time are now and
+// those without a duration last the whole song. Fails with
+// ErrNotPresent when there is no such song.
+func (wdb *WarblerDB) RecordPlay(play Play) (Play, error) {
+	now := time.Now().Unix()
+	if play.Played == 0 {
+		play.Played = now
+	}
+	if play.Played > now {
+		return Play{}, ErrInvalidPlayTime
+	}
+	if play.Duration < 0 {
+		return Play{}, ErrInvalidPlayDuration
+	}
+	if play.Source == "" {
+		play.Source = SourceScrobble
+	}
+
+	tx, err := wdb.Begin()
+	if err != nil {
+		return Play{}, err
+	}
+	defer tx.Rollback()
+
+	var duration float64
+	err = tx.QueryRow(wdb.dialect.rebind("SELECT duration FROM music.songs WHERE id = $1"), play.Song).Scan(&duration)
+	if err == sql.ErrNoRows {
+		return Play{}, ErrNotPresent
+	}
+	if err != nil {
+		return Play{}, err
+	}
+	if play.Duration == 0 {
+		play.Duration = duration
+	}
+
+	play.ID, err = wdb.txInsertReturningID(tx, "INSERT INTO music.plays (user_id, song_id, played_at, duration, source) "+
+		"VALUES ($1, $2, $3, $4, $5)", play.User, play.Song, play.Played, play.Duration, string(play.Source))
+	if err != nil {
+		return Play{}, err
+	}
+	// plays can be sent late, the last played is the latest of them
+	_, err = tx.Exec(wdb.dialect.rebind("UPDATE music.songs SET play_count = play_count + 1, "+
+		"last_played_at = CASE WHEN last_played_at IS NULL OR last_played_at < $1 THEN $1 ELSE last_played_at END "+
+		"WHERE id = $2"), play.Played, play.Song)
+	if err != nil {
+		return Play{}, err
+	}
+	err = wdb.queueListen(tx, play)
+	if err != nil {
+		return Play{}, err
+	}
+	return play, tx.Commit()
+}
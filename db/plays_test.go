@@ -0,0 +1,75 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRecordPlay ...
+func TestRecordPlay(t *testing.T) {
+	prepareDB()
+
+	// plays are personal, nobody else sees them
+	for _, test := range []struct {
+		user     *User
+		expected []int64
+	}{
+		{nil, []int64{}},
+		{&User{ID: 1, Admin: true}, []int64{4, 5, 6, 7}},
+		{&User{ID: 2}, []int64{1, 2, 3}},
+	} {
+		results, err := wdb.ReadFilter(Play{}, Visible(Play{}, test.user), []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := []int64{}
+		for _, r := range results {
+			received = append(received, r.(Play).ID)
+		}
+		if !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%+v: expected %v, received %v", test.user, test.expected, received)
+		}
+	}
+
+	before := time.Now().Unix()
+	play, err := wdb.RecordPlay(Play{User: 2, Song: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if play.ID != 10001 || play.Played < before || play.Duration != 9994 || play.Source != SourceScrobble {
+		t.Errorf("expected a whole play of song 4 now, received %+v", play)
+	}
+
+	// a play sent late does not move the last played back
+	late, err := wdb.RecordPlay(Play{User: 2, Song: 4, Played: 1500000000, Duration: 30, Source: SourceStream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if late.Played != 1500000000 || late.Duration != 30 || late.Source != SourceStream {
+		t.Errorf("expected the play as it was sent, received %+v", late)
+	}
+	song := Song{ID: 4}
+	err = wdb.ReadUnique(&song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if song.Plays != 2 || song.LastPlayed != NewNullInt64(play.Played) {
+		t.Errorf("expected 2 plays last at %d, received %d at %v", play.Played, song.Plays, song.LastPlayed)
+	}
+
+	var tests = []struct {
+		play Play
+		err  error
+	}{
+		{Play{User: 2, Song: 99}, ErrNotPresent},
+		{Play{User: 2, Song: 4, Played: time.Now().Add(time.Hour).Unix()}, ErrInvalidPlayTime},
+		{Play{User: 2, Song: 4, Duration: -1}, ErrInvalidPlayDuration},
+	}
+	for _, test := range tests {
+		_, err := wdb.RecordPlay(test.play)
+		if err != test.err {
+			t.Errorf("%+v: expected %v, received %v", test.play, test.err, err)
+		}
+	}
+}
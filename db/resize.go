@@ -0,0 +1,117 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gitlab.stergianis.ca/michael/warbler/artwork"
+)
+
+// resizeSizes ...
+// The sizes artwork is resized to, smallest first. Requested sizes are
+// rounded up to one of them so that few copies of each image are
+// cached.
+var resizeSizes = []int{64, 128, 256, 512, 1024, 2048}
+
+// resizeSize ...
+// Rounds a requested size up to the nearest size artwork is resized
+// to, at most the largest.
+func resizeSize(size int) int {
+	for _, s := range resizeSizes {
+		if size <= s {
+			return s
+		}
+	}
+	return resizeSizes[len(resizeSizes)-1]
+}
+
+// resizedDir ...
+// The directory the resized copies of an image with a hash are cached
+// in.
+func (wdb *WarblerDB) resizedDir(hash string) string {
+	return filepath.Join(wdb.CacheDir, "resized", hash[:2])
+}
+
+// ResizedImage ...
+// Returns a copy of an image scaled down to fit in a size by size
+// square and written in a format. Sizes are rounded up to one of
+// resizeSizes. Copies are cached in the cache directory and made once,
+// the Hash of the returned image identifies its contents. Images that
+// cannot be decoded, or that are not hashed, are returned as they are.
+func (wdb *WarblerDB) ResizedImage(img Image, size int, format artwork.Format) (Image, error) {
+	if wdb.CacheDir == "" || !img.Hash.Valid || len(img.Hash.String) < 2 {
+		return img, nil
+	}
+
+	key := img.Hash.String + "-" + strconv.Itoa(resizeSize(size)) + "." + format.Extension()
+	resized := img
+	resized.Path = filepath.Join(wdb.resizedDir(img.Hash.String), key)
+	resized.Hash = NewNullString(key)
+	resized.MIMEType = NewNullString(format.MIMEType())
+
+	if _, err := os.Stat(resized.Path); err == nil {
+		return resized, nil
+	}
+
+	// copies are made one at a time, the same one may have been
+	// requested while waiting
+	wdb.resizeMu.Lock()
+	defer wdb.resizeMu.Unlock()
+	if _, err := os.Stat(resized.Path); err == nil {
+		return resized, nil
+	}
+
+	f, err := os.Open(img.Path)
+	if err != nil {
+		return img, err
+	}
+	defer f.Close()
+
+	src, err := artwork.Decode(f)
+	if err != nil {
+		return img, nil
+	}
+
+	var buf bytes.Buffer
+	err = artwork.Encode(&buf, artwork.Resize(src, resizeSize(size)), format)
+	if err != nil {
+		return img, err
+	}
+
+	err = writeFileAtomic(resized.Path, buf.Bytes())
+	if err != nil {
+		return img, err
+	}
+
+	return resized, nil
+}
+
+// removeResizedImages ...
+// Deletes the cached copies of images with a hash, unless an image
+// with the hash is left. The caller must hold imageMu.
+func (wdb *WarblerDB) removeResizedImages(hash string) error {
+	if wdb.CacheDir == "" || len(hash) < 2 {
+		return nil
+	}
+
+	var n int64
+	err := wdb.QueryRow("SELECT COUNT(*) FROM music.images WHERE hash = $1", hash).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	copies, err := filepath.Glob(filepath.Join(wdb.resizedDir(hash), hash+"-*"))
+	if err != nil {
+		return err
+	}
+	for _, c := range copies {
+		err = os.Remove(c)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
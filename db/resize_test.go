@@ -0,0 +1,104 @@
+package db
+
+import (
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.stergianis.ca/michael/warbler/artwork"
+)
+
+// TestResizeSize ...
+func TestResizeSize(t *testing.T) {
+	cases := []struct {
+		size, expected int
+	}{
+		{1, 64},
+		{64, 64},
+		{65, 128},
+		{300, 512},
+		{2048, 2048},
+		{5000, 2048},
+	}
+
+	for _, c := range cases {
+		if s := resizeSize(c.size); s != c.expected {
+			t.Errorf("expected %d to round to %d, received %d", c.size, c.expected, s)
+		}
+	}
+}
+
+// TestResizedImage ...
+func TestResizedImage(t *testing.T) {
+	prepareDB()
+
+	cacheDir, err := ioutil.TempDir("", "warbler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	wdb.CacheDir = cacheDir
+	defer func() { wdb.CacheDir = "" }()
+
+	src := filepath.Join(cacheDir, "cover.png")
+	err = ioutil.WriteFile(src, testPNG(t, color.White), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := Image{ID: 1, Path: src, Hash: NewNullString("abcdef"), MIMEType: NewNullString("image/png")}
+
+	resized, err := wdb.ResizedImage(img, 100, artwork.PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resized.Hash.String != "abcdef-128.png" || resized.MIMEType.String != "image/png" ||
+		resized.Path != filepath.Join(cacheDir, "resized", "ab", "abcdef-128.png") {
+		t.Fatalf("unexpected resized image: %+v", resized)
+	}
+
+	f, err := os.Open(resized.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Errorf("expected a png to be cached: %v", err)
+	}
+
+	// the cached copy is used even once the original is gone
+	err = os.Remove(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := wdb.ResizedImage(img, 128, artwork.PNG)
+	if err != nil || again != resized {
+		t.Errorf("expected the cached copy, received %+v: %v", again, err)
+	}
+	_, err = wdb.ResizedImage(img, 128, artwork.WebP)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected the missing original to be reported, received: %v", err)
+	}
+
+	// images that cannot be decoded are served as they are
+	err = ioutil.WriteFile(src, []byte("not an image"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := wdb.ResizedImage(img, 256, artwork.JPEG)
+	if err != nil || same != img {
+		t.Errorf("expected the original image, received %+v: %v", same, err)
+	}
+
+	// copies of images no longer in the db are deleted
+	err = wdb.removeResizedImages("abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(resized.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the cached copy to be removed, received: %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// ScanStats ...
+// Counts of the files handled by a library scan.
+type ScanStats struct {
+	// files recorded by the previous scan, an estimate of the files
+	// this scan will see. 0 on the first scan of a library.
+	Expected int `edn:"expected" json:"expected"`
+
+	Seen    int `edn:"seen"    json:"seen"`
+	Skipped int `edn:"skipped" json:"skipped"` // unchanged since the last scan
+	Added   int `edn:"added"   json:"added"`
+	Updated int `edn:"updated" json:"updated"`
+	Errors  int `edn:"errors"  json:"errors"`
+
+	// songs removed from the library because their files are gone
+	Removed int `edn:"removed" json:"removed"`
+	// albums, artists, genres and extracted artwork deleted for
+	// having no songs
+	Collected int64 `edn:"collected" json:"collected"`
+}
+
+// ScanOptions ...
+// Configures a library scan.
+type ScanOptions struct {
+	// Workers is the number of files processed at once. Defaults to
+	// the number of CPUs.
+	Workers int
+
+	// Progress, if set, is called with the current stats every time
+	// they change. It is called from the scan's workers one at a time
+	// and must not block.
+	Progress func(ScanStats)
+}
+
+// scanFile ...
+// A file found while walking a library, waiting to be processed.
+type scanFile struct {
+	path  string
+	state fileState
+	known bool
+}
+
+// scanner ...
+// The state of a single library scan shared between its workers.
+type scanner struct {
+	wdb      *WarblerDB
+	lib      Library
+	states   map[string]fileState
+	progress func(ScanStats)
+
+	mu    sync.Mutex
+	stats ScanStats
+	// playlist files, imported once every song has been
+	playlists []scanFile
+}
+
+// count ...
+// Applies f to the scan stats while holding the scanner's lock and
+// reports the new stats.
+func (sc *scanner) count(f func(stats *ScanStats)) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	f(&sc.stats)
+	if sc.progress != nil {
+		sc.progress(sc.stats)
+	}
+}
+
+// process ...
+// Ingests a single new or changed file and records its state.
+func (sc *scanner) process(file scanFile) {
+	var err error
+	state := file.state
+
+	state.FileType, err = fileType(file.path)
+	if err != nil {
+		log.Printf("%v", err)
+		sc.count(func(stats *ScanStats) { stats.Errors++ })
+		return
+	}
+
+	switch state.FileType {
+	case musicType:
+		// songs scanned before file states were recorded are not
+		// read again
+		inLib := false
+		if !file.known {
+			inLib, err = sc.wdb.songInLibrary(Song{Path: file.path}, sc.lib)
+			if err != nil {
+				log.Printf("%v", err)
+				sc.count(func(stats *ScanStats) { stats.Errors++ })
+				return
+			}
+		}
+		if inLib {
+			sc.count(func(stats *ScanStats) { stats.Skipped++ })
+			break
+		}
+
+		err = sc.wdb.processMedia(file.path, sc.lib)
+		if err != nil {
+			log.Printf("%v", err)
+			sc.count(func(stats *ScanStats) { stats.Errors++ })
+			return
+		}
+		sc.count(func(stats *ScanStats) {
+			if file.known {
+				stats.Updated++
+			} else {
+				stats.Added++
+			}
+		})
+	case imageType:
+		err = sc.wdb.addImageFile(file.path)
+		if err != nil {
+			log.Printf("%v", err)
+			sc.count(func(stats *ScanStats) { stats.Errors++ })
+			return
+		}
+	case playlistType:
+		// the songs of a playlist may not have been added yet
+		file.state = state
+		sc.mu.Lock()
+		sc.playlists = append(sc.playlists, file)
+		sc.mu.Unlock()
+		return
+	}
+
+	err = sc.wdb.saveFileState(state)
+	if err != nil {
+		log.Printf("%v", err)
+		sc.count(func(stats *ScanStats) { stats.Errors++ })
+	}
+}
+
+// importPlaylists ...
+// Imports the playlist files found by process and records their
+// states. A playlist that cannot be imported is tried again by the
+// next scan.
+func (sc *scanner) importPlaylists() {
+	for _, file := range sc.playlists {
+		err := sc.wdb.importPlaylistFile(file.path, sc.lib)
+		if err != nil {
+			log.Printf("Error importing playlist %q: %v", file.path, err)
+			sc.count(func(stats *ScanStats) { stats.Errors++ })
+			continue
+		}
+		sc.count(func(stats *ScanStats) {
+			if file.known {
+				stats.Updated++
+			} else {
+				stats.Added++
+			}
+		})
+
+		err = sc.wdb.saveFileState(file.state)
+		if err != nil {
+			log.Printf("%v", err)
+			sc.count(func(stats *ScanStats) { stats.Errors++ })
+		}
+	}
+	sc.playlists = nil
+}
+
+// ScanLibrary ...
+// Scans the library. Files that have not changed in size,
+// modification time or inode since the last scan are skipped without
+// being read, changed files are ingested again by a pool of workers.
+// Playlist files are imported after the songs.
+// A new file with the inode and size of a recorded file that is gone
+// was moved there, its song or playlist keeps its id.
+// Songs whose files are no longer in the library are removed, along
+// with any albums, artists, genres and images left without songs.
+//
+// Cancelling ctx stops the scan once the files being processed are
+// done. Nothing is removed from a cancelled or failed scan.
+func (wdb *WarblerDB) ScanLibrary(ctx context.Context, lib Library, opts ScanOptions) (stats ScanStats, err error) {
+	states, err := wdb.fileStates(lib)
+	if err != nil {
+		return stats, err
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	sc := &scanner{wdb: wdb, lib: lib, states: states, progress: opts.Progress}
+	sc.stats.Expected = len(states)
+	files := make(chan scanFile)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				sc.process(file)
+			}
+		}()
+	}
+
+	movedFrom := map[int64]fileState{}
+	for _, s := range states {
+		if s.Inode != 0 {
+			movedFrom[s.Inode] = s
+		}
+	}
+
+	seen := map[string]struct{}{}
+	walkFn := func(fsPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Encountered the following error while traversing %q: %v", fsPath, err)
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if info.IsDir() {
+			return nil
+		}
+		sc.count(func(stats *ScanStats) { stats.Seen++ })
+		seen[fsPath] = struct{}{}
+
+		state := newFileState(lib, fsPath, info)
+		prev, known := states[fsPath]
+		if known && state.unchanged(prev) {
+			sc.count(func(stats *ScanStats) { stats.Skipped++ })
+			return nil
+		}
+
+		if old, ok := movedFrom[state.Inode]; !known && ok && old.Size == state.Size {
+			// a file still at its old path was copied, not moved
+			if _, err := os.Lstat(old.Path); os.IsNotExist(err) {
+				err = wdb.moveFile(old, state)
+				if err != nil {
+					return err
+				}
+				delete(movedFrom, state.Inode)
+				seen[old.Path] = struct{}{}
+				sc.count(func(stats *ScanStats) { stats.Updated++ })
+				return nil
+			}
+		}
+
+		select {
+		case files <- scanFile{fsPath, state, known}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// an incomplete walk must not remove anything
+	err = filepath.Walk(lib.Path, walkFn)
+	close(files)
+	wg.Wait()
+
+	if err == nil {
+		sc.importPlaylists()
+	}
+	stats = sc.stats
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Removed, err = wdb.removeMissing(lib, seen, states)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Collected, err = wdb.collectGarbage()
+	if err != nil {
+		return stats, err
+	}
+
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+
+	return stats, nil
+}
+
+// ScanLibraries ...
+// Scans all available libraries one after another. A library that
+// fails to scan is logged and does not stop the others.
+func (wdb *WarblerDB) ScanLibraries(ctx context.Context, opts ScanOptions) error {
+	libs, err := wdb.GetLibraries()
+	if err != nil {
+		return err
+	}
+
+	for _, lib := range libs {
+		_, err = wdb.ScanLibrary(ctx, lib, opts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Error scanning library %q: %v", lib.Name, err)
+		}
+	}
+
+	return nil
+}
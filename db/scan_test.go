@@ -0,0 +1,407 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// prepareScanLibrary ...
+// Creates a library in a temporary directory holding copies of the
+// test song under the given names. The returned function removes the
+// directory.
+func prepareScanLibrary(t *testing.T, name string, songs ...string) (Library, func()) {
+	dir, err := ioutil.TempDir("", "warbler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	song, err := ioutil.ReadFile(path.Join(testLib, testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range songs {
+		err = os.MkdirAll(path.Dir(path.Join(dir, s)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path.Join(dir, s), song, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lib := Library{Name: name, Path: dir}
+	err = wdb.Create(&lib, []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lib, func() { os.RemoveAll(dir) }
+}
+
+// TestRescanLibrary ...
+func TestRescanLibrary(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Rescan", "01 Obey.mp3")
+	defer cleanup()
+	songPath := path.Join(lib.Path, "01 Obey.mp3")
+
+	err := ioutil.WriteFile(path.Join(lib.Path, "notes.txt"), []byte("not music"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		before func()
+		stats  ScanStats
+	}{
+		{"first scan", func() {}, ScanStats{Seen: 2, Added: 1}},
+		{"unchanged", func() {}, ScanStats{Expected: 2, Seen: 2, Skipped: 2}},
+		// tags the file no longer has are cleared
+		{"modified", func() {
+			_, err := wdb.Exec("UPDATE music.songs SET mbid = 'removed', release_year = 1999 WHERE fs_path = $1", songPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(songPath, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, ScanStats{Expected: 2, Seen: 2, Skipped: 1, Updated: 1}},
+	}
+
+	var songID int64
+	for _, test := range testCases {
+		test.before()
+
+		stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		// the fixtures contain albums and images without songs
+		stats.Collected = 0
+		if stats != test.stats {
+			t.Errorf("%s: unexpected scan stats\n\texpected: %+v\n\treceived: %+v", test.name, test.stats, stats)
+		}
+
+		songs, err := wdb.GetSongsInLibrary(lib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(songs) != 1 {
+			t.Fatalf("%s: unexpected number of songs: %d", test.name, len(songs))
+		}
+		if songID == 0 {
+			songID = songs[0].ID
+		}
+		if songs[0].ID != songID {
+			t.Errorf("%s: song id changed from %d to %d", test.name, songID, songs[0].ID)
+		}
+		if songs[0].MBID.Valid || songs[0].Year.Valid && songs[0].Year.Int64 == 1999 {
+			t.Errorf("%s: expected the tags of the file, received %v %v", test.name, songs[0].MBID, songs[0].Year)
+		}
+	}
+}
+
+// TestScanLibraryRemovesMissing ...
+func TestScanLibraryRemovesMissing(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Removal", "01 Obey.mp3")
+	defer cleanup()
+	songPath := path.Join(lib.Path, "01 Obey.mp3")
+
+	// a library pointing at the old location of some songs
+	moved := Library{ID: 1, Name: "Music", Path: lib.Path}
+
+	stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Added != 1 {
+		t.Fatalf("expected one song to be added, received: %+v", stats)
+	}
+	songs, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	albumID := songs[0].Album
+
+	err = os.Remove(songPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 1 || stats.Collected < 1 {
+		t.Errorf("expected the song and its album to be removed, received: %+v", stats)
+	}
+
+	err = wdb.ReadUnique(&Song{ID: songs[0].ID})
+	if err != ErrNotPresent {
+		t.Errorf("expected removed song to be deleted, received: %v", err)
+	}
+	err = wdb.ReadUnique(&Album{ID: albumID.Int64})
+	if err != ErrNotPresent {
+		t.Errorf("expected album without songs to be deleted, received: %v", err)
+	}
+
+	// songs 1, 2 and 4 are in "Music" but not under its new path
+	stats, err = wdb.ScanLibrary(context.Background(), moved, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 3 {
+		t.Errorf("expected 3 songs to be removed after moving the library, received: %+v", stats)
+	}
+	count, err := wdb.CountTable("music.songs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("unexpected number of songs remaining: %d", count)
+	}
+
+	// songs that were played are kept out of every library with their
+	// plays
+	var libraries int
+	err = wdb.QueryRow("SELECT COUNT(1) FROM music.songs_in_library WHERE song_id = 1").Scan(&libraries)
+	if err != nil || libraries != 0 {
+		t.Errorf("expected song 1 to be in no library, received %d %v", libraries, err)
+	}
+	plays, err := wdb.CountTable("music.plays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plays != 7 {
+		t.Errorf("expected every play to be kept, received %d", plays)
+	}
+	err = wdb.ReadUnique(&Song{ID: 4})
+	if err != ErrNotPresent {
+		t.Errorf("expected song 4, which was never played, to be deleted, received: %v", err)
+	}
+}
+
+// TestScanLibraryMovedFiles ...
+// Files moved while a library was not watched keep their songs, and
+// the plays of those songs, when it is scanned again.
+func TestScanLibraryMovedFiles(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Moved", "01 Obey.mp3", "02 Obey.mp3")
+	defer cleanup()
+
+	_, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != 2 {
+		t.Fatalf("expected 2 songs to be added, received %v", songs)
+	}
+	ids := map[string]int64{}
+	for _, s := range songs {
+		ids[path.Base(s.Path)] = s.ID
+		_, err = wdb.RecordPlay(Play{User: 1, Song: s.ID, Played: 1600000000})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one song is moved, the other is copied and its copy deleted
+	moved := path.Join(lib.Path, "Obey", "01 Obey.mp3")
+	err = os.MkdirAll(path.Dir(moved), 0755)
+	if err == nil {
+		err = os.Rename(path.Join(lib.Path, "01 Obey.mp3"), moved)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	song, err := ioutil.ReadFile(path.Join(lib.Path, "02 Obey.mp3"))
+	if err == nil {
+		err = ioutil.WriteFile(path.Join(lib.Path, "Obey", "02 Obey.mp3"), song, 0644)
+	}
+	if err == nil {
+		err = os.Remove(path.Join(lib.Path, "02 Obey.mp3"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Updated != 1 || stats.Added != 1 || stats.Removed != 1 {
+		t.Errorf("expected one song to be moved and the copy to replace the other, received: %+v", stats)
+	}
+
+	err = wdb.ReadUnique(&Song{ID: ids["01 Obey.mp3"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plays int
+	err = wdb.QueryRow("SELECT COUNT(1) FROM music.plays WHERE song_id = $1", ids["01 Obey.mp3"]).Scan(&plays)
+	if err != nil || plays != 1 {
+		t.Errorf("expected the moved song to keep its play, received %d %v", plays, err)
+	}
+	songs, err = wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range songs {
+		if s.Path == moved && s.ID != ids["01 Obey.mp3"] {
+			t.Errorf("moving a song changed its id to %d", s.ID)
+		}
+	}
+
+	// the song whose file was deleted is kept for its play
+	err = wdb.ReadUnique(&Song{ID: ids["02 Obey.mp3"]})
+	if err != nil {
+		t.Errorf("expected the played song to be kept, received: %v", err)
+	}
+}
+
+// TestScanLibraryPlaylistEntries ...
+// Playlist entries follow their songs when files are moved while a
+// library was not watched, and are kept but hidden when files are
+// deleted.
+func TestScanLibraryPlaylistEntries(t *testing.T) {
+	prepareDB()
+	admin := &User{ID: 1, Admin: true}
+
+	lib, cleanup := prepareScanLibrary(t, "Playlisted", "01 Obey.mp3", "02 Obey.mp3")
+	defer cleanup()
+
+	_, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, s := range songs {
+		ids = append(ids, s.ID)
+	}
+	playlist, err := wdb.CreatePlaylist(1, "Obey", SharePrivate)
+	if err == nil {
+		err = wdb.AddToPlaylist(playlist.ID, ids, -1, admin)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Rename(songs[0].Path, path.Join(lib.Path, "Obey.mp3"))
+	if err == nil {
+		err = os.Remove(songs[1].Path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wdb.ScanLibrary(context.Background(), lib, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := wdb.PlaylistEntries(playlist.ID, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := []int64{}
+	for _, e := range entries {
+		received = append(received, e.Song.ID)
+	}
+	if !reflect.DeepEqual(received, ids[:1]) {
+		t.Errorf("expected the entries of songs %v, received %v", ids[:1], received)
+	}
+
+	var kept int
+	err = wdb.QueryRow("SELECT COUNT(1) FROM music.playlist_songs WHERE playlist_id = $1", playlist.ID).Scan(&kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept != len(ids) {
+		t.Errorf("expected %d entries kept, received %d", len(ids), kept)
+	}
+}
+
+// TestScanLibraryConcurrent ...
+// Many copies of one song share an album, which must only be created
+// once no matter how many workers ingest it at the same time.
+func TestScanLibraryConcurrent(t *testing.T) {
+	prepareDB()
+
+	const numSongs = 16
+	names := make([]string, numSongs)
+	for i := range names {
+		names[i] = fmt.Sprintf("disk %d/%02d Obey.mp3", i%2+1, i)
+	}
+	lib, cleanup := prepareScanLibrary(t, "Concurrent", names...)
+	defer cleanup()
+
+	stats, err := wdb.ScanLibrary(context.Background(), lib, ScanOptions{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Added != numSongs || stats.Errors != 0 {
+		t.Errorf("unexpected scan stats: %+v", stats)
+	}
+
+	songs, err := wdb.GetSongsInLibrary(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != numSongs {
+		t.Fatalf("unexpected number of songs: %d", len(songs))
+	}
+
+	albums, err := wdb.Read(&Album{Title: "Thermo"}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 1 {
+		t.Errorf("expected a single album, received %d: %v", len(albums), albums)
+	}
+}
+
+// TestScanLibraryCancel ...
+func TestScanLibraryCancel(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Cancelled", "01 Obey.mp3", "02 Obey.mp3")
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	stats, err := wdb.ScanLibrary(ctx, lib, ScanOptions{Workers: 2})
+	if err != context.Canceled {
+		t.Errorf("expected the scan to be cancelled, received: %v", err)
+	}
+	if stats.Added != 0 || stats.Removed != 0 {
+		t.Errorf("expected a cancelled scan to do nothing, received: %+v", stats)
+	}
+
+	// the songs of a library are not removed by a cancelled scan
+	stats, err = wdb.ScanLibrary(ctx, Library{ID: 1, Name: "Music", Path: lib.Path}, ScanOptions{})
+	if err != context.Canceled || stats.Removed != 0 {
+		t.Errorf("unexpected result of cancelled scan: %+v %v", stats, err)
+	}
+}
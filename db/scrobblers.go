@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
+)
+
+// Scrobbler ...
+// A service a user's plays are forwarded to. The token it is sent with
+// is never returned. Pending is how many plays are waiting to be sent
+// and LastError why the oldest of them could not be, when it was tried.
+type Scrobbler struct {
+	ID        int64            `edn:"id"         json:"id"`
+	User      int64            `edn:"user"       json:"user"`
+	Service   scrobble.Service `edn:"service"    json:"service"`
+	Pending   int64            `edn:"pending"    json:"pending"`
+	LastError NullString       `edn:"last-error" json:"last-error"`
+}
+
+// SetScrobbler ...
+// Forwards a user's plays to a service with a token, replacing the one
+// they had for it. Plays waiting to be sent to it are tried again with
+// the new token straight away.
+func (wdb *WarblerDB) SetScrobbler(user int64, service scrobble.Service, token string) error {
+	if !service.Valid() {
+		return ErrInvalidScrobbler
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrInvalidScrobbleToken
+	}
+
+	tx, err := wdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(wdb.dialect.rebind("INSERT INTO config.scrobblers (user_id, service, token) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (user_id, service) DO UPDATE SET token = excluded.token"), user, string(service), token)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(wdb.dialect.rebind("UPDATE config.scrobble_queue SET next_attempt_at = $1 WHERE scrobbler_id IN "+
+		"(SELECT id FROM config.scrobblers WHERE user_id = $2 AND service = $3)"),
+		time.Now().Unix(), user, string(service))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Scrobblers ...
+// Returns the services a user's plays are forwarded to, in order of
+// their names.
+func (wdb *WarblerDB) Scrobblers(user int64) (scrobblers []Scrobbler, err error) {
+	rows, err := wdb.Query("SELECT s.id, s.user_id, s.service, "+
+		"(SELECT COUNT(1) FROM config.scrobble_queue AS q WHERE q.scrobbler_id = s.id), "+
+		"(SELECT q.last_error FROM config.scrobble_queue AS q WHERE q.scrobbler_id = s.id ORDER BY q.id LIMIT 1) "+
+		"FROM config.scrobblers AS s WHERE s.user_id = $1 ORDER BY s.service", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scrobblers = []Scrobbler{}
+	for rows.Next() {
+		var s Scrobbler
+		err = rows.Scan(&s.ID, &s.User, &s.Service, &s.Pending, &s.LastError)
+		if err != nil {
+			return nil, err
+		}
+		scrobblers = append(scrobblers, s)
+	}
+	return scrobblers, rows.Err()
+}
+
+// DeleteScrobbler ...
+// Stops forwarding a user's plays to a service, dropping those waiting
+// to be sent to it. Fails with ErrNotPresent when they were not.
+func (wdb *WarblerDB) DeleteScrobbler(user int64, service scrobble.Service) error {
+	tx, err := wdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(wdb.dialect.rebind("SELECT id FROM config.scrobblers WHERE user_id = $1 AND service = $2"),
+		user, string(service)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotPresent
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(wdb.dialect.rebind("DELETE FROM config.scrobble_queue WHERE scrobbler_id = $1"), id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(wdb.dialect.rebind("DELETE FROM config.scrobblers WHERE id = $1"), id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// songListen ...
+// Returns a song as it is submitted to scrobblers, its artist being
+// the first of its primary credits when its tags name none. queryRow
+// is that of the database or of a transaction, so the query is rebound
+// here.
+func (wdb *WarblerDB) songListen(queryRow func(string, ...interface{}) *sql.Row, song int64) (scrobble.Listen, error) {
+	var (
+		l      scrobble.Listen
+		artist NullString
+		album  NullString
+		mbid   NullString
+	)
+	err := queryRow(wdb.dialect.rebind("SELECT songs.title, songs.duration, songs.mbid, albums.title, "+
+		"COALESCE(songs.artist, (SELECT artists.name FROM music.song_artists AS sa "+
+		"JOIN music.artists AS artists ON artists.id = sa.artist_id "+
+		"WHERE sa.song_id = songs.id AND sa.role = $1 ORDER BY sa.position LIMIT 1)) "+
+		"FROM music.songs AS songs LEFT JOIN music.albums AS albums ON albums.id = songs.album "+
+		"WHERE songs.id = $2"), RolePrimary, song).
+		Scan(&l.Track, &l.Duration, &mbid, &album, &artist)
+	if err == sql.ErrNoRows {
+		return l, ErrNotPresent
+	}
+	if err != nil {
+		return l, err
+	}
+	l.Artist, l.Album, l.MBID = artist.String, album.String, mbid.String
+	return l, nil
+}
+
+// queueListen ...
+// Queues a play to be forwarded to each of its user's scrobblers,
+// within the transaction recording it. Songs no artist is known for
+// cannot be submitted and are not queued.
+func (wdb *WarblerDB) queueListen(tx *sql.Tx, play Play) error {
+	var n int64
+	err := tx.QueryRow(wdb.dialect.rebind("SELECT COUNT(1) FROM config.scrobblers WHERE user_id = $1"), play.User).Scan(&n)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	l, err := wdb.songListen(tx.QueryRow, play.Song)
+	if err != nil {
+		return err
+	}
+	if l.Artist == "" {
+		return nil
+	}
+	l.Listened = play.Played
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(wdb.dialect.rebind("INSERT INTO config.scrobble_queue (scrobbler_id, listen, created_at, next_attempt_at) "+
+		"SELECT id, $1, $2, $2 FROM config.scrobblers WHERE user_id = $3"), string(data), now, play.User)
+	return err
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
+)
+
+// queued ...
+// Returns the listens queued for a scrobbler, oldest first.
+func queued(t *testing.T, scrobbler int64) []scrobble.Listen {
+	t.Helper()
+	rows, err := wdb.Query("SELECT listen FROM config.scrobble_queue WHERE scrobbler_id = $1 ORDER BY id", scrobbler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	listens := []scrobble.Listen{}
+	for rows.Next() {
+		var (
+			data string
+			l    scrobble.Listen
+		)
+		err = rows.Scan(&data)
+		if err == nil {
+			err = json.Unmarshal([]byte(data), &l)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		listens = append(listens, l)
+	}
+	return listens
+}
+
+// TestScrobblers ...
+func TestScrobblers(t *testing.T) {
+	prepareDB()
+
+	listener := []Scrobbler{
+		{1, 2, scrobble.ListenBrainz, 1, NewNullString("scrobble: listenbrainz responded 503")},
+	}
+	scrobblers, err := wdb.Scrobblers(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scrobblers, listener) {
+		t.Errorf("expected %v, received %v", listener, scrobblers)
+	}
+
+	var tests = []struct {
+		name    string
+		service scrobble.Service
+		token   string
+		err     error
+	}{
+		{"new", scrobble.LastFM, "lastfm-listener", nil},
+		{"replaced", scrobble.ListenBrainz, " lb-listener-2 ", nil},
+		{"invalid service", scrobble.Service("librefm"), "token", ErrInvalidScrobbler},
+		{"no token", scrobble.LastFM, " ", ErrInvalidScrobbleToken},
+	}
+	for _, test := range tests {
+		err := wdb.SetScrobbler(2, test.service, test.token)
+		if err != test.err {
+			t.Errorf("%s: expected error %v, received %v", test.name, test.err, err)
+		}
+	}
+
+	var token string
+	var next int64
+	err = wdb.QueryRow("SELECT s.token, q.next_attempt_at FROM config.scrobblers AS s "+
+		"JOIN config.scrobble_queue AS q ON q.scrobbler_id = s.id WHERE s.id = 1").Scan(&token, &next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "lb-listener-2" || next <= 1580519100 {
+		t.Errorf("expected the new token and the queued play to be sent again, received %q at %d", token, next)
+	}
+
+	// plays are queued for each scrobbler, with the artists credited on
+	// songs whose tags name none
+	_, err = wdb.Exec("UPDATE music.songs SET artist = NULL WHERE id = 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wdb.RecordPlay(Play{User: 2, Song: 3, Played: 1600000000, Duration: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := scrobble.Listen{Artist: "Iron Maiden", Track: "The Ides of March", Album: "Killers", Duration: 210, Listened: 1600000000}
+	if received := queued(t, 10001); !reflect.DeepEqual(received, []scrobble.Listen{listen}) {
+		t.Errorf("expected %v queued for Last.fm, received %v", listen, received)
+	}
+	if received := queued(t, 1); len(received) != 2 || received[1] != listen {
+		t.Errorf("expected %v queued for ListenBrainz, received %v", listen, received)
+	}
+
+	err = wdb.DeleteScrobbler(2, scrobble.ListenBrainz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received := queued(t, 1); len(received) != 0 {
+		t.Errorf("expected the queued plays to be dropped, received %v", received)
+	}
+	scrobblers, err = wdb.Scrobblers(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Scrobbler{{10001, 2, scrobble.LastFM, 1, NullString{}}}
+	if !reflect.DeepEqual(scrobblers, expected) {
+		t.Errorf("expected %v, received %v", expected, scrobblers)
+	}
+	if err := wdb.DeleteScrobbler(2, scrobble.ListenBrainz); err != ErrNotPresent {
+		t.Errorf("expected %v deleting again, received %v", ErrNotPresent, err)
+	}
+}
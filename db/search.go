@@ -0,0 +1,245 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// searchThreshold is how similar a search must be to some of the
+	// words of a name for the name to be found, between 0 and 1
+	searchThreshold = 0.3
+
+	// DefaultSearchLimit is the number of each kind of record found
+	// by a search when no limit is given.
+	DefaultSearchLimit = 20
+
+	// MaxSearchLimit is the most of each kind of record a search
+	// returns.
+	MaxSearchLimit = 100
+
+	// sqliteSearchDriver is the sqlite driver with the functions
+	// search uses, those postgres has from pg_trgm and unaccent.
+	sqliteSearchDriver = "sqlite3_warbler"
+)
+
+// ErrEmptySearch is returned when searching for text without any
+// letters or digits.
+var ErrEmptySearch = errors.New("wdb: nothing to search for")
+
+func init() {
+	sql.Register(sqliteSearchDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			funcs := map[string]interface{}{
+				"search_text":     foldText,
+				"similarity":      similarity,
+				"word_similarity": wordSimilarity,
+			}
+			for name, f := range funcs {
+				err := conn.RegisterFunc(name, f, true)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+var (
+	// foldAccents strips the accents decomposing a letter leaves as
+	// separate marks.
+	foldAccents = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+	// foldLetters spells the letters without a decomposition like
+	// unaccent does.
+	foldLetters = strings.NewReplacer(
+		"ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "þ", "th", "ı", "i",
+	)
+)
+
+// foldText ...
+// Returns the lowercase form of text without accents, which searches
+// are matched against.
+func foldText(text string) string {
+	folded, _, err := transform.String(foldAccents, strings.ToLower(text))
+	if err != nil {
+		folded = strings.ToLower(text)
+	}
+	return foldLetters.Replace(folded)
+}
+
+// searchWords ...
+// Splits text into its words, runs of letters and digits.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams ...
+// Returns the set of trigrams of words the way pg_trgm makes them,
+// each word padded by two spaces before and one after.
+func trigrams(words []string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, w := range words {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			set[string(r[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// trigramSimilarity ...
+// Returns the number of trigrams two sets share over the number in
+// either.
+func trigramSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if _, ok := b[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// similarity ...
+// Returns how similar two texts are from 0 to 1, like pg_trgm's
+// similarity.
+func similarity(a, b string) float64 {
+	return trigramSimilarity(trigrams(searchWords(a)), trigrams(searchWords(b)))
+}
+
+// wordSimilarity ...
+// Returns how similar a search is to the run of words of text that is
+// most like it, from 0 to 1, like pg_trgm's word_similarity. Runs are
+// at most a word longer than the search.
+func wordSimilarity(search, text string) float64 {
+	searchWords, words := searchWords(search), searchWords(text)
+	want := trigrams(searchWords)
+
+	best := 0.0
+	for i := range words {
+		for j := i + 1; j <= len(words) && j-i <= len(searchWords)+1; j++ {
+			if s := trigramSimilarity(want, trigrams(words[i:j])); s > best {
+				best = s
+			}
+		}
+	}
+	return best
+}
+
+// SearchResults ...
+// The records found by a search, the best matches first.
+type SearchResults struct {
+	Artists []Artist `edn:"artists" json:"artists"`
+	Albums  []Album  `edn:"albums"  json:"albums"`
+	Songs   []Song   `edn:"songs"   json:"songs"`
+	Genres  []Genre  `edn:"genres"  json:"genres"`
+}
+
+// Search ...
+// Finds the artists, albums, songs and genres whose names are like
+// text, ignoring case and accents and allowing for typos. Names with
+// a run of words like text are found, ranked by how alike they are
+// then by how alike the whole name is. At most limit of each are
+// returned, limits outside 1 to MaxSearchLimit return the default.
+// Only records the user can see are found.
+func (wdb *WarblerDB) Search(text string, limit int, user *User) (results SearchResults, err error) {
+	search := strings.Join(searchWords(foldText(text)), " ")
+	if search == "" {
+		return results, ErrEmptySearch
+	}
+	if limit < 1 || limit > MaxSearchLimit {
+		limit = DefaultSearchLimit
+	}
+
+	searches := []struct {
+		table, column string
+		query         interface{}
+		ids           []int64
+	}{
+		{table: "music.artists", column: "name", query: Artist{}},
+		{table: "music.albums", column: "title", query: Album{}},
+		{table: "music.songs", column: "title", query: Song{}},
+		{table: "music.genres", column: "name", query: Genre{}},
+	}
+
+	tx, err := wdb.Begin()
+	if err != nil {
+		return results, err
+	}
+	defer tx.Rollback()
+
+	if wdb.dialect.searchSetup != "" {
+		_, err = tx.Exec(wdb.dialect.searchSetup)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	for i, s := range searches {
+		folded := wdb.dialect.fold(s.column)
+		idx := 3
+		visible, vals := Visible(s.query, user).where(&idx)
+		q := "SELECT id FROM " + s.table + " WHERE " + wdb.dialect.wordMatch("$1", folded) + " AND " + visible +
+			" ORDER BY word_similarity($1, " + folded + ") DESC, similarity($1, " + folded + ") DESC, id" +
+			" LIMIT $2"
+		rows, err := tx.Query(wdb.dialect.rebind(q), append([]interface{}{search, limit}, vals...)...)
+		if err != nil {
+			return results, err
+		}
+		for rows.Next() {
+			var id int64
+			err = rows.Scan(&id)
+			if err != nil {
+				rows.Close()
+				return results, err
+			}
+			searches[i].ids = append(searches[i].ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return results, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return results, err
+	}
+
+	results.Artists = make([]Artist, len(searches[0].ids))
+	results.Albums = make([]Album, len(searches[1].ids))
+	results.Songs = make([]Song, len(searches[2].ids))
+	results.Genres = make([]Genre, len(searches[3].ids))
+	records := []func(i int) Queryable{
+		func(i int) Queryable { return &results.Artists[i] },
+		func(i int) Queryable { return &results.Albums[i] },
+		func(i int) Queryable { return &results.Songs[i] },
+		func(i int) Queryable { return &results.Genres[i] },
+	}
+	for i, s := range searches {
+		for j, id := range s.ids {
+			record := records[i](j)
+			record.SetID(id)
+			err = wdb.ReadUnique(record)
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+
+	return results, nil
+}
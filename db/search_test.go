@@ -0,0 +1,124 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestFoldText ...
+func TestFoldText(t *testing.T) {
+	var tests = []struct {
+		in, expected string
+	}{
+		{"BADBADNOTGOOD", "badbadnotgood"},
+		{"Sigur Rós", "sigur ros"},
+		{"Mötley Crüe", "motley crue"},
+		{"Röyksopp & Robyn", "royksopp & robyn"},
+		{"Røyksopp", "royksopp"},
+		{"Die Straße", "die strasse"},
+		{"Beyoncé", "beyonce"},
+	}
+
+	for _, test := range tests {
+		if folded := foldText(test.in); folded != test.expected {
+			t.Errorf("foldText(%q): expected %q, received %q", test.in, test.expected, folded)
+		}
+	}
+}
+
+// TestSimilarity ...
+func TestSimilarity(t *testing.T) {
+	var tests = []struct {
+		search, text string
+		similar      bool // at least searchThreshold
+		word         float64
+	}{
+		{"the beatles", "the beatles", true, 1},
+		{"beatles", "the beatles", true, 1},
+		{"beatels", "the beatles", false, 1.0 / 3},
+		{"night", "in the night", true, 1},
+		{"in the nigth", "in the night", true, 10.0 / 16},
+		{"megadeth", "iron maiden", false, 1.0 / 15},
+		{"coltrane", "iron maiden", false, 0},
+		{"", "iron maiden", false, 0},
+	}
+
+	for _, test := range tests {
+		if s := similarity(test.search, test.text); (s >= searchThreshold) != test.similar {
+			t.Errorf("similarity(%q, %q): %v", test.search, test.text, s)
+		}
+		if s := wordSimilarity(test.search, test.text); s != test.word {
+			t.Errorf("wordSimilarity(%q, %q): expected %v, received %v", test.search, test.text, test.word, s)
+		}
+	}
+}
+
+// TestSearch ...
+func TestSearch(t *testing.T) {
+	prepareDB()
+
+	type found struct {
+		artists, albums, songs, genres []int64
+	}
+	ids := func(r SearchResults) (f found) {
+		f = found{[]int64{}, []int64{}, []int64{}, []int64{}}
+		for _, a := range r.Artists {
+			f.artists = append(f.artists, a.ID)
+		}
+		for _, a := range r.Albums {
+			f.albums = append(f.albums, a.ID)
+		}
+		for _, s := range r.Songs {
+			f.songs = append(f.songs, s.ID)
+		}
+		for _, g := range r.Genres {
+			f.genres = append(f.genres, g.ID)
+		}
+		return f
+	}
+	none := []int64{}
+
+	var tests = []struct {
+		search   string
+		limit    int
+		expected found
+	}{
+		// the artist named only that is the better match
+		{"badbadnotgood", 0, found{[]int64{1, 2}, none, none, none}},
+		{"BADBADNOTGOOD", 1, found{[]int64{1}, none, none, none}},
+		{"ghostface", 0, found{[]int64{2}, none, none, none}},
+		// typos, "Killah" is close enough
+		{"Kíllers", 0, found{[]int64{2}, []int64{3}, none, none}},
+		{"in the nigth", 0, found{none, none, []int64{1, 3}, none}},
+		{"metal", 0, found{none, none, none, []int64{3, 4}}},
+		{"sour", 0, found{none, []int64{2}, []int64{2}, none}},
+		{"ides of march", 0, found{none, none, []int64{3}, none}},
+		{"coltrane", 0, found{none, none, none, none}},
+	}
+
+	for _, test := range tests {
+		results, err := wdb.Search(test.search, test.limit, nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.search, err)
+			continue
+		}
+		if f := ids(results); !reflect.DeepEqual(f, test.expected) {
+			t.Errorf("%s: expected %v, received %v", test.search, test.expected, f)
+		}
+	}
+
+	results, err := wdb.Search("sour", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Songs) != 1 || len(results.Songs[0].Artists) == 0 {
+		t.Errorf("expected songs to be found with their artists, received %+v", results.Songs)
+	}
+
+	for _, search := range []string{"", "  ", "!?"} {
+		_, err = wdb.Search(search, 0, nil)
+		if err != ErrEmptySearch {
+			t.Errorf("%q: expected %v, received %v", search, ErrEmptySearch, err)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"olympos.io/encoding/edn"
+)
+
+// songOrderRandom is the order of smart playlists shuffled each time
+// they are read.
+const songOrderRandom = "random"
+
+// SongRules ...
+// The songs of a smart playlist, a filter of songs as described by
+// ParseFilter. Rules are kept as json with the json names of the
+// fields and parsed each time they are read, so that times are
+// relative to when they are.
+//
+//	{"genre": 4, "year": {">=": 1955, "<=": 1965}}
+//	{"added": {"within": 30}}
+type SongRules string
+
+// ParseSongRules ...
+// Returns the rules of data decoded from edn or json into an
+// interface{}, its fields named by tag. Fails with an ErrInvalidFilter
+// when data is not a filter of songs.
+func ParseSongRules(tag string, data interface{}) (SongRules, error) {
+	_, err := ParseFilter(tag, Song{}, data)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := convertRules(data, NewTagConverter(Song{}, tag, "json"), false)
+	if err != nil {
+		return "", err
+	}
+	// operators are kept as they are, not escaped for html
+	var encoded bytes.Buffer
+	enc := json.NewEncoder(&encoded)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(canonical)
+	if err != nil {
+		return "", err
+	}
+	return SongRules(bytes.TrimSpace(encoded.Bytes())), nil
+}
+
+// decode ...
+// Returns the rules as they were decoded from json, numbers that are
+// whole as int64s.
+func (r SongRules) decode() (interface{}, error) {
+	if r == "" {
+		return map[string]interface{}{}, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(string(r)))
+	dec.UseNumber()
+	var data interface{}
+	err := dec.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	return convertRules(data, nil, false)
+}
+
+// Filter ...
+// Returns the filter of the songs meeting the rules, now.
+func (r SongRules) Filter() (Filter, error) {
+	data, err := r.decode()
+	if err != nil {
+		return nil, err
+	}
+	return ParseFilter("json", Song{}, data)
+}
+
+// convertRules ...
+// Copies decoded rules into maps of strings, or of edn keywords,
+// renaming the fields of songs with names. Keywords and other text
+// become strings and json numbers int64s when whole, float64s
+// otherwise.
+func convertRules(data interface{}, names map[string]string, keywords bool) (interface{}, error) {
+	rData := reflect.ValueOf(data)
+	switch {
+	case !rData.IsValid():
+		return nil, nil
+	case rData.Kind() == reflect.Map:
+		m, err := filterMap(data)
+		if err != nil {
+			return nil, err
+		}
+		strs := make(map[string]interface{}, len(m))
+		kws := make(map[edn.Keyword]interface{}, len(m))
+		for k, v := range m {
+			if name, ok := names[k]; ok {
+				k = name
+			}
+			v, err = convertRules(v, names, keywords)
+			if err != nil {
+				return nil, err
+			}
+			strs[k] = v
+			kws[edn.Keyword(k)] = v
+		}
+		if keywords {
+			return kws, nil
+		}
+		return strs, nil
+	case rData.Kind() == reflect.Slice:
+		list := make([]interface{}, rData.Len())
+		for i := range list {
+			var err error
+			list[i], err = convertRules(rData.Index(i).Interface(), names, keywords)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	if n, ok := data.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	}
+	if rData.Kind() == reflect.String {
+		return rData.String(), nil
+	}
+	return data, nil
+}
+
+// MarshalEDN ...
+func (r SongRules) MarshalEDN() ([]byte, error) {
+	data, err := r.decode()
+	if err != nil {
+		return nil, err
+	}
+	data, err = convertRules(data, NewTagConverter(Song{}, "json", "edn"), true)
+	if err != nil {
+		return nil, err
+	}
+	return edn.Marshal(data)
+}
+
+// MarshalJSON ...
+func (r SongRules) MarshalJSON() ([]byte, error) {
+	if r == "" {
+		return []byte("{}"), nil
+	}
+	return []byte(r), nil
+}
+
+// UnmarshalEDN ...
+func (r *SongRules) UnmarshalEDN(bytes []byte) error {
+	var data interface{}
+	err := edn.Unmarshal(bytes, &data)
+	if err != nil {
+		return err
+	}
+	*r, err = ParseSongRules("edn", data)
+	return err
+}
+
+// UnmarshalJSON ...
+func (r *SongRules) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var decoded interface{}
+	err := dec.Decode(&decoded)
+	if err != nil {
+		return err
+	}
+	decoded, err = convertRules(decoded, nil, false)
+	if err != nil {
+		return err
+	}
+	*r, err = ParseSongRules("json", decoded)
+	return err
+}
+
+// SmartPlaylist ...
+// A playlist of the songs meeting its rules, read again each time it
+// is. OrderBy is a comma separated list of the json names of song
+// fields, those prefixed by - in descending order, or random. Limit
+// is the most songs in it, all of them when it is null.
+type SmartPlaylist struct {
+	ID      int64           `edn:"id"      json:"id"      sql:"id"`
+	Owner   int64           `edn:"owner"   json:"owner"   sql:"owner"`
+	Name    string          `edn:"name"    json:"name"    sql:"name"`
+	Sharing PlaylistSharing `edn:"sharing" json:"sharing" sql:"sharing"`
+
+	Rules   SongRules  `edn:"rules"    json:"rules"    sql:"rules"`
+	OrderBy NullString `edn:"order-by" json:"order-by" sql:"order_by"`
+	Limit   NullInt64  `edn:"limit"    json:"limit"    sql:"max_songs"`
+}
+
+// GetID ...
+func (p SmartPlaylist) GetID() int64 {
+	return p.ID
+}
+
+// SetID ...
+func (p *SmartPlaylist) SetID(ID int64) {
+	p.ID = ID
+}
+
+// CanManage ...
+// Reports whether a user can change and delete the smart playlist,
+// which only its owner can.
+func (p SmartPlaylist) CanManage(user *User) bool {
+	return user != nil && p.Owner == user.ID
+}
+
+// songOrder ...
+// Returns the columns the songs of the playlist are ordered by.
+func (p SmartPlaylist) songOrder() ([]string, error) {
+	if !p.OrderBy.Valid || strings.TrimSpace(p.OrderBy.String) == "" {
+		return []string{}, nil
+	}
+	fields := strings.Split(p.OrderBy.String, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) == 1 && fields[0] == songOrderRandom {
+		// RANDOM() is the same in every database
+		return []string{"RANDOM()"}, nil
+	}
+
+	columns, err := ConvertTags(fields, NewTagConverter(Song{}, "json", "sql"))
+	if err != nil {
+		return nil, ErrInvalidSongOrder
+	}
+	return columns, nil
+}
+
+// check ...
+// Tidies the playlist's name and order, failing when it cannot be
+// saved as it is.
+func (p *SmartPlaylist) check() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return ErrInvalidPlaylistName
+	}
+	if p.Sharing == "" {
+		p.Sharing = SharePrivate
+	}
+	if p.Sharing != SharePrivate && p.Sharing != ShareRead {
+		return ErrInvalidSmartSharing
+	}
+
+	_, err := p.Rules.Filter()
+	if err != nil {
+		return err
+	}
+	if p.Rules == "" {
+		p.Rules = "{}"
+	}
+
+	if strings.TrimSpace(p.OrderBy.String) == "" {
+		p.OrderBy = NullString{}
+	}
+	_, err = p.songOrder()
+	if err != nil {
+		return err
+	}
+	if p.Limit.Valid && p.Limit.Int64 < 1 {
+		return ErrInvalidSongLimit
+	}
+	return nil
+}
+
+// CreateSmartPlaylist ...
+// Saves a smart playlist for its owner, private when it has no
+// sharing.
+func (wdb *WarblerDB) CreateSmartPlaylist(playlist SmartPlaylist) (SmartPlaylist, error) {
+	err := playlist.check()
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+
+	playlist.ID, err = wdb.insertReturningID("INSERT INTO music.smart_playlists "+
+		"(owner, name, sharing, rules, order_by, max_songs) VALUES ($1, $2, $3, $4, $5, $6)",
+		playlist.Owner, playlist.Name, string(playlist.Sharing), string(playlist.Rules), playlist.OrderBy, playlist.Limit)
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+	return playlist, nil
+}
+
+// UpdateSmartPlaylist ...
+// Replaces the name, sharing, rules, order and limit of a smart
+// playlist with those of playlist.
+func (wdb *WarblerDB) UpdateSmartPlaylist(playlist SmartPlaylist) error {
+	err := playlist.check()
+	if err != nil {
+		return err
+	}
+
+	res, err := wdb.Exec("UPDATE music.smart_playlists SET name = $1, sharing = $2, rules = $3, "+
+		"order_by = $4, max_songs = $5 WHERE id = $6",
+		playlist.Name, string(playlist.Sharing), string(playlist.Rules), playlist.OrderBy, playlist.Limit, playlist.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotPresent
+	}
+	return nil
+}
+
+// DeleteSmartPlaylist ...
+func (wdb *WarblerDB) DeleteSmartPlaylist(id int64) error {
+	res, err := wdb.Exec("DELETE FROM music.smart_playlists WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotPresent
+	}
+	return nil
+}
+
+// SmartPlaylistSongs ...
+// Returns the songs a user can see that meet the rules of a smart
+// playlist, in its order and up to its limit.
+func (wdb *WarblerDB) SmartPlaylistSongs(playlist SmartPlaylist, user *User) ([]Song, error) {
+	rules, err := playlist.Rules.Filter()
+	if err != nil {
+		return nil, err
+	}
+	order, err := playlist.songOrder()
+	if err != nil {
+		return nil, err
+	}
+	var page Page
+	if playlist.Limit.Valid {
+		page.Limit = int(playlist.Limit.Int64)
+	}
+
+	results, err := wdb.ReadPage(Song{}, AllOf{rules, Visible(Song{}, user)}, order, page)
+	if err != nil {
+		return nil, err
+	}
+	songs := make([]Song, len(results))
+	for i, r := range results {
+		songs[i] = r.(Song)
+	}
+	return songs, nil
+}
+
+// readSmartPlaylistSongs ...
+// Reads the songs of smart playlists a user can see.
+func readSmartPlaylistSongs(wdb *WarblerDB, ids []int64, user *User) (map[int64]interface{}, error) {
+	results, err := wdb.ReadFilter(SmartPlaylist{}, Condition{"id", OpIn, idList(ids)}, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	related := make(map[int64]interface{}, len(results))
+	for _, r := range results {
+		playlist := r.(SmartPlaylist)
+		related[playlist.ID], err = wdb.SmartPlaylistSongs(playlist, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return related, nil
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"olympos.io/encoding/edn"
+)
+
+// TestSongRules ...
+func TestSongRules(t *testing.T) {
+	var tests = []struct {
+		tag, data string
+		expected  SongRules
+		err       error
+	}{
+		{"json", `{"year": {">=": 1955, "<=": 1965}, "genre": 4}`, `{"genre":4,"year":{"<=":1965,">=":1955}}`, nil},
+		{"edn", `{:duration {:< 240} :or [{:artist "Thermo"} {:lossless true}]}`,
+			`{"duration":{"<":240},"or":[{"artist":"Thermo"},{"lossless":true}]}`, nil},
+		{"json", `{"added": {"within": 30}}`, `{"added":{"within":30}}`, nil},
+		{"json", `{"name": "Jazz"}`, "", ErrInvalidFilter{"name", "no such field"}},
+		{"edn", `{:duration {:between [1 2]}}`, "", ErrInvalidFilter{"duration", `unknown operator "between"`}},
+	}
+
+	for _, test := range tests {
+		var rules SongRules
+		var err error
+		if test.tag == "json" {
+			err = json.Unmarshal([]byte(test.data), &rules)
+		} else {
+			err = edn.Unmarshal([]byte(test.data), &rules)
+		}
+		if err != test.err {
+			t.Errorf("%s: expected error %v, received %v", test.data, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if rules != test.expected {
+			t.Errorf("%s: expected %s, received %s", test.data, test.expected, rules)
+		}
+	}
+
+	// rules are written in each format with its names and values
+	rules := SongRules(`{"duration":{"<":240.5},"num-tracks":{"in":[1,2]}}`)
+	received, err := edn.Marshal(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[edn.Keyword]interface{}
+	err = edn.Unmarshal(received, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[edn.Keyword]interface{}{
+		"duration":   map[interface{}]interface{}{edn.Keyword("<"): 240.5},
+		"num-tracks": map[interface{}]interface{}{edn.Keyword("in"): []interface{}{int64(1), int64(2)}},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %v, received %s", expected, received)
+	}
+}
+
+// TestSmartPlaylists ...
+func TestSmartPlaylists(t *testing.T) {
+	prepareDB()
+
+	admin := &User{ID: 1, Admin: true}
+	listener := &User{ID: 2}
+
+	// smart playlists are personal like playlists
+	for _, test := range []struct {
+		user     *User
+		expected []int64
+	}{
+		{nil, []int64{2}},
+		{admin, []int64{2, 3}},
+		{listener, []int64{1, 2}},
+	} {
+		results, err := wdb.ReadFilter(SmartPlaylist{}, Visible(SmartPlaylist{}, test.user), []string{"id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := []int64{}
+		for _, r := range results {
+			received = append(received, r.(SmartPlaylist).ID)
+		}
+		if !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%+v: expected %v, received %v", test.user, test.expected, received)
+		}
+	}
+
+	// songs returns the ids of the songs of a smart playlist
+	songs := func(playlist SmartPlaylist, user *User) []int64 {
+		found, err := wdb.SmartPlaylistSongs(playlist, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, s := range found {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	var tests = []struct {
+		name     string
+		playlist int64
+		user     *User
+		expected []int64
+	}{
+		{"short songs", 1, listener, []int64{3}},
+		{"ordered and limited", 2, admin, []int64{1}},
+		{"in libraries the listener cannot see", 2, listener, []int64{}},
+	}
+	for _, test := range tests {
+		playlist := SmartPlaylist{ID: test.playlist}
+		err := wdb.ReadUnique(&playlist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received := songs(playlist, test.user); !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("%s: expected %v, received %v", test.name, test.expected, received)
+		}
+	}
+
+	// random order shuffles every song
+	shuffle := SmartPlaylist{ID: 3}
+	err := wdb.ReadUnique(&shuffle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received := songs(shuffle, admin); len(received) != 4 {
+		t.Errorf("expected every song shuffled, received %v", received)
+	}
+
+	// rules are evaluated each time the playlist is read
+	recent, err := wdb.CreateSmartPlaylist(SmartPlaylist{
+		Owner: 2,
+		Name:  " Recently Added ",
+		Rules: `{"added":{"within":30}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recent.Name != "Recently Added" || recent.Sharing != SharePrivate || recent.ID != 10001 {
+		t.Errorf("expected a private playlist, received %+v", recent)
+	}
+	if received := songs(recent, listener); len(received) != 0 {
+		t.Errorf("expected no recent songs, received %v", received)
+	}
+	_, err = wdb.Exec("UPDATE music.songs SET added_at = $1 WHERE id = 3", time.Now().Add(-24*time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received := songs(recent, listener); !reflect.DeepEqual(received, []int64{3}) {
+		t.Errorf("expected the recent song, received %v", received)
+	}
+
+	invalid := []struct {
+		playlist SmartPlaylist
+		err      error
+	}{
+		{SmartPlaylist{Owner: 2}, ErrInvalidPlaylistName},
+		{SmartPlaylist{Owner: 2, Name: "x", Sharing: ShareCollaborative}, ErrInvalidSmartSharing},
+		{SmartPlaylist{Owner: 2, Name: "x", Rules: `{"name":"x"}`}, ErrInvalidFilter{"name", "no such field"}},
+		{SmartPlaylist{Owner: 2, Name: "x", OrderBy: NewNullString("random, title")}, ErrInvalidSongOrder},
+		{SmartPlaylist{Owner: 2, Name: "x", OrderBy: NewNullString("-artists")}, ErrInvalidSongOrder},
+		{SmartPlaylist{Owner: 2, Name: "x", Limit: NewNullInt64(0)}, ErrInvalidSongLimit},
+	}
+	for _, test := range invalid {
+		_, err := wdb.CreateSmartPlaylist(test.playlist)
+		if err != test.err {
+			t.Errorf("%+v: expected %v, received %v", test.playlist, test.err, err)
+		}
+	}
+
+	// updates replace every field but the owner
+	recent.Name = "Latest"
+	recent.OrderBy = NewNullString("-added, title")
+	recent.Limit = NewNullInt64(10)
+	err = wdb.UpdateSmartPlaylist(recent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := SmartPlaylist{ID: recent.ID}
+	err = wdb.ReadUnique(&updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated, recent) {
+		t.Errorf("expected %+v, received %+v", recent, updated)
+	}
+
+	err = wdb.DeleteSmartPlaylist(recent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wdb.UpdateSmartPlaylist(recent); err != ErrNotPresent {
+		t.Errorf("expected %v, received %v", ErrNotPresent, err)
+	}
+	if err = wdb.DeleteSmartPlaylist(recent.ID); err != ErrNotPresent {
+		t.Errorf("expected %v, received %v", ErrNotPresent, err)
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// PlayGroup ...
+// What plays are counted by.
+type PlayGroup string
+
+const (
+	// GroupSongs counts the plays of each song.
+	GroupSongs PlayGroup = "songs"
+
+	// GroupAlbums counts the plays of the songs of each album.
+	GroupAlbums PlayGroup = "albums"
+
+	// GroupArtists counts the plays of the songs each artist is a
+	// primary artist of.
+	GroupArtists PlayGroup = "artists"
+
+	// GroupGenres counts the plays of the songs of each genre.
+	GroupGenres PlayGroup = "genres"
+)
+
+// playGroups are the tables joined to the songs of plays to count them
+// by a group, and the columns of the group's ids and names.
+var playGroups = map[PlayGroup]struct{ join, id, name string }{
+	GroupSongs:  {"", "songs.id", "songs.title"},
+	GroupAlbums: {"JOIN music.albums AS albums ON albums.id = songs.album", "albums.id", "albums.title"},
+	GroupArtists: {"JOIN music.song_artists AS sa ON sa.song_id = songs.id AND sa.role = '" + RolePrimary + "' " +
+		"JOIN music.artists AS artists ON artists.id = sa.artist_id", "artists.id", "artists.name"},
+	GroupGenres: {"JOIN music.genres AS genres ON genres.id = songs.genre", "genres.id", "genres.name"},
+}
+
+// StatsPeriod ...
+// The periods listening time is summed over.
+type StatsPeriod string
+
+const (
+	// PeriodWeek sums listening time by week, from Monday.
+	PeriodWeek StatsPeriod = "week"
+
+	// PeriodMonth sums listening time by month.
+	PeriodMonth StatsPeriod = "month"
+)
+
+// TimeRange ...
+// The plays from From and before To, both seconds since the unix epoch.
+// A To of 0 is no end.
+type TimeRange struct {
+	From int64
+	To   int64
+}
+
+// end ...
+// Returns the time plays are before.
+func (r TimeRange) end() int64 {
+	if r.To == 0 {
+		return math.MaxInt64
+	}
+	return r.To
+}
+
+// PlayCount ...
+// How many times a user played the songs of a record, and for how many
+// seconds.
+type PlayCount struct {
+	ID       int64   `edn:"id"       json:"id"`
+	Name     string  `edn:"name"     json:"name"`
+	Plays    int64   `edn:"plays"    json:"plays"`
+	Duration float64 `edn:"duration" json:"duration"`
+}
+
+// ListeningTime ...
+// How many songs a user played over a week or month starting at Start,
+// seconds since the unix epoch, and for how many seconds.
+type ListeningTime struct {
+	Start    int64   `edn:"start"    json:"start"`
+	Plays    int64   `edn:"plays"    json:"plays"`
+	Duration float64 `edn:"duration" json:"duration"`
+}
+
+// TopPlayed ...
+// Returns the songs, albums, artists or genres a user played the most
+// over a time range, the most played first and those listened to
+// longest of them before the rest. Limit is the most returned, all of
+// them when it is less than one.
+func (wdb *WarblerDB) TopPlayed(user int64, group PlayGroup, during TimeRange, limit int) ([]PlayCount, error) {
+	g, ok := playGroups[group]
+	if !ok {
+		return nil, ErrInvalidPlayGroup
+	}
+
+	query := "SELECT " + g.id + ", " + g.name + ", COUNT(1), SUM(plays.duration) " +
+		"FROM music.plays AS plays JOIN music.songs AS songs ON songs.id = plays.song_id " + g.join + " " +
+		"WHERE plays.user_id = $1 AND plays.played_at >= $2 AND plays.played_at < $3 " +
+		"GROUP BY " + g.id + ", " + g.name + " " +
+		"ORDER BY COUNT(1) DESC, SUM(plays.duration) DESC, " + g.id
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	rows, err := wdb.Query(query, user, during.From, during.end())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []PlayCount{}
+	for rows.Next() {
+		var c PlayCount
+		err = rows.Scan(&c.ID, &c.Name, &c.Plays, &c.Duration)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// periodStart ...
+// Returns the start of the week or month of a time, in UTC.
+func periodStart(period StatsPeriod, t time.Time) time.Time {
+	t = t.UTC()
+	if period == PeriodMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	// weeks start on monday
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// ListeningTimes ...
+// Returns how long a user listened each week or month of a time range
+// they played songs in, in order. Weeks and months are those of UTC.
+func (wdb *WarblerDB) ListeningTimes(user int64, period StatsPeriod, during TimeRange) ([]ListeningTime, error) {
+	if period != PeriodWeek && period != PeriodMonth {
+		return nil, ErrInvalidPeriod
+	}
+
+	rows, err := wdb.Query("SELECT played_at, duration FROM music.plays "+
+		"WHERE user_id = $1 AND played_at >= $2 AND played_at < $3 ORDER BY played_at", user, during.From, during.end())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := []ListeningTime{}
+	for rows.Next() {
+		var (
+			played   int64
+			duration float64
+		)
+		err = rows.Scan(&played, &duration)
+		if err != nil {
+			return nil, err
+		}
+
+		start := periodStart(period, time.Unix(played, 0)).Unix()
+		if len(times) == 0 || times[len(times)-1].Start != start {
+			times = append(times, ListeningTime{Start: start})
+		}
+		times[len(times)-1].Plays++
+		times[len(times)-1].Duration += duration
+	}
+	return times, rows.Err()
+}
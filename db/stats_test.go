@@ -0,0 +1,118 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestTopPlayed ...
+func TestTopPlayed(t *testing.T) {
+	prepareDB()
+
+	february := TimeRange{From: 1580515200, To: 1583020800}
+
+	var tests = []struct {
+		name     string
+		user     int64
+		group    PlayGroup
+		during   TimeRange
+		limit    int
+		expected []PlayCount
+		err      error
+	}{
+		{"songs", 1, GroupSongs, TimeRange{}, 0, []PlayCount{
+			{1, "In the Night", 2, 3986},
+			{5, "Triangle", 1, 1999},
+			{2, "Sour Soul", 1, 600},
+		}, nil},
+		{"limited", 1, GroupSongs, TimeRange{}, 1, []PlayCount{{1, "In the Night", 2, 3986}}, nil},
+		{"in february", 1, GroupSongs, february, 0, []PlayCount{
+			{5, "Triangle", 1, 1999},
+			{1, "In the Night", 1, 1993},
+		}, nil},
+		{"albums", 1, GroupAlbums, TimeRange{}, 0, []PlayCount{{1, "III", 3, 5985}, {2, "Sour Soul", 1, 600}}, nil},
+		// composers are not counted
+		{"artists", 1, GroupArtists, TimeRange{}, 0, []PlayCount{
+			{1, "BADBADNOTGOOD", 3, 5985},
+			{2, "BADBADNOTGOOD & Ghostface Killah", 1, 600},
+		}, nil},
+		{"genres", 2, GroupGenres, TimeRange{}, 0, []PlayCount{{3, "Metal", 3, 525}}, nil},
+		{"another user's", 2, GroupSongs, february, 0, []PlayCount{{3, "The Ides of March", 1, 105}}, nil},
+		{"nothing played", 2, GroupSongs, TimeRange{From: 1600000000}, 0, []PlayCount{}, nil},
+		{"invalid group", 1, PlayGroup("years"), TimeRange{}, 0, nil, ErrInvalidPlayGroup},
+	}
+
+	for _, test := range tests {
+		counts, err := wdb.TopPlayed(test.user, test.group, test.during, test.limit)
+		if err != test.err {
+			t.Errorf("%s: expected error %v, received %v", test.name, test.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(counts, test.expected) {
+			t.Errorf("%s: expected %v, received %v", test.name, test.expected, counts)
+		}
+	}
+}
+
+// TestListeningTimes ...
+func TestListeningTimes(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		name     string
+		period   StatsPeriod
+		during   TimeRange
+		expected []ListeningTime
+		err      error
+	}{
+		// the first of January 2020 was a Wednesday
+		{"weeks", PeriodWeek, TimeRange{}, []ListeningTime{
+			{1577664000, 1, 210},
+			{1578268800, 1, 210},
+			{1580083200, 1, 105},
+		}, nil},
+		{"months", PeriodMonth, TimeRange{}, []ListeningTime{
+			{1577836800, 2, 420},
+			{1580515200, 1, 105},
+		}, nil},
+		{"from the sixth", PeriodMonth, TimeRange{From: 1578268800}, []ListeningTime{
+			{1577836800, 1, 210},
+			{1580515200, 1, 105},
+		}, nil},
+		{"invalid period", StatsPeriod("day"), TimeRange{}, nil, ErrInvalidPeriod},
+	}
+
+	for _, test := range tests {
+		times, err := wdb.ListeningTimes(2, test.period, test.during)
+		if err != test.err {
+			t.Errorf("%s: expected error %v, received %v", test.name, test.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(times, test.expected) {
+			t.Errorf("%s: expected %v, received %v", test.name, test.expected, times)
+		}
+	}
+}
+
+// TestPeriodStart ...
+func TestPeriodStart(t *testing.T) {
+	var tests = []struct {
+		period   StatsPeriod
+		t        time.Time
+		expected time.Time
+	}{
+		{PeriodWeek, time.Date(2020, 1, 5, 23, 59, 0, 0, time.UTC), time.Date(2019, 12, 30, 0, 0, 0, 0, time.UTC)},
+		{PeriodWeek, time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC), time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// times are of UTC wherever they are
+		{PeriodMonth, time.Date(2020, 3, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600)), time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2020, 3, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)), time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if start := periodStart(test.period, test.t); !start.Equal(test.expected) {
+			t.Errorf("%s of %v: expected %v, received %v", test.period, test.t, test.expected, start)
+		}
+	}
+}
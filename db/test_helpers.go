@@ -1,16 +1,80 @@
 package db
 
 import (
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 
 	"gopkg.in/testfixtures.v2"
 )
 
+const (
+	testDriverEnv     = "WARBLER_TEST_DRIVER"
+	testDataSourceEnv = "WARBLER_TEST_DSN"
+)
+
+// OpenTestDatabase ...
+// Opens the database used by the test suites and migrates it to the
+// latest schema. By default a temporary sqlite database is created.
+// To run against postgres set WARBLER_TEST_DRIVER=postgres and
+// WARBLER_TEST_DSN to the connection string of an existing database
+// created by createdb.sh. The returned function removes any
+// temporary files.
+func OpenTestDatabase() (*WarblerDB, func(), error) {
+	driver := os.Getenv(testDriverEnv)
+	dataSource := os.Getenv(testDataSourceEnv)
+	cleanup := func() {}
+
+	if driver == "" {
+		driver = sqliteDialect.driver
+	}
+
+	if driver == postgresDialect.driver && dataSource == "" {
+		dataSource = "dbname=warbler_test user=warbler sslmode=disable"
+	}
+
+	if driver == sqliteDialect.driver && dataSource == "" {
+		dir, err := ioutil.TempDir("", "warbler")
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		// the name must contain "test" for testfixtures to load it
+		dataSource = filepath.Join(dir, "warbler_test.db")
+	}
+
+	wdb, err := Open(driver, dataSource)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	_, err = wdb.MigrateUp()
+	if err != nil {
+		wdb.Close()
+		cleanup()
+		return nil, nil, err
+	}
+
+	return wdb, cleanup, nil
+}
+
 // PrepareTestDatabase ...
 func PrepareTestDatabase(wdb *WarblerDB, fixturesDir string) (func(), error) {
-	var err error
+	var (
+		err    error
+		helper testfixtures.Helper
+	)
+
+	switch wdb.dialect.driver {
+	case sqliteDialect.driver:
+		helper = &testfixtures.SQLite{}
+	default:
+		helper = &testfixtures.PostgreSQL{UseAlterConstraint: true}
+	}
 
-	fixtures, err := testfixtures.NewFolder(wdb.DB, &testfixtures.PostgreSQL{UseAlterConstraint: true}, fixturesDir)
+	fixtures, err := testfixtures.NewFolder(wdb.DB, helper, fixturesDir)
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +83,47 @@ func PrepareTestDatabase(wdb *WarblerDB, fixturesDir string) (func(), error) {
 		if err := fixtures.Load(); err != nil {
 			log.Fatal(err)
 		}
+		if wdb.dialect.driver == sqliteDialect.driver {
+			if err := resetSqliteSequences(wdb); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
 	return f, nil
 }
+
+// resetSqliteSequences ...
+// testfixtures resets postgres sequences to 10000 after loading, this
+// does the same for sqlite so that ids are the same on both.
+func resetSqliteSequences(wdb *WarblerDB) error {
+	rows, err := wdb.DB.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND sql LIKE '%AUTOINCREMENT%'")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		_, err = wdb.DB.Exec("DELETE FROM sqlite_sequence WHERE name = ?", table)
+		if err != nil {
+			return err
+		}
+		_, err = wdb.DB.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES (?, 10000)", table)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
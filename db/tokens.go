@@ -0,0 +1,173 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every API token, telling them apart from
+// session tokens.
+const APITokenPrefix = "wbt_"
+
+// TokenScope ...
+// What an API token may be used for. Each scope allows what the ones
+// before it do.
+type TokenScope string
+
+const (
+	// ScopeRead reads records.
+	ScopeRead TokenScope = "read"
+
+	// ScopeStream also streams songs and serves artwork.
+	ScopeStream TokenScope = "stream"
+
+	// ScopeAdmin does anything its user can.
+	ScopeAdmin TokenScope = "admin"
+)
+
+// scopes are the valid scopes, in order.
+var scopes = []TokenScope{ScopeRead, ScopeStream, ScopeAdmin}
+
+// rank ...
+// Returns the position of a scope, -1 when it is not valid.
+func (s TokenScope) rank() int {
+	for i, scope := range scopes {
+		if s == scope {
+			return i
+		}
+	}
+	return -1
+}
+
+// Allows ...
+// Reports whether a token with the scope may be used for what needs
+// another.
+func (s TokenScope) Allows(needed TokenScope) bool {
+	return s.rank() >= 0 && s.rank() >= needed.rank()
+}
+
+// APIToken ...
+// A long lived token a user made to log in without their password.
+// Only its hash is stored, so Token is only set when it is created.
+type APIToken struct {
+	ID       int64      `edn:"id"                json:"id"`
+	User     int64      `edn:"user"              json:"user"`
+	Name     string     `edn:"name"              json:"name"`
+	Scope    TokenScope `edn:"scope"             json:"scope"`
+	Created  time.Time  `edn:"created"           json:"created"`
+	LastUsed *time.Time `edn:"last-used"         json:"last-used"`
+	Token    string     `edn:"token,omitempty"   json:"token,omitempty"`
+}
+
+// CreateAPIToken ...
+// Makes a user a named token with a scope. The token is only ever
+// returned here.
+func (wdb *WarblerDB) CreateAPIToken(user int64, name string, scope TokenScope) (token APIToken, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return token, ErrInvalidTokenName
+	}
+	if scope.rank() < 0 {
+		return token, ErrInvalidScope
+	}
+
+	b := make([]byte, sessionTokenBytes)
+	_, err = rand.Read(b)
+	if err != nil {
+		return token, err
+	}
+
+	token = APIToken{
+		User:    user,
+		Name:    name,
+		Scope:   scope,
+		Created: time.Unix(time.Now().Unix(), 0),
+		Token:   APITokenPrefix + base64.RawURLEncoding.EncodeToString(b),
+	}
+	token.ID, err = wdb.insertReturningID("INSERT INTO config.api_tokens (user_id, name, scope, token_hash, created_at) "+
+		"VALUES ($1, $2, $3, $4, $5)", user, name, string(scope), hashToken(token.Token), token.Created.Unix())
+	if err != nil {
+		return APIToken{}, err
+	}
+	return token, nil
+}
+
+// APITokens ...
+// Returns the tokens of a user, without the tokens themselves, oldest
+// first.
+func (wdb *WarblerDB) APITokens(user int64) (tokens []APIToken, err error) {
+	rows, err := wdb.Query("SELECT id, user_id, name, scope, created_at, last_used_at FROM config.api_tokens "+
+		"WHERE user_id = $1 ORDER BY id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens = []APIToken{}
+	for rows.Next() {
+		var (
+			t        APIToken
+			created  int64
+			lastUsed sql.NullInt64
+		)
+		err = rows.Scan(&t.ID, &t.User, &t.Name, &t.Scope, &created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		t.Created = time.Unix(created, 0)
+		if lastUsed.Valid {
+			used := time.Unix(lastUsed.Int64, 0)
+			t.LastUsed = &used
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken ...
+// Deletes a token of a user. Fails with ErrNotPresent when the user
+// has no token with the id.
+func (wdb *WarblerDB) RevokeAPIToken(user, id int64) error {
+	res, err := wdb.Exec("DELETE FROM config.api_tokens WHERE id = $1 AND user_id = $2", id, user)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotPresent
+	}
+	return nil
+}
+
+// APITokenUser ...
+// Returns the user of an API token and its scope, recording that it
+// was used. Fails with ErrInvalidSession when there is no such token.
+func (wdb *WarblerDB) APITokenUser(token string) (User, TokenScope, error) {
+	hash := hashToken(token)
+
+	var scope TokenScope
+	user := User{}
+	err := wdb.QueryRow(
+		"SELECT users.id, users.user_name, users.email, users.admin, users.password, tokens.scope "+
+			"FROM config.api_tokens AS tokens JOIN config.users AS users ON users.id = tokens.user_id "+
+			"WHERE tokens.token_hash = $1", hash).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Admin, &user.Password, &scope)
+	if err == sql.ErrNoRows {
+		return User{}, "", ErrInvalidSession
+	}
+	if err != nil {
+		return User{}, "", err
+	}
+
+	_, err = wdb.Exec("UPDATE config.api_tokens SET last_used_at = $1 WHERE token_hash = $2", time.Now().Unix(), hash)
+	if err != nil {
+		return User{}, "", err
+	}
+	return user, scope, nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTokenScope ...
+func TestTokenScope(t *testing.T) {
+	var tests = []struct {
+		scope, needed TokenScope
+		allows        bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeStream, false},
+		{ScopeStream, ScopeRead, true},
+		{ScopeStream, ScopeAdmin, false},
+		{ScopeAdmin, ScopeStream, true},
+		{"", ScopeRead, false},
+		{"write", ScopeRead, false},
+	}
+
+	for _, test := range tests {
+		if allows := test.scope.Allows(test.needed); allows != test.allows {
+			t.Errorf("%q allows %q: expected %v, received %v", test.scope, test.needed, test.allows, allows)
+		}
+	}
+}
+
+// TestAPITokens ...
+func TestAPITokens(t *testing.T) {
+	prepareDB()
+
+	user, scope, err := wdb.APITokenUser("wbt_listener-read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 2 || scope != ScopeRead {
+		t.Errorf("expected the listener with %q, received %+v with %q", ScopeRead, user, scope)
+	}
+
+	token, err := wdb.CreateAPIToken(1, " backup script ", ScopeAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Name != "backup script" || !strings.HasPrefix(token.Token, APITokenPrefix) {
+		t.Errorf("unexpected token %+v", token)
+	}
+	user, scope, err = wdb.APITokenUser(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || scope != ScopeAdmin {
+		t.Errorf("expected the admin with %q, received %+v with %q", ScopeAdmin, user, scope)
+	}
+
+	for _, test := range []struct {
+		name  string
+		scope TokenScope
+		err   error
+	}{
+		{"", ScopeRead, ErrInvalidTokenName},
+		{"script", "write", ErrInvalidScope},
+	} {
+		_, err = wdb.CreateAPIToken(1, test.name, test.scope)
+		if err != test.err {
+			t.Errorf("%q %q: expected %v, received %v", test.name, test.scope, test.err, err)
+		}
+	}
+
+	tokens, err := wdb.APITokens(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 tokens, received %+v", tokens)
+	}
+	// the read token was just used, the stream token in the fixtures
+	if tokens[0].LastUsed == nil || time.Since(*tokens[0].LastUsed) > time.Minute {
+		t.Errorf("expected the read token to have just been used, received %v", tokens[0].LastUsed)
+	}
+	if tokens[1].LastUsed == nil || !tokens[1].LastUsed.Equal(time.Unix(1700003600, 0)) {
+		t.Errorf("expected the stream token to have been used at 1700003600, received %v", tokens[1].LastUsed)
+	}
+	for _, token := range tokens {
+		if token.Token != "" {
+			t.Errorf("expected no token, received %q", token.Token)
+		}
+	}
+
+	// only the user of a token can revoke it
+	err = wdb.RevokeAPIToken(1, tokens[0].ID)
+	if err != ErrNotPresent {
+		t.Errorf("expected %v, received %v", ErrNotPresent, err)
+	}
+	err = wdb.RevokeAPIToken(2, tokens[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = wdb.APITokenUser("wbt_listener-read")
+	if err != ErrInvalidSession {
+		t.Errorf("expected %v, received %v", ErrInvalidSession, err)
+	}
+}
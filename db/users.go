@@ -0,0 +1,234 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MinPasswordLength is the fewest bytes a password can have.
+	MinPasswordLength = 8
+
+	// MaxPasswordLength is the most bytes of a password bcrypt uses.
+	MaxPasswordLength = 72
+
+	// sessionTokenBytes is the number of random bytes of a session
+	// token.
+	sessionTokenBytes = 32
+)
+
+var (
+	// dummyHash is compared against when logging in as a user that does
+	// not exist, so that it takes as long as with one that does.
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// User ...
+// An account that can log in. Only the bcrypt hash of the password is
+// stored, and it is never encoded. Admins manage libraries and users,
+// other users only see the libraries they are granted.
+type User struct {
+	ID       int64  `edn:"id"    json:"id"    sql:"id"`
+	Name     string `edn:"name"  json:"name"  sql:"user_name"`
+	Email    string `edn:"email" json:"email" sql:"email"`
+	Admin    bool   `edn:"admin" json:"admin" sql:"admin"`
+	Password string `edn:"-"     json:"-"     sql:"password"`
+}
+
+// GetID ...
+func (u User) GetID() int64 {
+	return u.ID
+}
+
+// SetID ...
+func (u *User) SetID(ID int64) {
+	u.ID = ID
+}
+
+// insertReturningID ...
+// Runs an insert of one row and returns its id.
+func (wdb *WarblerDB) insertReturningID(query string, args ...interface{}) (id int64, err error) {
+	if wdb.dialect.returning {
+		err = wdb.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := wdb.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// txInsertReturningID ...
+// Runs an insert of one row in a transaction and returns its id.
+func (wdb *WarblerDB) txInsertReturningID(tx *sql.Tx, query string, args ...interface{}) (id int64, err error) {
+	if wdb.dialect.returning {
+		err = tx.QueryRow(wdb.dialect.rebind(query+" RETURNING id"), args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := tx.Exec(wdb.dialect.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CreateUser ...
+// Creates a user with a password, which must be between
+// MinPasswordLength and MaxPasswordLength bytes long. User names are
+// unique.
+func (wdb *WarblerDB) CreateUser(name, email, password string, admin bool) (user User, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return user, ErrInvalidUserName
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return user, ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+
+	wdb.createMu.Lock()
+	defer wdb.createMu.Unlock()
+
+	var exists int
+	err = wdb.QueryRow("SELECT COUNT(1) FROM config.users WHERE user_name = $1", name).Scan(&exists)
+	if err != nil {
+		return user, err
+	}
+	if exists > 0 {
+		return user, ErrUserExists
+	}
+
+	user = User{Name: name, Email: email, Admin: admin, Password: string(hash)}
+	user.ID, err = wdb.insertReturningID("INSERT INTO config.users (user_name, email, admin, password) VALUES ($1, $2, $3, $4)",
+		user.Name, user.Email, user.Admin, user.Password)
+	return user, err
+}
+
+// readUser ...
+// Reads the user a row is of, nil when there is none.
+func readUser(row *sql.Row) (user *User, err error) {
+	user = &User{}
+	err = row.Scan(&user.ID, &user.Name, &user.Email, &user.Admin, &user.Password)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UserByName ...
+// Returns the user with a name. Fails with ErrNotPresent when there is
+// none.
+func (wdb *WarblerDB) UserByName(name string) (User, error) {
+	user, err := readUser(wdb.QueryRow(
+		"SELECT id, user_name, email, admin, password FROM config.users WHERE user_name = $1",
+		strings.TrimSpace(name)))
+	if err != nil {
+		return User{}, err
+	}
+	if user == nil {
+		return User{}, ErrNotPresent
+	}
+	return *user, nil
+}
+
+// Authenticate ...
+// Returns the user with a name and password. Fails with
+// ErrInvalidCredentials whether the user does not exist or the
+// password is wrong.
+func (wdb *WarblerDB) Authenticate(name, password string) (User, error) {
+	user, err := wdb.UserByName(name)
+	if err == ErrNotPresent {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("warbler"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// hashToken ...
+// Returns the hash of a token that is stored in its place.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession ...
+// Logs a user in for a duration, returning the token of the session
+// and when it expires. The user's expired sessions are removed.
+func (wdb *WarblerDB) CreateSession(user int64, ttl time.Duration) (token string, expires time.Time, err error) {
+	b := make([]byte, sessionTokenBytes)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", expires, err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	expires = now.Add(ttl)
+
+	_, err = wdb.Exec("DELETE FROM config.sessions WHERE user_id = $1 AND expires_at <= $2", user, now.Unix())
+	if err != nil {
+		return "", expires, err
+	}
+
+	_, err = wdb.Exec("INSERT INTO config.sessions (token_hash, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)",
+		hashToken(token), user, now.Unix(), expires.Unix())
+	if err != nil {
+		return "", expires, err
+	}
+	return token, expires, nil
+}
+
+// SessionUser ...
+// Returns the user logged in with a session token. Fails with
+// ErrInvalidSession when there is no such session or it has expired.
+func (wdb *WarblerDB) SessionUser(token string) (User, error) {
+	user, err := readUser(wdb.QueryRow(
+		"SELECT users.id, users.user_name, users.email, users.admin, users.password "+
+			"FROM config.sessions AS sessions JOIN config.users AS users ON users.id = sessions.user_id "+
+			"WHERE sessions.token_hash = $1 AND sessions.expires_at > $2",
+		hashToken(token), time.Now().Unix()))
+	if err != nil {
+		return User{}, err
+	}
+	if user == nil {
+		return User{}, ErrInvalidSession
+	}
+	return *user, nil
+}
+
+// DeleteSession ...
+// Logs out of the session of a token.
+func (wdb *WarblerDB) DeleteSession(token string) error {
+	_, err := wdb.Exec("DELETE FROM config.sessions WHERE token_hash = $1", hashToken(token))
+	return err
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCreateUser ...
+func TestCreateUser(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		name, password string
+		admin          bool
+		err            error
+	}{
+		{"guest", "correct horse", false, nil},
+		{"owner", "battery staple", true, nil},
+		{"  guest  ", "battery staple", false, ErrUserExists},
+		{"admin", "correct horse", true, ErrUserExists},
+		{" ", "correct horse", false, ErrInvalidUserName},
+		{"short", "horse", false, ErrInvalidPassword},
+		{"long", strings.Repeat("horse", 15), false, ErrInvalidPassword},
+	}
+
+	for _, test := range tests {
+		user, err := wdb.CreateUser(test.name, test.name+"@example.com", test.password, test.admin)
+		if err != test.err {
+			t.Errorf("%q: expected %v, received %v", test.name, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if user.ID == 0 || user.Name != strings.TrimSpace(test.name) || user.Password == test.password {
+			t.Errorf("%q: unexpected user %+v", test.name, user)
+		}
+		logged, err := wdb.Authenticate(test.name, test.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if logged.ID != user.ID || logged.Admin != test.admin {
+			t.Errorf("%q: expected to log in as %+v, received %+v", test.name, user, logged)
+		}
+	}
+}
+
+// TestAuthenticate ...
+func TestAuthenticate(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		name, password string
+		id             int64
+		err            error
+	}{
+		{"admin", "correct horse", 1, nil},
+		{"listener", "correct horse", 2, nil},
+		{"listener", "Correct horse", 0, ErrInvalidCredentials},
+		{"listener", "", 0, ErrInvalidCredentials},
+		{"nobody", "correct horse", 0, ErrInvalidCredentials},
+	}
+
+	for _, test := range tests {
+		user, err := wdb.Authenticate(test.name, test.password)
+		if err != test.err {
+			t.Errorf("%s %q: expected %v, received %v", test.name, test.password, test.err, err)
+		}
+		if user.ID != test.id {
+			t.Errorf("%s %q: expected user %d, received %d", test.name, test.password, test.id, user.ID)
+		}
+	}
+}
+
+// TestSessions ...
+func TestSessions(t *testing.T) {
+	prepareDB()
+
+	token, expires, err := wdb.CreateSession(2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(expires); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("expected the session to expire in an hour, expires in %v", until)
+	}
+
+	user, err := wdb.SessionUser(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 2 || user.Name != "listener" {
+		t.Errorf("expected the listener, received %+v", user)
+	}
+
+	// only the hash of the token is stored
+	var stored int
+	err = wdb.QueryRow("SELECT COUNT(1) FROM config.sessions WHERE token_hash = $1", token).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Error("expected the token not to be stored")
+	}
+
+	expired, _, err := wdb.CreateSession(2, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wdb.DeleteSession(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{token, expired, "", "not a token"} {
+		_, err = wdb.SessionUser(token)
+		if err != ErrInvalidSession {
+			t.Errorf("%q: expected %v, received %v", token, ErrInvalidSession, err)
+		}
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
-	"gopkg.in/edn.v1"
+	"olympos.io/encoding/edn"
 )
 
 var (
@@ -77,18 +77,18 @@ func TestUnmarshalNullBool(t *testing.T) {
 	}{
 		{[]string{"{:value false}", `{"value": false}`},
 			&Container{Value: NullBool{}},
-			&Container{Value: NullBool{sql.NullBool{false, true}}},
+			&Container{Value: NullBool{sql.NullBool{Bool: false, Valid: true}}},
 		},
 
 		{[]string{"{:value true}", `{"value": true}`},
 			&Container{Value: NullBool{}},
-			&Container{Value: NullBool{sql.NullBool{true, true}}},
+			&Container{Value: NullBool{sql.NullBool{Bool: true, Valid: true}}},
 		},
 
 		// null cases
 		{[]string{"{:value nil}", `{"value": null}`},
 			&Container{Value: NullBool{}},
-			&Container{Value: NullBool{sql.NullBool{false, false}}},
+			&Container{Value: NullBool{sql.NullBool{Bool: false, Valid: false}}},
 		},
 
 		{[]string{"{}", `{}`},
@@ -129,23 +129,23 @@ func TestUnmarshalNullFloat64(t *testing.T) {
 		// 0
 		{[]string{"{:value 3.14}", `{"value": 3.14}`},
 			&Container{Value: NullFloat64{}},
-			&Container{Value: NullFloat64{sql.NullFloat64{3.14, true}}},
+			&Container{Value: NullFloat64{sql.NullFloat64{Float64: 3.14, Valid: true}}},
 		},
 
 		{[]string{"{:value 0}", `{"value": 0}`},
 			&Container{Value: NullFloat64{}},
-			&Container{Value: NullFloat64{sql.NullFloat64{0.0, true}}},
+			&Container{Value: NullFloat64{sql.NullFloat64{Float64: 0.0, Valid: true}}},
 		},
 
 		{[]string{"{:value -3.14}", `{"value": -3.14}`},
 			&Container{Value: NullFloat64{}},
-			&Container{Value: NullFloat64{sql.NullFloat64{-3.14, true}}},
+			&Container{Value: NullFloat64{sql.NullFloat64{Float64: -3.14, Valid: true}}},
 		},
 
 		// null cases
 		{[]string{"{:value nil}", `{"value": null}`},
 			&Container{Value: NullFloat64{}},
-			&Container{Value: NullFloat64{sql.NullFloat64{0.0, false}}},
+			&Container{Value: NullFloat64{sql.NullFloat64{Float64: 0.0, Valid: false}}},
 		},
 
 		{[]string{"{}", `{}`},
@@ -187,20 +187,20 @@ func TestUnmarshalNullInt64(t *testing.T) {
 		// valued cases
 		{[]string{"{:value 4}", `{"value":4}`},
 			&Container{Value: NullInt64{}},
-			&Container{Value: NullInt64{sql.NullInt64{4, true}}}},
+			&Container{Value: NullInt64{sql.NullInt64{Int64: 4, Valid: true}}}},
 
 		{[]string{"{:value 0}", `{"value":0}`},
 			&Container{Value: NullInt64{}},
-			&Container{Value: NullInt64{sql.NullInt64{0, true}}}},
+			&Container{Value: NullInt64{sql.NullInt64{Int64: 0, Valid: true}}}},
 
 		{[]string{"{:value -4}", `{"value":-4}`},
 			&Container{Value: NullInt64{}},
-			&Container{Value: NullInt64{sql.NullInt64{-4, true}}}},
+			&Container{Value: NullInt64{sql.NullInt64{Int64: -4, Valid: true}}}},
 
 		// null cases
 		{[]string{"{:value nil}", `{"value": null}`},
 			&Container{Value: NullInt64{}},
-			&Container{Value: NullInt64{sql.NullInt64{0, false}}}},
+			&Container{Value: NullInt64{sql.NullInt64{Int64: 0, Valid: false}}}},
 
 		{[]string{"{}", `{}`},
 			&Container{Value: NullInt64{}},
@@ -242,20 +242,20 @@ func TestUnmarshalNullString(t *testing.T) {
 		// valued cases
 		{[]string{`{:value "hello"}`, `{"value":"hello"}`},
 			&Container{Value: NullString{}},
-			&Container{Value: NullString{sql.NullString{"hello", true}}}},
+			&Container{Value: NullString{sql.NullString{String: "hello", Valid: true}}}},
 
 		{[]string{`{:value "0"}`, `{"value":"0"}`},
 			&Container{Value: NullString{}},
-			&Container{Value: NullString{sql.NullString{"0", true}}}},
+			&Container{Value: NullString{sql.NullString{String: "0", Valid: true}}}},
 
 		{[]string{`{:value "world"}`, `{"value":"world"}`},
 			&Container{Value: NullString{}},
-			&Container{Value: NullString{sql.NullString{"world", true}}}},
+			&Container{Value: NullString{sql.NullString{String: "world", Valid: true}}}},
 
 		// null cases
 		{[]string{`{:value nil}`, `{"value": null}`},
 			&Container{Value: NullString{}},
-			&Container{Value: NullString{sql.NullString{"", false}}}},
+			&Container{Value: NullString{sql.NullString{String: "", Valid: false}}}},
 
 		{[]string{`{}`, `{}`},
 			&Container{Value: NullString{}},
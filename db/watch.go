@@ -0,0 +1,409 @@
+package db
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchOptions ...
+// Configures a library watcher.
+type WatchOptions struct {
+	// Debounce is how long a path must go without changes before they
+	// are applied, so files still being written are only read once.
+	// Defaults to two seconds.
+	Debounce time.Duration
+
+	// Scan configures the scans run when events were lost.
+	Scan ScanOptions
+}
+
+// Watcher ...
+// Watches the directories of libraries and applies changes to their
+// files to the database as they happen.
+type Watcher struct {
+	wdb  *WarblerDB
+	fsw  *fsnotify.Watcher
+	opts WatchOptions
+
+	mu      sync.Mutex
+	libs    map[int64]Library
+	pending map[string]time.Time // path -> time of its last event
+
+	// rescans holds a request to rescan every library, so requests made
+	// while one runs are coalesced into the next
+	rescans chan struct{}
+}
+
+// NewWatcher ...
+// Creates a watcher with no libraries. Call Run to start applying
+// changes and Add to watch libraries.
+func (wdb *WarblerDB) NewWatcher(opts WatchOptions) (*Watcher, error) {
+	if opts.Debounce <= 0 {
+		opts.Debounce = 2 * time.Second
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		wdb:     wdb,
+		fsw:     fsw,
+		opts:    opts,
+		libs:    map[int64]Library{},
+		pending: map[string]time.Time{},
+		rescans: make(chan struct{}, 1),
+	}, nil
+}
+
+// Add ...
+// Watches every directory in a library. Adding a library that is
+// already watched, for instance after its path changed, replaces it.
+func (w *Watcher) Add(lib Library) error {
+	w.mu.Lock()
+	old, ok := w.libs[lib.ID]
+	w.libs[lib.ID] = lib
+	w.mu.Unlock()
+
+	if ok && old.Path != lib.Path {
+		w.unwatch(old.Path)
+	}
+
+	return w.watch(lib.Path)
+}
+
+// watch ...
+// Watches a directory and every directory below it.
+func (w *Watcher) watch(dir string) error {
+	return filepath.Walk(dir, func(fsPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return w.fsw.Add(fsPath)
+	})
+}
+
+// unwatch ...
+// Stops watching a directory and every directory below it.
+func (w *Watcher) unwatch(dir string) {
+	for _, watched := range w.fsw.WatchList() {
+		if within(watched, dir) {
+			w.fsw.Remove(watched)
+		}
+	}
+}
+
+// within ...
+// Reports whether fsPath is dir or is below it.
+func within(fsPath, dir string) bool {
+	return fsPath == dir || strings.HasPrefix(fsPath, dir+string(filepath.Separator))
+}
+
+// library ...
+// Returns the library containing a path, the one with the longest
+// path if libraries are nested.
+func (w *Watcher) library(fsPath string) (lib Library, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, l := range w.libs {
+		if within(fsPath, l.Path) && len(l.Path) > len(lib.Path) {
+			lib, ok = l, true
+		}
+	}
+
+	return lib, ok
+}
+
+// Run ...
+// Applies changes to the watched libraries until ctx is cancelled.
+// The watcher cannot be used after Run returns.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer w.fsw.Close()
+
+	ticker := time.NewTicker(w.opts.Debounce / 2)
+	defer ticker.Stop()
+
+	// rescans run apart from the events so that they keep being read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-w.rescans:
+				w.rescan(ctx)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.mu.Lock()
+			w.pending[event.Name] = time.Now()
+			w.mu.Unlock()
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Error watching libraries: %v", err)
+			if err == fsnotify.ErrEventOverflow {
+				w.requestRescan()
+			}
+
+		case now := <-ticker.C:
+			w.flush(now)
+		}
+	}
+}
+
+// requestRescan ...
+// Asks for every watched library to be rescanned, unless a rescan is
+// already waiting to start.
+func (w *Watcher) requestRescan() {
+	select {
+	case w.rescans <- struct{}{}:
+	default:
+	}
+}
+
+// rescan ...
+// Scans every watched library, used when events were lost.
+func (w *Watcher) rescan(ctx context.Context) {
+	w.mu.Lock()
+	libs := make([]Library, 0, len(w.libs))
+	for _, lib := range w.libs {
+		libs = append(libs, lib)
+	}
+	w.mu.Unlock()
+
+	for _, lib := range libs {
+		_, err := w.wdb.ScanLibrary(ctx, lib, w.opts.Scan)
+		if err != nil {
+			log.Printf("Error rescanning library %q: %v", lib.Name, err)
+		}
+	}
+}
+
+// flush ...
+// Applies the changes to every path that has not changed for the
+// debounce period.
+func (w *Watcher) flush(now time.Time) {
+	var ready []string
+
+	w.mu.Lock()
+	for fsPath, last := range w.pending {
+		if now.Sub(last) >= w.opts.Debounce {
+			ready = append(ready, fsPath)
+			delete(w.pending, fsPath)
+		}
+	}
+	w.mu.Unlock()
+
+	byLib := map[int64][]string{}
+	libs := map[int64]Library{}
+	for _, fsPath := range ready {
+		lib, ok := w.library(fsPath)
+		if !ok {
+			continue
+		}
+		byLib[lib.ID] = append(byLib[lib.ID], fsPath)
+		libs[lib.ID] = lib
+	}
+
+	for id, paths := range byLib {
+		err := w.apply(libs[id], paths)
+		if err != nil {
+			log.Printf("Error updating library %q: %v", libs[id].Name, err)
+		}
+	}
+}
+
+// apply ...
+// Brings a library in line with the current contents of paths in it.
+// New directories are watched and their files added. A file that
+// disappeared from one path and appeared at another with the same
+// inode was moved, and keeps its song.
+func (w *Watcher) apply(lib Library, paths []string) error {
+	states, err := w.wdb.fileStates(lib)
+	if err != nil {
+		return err
+	}
+
+	var gone []string
+	files := map[string]os.FileInfo{}
+	for _, fsPath := range paths {
+		info, err := os.Stat(fsPath)
+		if os.IsNotExist(err) {
+			gone = append(gone, fsPath)
+			w.unwatch(fsPath)
+			continue
+		}
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		if !info.IsDir() {
+			files[fsPath] = info
+			continue
+		}
+
+		// a directory created in or moved into the library
+		err = w.watch(fsPath)
+		if err != nil {
+			log.Printf("Error watching %q: %v", fsPath, err)
+		}
+		err = filepath.Walk(fsPath, func(fsPath string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files[fsPath] = info
+			}
+			return err
+		})
+		if err != nil {
+			log.Printf("Encountered the following error while traversing %q: %v", fsPath, err)
+		}
+	}
+
+	isGone := func(fsPath string) bool {
+		for _, g := range gone {
+			if within(fsPath, g) {
+				return true
+			}
+		}
+		return false
+	}
+
+	movedFrom := map[int64]fileState{}
+	for fsPath, s := range states {
+		if s.Inode != 0 && isGone(fsPath) {
+			movedFrom[s.Inode] = s
+		}
+	}
+
+	sc := &scanner{wdb: w.wdb, lib: lib, states: states}
+	moved := map[string]struct{}{}
+	for fsPath, info := range files {
+		state := newFileState(lib, fsPath, info)
+		prev, known := states[fsPath]
+		if known && state.unchanged(prev) {
+			continue
+		}
+
+		old, ok := movedFrom[state.Inode]
+		if !known && ok && old.Size == state.Size {
+			err = w.wdb.moveFile(old, state)
+			if err != nil {
+				return err
+			}
+			delete(movedFrom, state.Inode)
+			moved[old.Path] = struct{}{}
+			continue
+		}
+
+		sc.process(scanFile{fsPath, state, known})
+	}
+	sc.importPlaylists()
+
+	if len(gone) == 0 {
+		return nil
+	}
+
+	removed, err := w.wdb.removeFromLibrary(lib, func(fsPath string) bool {
+		_, ok := moved[fsPath]
+		return !ok && isGone(fsPath)
+	}, states)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		_, err = w.wdb.collectGarbage()
+	}
+
+	return err
+}
+
+// moveFile ...
+// Records that the file described by from is now at the path of to.
+// Its song or playlist, if it has one, keeps its id. An image is added
+// again as it may belong to other albums under its new name.
+func (wdb *WarblerDB) moveFile(from, to fileState) error {
+	switch from.FileType {
+	case musicType:
+		_, err := wdb.Exec("UPDATE music.songs SET fs_path = $1 WHERE fs_path = $2", to.Path, from.Path)
+		if err != nil {
+			return err
+		}
+	case imageType:
+		err := wdb.removeImageFile(from.Path)
+		if err != nil {
+			return err
+		}
+		err = wdb.addImageFile(to.Path)
+		if err != nil {
+			return err
+		}
+	case playlistType:
+		_, err := wdb.Exec("UPDATE music.playlists SET fs_path = $1 WHERE library_id = $2 AND fs_path = $3",
+			to.Path, from.LibraryID, from.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := wdb.deleteFileState(Library{ID: from.LibraryID}, from.Path)
+	if err != nil {
+		return err
+	}
+
+	to.FileType = from.FileType
+	return wdb.saveFileState(to)
+}
+
+// WatchLibraries ...
+// Creates a watcher watching every library. Changes made while the
+// libraries were not watched are not seen, scan the libraries before
+// calling Run to catch up on them.
+func (wdb *WarblerDB) WatchLibraries(opts WatchOptions) (*Watcher, error) {
+	w, err := wdb.NewWatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	libs, err := wdb.GetLibraries()
+	if err != nil {
+		w.fsw.Close()
+		return nil, err
+	}
+
+	for _, lib := range libs {
+		err = w.Add(lib)
+		if err != nil {
+			log.Printf("Error watching library %q: %v", lib.Name, err)
+		}
+	}
+
+	return w, nil
+}
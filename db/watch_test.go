@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// waitFor ...
+// Polls cond until it is true, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestWatcher ...
+func TestWatcher(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Watched")
+	defer cleanup()
+
+	w, err := wdb.NewWatcher(WatchOptions{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Add(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	songs := func() []Song {
+		songs, err := wdb.GetSongsInLibrary(lib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return songs
+	}
+
+	// a directory created after the library is watched
+	song, err := ioutil.ReadFile(path.Join(testLib, testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := path.Join(lib.Path, "Thermo")
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(dir, "01 Obey.mp3"), song, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the new song to be added", func() bool { return len(songs()) == 1 })
+	added := songs()[0]
+
+	// renaming keeps the song
+	moved := path.Join(lib.Path, "Obey.mp3")
+	err = os.Rename(path.Join(dir, "01 Obey.mp3"), moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the song to be moved", func() bool {
+		s := songs()
+		return len(s) == 1 && s[0].Path == moved
+	})
+	if id := songs()[0].ID; id != added.ID {
+		t.Errorf("moving a song changed its id from %d to %d", added.ID, id)
+	}
+
+	// deleting removes the song and its album
+	err = os.Remove(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the album is collected after the song is removed
+	waitFor(t, "the song and its album to be removed", func() bool {
+		return len(songs()) == 0 && wdb.ReadUnique(&Album{ID: added.Album.Int64}) == ErrNotPresent
+	})
+
+	states, err := wdb.fileStates(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("expected no file states, received: %v", states)
+	}
+}
+
+// TestWatcherOverflow ...
+func TestWatcherOverflow(t *testing.T) {
+	prepareDB()
+
+	lib, cleanup := prepareScanLibrary(t, "Overflowed")
+	defer cleanup()
+
+	// a file added before the library is watched has no event
+	song, err := ioutil.ReadFile(path.Join(testLib, testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(lib.Path, "Obey.mp3"), song, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := wdb.NewWatcher(WatchOptions{Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Add(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requests made while one waits are coalesced
+	w.requestRescan()
+	w.requestRescan()
+	if len(w.rescans) != 1 {
+		t.Errorf("expected 1 waiting rescan, received %d", len(w.rescans))
+	}
+	<-w.rescans
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// lost events rescan the library
+	w.fsw.Errors <- fsnotify.ErrEventOverflow
+	waitFor(t, "the library to be rescanned", func() bool {
+		songs, err := wdb.GetSongsInLibrary(lib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(songs) == 1
+	})
+}
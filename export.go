@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+	"gitlab.stergianis.ca/michael/warbler/playlist"
+)
+
+// exportFormats are the formats playlists and albums are exported in,
+// by extension, with their content types.
+var exportFormats = map[string]struct {
+	format      playlist.Format
+	contentType string
+}{
+	"m3u8": {playlist.M3U8, "audio/x-mpegurl"},
+	"xspf": {playlist.XSPF, "application/xspf+xml"},
+}
+
+// streamURL ...
+// Returns the url of the stream of a song under the server's base url,
+// or its path on the server when there is none. It carries no
+// credentials, players send their own.
+func (serv *server) streamURL(enc encoder, song int64) string {
+	return strings.TrimSuffix(serv.baseURL, "/") + "/" + enc.name + "/stream/" + strconv.FormatInt(song, 10)
+}
+
+// writePlaylistFile ...
+// Responds with songs as a playlist file in the format named by the
+// type of the request's route, one entry per song streamed from the
+// server.
+func (serv *server) writePlaylistFile(enc encoder, w http.ResponseWriter, r *http.Request, title string, songs []warblerDB.Song, album string) {
+	ext := mux.Vars(r)["type"]
+	f, ok := exportFormats[ext]
+	if !ok {
+		badRequestErr(w, errors.New("invalid type"))
+		return
+	}
+
+	p := playlist.Playlist{Title: title, Entries: make([]playlist.Entry, len(songs))}
+	for i, s := range songs {
+		p.Entries[i] = playlist.Entry{
+			Location: serv.streamURL(enc, s.ID),
+			Artist:   s.Artist.String,
+			Title:    s.Title,
+			Album:    album,
+			Duration: s.Duration,
+		}
+	}
+
+	var buf bytes.Buffer
+	err := playlist.Write(&buf, f.format, p)
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": title + "." + ext}))
+	w.Write(buf.Bytes())
+}
+
+// newPlaylistExportRoute ...
+// Exports a playlist as an M3U8 or XSPF file of the songs in it the
+// user can see.
+func (serv *server) newPlaylistExportRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pl, ok := serv.requestPlaylist(w, r, func(warblerDB.Playlist, *warblerDB.User) bool { return true })
+		if !ok {
+			return
+		}
+
+		entries, err := serv.wdb.PlaylistEntries(pl.ID, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		songs := make([]warblerDB.Song, len(entries))
+		for i, e := range entries {
+			songs[i] = e.Song
+		}
+
+		serv.writePlaylistFile(enc, w, r, pl.Name, songs, "")
+	}
+}
+
+// newSmartPlaylistExportRoute ...
+// Exports the songs of a smart playlist the user can see, as they are
+// now, as an M3U8 or XSPF file.
+func (serv *server) newSmartPlaylistExportRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pl, ok := serv.requestSmartPlaylist(w, r, false)
+		if !ok {
+			return
+		}
+
+		songs, err := serv.wdb.SmartPlaylistSongs(pl, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		serv.writePlaylistFile(enc, w, r, pl.Name, songs, "")
+	}
+}
+
+// newAlbumExportRoute ...
+// Exports the songs of an album the user can see, in order, as an M3U8
+// or XSPF file.
+func (serv *server) newAlbumExportRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			badRequestErr(w, errors.New("invalid id"))
+			return
+		}
+
+		user := requestUser(r)
+		album := warblerDB.Album{ID: id}
+		err = serv.wdb.ReadUnique(&album)
+		if err == warblerDB.ErrNotPresent {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		visible, err := serv.wdb.CanSee(album, id, user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		filter := warblerDB.AllOf{
+			warblerDB.Condition{Column: "album", Op: warblerDB.OpEqual, Value: id},
+			warblerDB.Visible(warblerDB.Song{}, user),
+		}
+		results, err := serv.wdb.ReadFilter(warblerDB.Song{}, filter, []string{"disk", "track", "id"})
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		songs := make([]warblerDB.Song, len(results))
+		for i, s := range results {
+			songs[i] = s.(warblerDB.Song)
+		}
+
+		serv.writePlaylistFile(enc, w, r, album.Title, songs, album.Title)
+	}
+}
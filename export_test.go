@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestExport ...
+func TestExport(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	// the listener cannot see song 1, the second entry of Road Trip
+	entry := "#EXTINF:210,Iron Maiden - The Ides of March\n" +
+		"/json/stream/3\n"
+
+	stream := map[string]string{"Authorization": "Bearer wbt_listener-stream"}
+	read := map[string]string{"Authorization": "Bearer wbt_listener-read"}
+
+	var tests = []struct {
+		name        string
+		url         string
+		headers     map[string]string
+		rCode       int
+		contentType string
+		response    string
+	}{
+		{"playlist", "http://warbler.test/json/playlist/1/export.m3u8", stream, http.StatusOK,
+			"audio/x-mpegurl", "#EXTM3U\n#PLAYLIST:Road Trip\n" + entry + entry},
+		{"another's playlist", "http://warbler.test/json/playlist/4/export.m3u8", stream,
+			http.StatusNotFound, "", ""},
+		{"album", "http://warbler.test/edn/album/3/export.xspf", read, http.StatusOK,
+			"application/xspf+xml", "<location>/edn/stream/3</location>"},
+		{"invisible album", "http://warbler.test/json/album/1/export.xspf", read,
+			http.StatusNotFound, "", ""},
+		{"other format", "http://warbler.test/json/album/3/export.pls", read,
+			http.StatusNotFound, "", ""},
+		// tokens are not taken from urls
+		{"token in the url", "http://warbler.test/json/album/3/export.m3u8?token=wbt_listener-read", nil,
+			http.StatusUnauthorized, "", ""},
+	}
+
+	for _, test := range tests {
+		rr := do(http.MethodGet, test.url, "", test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d", test.name, test.rCode, rr.Code)
+			continue
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != test.contentType && test.contentType != "" {
+			t.Errorf("%s: expected content type %q, received %q", test.name, test.contentType, contentType)
+		}
+		if !strings.Contains(rr.Body.String(), test.response) {
+			t.Errorf("%s: expected %q in %q", test.name, test.response, rr.Body)
+		}
+	}
+}
+
+// TestStreamURL ...
+func TestStreamURL(t *testing.T) {
+	var tests = []struct {
+		baseURL string
+		url     string
+	}{
+		{"", "/json/stream/3"},
+		{"https://music.example.com", "https://music.example.com/json/stream/3"},
+		{"https://example.com/music/", "https://example.com/music/json/stream/3"},
+	}
+
+	for _, test := range tests {
+		s := &server{baseURL: test.baseURL}
+		if url := s.streamURL(encoder{name: "json"}, 3); url != test.url {
+			t.Errorf("%q: expected %q, received %q", test.baseURL, test.url, url)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 module gitlab.stergianis.ca/michael/warbler
 
-go 1.12
+go 1.16
 
 require (
 	github.com/dhowden/tag v0.0.0-20190519100835-db0c67e351b1
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gorilla/mux v1.7.3
 	github.com/h2non/filetype v1.0.9
 	github.com/lib/pq v1.2.0
 	github.com/mattn/go-sqlite3 v1.11.0
+	golang.org/x/crypto v0.24.0
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.16.0
 	gopkg.in/testfixtures.v2 v2.5.3
 	olympos.io/encoding/edn v0.0.0-20180723231152-d2d5b26ce027
 )
@@ -1,24 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
-	_ "github.com/mattn/go-sqlite3"
 	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
 )
 
 const resourcesLoc string = "frontend/resources/public/"
 
 // newServer ...
-func newServer(connStr string) (serv *server, err error) {
+func newServer(driver, dataSource string) (serv *server, err error) {
 	serv = &server{}
-	serv.wdb, err = warblerDB.Open(connStr)
+	serv.wdb, err = warblerDB.Open(driver, dataSource)
 	if err != nil {
 		return &server{}, err
 	}
@@ -43,6 +47,24 @@ func main() {
 	var err error
 	port := flag.Int("port", 8080, "The port on which to bind the server")
 	logfile := *flag.String("logfile", "", "The log file to use. Defaults to stdout.")
+	driver := flag.String("driver", "postgres", "The database driver to use, either postgres or sqlite3.")
+	dataSource := flag.String("dsn", "", "The data source name passed to the database driver. "+
+		"Defaults to the warbler database on POSTGRES_HOST for postgres and warbler.db for sqlite3.")
+	scanWorkers := flag.Int("scan-workers", runtime.NumCPU(), "The number of files processed at once when scanning a library.")
+	watch := flag.Bool("watch", false, "Watch libraries for changes and apply them as they happen.")
+	scanOnStart := flag.Bool("scan-on-start", false, "Scan every library on startup, catching up on changes made while warbler was not running.")
+	watchDelay := flag.Duration("watch-delay", 2*time.Second, "How long a file must go unchanged before a watched change is applied.")
+	cacheDir := flag.String("cache-dir", "", "The directory artwork embedded in songs is extracted to. "+
+		"Defaults to warbler in the user's cache directory.")
+	anonymous := flag.Bool("anonymous", false, "Serve requests made without logging in.")
+	sessionTTL := flag.Duration("session-ttl", defaultSessionTTL, "How long a login lasts.")
+	baseURL := flag.String("base-url", "", "The address players reach the server at, such as https://music.example.com. "+
+		"Entries of exported playlists are paths on the server without one.")
+	listenBrainzURL := flag.String("listenbrainz-url", scrobble.DefaultListenBrainzURL, "The root of the ListenBrainz API plays are forwarded to.")
+	lastFMURL := flag.String("lastfm-url", scrobble.DefaultLastFMURL, "The endpoint of the Last.fm API plays are forwarded to.")
+	lastFMKey := flag.String("lastfm-key", "", "The API key of the server's Last.fm account. "+
+		"Plays are only forwarded to Last.fm with one and its secret.")
+	lastFMSecret := flag.String("lastfm-secret", "", "The shared secret of the server's Last.fm account.")
 	flag.Parse()
 
 	// args
@@ -57,14 +79,84 @@ func main() {
 		log.SetOutput(f)
 	}
 
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		host = "localhost"
+	if *dataSource == "" {
+		switch *driver {
+		case "sqlite3":
+			*dataSource = "warbler.db"
+		default:
+			host := os.Getenv("POSTGRES_HOST")
+			if host == "" {
+				host = "localhost"
+			}
+			*dataSource = "host=" + host + " dbname=warbler user=warbler sslmode=disable"
+		}
 	}
 
-	serv, err := newServer("host=" + host + " dbname=warbler user=warbler sslmode=disable")
+	serv, err := newServer(*driver, *dataSource)
 	check(err)
 	defer serv.wdb.Close()
+	serv.scanOptions.Workers = *scanWorkers
+	serv.anonymous = *anonymous
+	serv.sessionTTL = *sessionTTL
+	serv.baseURL = *baseURL
+
+	if *cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		check(err)
+		*cacheDir = filepath.Join(userCache, "warbler")
+	}
+	serv.wdb.CacheDir = *cacheDir
+
+	// commands
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			check(runMigrate(serv.wdb, args[1:], os.Stdout))
+		case "user":
+			check(runUser(serv.wdb, args[1:], os.Stdin, os.Stdout))
+		default:
+			log.Fatalf("unknown command %q", args[0])
+		}
+		return
+	}
+
+	// refuse to serve a database the binary does not understand
+	check(serv.wdb.CheckSchema())
+
+	if *watch {
+		serv.watcher, err = serv.wdb.WatchLibraries(warblerDB.WatchOptions{
+			Debounce: *watchDelay,
+			Scan:     serv.scanOptions,
+		})
+		check(err)
+	}
+
+	if *scanOnStart || serv.watcher != nil {
+		// catch up on changes made while warbler was not running
+		// before applying new ones
+		go func(watcher *warblerDB.Watcher) {
+			ctx := context.Background()
+			if *scanOnStart {
+				err := serv.wdb.ScanLibraries(ctx, serv.scanOptions)
+				if err != nil {
+					log.Printf("Error scanning libraries: %v", err)
+				}
+			}
+			if watcher != nil {
+				watcher.Run(ctx)
+			}
+		}(serv.watcher)
+	}
+
+	serv.forwarder = serv.wdb.NewForwarder(warblerDB.ForwardOptions{
+		Scrobble: scrobble.Options{
+			ListenBrainzURL: *listenBrainzURL,
+			LastFMURL:       *lastFMURL,
+			LastFMKey:       *lastFMKey,
+			LastFMSecret:    *lastFMSecret,
+		},
+	})
+	go serv.forwarder.Run(context.Background())
 
 	serv.addRoutes()
 
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+const migrateUsage = "usage: warbler [flags] migrate up|down|status"
+
+// runMigrate ...
+// Implements the migrate command. up applies every pending
+// migration, down reverts the latest applied migration and status
+// lists every migration and whether it has been applied.
+func runMigrate(wdb *warblerDB.WarblerDB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := wdb.MigrateUp()
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "database is up to date")
+		}
+
+	case "down":
+		m, err := wdb.MigrateDown()
+		if err == warblerDB.ErrNotPresent {
+			fmt.Fprintln(out, "no migrations to revert")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %d %s\n", m.Version, m.Name)
+
+	case "status":
+		status, err := wdb.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package playlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// readM3U ...
+// Reads an M3U playlist, in UTF-8 when utf8Only is set and otherwise
+// in UTF-8 or Windows-1252.
+func readM3U(r io.Reader, utf8Only bool) (Playlist, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Playlist{}, err
+	}
+	data = trimBOM(data)
+	if !utf8.Valid(data) {
+		if utf8Only {
+			return Playlist{}, ErrInvalid
+		}
+		data, err = charmap.Windows1252.NewDecoder().Bytes(data)
+		if err != nil {
+			return Playlist{}, err
+		}
+	}
+
+	var (
+		p    Playlist
+		info Entry
+	)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info = parseEXTINF(line[len("#EXTINF:"):])
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			p.Title = strings.TrimSpace(line[len("#PLAYLIST:"):])
+		case strings.HasPrefix(line, "#EXTALB:"):
+			info.Album = strings.TrimSpace(line[len("#EXTALB:"):])
+		case strings.HasPrefix(line, "#"):
+			// #EXTM3U and other directives and comments
+		default:
+			info.Location = line
+			p.Entries = append(p.Entries, info)
+			info = Entry{}
+		}
+	}
+	return p, scanner.Err()
+}
+
+// parseEXTINF ...
+// Parses the duration and title of an #EXTINF directive, written
+// "duration attributes,Artist - Title". The title is split at the
+// first " - " into the artist and title.
+func parseEXTINF(info string) (e Entry) {
+	comma := strings.Index(info, ",")
+	if comma < 0 {
+		comma = len(info)
+	}
+
+	// the duration may be followed by attributes, key="value"
+	fields := strings.Fields(info[:comma])
+	if len(fields) > 0 {
+		if d, err := strconv.ParseFloat(fields[0], 64); err == nil && d > 0 {
+			e.Duration = d
+		}
+	}
+
+	if comma < len(info) {
+		e.Title = strings.TrimSpace(info[comma+1:])
+		if i := strings.Index(e.Title, " - "); i >= 0 {
+			e.Artist = strings.TrimSpace(e.Title[:i])
+			e.Title = strings.TrimSpace(e.Title[i+3:])
+		}
+	}
+	return e
+}
+
+// writeM3U8 ...
+// Writes an extended M3U playlist in UTF-8.
+func writeM3U8(w io.Writer, p Playlist) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if p.Title != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(p.Title))
+	}
+	for _, e := range p.Entries {
+		duration := -1
+		if e.Duration > 0 {
+			duration = int(e.Duration + 0.5)
+		}
+		title := e.Title
+		if e.Artist != "" {
+			title = e.Artist + " - " + title
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", duration, oneLine(title))
+		fmt.Fprintln(bw, oneLine(e.Location))
+	}
+	return bw.Flush()
+}
+
+// oneLine ...
+// Replaces the line breaks in s, which would end a directive early.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// trimBOM ...
+// Removes the UTF-8 byte order mark from the start of data.
+func trimBOM(data []byte) []byte {
+	if len(data) >= 3 && data[0] == 0xef && data[1] == 0xbb && data[2] == 0xbf {
+		return data[3:]
+	}
+	return data
+}
@@ -0,0 +1,140 @@
+// Package playlist reads and writes playlist files.
+//
+// M3U (with or without the extended #EXTM3U directives), M3U8, PLS and
+// XSPF playlists are read. M3U8 and XSPF playlists are written. M3U
+// files that are not UTF-8 are read as Windows-1252, as most players
+// write them.
+package playlist
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrUnsupported is returned for formats that cannot be read or
+	// written.
+	ErrUnsupported = errors.New("playlist: unsupported format")
+	// ErrInvalid is returned for files that are not playlists of
+	// their format.
+	ErrInvalid = errors.New("playlist: invalid file")
+)
+
+// Format ...
+// The format of a playlist file, named by its usual extension.
+type Format string
+
+const (
+	// M3U is a list of locations, optionally with #EXTINF directives
+	// giving their title and duration.
+	M3U Format = "m3u"
+	// M3U8 is M3U in UTF-8.
+	M3U8 Format = "m3u8"
+	// PLS is an ini file of numbered File, Title and Length keys.
+	PLS Format = "pls"
+	// XSPF is the XML Shareable Playlist Format.
+	XSPF Format = "xspf"
+)
+
+// FormatOf ...
+// Returns the format of a playlist file from its extension, reporting
+// whether it is a playlist at all.
+func FormatOf(file string) (Format, bool) {
+	f := Format(strings.ToLower(strings.TrimPrefix(filepath.Ext(file), ".")))
+	switch f {
+	case M3U, M3U8, PLS, XSPF:
+		return f, true
+	}
+	return "", false
+}
+
+// Playlist ...
+// The title and entries of a playlist file.
+type Playlist struct {
+	Title   string
+	Entries []Entry
+}
+
+// Entry ...
+// An entry of a playlist. The title and duration are those the file
+// gives, which players show until they read the file itself.
+type Entry struct {
+	// Location is a path, relative to the playlist or absolute, or a
+	// URL
+	Location string
+
+	Artist   string
+	Title    string
+	Album    string
+	Duration float64 // seconds, 0 when unknown
+}
+
+// Read ...
+// Reads a playlist in a format.
+func Read(r io.Reader, f Format) (Playlist, error) {
+	switch f {
+	case M3U, M3U8:
+		return readM3U(r, f == M3U8)
+	case PLS:
+		return readPLS(r)
+	case XSPF:
+		return readXSPF(r)
+	}
+	return Playlist{}, ErrUnsupported
+}
+
+// Write ...
+// Writes a playlist in a format, M3U8 or XSPF.
+func Write(w io.Writer, f Format, p Playlist) error {
+	switch f {
+	case M3U8:
+		return writeM3U8(w, p)
+	case XSPF:
+		return writeXSPF(w, p)
+	}
+	return ErrUnsupported
+}
+
+// Resolve ...
+// Returns the path of the file an entry's location refers to, given
+// the path of the playlist. Relative locations are relative to the
+// playlist's directory, Windows separators are understood and file
+// URLs are turned into paths. Reports false for the locations of other
+// URLs, such as streams on the web.
+func Resolve(playlistPath, location string) (string, bool) {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return "", false
+	}
+
+	if u, err := url.Parse(location); err == nil && len(u.Scheme) > 1 {
+		if u.Scheme != "file" {
+			return "", false
+		}
+		location = u.Path
+		if u.Opaque != "" {
+			// file:relative/path
+			location, err = url.PathUnescape(u.Opaque)
+			if err != nil {
+				return "", false
+			}
+		}
+	}
+
+	location = strings.Replace(location, `\`, "/", -1)
+	if !path.IsAbs(location) && !isWindowsAbs(location) {
+		location = path.Join(filepath.ToSlash(filepath.Dir(playlistPath)), location)
+	}
+	return filepath.FromSlash(path.Clean(location)), true
+}
+
+// isWindowsAbs ...
+// Reports whether a location is an absolute Windows path, C:/Music.
+func isWindowsAbs(location string) bool {
+	return len(location) >= 3 && location[1] == ':' && location[2] == '/' &&
+		(location[0] >= 'a' && location[0] <= 'z' || location[0] >= 'A' && location[0] <= 'Z')
+}
@@ -0,0 +1,158 @@
+package playlist
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFormatOf ...
+func TestFormatOf(t *testing.T) {
+	var tests = []struct {
+		file     string
+		expected Format
+		ok       bool
+	}{
+		{"/music/Road Trip.m3u", M3U, true},
+		{"/music/Road Trip.M3U8", M3U8, true},
+		{"radio.pls", PLS, true},
+		{"mix.xspf", XSPF, true},
+		{"cover.jpg", "", false},
+		{"m3u", "", false},
+	}
+
+	for _, test := range tests {
+		f, ok := FormatOf(test.file)
+		if f != test.expected || ok != test.ok {
+			t.Errorf("%s: expected %q %v, received %q %v", test.file, test.expected, test.ok, f, ok)
+		}
+	}
+}
+
+// TestRead ...
+func TestRead(t *testing.T) {
+	var tests = []struct {
+		name     string
+		format   Format
+		data     string
+		expected Playlist
+		err      error
+	}{
+		{"plain m3u", M3U, "# made by hand\r\n01 Obey.mp3\r\n\r\n/music/02 Rain.flac\r\n", Playlist{Entries: []Entry{
+			{Location: "01 Obey.mp3"},
+			{Location: "/music/02 Rain.flac"},
+		}}, nil},
+		{"extended m3u", M3U8, "\ufeff#EXTM3U\n#PLAYLIST:Road Trip\n" +
+			"#EXTINF:123 tvg-id=\"x\",Thermo - Obey\n#EXTALB:Simpsons\nObey.mp3\n" +
+			"#EXTINF:-1,Untitled\nhttp://radio.example/stream\n",
+			Playlist{Title: "Road Trip", Entries: []Entry{
+				{Location: "Obey.mp3", Artist: "Thermo", Title: "Obey", Album: "Simpsons", Duration: 123},
+				{Location: "http://radio.example/stream", Title: "Untitled"},
+			}}, nil},
+		{"windows-1252 m3u", M3U, "Bj\xf6rk - J\xf3ga.mp3\n", Playlist{Entries: []Entry{
+			{Location: "Björk - Jóga.mp3"},
+		}}, nil},
+		{"windows-1252 m3u8", M3U8, "Bj\xf6rk.mp3\n", Playlist{}, ErrInvalid},
+		{"pls", PLS, "[playlist]\nX-GNOME-Title=Radio\nNumberOfEntries=2\n" +
+			"File2=b.ogg\nTitle2=B\nFile1=a.mp3\nLength1=61\nFile10=c.mp3\nVersion=2\n",
+			Playlist{Title: "Radio", Entries: []Entry{
+				{Location: "a.mp3", Duration: 61},
+				{Location: "b.ogg", Title: "B"},
+				{Location: "c.mp3"},
+			}}, nil},
+		{"not pls", PLS, "a.mp3\n", Playlist{}, ErrInvalid},
+		{"xspf", XSPF, `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Mix</title>
+  <trackList>
+    <track><location>Thermo/01%20Obey.mp3</location><title>Obey</title><creator>Thermo</creator><duration>61500</duration></track>
+    <track><title>Nowhere</title></track>
+    <track><location>file:///music/a.mp3</location><location>b.mp3</location></track>
+  </trackList>
+</playlist>`, Playlist{Title: "Mix", Entries: []Entry{
+			{Location: "Thermo/01 Obey.mp3", Artist: "Thermo", Title: "Obey", Duration: 61.5},
+			{Location: "file:///music/a.mp3"},
+		}}, nil},
+		{"xspf without namespace", XSPF, `<playlist><trackList><track><location>a.mp3</location></track></trackList></playlist>`,
+			Playlist{Entries: []Entry{{Location: "a.mp3"}}}, nil},
+		{"not xspf", XSPF, "a.mp3", Playlist{}, ErrInvalid},
+		{"unsupported", Format("wpl"), "", Playlist{}, ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		p, err := Read(strings.NewReader(test.data), test.format)
+		if err != test.err {
+			t.Errorf("%s: expected %v, received %v", test.name, test.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, test.expected) {
+			t.Errorf("%s: expected %+v, received %+v", test.name, test.expected, p)
+		}
+	}
+}
+
+// TestResolve ...
+func TestResolve(t *testing.T) {
+	var tests = []struct {
+		location string
+		expected string
+		ok       bool
+	}{
+		{"01 Obey.mp3", "/music/Thermo/01 Obey.mp3", true},
+		{"../Other/a.mp3", "/music/Other/a.mp3", true},
+		{`Disc 1\a.mp3`, "/music/Thermo/Disc 1/a.mp3", true},
+		{"/srv/music/a.mp3", "/srv/music/a.mp3", true},
+		{`C:\Music\a.mp3`, "C:/Music/a.mp3", true},
+		{"file:///srv/music/a%20b.mp3", "/srv/music/a b.mp3", true},
+		{"http://radio.example/stream", "", false},
+		{" ", "", false},
+	}
+
+	for _, test := range tests {
+		fsPath, ok := Resolve("/music/Thermo/mix.m3u", test.location)
+		if fsPath != test.expected || ok != test.ok {
+			t.Errorf("%q: expected %q %v, received %q %v", test.location, test.expected, test.ok, fsPath, ok)
+		}
+	}
+}
+
+// TestWrite ...
+func TestWrite(t *testing.T) {
+	p := Playlist{Title: "Road\nTrip", Entries: []Entry{
+		{Location: "http://localhost/edn/stream/1", Artist: "Thermo", Title: "Obey", Album: "Simpsons", Duration: 61.4},
+		{Location: "http://localhost/edn/stream/2", Title: "Rain"},
+	}}
+
+	var buf bytes.Buffer
+	err := Write(&buf, M3U8, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#EXTM3U\n#PLAYLIST:Road Trip\n" +
+		"#EXTINF:61,Thermo - Obey\nhttp://localhost/edn/stream/1\n" +
+		"#EXTINF:-1,Rain\nhttp://localhost/edn/stream/2\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, received %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	err = Write(&buf, XSPF, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<playlist xmlns="http://xspf.org/ns/0/" version="1">`) {
+		t.Errorf("expected an XSPF playlist, received %s", buf.String())
+	}
+	read, err := Read(&buf, XSPF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, p) {
+		t.Errorf("expected %+v, received %+v", p, read)
+	}
+
+	if err := Write(&buf, PLS, p); err != ErrUnsupported {
+		t.Errorf("expected %v, received %v", ErrUnsupported, err)
+	}
+}
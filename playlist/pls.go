@@ -0,0 +1,104 @@
+package playlist
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// readPLS ...
+// Reads a PLS playlist. Entries are ordered by their number, the title
+// of the playlist is its X-GNOME-Title or Title key.
+func readPLS(r io.Reader) (Playlist, error) {
+	var (
+		p       Playlist
+		section bool
+	)
+	entries := map[int]*Entry{}
+	entry := func(n int) *Entry {
+		if entries[n] == nil {
+			entries[n] = &Entry{}
+		}
+		return entries[n]
+	}
+
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = string(trimBOM([]byte(line)))
+			first = false
+		}
+		if !utf8.ValidString(line) {
+			line, _ = charmap.Windows1252.NewDecoder().String(line)
+		}
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.EqualFold(line, "[playlist]")
+			continue
+		}
+		if !section {
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:eq])), strings.TrimSpace(line[eq+1:])
+
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if field == "" || err != nil {
+			if key == "x-gnome-title" || key == "title" {
+				p.Title = value
+			}
+			continue
+		}
+
+		switch field {
+		case "file":
+			entry(n).Location = value
+		case "title":
+			entry(n).Title = value
+		case "length":
+			if d, err := strconv.ParseFloat(value, 64); err == nil && d > 0 {
+				entry(n).Duration = d
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Playlist{}, err
+	}
+	if !section && len(entries) == 0 {
+		return Playlist{}, ErrInvalid
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n, e := range entries {
+		if e.Location != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		p.Entries = append(p.Entries, *entries[n])
+	}
+	return p, nil
+}
@@ -0,0 +1,97 @@
+package playlist
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// xspfNamespace is the namespace of XSPF version 1.
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+// xspfPlaylist ...
+// The elements of an XSPF playlist that are read and written. Files
+// without the namespace are read too.
+type xspfPlaylist struct {
+	XMLName xml.Name
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// xspfTrack ...
+type xspfTrack struct {
+	Locations []string `xml:"location"`
+	Title     string   `xml:"title,omitempty"`
+	Creator   string   `xml:"creator,omitempty"`
+	Album     string   `xml:"album,omitempty"`
+	Duration  int64    `xml:"duration,omitempty"` // milliseconds
+}
+
+// readXSPF ...
+// Reads an XSPF playlist. Tracks are given by the first of their
+// locations, and tracks without one are left out.
+func readXSPF(r io.Reader) (Playlist, error) {
+	var x xspfPlaylist
+	err := xml.NewDecoder(r).Decode(&x)
+	if err != nil || x.XMLName.Local != "playlist" {
+		return Playlist{}, ErrInvalid
+	}
+
+	p := Playlist{Title: strings.TrimSpace(x.Title)}
+	for _, t := range x.Tracks {
+		if len(t.Locations) == 0 {
+			continue
+		}
+
+		// locations are URIs, those that are relative are escaped
+		// paths
+		location := strings.TrimSpace(t.Locations[0])
+		if u, err := url.Parse(location); err == nil && u.Scheme == "" {
+			location = u.Path
+		}
+
+		p.Entries = append(p.Entries, Entry{
+			Location: location,
+			Artist:   strings.TrimSpace(t.Creator),
+			Title:    strings.TrimSpace(t.Title),
+			Album:    strings.TrimSpace(t.Album),
+			Duration: float64(t.Duration) / 1000,
+		})
+	}
+	return p, nil
+}
+
+// writeXSPF ...
+// Writes an XSPF playlist. Locations should be URLs.
+func writeXSPF(w io.Writer, p Playlist) error {
+	x := xspfPlaylist{
+		XMLName: xml.Name{Space: xspfNamespace, Local: "playlist"},
+		Version: "1",
+		Title:   p.Title,
+		Tracks:  []xspfTrack{},
+	}
+	for _, e := range p.Entries {
+		x.Tracks = append(x.Tracks, xspfTrack{
+			Locations: []string{e.Location},
+			Title:     e.Title,
+			Creator:   e.Artist,
+			Album:     e.Album,
+			Duration:  int64(e.Duration*1000 + 0.5),
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(x)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
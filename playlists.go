@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// playlistRequest ...
+// A playlist to create, or the changes to one.
+type playlistRequest struct {
+	Name    string                    `edn:"name"    json:"name"`
+	Sharing warblerDB.PlaylistSharing `edn:"sharing" json:"sharing"`
+}
+
+// entriesRequest ...
+// Songs to add to a playlist at a position, the end when there is
+// none.
+type entriesRequest struct {
+	Songs    []int64 `edn:"songs"    json:"songs"`
+	Position *int    `edn:"position" json:"position"`
+}
+
+// orderRequest ...
+// The new order of the entries of a playlist.
+type orderRequest struct {
+	Entries []int64 `edn:"entries" json:"entries"`
+}
+
+// moveRequest ...
+// The position to move an entry of a playlist to.
+type moveRequest struct {
+	Position int `edn:"position" json:"position"`
+}
+
+// decodeBody ...
+// Decodes the body of a request into v, writing an error response when
+// it cannot.
+func decodeBody(enc encoder, w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalServerError(w)
+		return false
+	}
+	err = enc.dec(data, v)
+	if err != nil {
+		badRequestErr(w, err)
+		return false
+	}
+	return true
+}
+
+// requestRecord ...
+// Reads the record named by the id of a request into record, writing
+// an error response when it cannot. Records the user cannot see are not
+// found.
+func (serv *server) requestRecord(w http.ResponseWriter, r *http.Request, record warblerDB.Queryable) bool {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		badRequestErr(w, errors.New("invalid id"))
+		return false
+	}
+
+	record.SetID(id)
+	err = serv.wdb.ReadUnique(record)
+	if err == warblerDB.ErrNotPresent {
+		w.WriteHeader(http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		internalServerError(w)
+		return false
+	}
+	visible, err := serv.wdb.CanSee(record, id, requestUser(r))
+	if err != nil {
+		internalServerError(w)
+		return false
+	}
+	if !visible {
+		w.WriteHeader(http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// forbidden ...
+// Responds to a request a user may not make, asking them to log in
+// when they have not.
+func forbidden(w http.ResponseWriter, user *warblerDB.User) {
+	if user == nil {
+		unauthorized(w)
+	} else {
+		w.WriteHeader(http.StatusForbidden)
+	}
+}
+
+// requestPlaylist ...
+// Reads the playlist of a request if the user can see it and may do
+// what allowed reports they can, writing an error response when they
+// cannot. Playlists the user cannot see are not found, and those that
+// cannot be changed without logging in ask for it.
+func (serv *server) requestPlaylist(w http.ResponseWriter, r *http.Request,
+	allowed func(warblerDB.Playlist, *warblerDB.User) bool) (playlist warblerDB.Playlist, ok bool) {
+	if !serv.requestRecord(w, r, &playlist) {
+		return playlist, false
+	}
+
+	user := requestUser(r)
+	if !allowed(playlist, user) {
+		forbidden(w, user)
+		return playlist, false
+	}
+	return playlist, true
+}
+
+// requestEntry ...
+// Returns the entry id of a request, writing an error response when it
+// is not a number.
+func requestEntry(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	entry, err := strconv.ParseInt(mux.Vars(r)["entry"], 10, 64)
+	if err != nil {
+		badRequestErr(w, errors.New("invalid entry"))
+		return 0, false
+	}
+	return entry, true
+}
+
+// playlistChanged ...
+// Responds to a change of a playlist, which fails with ErrNotPresent
+// when an entry or song it names is not there.
+func playlistChanged(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case warblerDB.ErrNotPresent:
+		w.WriteHeader(http.StatusNotFound)
+	case warblerDB.ErrInvalidPlaylistName, warblerDB.ErrInvalidSharing, warblerDB.ErrInvalidOrder:
+		badRequestErr(w, err)
+	default:
+		internalServerError(w)
+	}
+}
+
+// newPlaylistCreator ...
+// Makes the user a playlist with the name and sharing in the body.
+func (serv *server) newPlaylistCreator(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		var req playlistRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+
+		playlist, err := serv.wdb.CreatePlaylist(user.ID, req.Name, req.Sharing)
+		if err == warblerDB.ErrInvalidPlaylistName || err == warblerDB.ErrInvalidSharing {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(playlist)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(response)
+	}
+}
+
+// newPlaylistUpdater ...
+// Renames one of the user's playlists or changes its sharing, leaving
+// what is not in the body as it is.
+func (serv *server) newPlaylistUpdater(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, warblerDB.Playlist.CanManage)
+		if !ok {
+			return
+		}
+
+		var req playlistRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+
+		playlistChanged(w, serv.wdb.UpdatePlaylist(playlist.ID, req.Name, req.Sharing))
+	}
+}
+
+// newPlaylistDeleter ...
+// Deletes one of the user's playlists.
+func (serv *server) newPlaylistDeleter(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, warblerDB.Playlist.CanManage)
+		if !ok {
+			return
+		}
+
+		playlistChanged(w, serv.wdb.DeletePlaylist(playlist.ID))
+	}
+}
+
+// newPlaylistEntriesRoute ...
+// Lists the entries of a playlist in order, leaving out the songs the
+// user cannot see.
+func (serv *server) newPlaylistEntriesRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, func(warblerDB.Playlist, *warblerDB.User) bool { return true })
+		if !ok {
+			return
+		}
+
+		entries, err := serv.wdb.PlaylistEntries(playlist.ID, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(entries)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newPlaylistAppender ...
+// Adds the songs in the body to a playlist at the position in the
+// body, or at the end when there is none.
+func (serv *server) newPlaylistAppender(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, warblerDB.Playlist.CanEdit)
+		if !ok {
+			return
+		}
+
+		var req entriesRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+		position := -1
+		if req.Position != nil {
+			position = *req.Position
+		}
+
+		playlistChanged(w, serv.wdb.AddToPlaylist(playlist.ID, req.Songs, position, requestUser(r)))
+	}
+}
+
+// newPlaylistReorderer ...
+// Puts the entries of a playlist in the order given in the body.
+func (serv *server) newPlaylistReorderer(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, warblerDB.Playlist.CanEdit)
+		if !ok {
+			return
+		}
+
+		var req orderRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+
+		playlistChanged(w, serv.wdb.ReorderPlaylist(playlist.ID, req.Entries))
+	}
+}
+
+// newPlaylistEntryMover ...
+// Moves an entry of a playlist to the position in the body.
+func (serv *server) newPlaylistEntryMover(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, warblerDB.Playlist.CanEdit)
+		if !ok {
+			return
+		}
+		entry, ok := requestEntry(w, r)
+		if !ok {
+			return
+		}
+
+		var req moveRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+
+		playlistChanged(w, serv.wdb.MovePlaylistEntry(playlist.ID, entry, req.Position))
+	}
+}
+
+// newPlaylistEntryRemover ...
+// Removes an entry from a playlist.
+func (serv *server) newPlaylistEntryRemover(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestPlaylist(w, r, warblerDB.Playlist.CanEdit)
+		if !ok {
+			return
+		}
+		entry, ok := requestEntry(w, r)
+		if !ok {
+			return
+		}
+
+		playlistChanged(w, serv.wdb.RemovePlaylistEntry(playlist.ID, entry))
+	}
+}
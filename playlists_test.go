@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// TestPlaylists ...
+func TestPlaylists(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	login := func(name string) map[string]string {
+		rr := do(http.MethodPost, "/json/login", `{"name":"`+name+`","password":"correct horse"}`, nil)
+		var s session
+		err := jsonE.dec(rr.Body.Bytes(), &s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"Authorization": "Bearer " + s.Token}
+	}
+	admin, listener := login("admin"), login("listener")
+
+	var tests = []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		headers  map[string]string
+		rCode    int
+		response string
+	}{
+		{"list", http.MethodGet, "/json/playlist", "", listener, http.StatusOK,
+			`[[{"id":1,"owner":2,"name":"Road Trip","sharing":"private","library":null},{"id":2,"owner":1,"name":"Favourites","sharing":"read","library":null},{"id":3,"owner":1,"name":"Party","sharing":"collaborative","library":null}]]`},
+		{"private", http.MethodGet, "/json/playlist/4", "", listener, http.StatusNotFound, ""},
+		{"another's private", http.MethodGet, "/json/playlist/1/songs", "", admin, http.StatusNotFound, ""},
+		{"entries", http.MethodGet, "/edn/playlist/3/songs", "", admin, http.StatusOK, ""},
+		{"include", http.MethodGet, "/edn/playlist/3?include=entries", "", listener, http.StatusOK, ""},
+
+		{"create", http.MethodPost, "/json/playlist", `{"name":"Gym"}`, listener, http.StatusCreated,
+			`{"id":10001,"owner":2,"name":"Gym","sharing":"private","library":null}`},
+		{"create unnamed", http.MethodPost, "/json/playlist", `{"sharing":"read"}`, listener, http.StatusBadRequest, ""},
+		{"rename", http.MethodPut, "/edn/playlist/10001", `{:name "Run" :sharing "read"}`, listener, http.StatusNoContent, ""},
+		{"renamed", http.MethodGet, "/json/playlist/10001", "", admin, http.StatusOK,
+			`{"id":10001,"owner":2,"name":"Run","sharing":"read","library":null}`},
+		{"invalid sharing", http.MethodPut, "/json/playlist/10001", `{"sharing":"public"}`, listener, http.StatusBadRequest, ""},
+
+		// only the owner changes a read only playlist, anyone the songs
+		// of a collaborative one
+		{"rename another's", http.MethodPut, "/json/playlist/2", `{"name":"Mine"}`, listener, http.StatusForbidden, ""},
+		{"add to read only", http.MethodPost, "/json/playlist/2/songs", `{"songs":[3]}`, listener, http.StatusForbidden, ""},
+		{"add", http.MethodPost, "/json/playlist/3/songs", `{"songs":[3,3],"position":0}`, listener, http.StatusNoContent, ""},
+		{"add invisible", http.MethodPost, "/json/playlist/3/songs", `{"songs":[1]}`, listener, http.StatusNotFound, ""},
+		{"move", http.MethodPut, "/json/playlist/3/songs/4", `{"position":0}`, listener, http.StatusNoContent, ""},
+		{"reorder", http.MethodPut, "/json/playlist/3/songs", `{"entries":[10002,4,10001]}`, admin, http.StatusNoContent, ""},
+		{"reorder missing", http.MethodPut, "/json/playlist/3/songs", `{"entries":[1]}`, admin, http.StatusBadRequest, ""},
+		{"remove", http.MethodDelete, "/json/playlist/3/songs/10001", "", listener, http.StatusNoContent, ""},
+		{"remove missing", http.MethodDelete, "/json/playlist/3/songs/10001", "", listener, http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, test.body, test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d %s", test.name, test.rCode, rr.Code, rr.Body)
+		}
+		if test.response != "" && rr.Body.String() != test.response {
+			t.Errorf("%s: expected %s, received %s", test.name, test.response, rr.Body)
+		}
+	}
+
+	rr := do(http.MethodGet, "/json/playlist/3/songs", "", listener)
+	var entries []warblerDB.PlaylistEntry
+	err := jsonE.dec(rr.Body.Bytes(), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the listener cannot see song 2 of entry 4
+	if len(entries) != 1 || entries[0].ID != 10002 || entries[0].Position != 0 || entries[0].Song.ID != 3 {
+		t.Errorf("expected entry 10002 at 0, received %+v", entries)
+	}
+
+	if rr := do(http.MethodDelete, "/json/playlist/3", "", listener); rr.Code != http.StatusForbidden {
+		t.Errorf("delete another's: expected status %d, received %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/json/playlist/3", "", admin); rr.Code != http.StatusNoContent {
+		t.Errorf("delete: expected status %d, received %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do(http.MethodGet, "/json/playlist/3", "", admin); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted: expected status %d, received %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := do(http.MethodPost, "/json/playlist", `{"name":"Gym"}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("logged out: expected status %d, received %d", http.StatusUnauthorized, rr.Code)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+const (
+	// minPlayDuration is the length of the shortest songs whose streams
+	// are recorded as plays, in seconds.
+	minPlayDuration = 30
+
+	// playDuration is how much of longer songs must be streamed for a
+	// play to be recorded, in seconds. Shorter songs need half of them.
+	playDuration = 240
+
+	// defaultTopLimit is how many records are counted when a request
+	// does not say.
+	defaultTopLimit = 10
+)
+
+// streamKey ...
+// A song streamed to a user.
+type streamKey struct {
+	user, song int64
+}
+
+// songStream ...
+// How much of a song has been streamed to a user since they started.
+type songStream struct {
+	served   int64
+	expires  time.Time
+	recorded bool
+}
+
+// streamPlays ...
+// Counts the bytes of the songs streamed to each user, so that a play
+// is recorded once enough of a song has been, even when players fetch
+// it in ranges over several requests.
+type streamPlays struct {
+	mu      sync.Mutex
+	streams map[streamKey]*songStream
+}
+
+// playBytes ...
+// Returns how many bytes of a song must be streamed for it to be
+// played, 0 when streaming it is never a play.
+func playBytes(song warblerDB.Song) int64 {
+	if song.Duration < minPlayDuration || song.Size <= 0 {
+		return 0
+	}
+	if song.Duration > 2*playDuration {
+		return int64(float64(song.Size) * playDuration / song.Duration)
+	}
+	return song.Size / 2
+}
+
+// served ...
+// Adds n bytes of a song streamed to a user and reports whether they
+// just started it and whether that makes it played. A song is only
+// played once each time it is streamed, streaming it again after it
+// has had time to finish starts over.
+func (p *streamPlays) served(user int64, song warblerDB.Song, n int64, now time.Time) (started, played bool) {
+	needed := playBytes(song)
+	if needed == 0 {
+		return false, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.streams == nil {
+		p.streams = map[streamKey]*songStream{}
+	}
+	for key, s := range p.streams {
+		if now.After(s.expires) {
+			delete(p.streams, key)
+		}
+	}
+
+	key := streamKey{user, song.ID}
+	s, ok := p.streams[key]
+	if !ok {
+		s = &songStream{expires: now.Add(time.Duration(song.Duration*float64(time.Second)) + time.Minute)}
+		p.streams[key] = s
+	}
+	s.served += n
+	if s.recorded || s.served < needed {
+		return !ok, false
+	}
+	s.recorded = true
+	return !ok, true
+}
+
+// servedWriter ...
+// A response writer counting the bytes of the body written to it.
+type servedWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *servedWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// recordStream ...
+// Records a play of a song by a user once enough of it has been
+// streamed to them, telling their scrobblers they are playing it when
+// they start.
+func (serv *server) recordStream(user *warblerDB.User, song warblerDB.Song, written int64) {
+	if user == nil {
+		return
+	}
+	started, played := serv.streamPlays.served(user.ID, song, written, time.Now())
+	if started {
+		go serv.nowPlaying(user.ID, song.ID)
+	}
+	if !played {
+		return
+	}
+
+	_, err := serv.wdb.RecordPlay(warblerDB.Play{User: user.ID, Song: song.ID, Source: warblerDB.SourceStream})
+	if err != nil {
+		log.Printf("Error recording a play of song %d: %v", song.ID, err)
+		return
+	}
+	serv.forwardPlays()
+}
+
+// nowPlaying ...
+// Tells a user's scrobblers they are playing a song.
+func (serv *server) nowPlaying(user, song int64) {
+	if serv.forwarder == nil {
+		return
+	}
+	err := serv.forwarder.NowPlaying(context.Background(), user, song)
+	if err != nil {
+		log.Printf("Error sending song %d playing now to scrobblers: %v", song, err)
+	}
+}
+
+// forwardPlays ...
+// Sends the plays just recorded to the scrobblers of their users.
+func (serv *server) forwardPlays() {
+	if serv.forwarder != nil {
+		serv.forwarder.Wake()
+	}
+}
+
+// scrobbleRequest ...
+// A play of a song sent by a player. Played is the seconds since the
+// unix epoch it was played, now when it is 0, and Duration how many
+// seconds were listened to, the whole song when it is 0. NowPlaying
+// says the user started the song instead, which is not a play.
+type scrobbleRequest struct {
+	Song       int64   `edn:"song"        json:"song"`
+	Played     int64   `edn:"played"      json:"played"`
+	Duration   float64 `edn:"duration"    json:"duration"`
+	NowPlaying bool    `edn:"now-playing" json:"now-playing"`
+}
+
+// newScrobbleRoute ...
+// Records the play of a song in the body by the user, or tells their
+// scrobblers they are playing it now.
+func (serv *server) newScrobbleRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		var req scrobbleRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+		visible, err := serv.wdb.CanSee(warblerDB.Song{}, req.Song, user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.NowPlaying {
+			go serv.nowPlaying(user.ID, req.Song)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		play, err := serv.wdb.RecordPlay(warblerDB.Play{
+			User:     user.ID,
+			Song:     req.Song,
+			Played:   req.Played,
+			Duration: req.Duration,
+			Source:   warblerDB.SourceScrobble,
+		})
+		switch err {
+		case nil:
+		case warblerDB.ErrNotPresent:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case warblerDB.ErrInvalidPlayTime, warblerDB.ErrInvalidPlayDuration:
+			badRequestErr(w, err)
+			return
+		default:
+			internalServerError(w)
+			return
+		}
+		serv.forwardPlays()
+
+		response, err := enc.enc(play)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(response)
+	}
+}
+
+// parseStatsTime ...
+// Returns the seconds since the unix epoch of a time given either as
+// them or as a date, the start of that day in UTC.
+func parseStatsTime(s string) (int64, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return seconds, nil
+	}
+	day, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, errors.New("invalid time " + strconv.Quote(s))
+	}
+	return day.Unix(), nil
+}
+
+// statsRequest ...
+// Returns the user whose plays a request counts and the time range it
+// counts them over, from its user, from and to parameters, writing an
+// error response when it cannot. Users count their own plays unless
+// they are admins, and nobody's are counted for requests let through
+// anonymously.
+func statsRequest(w http.ResponseWriter, r *http.Request) (user int64, during warblerDB.TimeRange, ok bool) {
+	requester := requestUser(r)
+	if requester == nil {
+		unauthorized(w)
+		return 0, during, false
+	}
+	query := r.URL.Query()
+
+	if id := query.Get("user"); id != "" {
+		var err error
+		user, err = strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			badRequestErr(w, errors.New("invalid user"))
+			return 0, during, false
+		}
+		if !requester.Admin && requester.ID != user {
+			w.WriteHeader(http.StatusForbidden)
+			return 0, during, false
+		}
+	} else {
+		user = requester.ID
+	}
+
+	for _, t := range []struct {
+		name  string
+		value *int64
+	}{{"from", &during.From}, {"to", &during.To}} {
+		if s := query.Get(t.name); s != "" {
+			var err error
+			*t.value, err = parseStatsTime(s)
+			if err != nil {
+				badRequestErr(w, err)
+				return 0, during, false
+			}
+		}
+	}
+	return user, during, true
+}
+
+// newTopPlayedRoute ...
+// Lists the songs, albums, artists or genres a user played the most,
+// with how many times and for how long.
+func (serv *server) newTopPlayedRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, during, ok := statsRequest(w, r)
+		if !ok {
+			return
+		}
+		limit := defaultTopLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 {
+				badRequestErr(w, errors.New("invalid limit"))
+				return
+			}
+		}
+
+		counts, err := serv.wdb.TopPlayed(user, warblerDB.PlayGroup(mux.Vars(r)["group"]), during, limit)
+		if err == warblerDB.ErrInvalidPlayGroup {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(counts)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newListeningTimeRoute ...
+// Lists how long a user listened each week or month they played songs
+// in.
+func (serv *server) newListeningTimeRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, during, ok := statsRequest(w, r)
+		if !ok {
+			return
+		}
+
+		times, err := serv.wdb.ListeningTimes(user, warblerDB.StatsPeriod(mux.Vars(r)["period"]), during)
+		if err == warblerDB.ErrInvalidPeriod {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(times)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
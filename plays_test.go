@@ -0,0 +1,183 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// TestPlays ...
+func TestPlays(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	login := func(name string) map[string]string {
+		rr := do(http.MethodPost, "/json/login", `{"name":"`+name+`","password":"correct horse"}`, nil)
+		var s session
+		err := jsonE.dec(rr.Body.Bytes(), &s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"Authorization": "Bearer " + s.Token}
+	}
+	admin, listener := login("admin"), login("listener")
+	stream := map[string]string{"Authorization": "Bearer wbt_listener-stream"}
+	read := map[string]string{"Authorization": "Bearer wbt_listener-read"}
+
+	var tests = []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		headers  map[string]string
+		rCode    int
+		response string
+	}{
+		{"scrobble", http.MethodPost, "/json/scrobble", `{"song":3,"played":1600000000}`, listener, http.StatusCreated,
+			`{"id":10001,"user":2,"song":3,"played":1600000000,"duration":210,"source":"scrobble"}`},
+		{"scrobble with a token", http.MethodPost, "/edn/scrobble", `{:song 3 :played 1600000100 :duration 20.5}`, stream,
+			http.StatusCreated, `{:id 10002 :user 2 :song 3 :played 1600000100 :duration 20.5 :source"scrobble"}`},
+		{"read token", http.MethodPost, "/json/scrobble", `{"song":3}`, read, http.StatusForbidden, ""},
+		{"invisible song", http.MethodPost, "/json/scrobble", `{"song":1}`, listener, http.StatusNotFound, ""},
+		{"no such song", http.MethodPost, "/json/scrobble", `{"song":99}`, admin, http.StatusNotFound, ""},
+		{"future", http.MethodPost, "/json/scrobble", `{"song":3,"played":99999999999}`, listener, http.StatusBadRequest, ""},
+		{"anonymous", http.MethodPost, "/json/scrobble", `{"song":3}`, nil, http.StatusUnauthorized, ""},
+
+		{"history", http.MethodGet, `/json/play?data={"played":{">=":1580515200}}&include=song`, "", listener, http.StatusOK, ""},
+		{"another's play", http.MethodGet, "/json/play/4", "", listener, http.StatusNotFound, ""},
+
+		{"top songs", http.MethodGet, "/json/stats/top/songs", "", listener, http.StatusOK,
+			`[{"id":3,"name":"The Ides of March","plays":5,"duration":755.5}]`},
+		{"top genres by date", http.MethodGet, "/edn/stats/top/genres?from=2020-02-01&to=2020-03-01", "", listener,
+			http.StatusOK, `[{:id 3 :name"Metal":plays 1 :duration 105.0}]`},
+		{"top albums of another user", http.MethodGet, "/json/stats/top/albums?user=1&limit=1", "", admin, http.StatusOK,
+			`[{"id":1,"name":"III","plays":3,"duration":5985}]`},
+		{"another user's", http.MethodGet, "/json/stats/top/songs?user=1", "", listener, http.StatusForbidden, ""},
+		{"invalid group", http.MethodGet, "/json/stats/top/years", "", listener, http.StatusBadRequest, ""},
+		{"invalid limit", http.MethodGet, "/json/stats/top/songs?limit=0", "", listener, http.StatusBadRequest, ""},
+		{"invalid time", http.MethodGet, "/json/stats/top/songs?from=yesterday", "", listener, http.StatusBadRequest, ""},
+
+		{"listening time", http.MethodGet, "/json/stats/listening/month", "", listener, http.StatusOK,
+			`[{"start":1577836800,"plays":2,"duration":420},{"start":1580515200,"plays":1,"duration":105},` +
+				`{"start":1598918400,"plays":2,"duration":230.5}]`},
+		{"listening time until", http.MethodGet, "/json/stats/listening/week?to=1578268800", "", listener, http.StatusOK,
+			`[{"start":1577664000,"plays":1,"duration":210}]`},
+		{"invalid period", http.MethodGet, "/json/stats/listening/day", "", listener, http.StatusBadRequest, ""},
+		{"anonymous stats", http.MethodGet, "/json/stats/listening/week", "", nil, http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, test.body, test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d %s", test.name, test.rCode, rr.Code, rr.Body)
+		}
+		if test.response != "" && rr.Body.String() != test.response {
+			t.Errorf("%s: expected %s, received %s", test.name, test.response, rr.Body)
+		}
+	}
+
+	// plays are not seen or counted without logging in
+	for url, code := range map[string]int{"/json/play": http.StatusOK, "/json/stats/top/songs?user=2": http.StatusUnauthorized} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+		if rr.Code != code || code == http.StatusOK && rr.Body.String() != "[[]]" {
+			t.Errorf("anonymous %s: expected status %d, received %d %s", url, code, rr.Code, rr.Body)
+		}
+	}
+
+	// plays returns how many times song 3 was played
+	plays := func() int64 {
+		rr := do(http.MethodGet, "/json/song/3", "", listener)
+		var song warblerDB.Song
+		err := jsonE.dec(rr.Body.Bytes(), &song)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return song.Plays
+	}
+	if received := plays(); received != 5 {
+		t.Errorf("expected 5 plays, received %d", received)
+	}
+
+	// streams are played once half of the song has been served, over
+	// any number of requests
+	dir, err := ioutil.TempDir("", "warbler-plays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	songPath := filepath.Join(dir, "01 The Ides of March.mp3")
+	err = ioutil.WriteFile(songPath, make([]byte, 2109), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = serv.wdb.Exec("UPDATE music.songs SET fs_path = $1 WHERE id = 3", songPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		ranges   string
+		expected int64
+	}{
+		{"bytes=0-499", 5},
+		{"bytes=500-1199", 6},
+		{"", 6},
+	} {
+		headers := map[string]string{"Authorization": listener["Authorization"]}
+		if test.ranges != "" {
+			headers["Range"] = test.ranges
+		}
+		rr := do(http.MethodGet, "/json/stream/3", "", headers)
+		if rr.Code != http.StatusOK && rr.Code != http.StatusPartialContent {
+			t.Fatalf("stream %d: received status %d", i, rr.Code)
+		}
+		if received := plays(); received != test.expected {
+			t.Errorf("stream %d: expected %d plays, received %d", i, test.expected, received)
+		}
+	}
+}
+
+// TestStreamPlays ...
+func TestStreamPlays(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	long := warblerDB.Song{ID: 1, Size: 1000, Duration: 960}
+	short := warblerDB.Song{ID: 2, Size: 1000, Duration: 20}
+
+	var p streamPlays
+	var tests = []struct {
+		name     string
+		user     int64
+		song     warblerDB.Song
+		n        int64
+		at       time.Time
+		started  bool
+		expected bool
+	}{
+		// four minutes of a long song is a quarter of it
+		{"started", 1, long, 200, now, true, false},
+		{"another user", 2, long, 100, now, true, false},
+		{"four minutes", 1, long, 50, now.Add(time.Minute), false, true},
+		{"played once", 1, long, 1000, now.Add(2 * time.Minute), false, false},
+		{"another user's four minutes", 2, long, 150, now.Add(3 * time.Minute), false, true},
+		{"played again", 1, long, 250, now.Add(18 * time.Minute), true, true},
+		{"too short", 1, short, 1000, now, false, false},
+	}
+
+	for _, test := range tests {
+		started, played := p.served(test.user, test.song, test.n, test.at)
+		if started != test.started || played != test.expected {
+			t.Errorf("%s: expected %v %v, received %v %v", test.name, test.started, test.expected, started, played)
+		}
+	}
+}
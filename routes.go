@@ -17,12 +17,15 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"gitlab.stergianis.ca/michael/warbler/artwork"
 	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
 	"olympos.io/encoding/edn"
 )
@@ -36,6 +39,28 @@ var (
 type server struct {
 	wdb    *warblerDB.WarblerDB
 	router *mux.Router
+
+	scanOptions warblerDB.ScanOptions
+	scanJobs    scanJobs
+
+	// nil when libraries are not watched
+	watcher *warblerDB.Watcher
+
+	// anonymous lets requests without a session through
+	anonymous bool
+
+	// sessionTTL is how long a login lasts, defaultSessionTTL when 0
+	sessionTTL time.Duration
+
+	// baseURL is the address players reach the server at, prefixed to
+	// the entries of exported playlists
+	baseURL string
+
+	// streamPlays records plays of the songs streamed
+	streamPlays streamPlays
+
+	// nil when plays are not forwarded to scrobblers
+	forwarder *warblerDB.Forwarder
 }
 
 type encFunc func(interface{}) ([]byte, error)
@@ -64,6 +89,20 @@ func internalServerError(w http.ResponseWriter) {
 	fmt.Fprint(w, "an internal server error occurred")
 }
 
+// watchLibrary ...
+// Starts watching a library that was created or moved, if libraries
+// are being watched.
+func (serv *server) watchLibrary(lib warblerDB.Library) {
+	if serv.watcher == nil {
+		return
+	}
+
+	err := serv.watcher.Add(lib)
+	if err != nil {
+		log.Printf("Error watching library %q: %v", lib.Name, err)
+	}
+}
+
 // routes ...
 func (serv *server) addRoutes() *server {
 	// static
@@ -86,10 +125,155 @@ func (serv *server) addRoutes() *server {
 		{"/genre", &warblerDB.Genre{}},
 		{"/song", &warblerDB.Song{}},
 		{"/image", &warblerDB.Image{}},
+		{"/playlist", &warblerDB.Playlist{}},
+		{"/smartPlaylist", &warblerDB.SmartPlaylist{}},
+		{"/play", &warblerDB.Play{}},
 	}
 
 	for _, enc := range encoders {
+		// logging in and out is open to everyone, so it is matched
+		// before the authenticated routes
+		serv.router.
+			Path("/" + enc.name + "/login").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newLoginRoute(enc))
+		serv.router.
+			Path("/" + enc.name + "/logout").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newLogoutRoute(enc))
+
 		subrouter := serv.router.PathPrefix("/" + enc.name + "/").Subrouter()
+		subrouter.Use(serv.authenticate)
+
+		// users
+		subrouter.
+			Path("/user/{id}/library").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newUserLibrariesRoute(enc))
+		subrouter.
+			Path("/user/{id}/library/{library}").
+			Methods(http.MethodPut).
+			HandlerFunc(serv.newLibraryGranter(enc))
+		subrouter.
+			Path("/user/{id}/library/{library}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newLibraryRevoker(enc))
+		subrouter.
+			PathPrefix("/user").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newUserCreator(enc))
+		subrouter.
+			PathPrefix("/user").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newCurrentUserRoute(enc))
+
+		// API tokens
+		subrouter.
+			Path("/token").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newTokenLister(enc))
+		subrouter.
+			Path("/token").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newTokenCreator(enc))
+		subrouter.
+			Path("/token/{id}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newTokenRevoker(enc))
+
+		// playlists
+		subrouter.
+			Path("/playlist").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newPlaylistCreator(enc))
+		subrouter.
+			Path("/playlist/{id}").
+			Methods(http.MethodPut).
+			HandlerFunc(serv.newPlaylistUpdater(enc))
+		subrouter.
+			Path("/playlist/{id}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newPlaylistDeleter(enc))
+		subrouter.
+			Path("/playlist/{id}/songs").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newPlaylistEntriesRoute(enc))
+		subrouter.
+			Path("/playlist/{id}/songs").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newPlaylistAppender(enc))
+		subrouter.
+			Path("/playlist/{id}/songs").
+			Methods(http.MethodPut).
+			HandlerFunc(serv.newPlaylistReorderer(enc))
+		subrouter.
+			Path("/playlist/{id}/songs/{entry}").
+			Methods(http.MethodPut).
+			HandlerFunc(serv.newPlaylistEntryMover(enc))
+		subrouter.
+			Path("/playlist/{id}/songs/{entry}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newPlaylistEntryRemover(enc))
+
+		// smart playlists
+		subrouter.
+			Path("/smartPlaylist").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newSmartPlaylistCreator(enc))
+		subrouter.
+			Path("/smartPlaylist/{id}").
+			Methods(http.MethodPut).
+			HandlerFunc(serv.newSmartPlaylistUpdater(enc))
+		subrouter.
+			Path("/smartPlaylist/{id}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newSmartPlaylistDeleter(enc))
+		subrouter.
+			Path("/smartPlaylist/{id}/songs").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newSmartPlaylistSongsRoute(enc))
+
+		// plays
+		subrouter.
+			Path("/scrobble").
+			Methods(http.MethodPost).
+			HandlerFunc(serv.newScrobbleRoute(enc))
+		subrouter.
+			Path("/stats/top/{group}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newTopPlayedRoute(enc))
+		subrouter.
+			Path("/stats/listening/{period}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newListeningTimeRoute(enc))
+
+		// scrobblers
+		subrouter.
+			Path("/scrobbler").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newScrobblerLister(enc))
+		subrouter.
+			Path("/scrobbler/{service}").
+			Methods(http.MethodPut).
+			HandlerFunc(serv.newScrobblerSetter(enc))
+		subrouter.
+			Path("/scrobbler/{service}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newScrobblerDeleter(enc))
+
+		// playlist files
+		subrouter.
+			Path("/playlist/{id}/export.{type:m3u8|xspf}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newPlaylistExportRoute(enc))
+		subrouter.
+			Path("/smartPlaylist/{id}/export.{type:m3u8|xspf}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newSmartPlaylistExportRoute(enc))
+		subrouter.
+			Path("/album/{id}/export.{type:m3u8|xspf}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newAlbumExportRoute(enc))
 
 		// create libraries
 		subrouter.
@@ -105,12 +289,50 @@ func (serv *server) addRoutes() *server {
 			Methods(http.MethodPut).
 			HandlerFunc(serv.newLibraryUpdater(enc))
 
+		// scan jobs
+		subrouter.
+			PathPrefix("/scanJob/{id}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newScanJobStatus(enc))
+		subrouter.
+			PathPrefix("/scanJob/{id}").
+			Methods(http.MethodDelete).
+			HandlerFunc(serv.newScanJobCanceller(enc))
+
 		// streaming
 		subrouter.
 			PathPrefix("/stream/{id}").
 			Methods(http.MethodGet).
 			HandlerFunc(serv.newStreamRoute(enc))
 
+		// artwork
+		subrouter.
+			PathPrefix("/imageFile/{id}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newImageFileRoute(enc))
+		subrouter.
+			PathPrefix("/albumArt/{id}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newAlbumArtRoute(enc))
+
+		// artists
+		subrouter.
+			PathPrefix("/appearsOn/{id}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newAppearsOnRoute(enc))
+
+		// search
+		subrouter.
+			PathPrefix("/search").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newSearchRoute(enc))
+
+		// MusicBrainz
+		subrouter.
+			PathPrefix("/mbid/{mbid}").
+			Methods(http.MethodGet).
+			HandlerFunc(serv.newMBIDRoute(enc))
+
 		// echo is disabled in code by default for now, maybe a config
 		// option later
 		/* subrouter.
@@ -134,7 +356,9 @@ func (serv *server) addRoutes() *server {
 }
 
 // NewUniqueQueryHandler ...
-// Expects a database object, a table name, and a type to use.
+// Expects a database object, a table name, and a type to use. The
+// include parameter names the related records nested in the response.
+// Records the user cannot see are not found.
 func (serv *server) NewUniqueQueryHandler(enc encoder, queryType warblerDB.Queryable) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// we need a new memory address for our query because we will write an id.
@@ -157,7 +381,29 @@ func (serv *server) NewUniqueQueryHandler(enc encoder, queryType warblerDB.Query
 			return
 		}
 
-		response, err := enc.enc(query)
+		// records the user cannot see are not there as far as they know
+		user := requestUser(r)
+		visible, err := serv.wdb.CanSee(query, query.GetID(), user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		result, err := serv.wdb.Include(query, []interface{}{query}, parseIncludes(r.URL.Query()), user)
+		if _, ok := err.(warblerDB.ErrInvalidInclude); ok {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(result[0])
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -172,8 +418,19 @@ func (serv *server) NewUniqueQueryHandler(enc encoder, queryType warblerDB.Query
 // NewQueryHandler ...
 // Creates a general purpose query handler. Will always write an array of arrays of values for response.
 //
-// data    - Format corresponding to the encoder.
-// orderby - Specifies the field by which to order the data, and is optional.
+// data    - Format corresponding to the encoder, a filter as described
+//           by ParseFilter. Each data given is answered by an array.
+// orderby - Specifies the field by which to order the data, and is
+//           optional. Fields prefixed by - are in descending order.
+// limit   - The most results of each data, optional.
+// offset  - The number of results skipped, optional.
+// cursor  - The position of the results after a page, optional.
+// include - The related records nested in the results, optional.
+//
+// With a limit the number of results of each data is in the
+// X-Total-Count header and, when there is one data, the next page is
+// linked to in the Link header. Only records the user can see are
+// read.
 func (serv *server) NewQueryHandler(enc encoder, queryType interface{}) http.HandlerFunc {
 	const orderField = "orderby"
 	validFields, err := warblerDB.ValidFields(enc.name, queryType)
@@ -185,7 +442,6 @@ func (serv *server) NewQueryHandler(enc encoder, queryType interface{}) http.Han
 	converter := warblerDB.NewTagConverter(queryType, enc.name, "sql")
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := warblerDB.NewFromInterface(queryType)
 		data, ok := r.URL.Query()["data"]
 		// if data is not given, return all articles matching that data type
 		if !ok {
@@ -195,26 +451,78 @@ func (serv *server) NewQueryHandler(enc encoder, queryType interface{}) http.Han
 		var results []interface{}
 
 		var orderBy []string = r.URL.Query()[orderField]
+		convTags, err := warblerDB.ConvertTags(orderBy, converter)
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
 
+		page, err := parsePage(r.URL.Query())
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
+		if page.After != nil && len(data) > 1 {
+			badRequestErr(w, errors.New("a cursor is the position of a single data"))
+			return
+		}
+		if page.Limit > 0 {
+			// one more is read to know whether there is a next page
+			page.Limit++
+		}
+		includes := parseIncludes(r.URL.Query())
+		user := requestUser(r)
+
+		var counts []string
+		var next string
 		for _, d := range data {
 			// construct the query
-			err := enc.dec([]byte(d), query)
+			var decoded interface{}
+			err := enc.dec([]byte(d), &decoded)
 			if err != nil {
 				badRequestErr(w, err)
 				return
 			}
-
-			convTags, err := warblerDB.ConvertTags(orderBy, converter)
+			parsed, err := warblerDB.ParseFilter(enc.name, queryType, decoded)
 			if err != nil {
 				badRequestErr(w, err)
 				return
 			}
+			filter := warblerDB.AllOf{parsed, warblerDB.Visible(queryType, user)}
 
-			result, err := serv.wdb.Read(query, convTags)
+			result, err := serv.wdb.ReadPage(queryType, filter, convTags, page)
 			if err != nil {
 				badRequestErr(w, err)
 				return
 			}
+
+			if page.Limit > 0 {
+				count, err := serv.wdb.Count(queryType, filter)
+				if err != nil {
+					internalServerError(w)
+					return
+				}
+				counts = append(counts, strconv.Itoa(count))
+
+				if len(result) == page.Limit {
+					result = result[:page.Limit-1]
+					next, err = nextPage(r.URL, page, result[len(result)-1], convTags)
+					if err != nil {
+						internalServerError(w)
+						return
+					}
+				}
+			}
+
+			result, err = serv.wdb.Include(queryType, result, includes, user)
+			if _, ok := err.(warblerDB.ErrInvalidInclude); ok {
+				badRequestErr(w, err)
+				return
+			}
+			if err != nil {
+				internalServerError(w)
+				return
+			}
 			results = append(results, result)
 		}
 		response, err := enc.enc(results)
@@ -223,17 +531,103 @@ func (serv *server) NewQueryHandler(enc encoder, queryType interface{}) http.Han
 			return
 		}
 
+		if counts != nil {
+			w.Header().Set("X-Total-Count", strings.Join(counts, ", "))
+		}
+		if next != "" && len(data) == 1 {
+			w.Header().Set("Link", "<"+next+`>; rel="next"`)
+		}
 		w.Header().Set("Content-Type", "application/"+enc.name)
 		w.Write(response)
 	}
 }
 
+// parsePage ...
+// Reads the page of results asked for by the limit, offset and cursor
+// query parameters.
+func parsePage(params url.Values) (page warblerDB.Page, err error) {
+	number := func(name string) (int, error) {
+		s := params.Get(name)
+		if s == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%s must be a whole number", name)
+		}
+		return n, nil
+	}
+
+	page.Limit, err = number("limit")
+	if err != nil {
+		return page, err
+	}
+	page.Offset, err = number("offset")
+	if err != nil {
+		return page, err
+	}
+	if cursor := params.Get("cursor"); cursor != "" {
+		page.After, err = warblerDB.ParseCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	if (page.Offset > 0 || page.After != nil) && page.Limit == 0 {
+		return page, errors.New("offset and cursor need a limit")
+	}
+	if page.Offset > 0 && page.After != nil {
+		return page, errors.New("offset and cursor cannot be used together")
+	}
+	return page, nil
+}
+
+// parseIncludes ...
+// Reads the names of the related records to include, given as a comma
+// separated list or as several include parameters.
+func parseIncludes(params url.Values) (includes []string) {
+	for _, include := range params["include"] {
+		for _, name := range strings.Split(include, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				includes = append(includes, name)
+			}
+		}
+	}
+	return includes
+}
+
+// nextPage ...
+// Returns the url of the page after one ending with last. Pages read
+// by offset are followed by offset, others by cursor.
+func nextPage(u *url.URL, page warblerDB.Page, last interface{}, orderBy []string) (string, error) {
+	params := u.Query()
+	// the page was read with one more than the limit
+	limit := page.Limit - 1
+	if page.Offset > 0 {
+		params.Set("offset", strconv.Itoa(page.Offset+limit))
+	} else {
+		cursor, err := warblerDB.Cursor(last, orderBy)
+		if err != nil {
+			return "", err
+		}
+		params.Set("cursor", cursor)
+	}
+
+	next := *u
+	next.RawQuery = params.Encode()
+	return next.RequestURI(), nil
+}
+
 // newLibraryCreator creates a library creator based on the current
 // server. It allows you to issue a request via http to create a
 // database object representing the root location of a collection of
 // audio files.
 func (serv *server) newLibraryCreator(enc encoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+
 		data, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			internalServerError(w)
@@ -253,6 +647,7 @@ func (serv *server) newLibraryCreator(enc encoder) http.HandlerFunc {
 			fmt.Fprint(w, "Library already exists.")
 			return
 		}
+		serv.watchLibrary(l)
 
 		returnData, err := enc.enc(l)
 		if err != nil {
@@ -267,6 +662,10 @@ func (serv *server) newLibraryCreator(enc encoder) http.HandlerFunc {
 // newLibraryUpdater creates a library updater
 func (serv *server) newLibraryUpdater(enc encoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+
 		data, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			internalServerError(w)
@@ -306,13 +705,29 @@ func (serv *server) newLibraryUpdater(enc encoder) http.HandlerFunc {
 			return
 		}
 
+		if set.Path != "" {
+			lib := warblerDB.Library{ID: where.ID}
+			err = serv.wdb.ReadUnique(&lib)
+			if err != nil {
+				internalServerError(w)
+				return
+			}
+			serv.watchLibrary(lib)
+		}
+
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
 // newLibraryScanner ...
+// Starts scanning a library in the background and responds with the
+// scan job, whose progress can be followed at /scanJob/{id}.
 func (serv *server) newLibraryScanner(enc encoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+
 		params := mux.Vars(r)
 		libID := params["id"]
 		id, err := strconv.ParseInt(libID, 10, 64)
@@ -328,21 +743,194 @@ func (serv *server) newLibraryScanner(enc encoder) http.HandlerFunc {
 			return
 		}
 
-		err = serv.wdb.ScanLibrary(lib)
+		job := serv.scanJobs.start(serv.wdb, lib, serv.scanOptions)
+
+		returnData, err := enc.enc(job.status())
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(returnData)
+	}
+}
+
+// lookupScanJob ...
+// Returns the scan job named by the id in the request's url. Writes
+// an error response and returns nil if there is no such job.
+func (serv *server) lookupScanJob(w http.ResponseWriter, r *http.Request) *scanJob {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		badRequestErr(w, errors.New("invalid id"))
+		return nil
+	}
+
+	job := serv.scanJobs.get(id)
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	return job
+}
+
+// newScanJobStatus ...
+// Reports the progress of a scan job.
+func (serv *server) newScanJobStatus(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+
+		job := serv.lookupScanJob(w, r)
+		if job == nil {
+			return
+		}
+
+		returnData, err := enc.enc(job.status())
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(returnData)
+	}
+}
+
+// newScanJobCanceller ...
+// Cancels a scan job. The job stops once the files being processed
+// are done, nothing is removed from the library by a cancelled scan.
+func (serv *server) newScanJobCanceller(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !serv.isAdmin(w, r) {
+			return
+		}
+
+		job := serv.lookupScanJob(w, r)
+		if job == nil {
+			return
+		}
+
+		job.cancel()
+
+		returnData, err := enc.enc(job.status())
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(returnData)
+	}
+}
+
+// newAppearsOnRoute ...
+// Lists the albums of other artists that an artist is credited on,
+// as a featured artist, composer, remixer or producer.
+func (serv *server) newAppearsOnRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			badRequestErr(w, errors.New("invalid id"))
+			return
+		}
+
+		user := requestUser(r)
+		visible, err := serv.wdb.CanSee(warblerDB.Artist{}, id, user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		albums, err := serv.wdb.AppearsOn(id, user)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(albums)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newSearchRoute ...
+// Searches the names of artists, albums, songs and genres for the q
+// query parameter. limit optionally caps the number of each returned.
+func (serv *server) newSearchRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		limit := 0
+		if l := params.Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > warblerDB.MaxSearchLimit {
+				badRequestErr(w, fmt.Errorf("limit must be between 1 and %d", warblerDB.MaxSearchLimit))
+				return
+			}
+		}
+
+		results, err := serv.wdb.Search(params.Get("q"), limit, requestUser(r))
+		if err == warblerDB.ErrEmptySearch {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(results)
 		if err != nil {
 			internalServerError(w)
 			return
 		}
 
-		returnData, err := enc.enc(lib)
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newMBIDRoute ...
+// Resolves a MusicBrainz id to the artists, albums and songs with it.
+// Albums are found by their release or release group id.
+func (serv *server) newMBIDRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records, err := serv.wdb.ReadMBID(mux.Vars(r)["mbid"], requestUser(r))
+		switch {
+		case err == warblerDB.ErrInvalidMBID:
+			badRequestErr(w, err)
+			return
+		case err == warblerDB.ErrNotPresent:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case err != nil:
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(records)
 		if err != nil {
 			internalServerError(w)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/"+enc.name)
-		fmt.Fprintf(w, "%s", returnData)
+		w.Write(response)
 	}
 }
 
@@ -383,17 +971,175 @@ func (serv *server) newStreamRoute(enc encoder) http.HandlerFunc {
 			return
 		}
 
-		// lookup file for the song
+		visible, err := serv.wdb.CanSee(song, id, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// lookup file for the song, it may have been removed since
+		// the library was last scanned
 		f, err := os.OpenFile(song.Path, os.O_RDONLY, 0644)
-		defer f.Close()
+		if os.IsNotExist(err) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			internalServerError(w)
 			return
 		}
+		defer f.Close()
 
 		// ServeContent supports ranged headers. This is a modified
 		// net/http.ServeContent taken directly from source at
 		// version 1.12.6 you can read the source at content.go
-		ServeContent(w, r, song.Path, unixEpoch, f)
+		cw := &servedWriter{ResponseWriter: w}
+		ServeContent(cw, r, song.Path, unixEpoch, f)
+		serv.recordStream(requestUser(r), song, cw.written)
+	}
+}
+
+// serveImage ...
+// Writes the contents of an image, which may have been removed since
+// its library was last scanned.
+func serveImage(w http.ResponseWriter, r *http.Request, img warblerDB.Image) {
+	f, err := os.Open(img.Path)
+	if os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	if img.MIMEType.Valid {
+		w.Header().Set("Content-Type", img.MIMEType.String)
+	}
+	// the hash identifies the contents, clients check it is current
+	// before using their copy
+	if img.Hash.Valid {
+		w.Header().Set("ETag", `"`+img.Hash.String+`"`)
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	ServeContent(w, r, img.Path, info.ModTime(), f)
+}
+
+// serveArtwork ...
+// Writes the contents of an image, resized when the request has a
+// size parameter. The format parameter chooses the format it is
+// resized to, jpeg if there is none.
+func (serv *server) serveArtwork(w http.ResponseWriter, r *http.Request, img warblerDB.Image) {
+	query := r.URL.Query()
+	if query.Get("size") == "" {
+		serveImage(w, r, img)
+		return
+	}
+
+	size, err := strconv.Atoi(query.Get("size"))
+	if err != nil || size <= 0 {
+		badRequestErr(w, errors.New("invalid size"))
+		return
+	}
+	format := artwork.JPEG
+	if name := query.Get("format"); name != "" {
+		format, err = artwork.ParseFormat(name)
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
+	}
+
+	resized, err := serv.wdb.ResizedImage(img, size, format)
+	if os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	serveImage(w, r, resized)
+}
+
+// newImageFileRoute ...
+// Serves the contents of an image, optionally resized.
+func (serv *server) newImageFileRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			badRequestErr(w, errors.New("invalid id"))
+			return
+		}
+
+		visible, err := serv.wdb.CanSee(warblerDB.Image{}, id, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		img := warblerDB.Image{ID: id}
+		err = serv.wdb.ReadUnique(&img)
+		if err == warblerDB.ErrNotPresent {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		serv.serveArtwork(w, r, img)
+	}
+}
+
+// newAlbumArtRoute ...
+// Serves the contents of the primary image of an album, optionally
+// resized.
+func (serv *server) newAlbumArtRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			badRequestErr(w, errors.New("invalid id"))
+			return
+		}
+
+		visible, err := serv.wdb.CanSee(warblerDB.Album{}, id, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		if !visible {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		img, err := serv.wdb.PrimaryImage(id)
+		if err == warblerDB.ErrNotPresent {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		serv.serveArtwork(w, r, img)
 	}
 }
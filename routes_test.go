@@ -1,16 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
 	"olympos.io/encoding/edn"
 )
@@ -26,19 +34,16 @@ var (
 	}
 )
 
-const (
-	dbName = "warbler_test"
-)
-
 // TestMain ...
 func TestMain(m *testing.M) {
 	var err error
 
-	// use warbler test server
-	serv, err = newServer("dbname=" + dbName + " user=warbler sslmode=disable")
+	// use warbler test database
+	wdb, cleanup, err := warblerDB.OpenTestDatabase()
 	if err != nil {
 		log.Fatalln("cannot create connection to testing server", err)
 	}
+	serv = &server{wdb: wdb, router: mux.NewRouter(), anonymous: true}
 	serv.addRoutes()
 
 	prepareDB, err = warblerDB.PrepareTestDatabase(serv.wdb, "db/fixtures")
@@ -46,7 +51,10 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	serv.wdb.Close()
+	cleanup()
+	os.Exit(code)
 }
 
 // TestNewUniqueQueryHandler ...
@@ -60,12 +68,12 @@ func TestNewUniqueQueryHandler(t *testing.T) {
 	}{
 		{"library successful", http.StatusOK, "/edn/library/1", `{:id 1 :name"Music":path"/home/test/Music"}`},
 		{"genre successful", http.StatusOK, "/json/genre/1", `{"id":1,"name":"Jazz"}`},
-		{"artist successful", http.StatusOK, "/edn/artist/1", `{:id 1 :name"BADBADNOTGOOD"}`},
+		{"artist successful", http.StatusOK, "/edn/artist/1", `{:id 1 :name"BADBADNOTGOOD":mbid "0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"}`},
 		{"album successful", http.StatusOK, "/json/album/1",
-			`{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688}`},
+			`{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688,"blurhash":"LEHV6nWB2yk8pyo0adR*.7kCMdnj","mbid":"4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56","release-group-mbid":"9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21"}`},
 		{"song successful", http.StatusOK, "/edn/song/1",
-			`{:id 1 :album 1 :genre 1 :title"In the Night":size 204192 :duration 1993.0 :track 1 :num-tracks 20 :disk 1 :num-disks 1 :artist "BADBADNOTGOOD"}`},
-		{"image successful", http.StatusOK, "/json/image/1", `{"id":1}`},
+			`{:id 1 :album 1 :genre 1 :title"In the Night":size 204192 :duration 1993.0 :track 1 :num-tracks 20 :disk 1 :num-disks 1 :artist "BADBADNOTGOOD" :year 2011 :codec "flac" :container "flac" :bitrate 2304000 :vbr false :sample-rate 96000 :bit-depth 24 :channels 2 :lossless true :mbid "6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09" :added nil :plays 2 :last-played 1580602200 :artists[{:artist 1 :name"BADBADNOTGOOD":role"primary"}]}`},
+		{"image successful", http.StatusOK, "/json/image/1", `{"id":1,"hash":"3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7","mime-type":"image/jpeg","source":"folder","blurhash":"LEHV6nWB2yk8pyo0adR*.7kCMdnj"}`},
 		{"album invalid characters", http.StatusBadRequest, "/edn/album/h9h", ""},
 		{"album number not in database", http.StatusNotFound, "/edn/album/99", ""},
 	}
@@ -112,18 +120,32 @@ func TestNewQueryHandler(t *testing.T) {
 		{ednE, http.StatusOK, "/edn/artist", []string{`{}`}},
 		{jsonE, http.StatusOK, "/json/artist", []string{`{}`}},
 		{jsonE, http.StatusOK, "/json/album", []string{}},
+		{jsonE, http.StatusOK, "/json/song", []string{`{"codec": "mp3"}`}},
+		{jsonE, http.StatusOK, "/json/album", []string{`{"year": {">=": 2000, "<": 2012}, "or": [{"artist": 2}, {"blurhash": {"prefix": "leh"}}]}`}},
+		{ednE, http.StatusOK, "/edn/song", []string{`{:lossless false}`}},
+		{ednE, http.StatusOK, "/edn/artist", []string{`{:not {:id {:in [1 2]}} :mbid nil}`}},
 
 		// error cases
 		{ednE, http.StatusBadRequest, "/edn/song", []string{`4`}},
+		{jsonE, http.StatusBadRequest, "/json/song", []string{`{"path": "/"}`}},
+		{jsonE, http.StatusBadRequest, "/json/album", []string{`{"year": {"~": 1990}}`}},
+		{jsonE, http.StatusBadRequest, "/json/album", []string{`{"year": "1990"}`}},
 	}
 	answers := []string{
-		`[[{:id 1 :album 1 :genre 1 :title"In the Night":size 204192 :duration 1993.0 :track 1 :num-tracks 20 :disk 1 :num-disks 1 :artist "BADBADNOTGOOD"}{:id 5 :album 1 :genre 1 :title"Triangle":size 204299 :duration 1999.0 :track 2 :num-tracks 20 :disk 1 :num-disks 1 :artist "BADBADNOTGOOD"}{:id 6 :album 1 :genre 1 :title"Something":size 91841 :duration 9381.0 :track nil :num-tracks nil :disk nil :num-disks nil :artist "BADBADNOTGOOD"}]]`,
-		`[[{:id 3 :album 3 :genre 3 :title"The Ides of March":size 2109 :duration 210.0 :track 1 :num-tracks 8 :disk 1 :num-disks 1 :artist "Iron Maiden"}][{:id 4 :album 4 :genre 4 :title"Hangar 18":size 99948 :duration 9994.0 :track 1 :num-tracks 13 :disk 1 :num-disks 1 :artist "Megadeth"}]]`,
-		`[[{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688},{"id":2,"artist":2,"title":"Sour Soul","year":2001,"num-tracks":10,"num-disks":1,"duration":1800},{"id":3,"artist":3,"title":"Killers","year":1980,"num-tracks":8,"num-disks":1,"duration":15440},{"id":4,"artist":4,"title":"Rust in Peace","year":1985,"num-tracks":13,"num-disks":1,"duration":1756},{"id":5,"artist":1,"title":"IV","year":2012,"num-tracks":19,"num-disks":1,"duration":1688}]]`,
-		`[[{:id 1 :name"BADBADNOTGOOD"}{:id 2 :name"BADBADNOTGOOD \u0026 Ghostface Killah"}{:id 3 :name"Iron Maiden"}{:id 4 :name"Megadeth"}]]`,
-		`[[{"id":1,"name":"BADBADNOTGOOD"},{"id":2,"name":"BADBADNOTGOOD \u0026 Ghostface Killah"},{"id":3,"name":"Iron Maiden"},{"id":4,"name":"Megadeth"}]]`,
-		`[[{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688},{"id":2,"artist":2,"title":"Sour Soul","year":2001,"num-tracks":10,"num-disks":1,"duration":1800},{"id":3,"artist":3,"title":"Killers","year":1980,"num-tracks":8,"num-disks":1,"duration":15440},{"id":4,"artist":4,"title":"Rust in Peace","year":1985,"num-tracks":13,"num-disks":1,"duration":1756},{"id":5,"artist":1,"title":"IV","year":2012,"num-tracks":19,"num-disks":1,"duration":1688}]]`,
-		"edn: cannot unmarshal int into Go value of type db.Song",
+		`[[{:id 1 :album 1 :genre 1 :title"In the Night":size 204192 :duration 1993.0 :track 1 :num-tracks 20 :disk 1 :num-disks 1 :artist "BADBADNOTGOOD" :year 2011 :codec "flac" :container "flac" :bitrate 2304000 :vbr false :sample-rate 96000 :bit-depth 24 :channels 2 :lossless true :mbid "6d8f0c2a-3e1b-4a9c-8f7d-5b4e3a2c1d09" :added nil :plays 2 :last-played 1580602200 :artists[{:artist 1 :name"BADBADNOTGOOD":role"primary"}]}]]`,
+		`[[{:id 3 :album 3 :genre 3 :title"The Ides of March":size 2109 :duration 210.0 :track 1 :num-tracks 8 :disk 1 :num-disks 1 :artist "Iron Maiden" :year 1980 :codec "mp3" :container "mp3" :bitrate 128000 :vbr false :sample-rate 44100 :bit-depth nil :channels 2 :lossless false :mbid nil :added nil :plays 3 :last-played 1580518800 :artists[{:artist 3 :name"Iron Maiden":role"primary"}]}][{:id 4 :album 4 :genre 4 :title"Hangar 18":size 99948 :duration 9994.0 :track 1 :num-tracks 13 :disk 1 :num-disks 1 :artist "Megadeth" :year 1985 :codec nil :container nil :bitrate nil :vbr nil :sample-rate nil :bit-depth nil :channels nil :lossless nil :mbid nil :added nil :plays 0 :last-played nil :artists[{:artist 4 :name"Megadeth":role"primary"}]}]]`,
+		`[[{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688,"blurhash":"LEHV6nWB2yk8pyo0adR*.7kCMdnj","mbid":"4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56","release-group-mbid":"9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21"},{"id":2,"artist":2,"title":"Sour Soul","year":2001,"num-tracks":10,"num-disks":1,"duration":1800,"blurhash":"LKO2?U%2Tw=w]~RBVZRi};RPxuwH","mbid":null,"release-group-mbid":null},{"id":3,"artist":3,"title":"Killers","year":1980,"num-tracks":8,"num-disks":1,"duration":15440,"blurhash":null,"mbid":null,"release-group-mbid":null},{"id":4,"artist":4,"title":"Rust in Peace","year":1985,"num-tracks":13,"num-disks":1,"duration":1756,"blurhash":null,"mbid":null,"release-group-mbid":null}]]`,
+		`[[{:id 1 :name"BADBADNOTGOOD":mbid "0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"}{:id 2 :name"BADBADNOTGOOD \u0026 Ghostface Killah":mbid nil}{:id 3 :name"Iron Maiden":mbid nil}{:id 4 :name"Megadeth":mbid nil}]]`,
+		`[[{"id":1,"name":"BADBADNOTGOOD","mbid":"0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"},{"id":2,"name":"BADBADNOTGOOD \u0026 Ghostface Killah","mbid":null},{"id":3,"name":"Iron Maiden","mbid":null},{"id":4,"name":"Megadeth","mbid":null}]]`,
+		`[[{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688,"blurhash":"LEHV6nWB2yk8pyo0adR*.7kCMdnj","mbid":"4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56","release-group-mbid":"9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21"},{"id":2,"artist":2,"title":"Sour Soul","year":2001,"num-tracks":10,"num-disks":1,"duration":1800,"blurhash":"LKO2?U%2Tw=w]~RBVZRi};RPxuwH","mbid":null,"release-group-mbid":null},{"id":3,"artist":3,"title":"Killers","year":1980,"num-tracks":8,"num-disks":1,"duration":15440,"blurhash":null,"mbid":null,"release-group-mbid":null},{"id":4,"artist":4,"title":"Rust in Peace","year":1985,"num-tracks":13,"num-disks":1,"duration":1756,"blurhash":null,"mbid":null,"release-group-mbid":null}]]`,
+		`[[{"id":3,"album":3,"genre":3,"title":"The Ides of March","size":2109,"duration":210,"track":1,"num-tracks":8,"disk":1,"num-disks":1,"artist":"Iron Maiden","year":1980,"codec":"mp3","container":"mp3","bitrate":128000,"vbr":false,"sample-rate":44100,"bit-depth":null,"channels":2,"lossless":false,"mbid":null,"added":null,"plays":3,"last-played":1580518800,"artists":[{"artist":3,"name":"Iron Maiden","role":"primary"}]}]]`,
+		`[[{"id":1,"artist":1,"title":"III","year":2011,"num-tracks":20,"num-disks":1,"duration":1688,"blurhash":"LEHV6nWB2yk8pyo0adR*.7kCMdnj","mbid":"4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56","release-group-mbid":"9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21"},{"id":2,"artist":2,"title":"Sour Soul","year":2001,"num-tracks":10,"num-disks":1,"duration":1800,"blurhash":"LKO2?U%2Tw=w]~RBVZRi};RPxuwH","mbid":null,"release-group-mbid":null}]]`,
+		`[[{:id 3 :album 3 :genre 3 :title"The Ides of March":size 2109 :duration 210.0 :track 1 :num-tracks 8 :disk 1 :num-disks 1 :artist "Iron Maiden" :year 1980 :codec "mp3" :container "mp3" :bitrate 128000 :vbr false :sample-rate 44100 :bit-depth nil :channels 2 :lossless false :mbid nil :added nil :plays 3 :last-played 1580518800 :artists[{:artist 3 :name"Iron Maiden":role"primary"}]}]]`,
+		`[[{:id 3 :name"Iron Maiden":mbid nil}{:id 4 :name"Megadeth":mbid nil}]]`,
+		"wdb: invalid filter: expected a map, received int64",
+		`wdb: invalid filter on "path": no such field`,
+		`wdb: invalid filter on "year": unknown operator "~"`,
+		`wdb: invalid filter on "year": expected a value of kind int64, received "1990"`,
 	}
 
 	for i, testCase := range cases {
@@ -153,6 +175,167 @@ func TestNewQueryHandler(t *testing.T) {
 	}
 }
 
+// TestPagination ...
+func TestPagination(t *testing.T) {
+	prepareDB()
+
+	get := func(url string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	cases := []struct {
+		url   string
+		ids   []int64
+		count string
+		next  bool
+	}{
+		{"/json/artist?orderby=-name&limit=2", []int64{4, 3}, "4", true},
+		{"/json/artist?limit=3&offset=1", []int64{2, 3, 4}, "4", false},
+		{"/json/artist?limit=1&offset=1", []int64{2}, "4", true},
+		{"/json/artist?orderby=-name", []int64{4, 3, 2, 1}, "", false},
+		{`/json/album?limit=1&data={"artist": 1}&data={"year": {"<": 2000}}`, []int64{1, 3}, "1, 2", false},
+	}
+
+	for _, c := range cases {
+		var pages [][]int64
+		for url := c.url; url != ""; {
+			rr := get(url)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s returned status code %d: %s", url, rr.Code, rr.Body)
+			}
+			if count := rr.Header().Get("X-Total-Count"); count != c.count {
+				t.Errorf("%s: expected a count of %q, received %q", url, c.count, count)
+			}
+
+			var results [][]warblerDB.Artist
+			err := json.Unmarshal(rr.Body.Bytes(), &results)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int64{}
+			for _, r := range results {
+				for _, a := range r {
+					ids = append(ids, a.ID)
+				}
+			}
+			pages = append(pages, ids)
+
+			url = ""
+			link := rr.Header().Get("Link")
+			if link != "" {
+				if !strings.HasPrefix(link, "<") || !strings.HasSuffix(link, `>; rel="next"`) {
+					t.Fatalf("%s: unexpected link %s", c.url, link)
+				}
+				url = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+		}
+
+		if !reflect.DeepEqual(pages[0], c.ids) {
+			t.Errorf("%s: expected %v, received %v", c.url, c.ids, pages[0])
+		}
+		if next := len(pages) > 1; next != c.next {
+			t.Errorf("%s: expected a next page %v, received pages %v", c.url, c.next, pages)
+		}
+	}
+
+	// every page of a cursor is read once
+	var all []int64
+	for url := "/edn/song?orderby=-track&limit=3"; url != ""; {
+		rr := get(url)
+		var results [][]warblerDB.Song
+		err := edn.Unmarshal(rr.Body.Bytes(), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range results[0] {
+			all = append(all, s.ID)
+		}
+		link := rr.Header().Get("Link")
+		url = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+	}
+	if expected := []int64{1, 2, 3, 4}; !reflect.DeepEqual(all, expected) {
+		t.Errorf("expected %v, received %v", expected, all)
+	}
+
+	badURLs := []string{
+		"/json/artist?limit=ten",
+		"/json/artist?limit=-1",
+		"/json/artist?offset=2",
+		"/json/artist?limit=2&cursor=nope",
+		"/json/artist?limit=2&offset=2&cursor=WzRd",
+		"/json/artist?limit=2&cursor=WzRd&data={}&data={}",
+		"/json/artist?orderby=-nope",
+	}
+	for _, url := range badURLs {
+		if rr := get(url); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned status code %d, expected %d", url, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestInclude ...
+func TestInclude(t *testing.T) {
+	prepareDB()
+	cases := []struct {
+		url      string
+		status   int
+		response string
+	}{
+		{"/json/song/3?include=album,genre", http.StatusOK,
+			`{"id":3,"album":{"id":3,"artist":3,"title":"Killers","year":1980,"num-tracks":8,"num-disks":1,"duration":15440,"blurhash":null,"mbid":null,"release-group-mbid":null},"genre":{"id":3,"name":"Metal"},"title":"The Ides of March","size":2109,"duration":210,"track":1,"num-tracks":8,"disk":1,"num-disks":1,"artist":"Iron Maiden","year":1980,"codec":"mp3","container":"mp3","bitrate":128000,"vbr":false,"sample-rate":44100,"bit-depth":null,"channels":2,"lossless":false,"mbid":null,"added":null,"plays":3,"last-played":1580518800,"artists":[{"artist":3,"name":"Iron Maiden","role":"primary"}]}`},
+		{"/edn/album?include=artist&include=images&data={:id 2}", http.StatusOK,
+			`[[{:id 2 :artist{:id 2 :name"BADBADNOTGOOD \u0026 Ghostface Killah":mbid nil}:title"Sour Soul":year 2001 :num-tracks 10 :num-disks 1 :duration 1800 :blurhash "LKO2?U%2Tw=w]~RBVZRi};RPxuwH" :mbid nil :release-group-mbid nil :images[{:id 2 :hash "ed4a77d1b56a118938788fc53037759b6c501e3d2a9c1b0ab7c4c5f7e4a2d8d5" :mime-type "image/jpeg" :source"folder":blurhash "LKO2?U%2Tw=w]~RBVZRi};RPxuwH"}]}]]`},
+		{"/json/genre?include=songs&data={\"id\": 100}", http.StatusOK, `[[]]`},
+		{"/json/album/1?include=genre", http.StatusBadRequest, ""},
+		{"/json/artist?include=songs", http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("%s returned status code %d, expected %d", c.url, rr.Code, c.status)
+			continue
+		}
+		if c.status == http.StatusOK && rr.Body.String() != c.response {
+			t.Errorf("%s returned %s, expected %s", c.url, rr.Body, c.response)
+		}
+	}
+}
+
+// adminAuth ...
+// Logs in as the admin, returning the header that authenticates a
+// request as them. Requests let through anonymously cannot manage
+// libraries.
+func adminAuth(t *testing.T) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "/json/login", strings.NewReader(`{"name":"admin","password":"correct horse"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	serv.router.ServeHTTP(rr, req)
+
+	var s session
+	err = jsonE.dec(rr.Body.Bytes(), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + s.Token
+}
+
 // TestNewLibrary ...
 func TestNewLibrary(t *testing.T) {
 	libLoc, err := filepath.Abs("db/test_lib")
@@ -163,11 +346,14 @@ func TestNewLibrary(t *testing.T) {
 		name     string
 		enc      encoder
 		bodyStr  string
+		admin    bool
 		code     int
 		expected string
 	}{
 		{"create \"NewMusic\"", ednE, fmt.Sprintf(`{:name "NewMusic" :path %q}`, libLoc),
-			http.StatusOK, fmt.Sprintf(`{:id 10001 :name"NewMusic":path%q}`, libLoc)},
+			true, http.StatusOK, fmt.Sprintf(`{:id 10001 :name"NewMusic":path%q}`, libLoc)},
+		{"anonymous", ednE, fmt.Sprintf(`{:name "NewMusic" :path %q}`, libLoc),
+			false, http.StatusUnauthorized, ""},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
@@ -177,6 +363,9 @@ func TestNewLibrary(t *testing.T) {
 			if err != nil {
 				t.Errorf("error in %s: %v", test.name, err)
 			}
+			if test.admin {
+				req.Header.Set("Authorization", adminAuth(t))
+			}
 
 			rr := httptest.NewRecorder()
 
@@ -216,6 +405,7 @@ func TestNewLibraryUpdate(t *testing.T) {
 			if err != nil {
 				t.Errorf("error in %s: %v", test.name, err)
 			}
+			req.Header.Set("Authorization", adminAuth(t))
 
 			rr := httptest.NewRecorder()
 
@@ -228,3 +418,352 @@ func TestNewLibraryUpdate(t *testing.T) {
 	}
 
 }
+
+// TestScanJob ...
+func TestScanJob(t *testing.T) {
+	prepareDB()
+
+	libLoc, err := filepath.Abs("db/test_lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib := warblerDB.Library{Name: "Scanned", Path: libLoc}
+	err = serv.wdb.Create(&lib, []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := adminAuth(t)
+	request := func(method, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request(http.MethodPost, fmt.Sprintf("/json/scanLibrary/%d", lib.ID))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the scan to be accepted, received: %v %s", rr.Code, rr.Body)
+	}
+
+	var status scanJobStatus
+	err = json.Unmarshal(rr.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Library != lib.ID {
+		t.Errorf("unexpected library in scan job: %d", status.Library)
+	}
+
+	// wait for the scan to finish
+	url := fmt.Sprintf("/json/scanJob/%d", status.ID)
+	deadline := time.Now().Add(10 * time.Second)
+	for status.State == jobRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("scan job did not finish: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		rr = request(http.MethodGet, url)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code for scan job: %v", rr.Code)
+		}
+		err = json.Unmarshal(rr.Body.Bytes(), &status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status.State != jobDone || status.Added != 1 || status.Finished == nil || status.ETA != nil {
+		t.Errorf("unexpected finished scan job: %s", rr.Body)
+	}
+
+	// edn reports the same job
+	rr = request(http.MethodGet, fmt.Sprintf("/edn/scanJob/%d", status.ID))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), ":state"+`"done"`) {
+		t.Errorf("unexpected edn scan job: %v %s", rr.Code, rr.Body)
+	}
+
+	// cancelling a finished job does not change it
+	rr = request(http.MethodDelete, url)
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"state":"done"`) {
+		t.Errorf("unexpected cancelled scan job: %v %s", rr.Code, rr.Body)
+	}
+
+	errorCases := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{http.MethodGet, "/json/scanJob/99", http.StatusNotFound},
+		{http.MethodDelete, "/edn/scanJob/99", http.StatusNotFound},
+		{http.MethodGet, "/json/scanJob/h9h", http.StatusBadRequest},
+		{http.MethodPost, "/json/scanLibrary/99", http.StatusBadRequest},
+	}
+	for _, test := range errorCases {
+		rr = request(test.method, test.url)
+		if rr.Code != test.code {
+			t.Errorf("%s %s: expected code %v received %v", test.method, test.url, test.code, rr.Code)
+		}
+	}
+}
+
+// TestAppearsOn ...
+func TestAppearsOn(t *testing.T) {
+	prepareDB()
+	cases := []struct {
+		url      string
+		status   int
+		response string
+	}{
+		{"/json/appearsOn/1", http.StatusOK,
+			`[{"id":2,"artist":2,"title":"Sour Soul","year":2001,"num-tracks":10,"num-disks":1,"duration":1800,"blurhash":"LKO2?U%2Tw=w]~RBVZRi};RPxuwH","mbid":null,"release-group-mbid":null}]`},
+		{"/edn/appearsOn/3", http.StatusOK, `[]`},
+		{"/edn/appearsOn/99", http.StatusNotFound, ""},
+		{"/edn/appearsOn/h9h", http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("%s returned status code %d, expected %d", c.url, rr.Code, c.status)
+			continue
+		}
+		if c.status == http.StatusOK && rr.Body.String() != c.response {
+			t.Errorf("%s returned %s, expected %s", c.url, rr.Body, c.response)
+		}
+	}
+}
+
+// TestMBID ...
+func TestMBID(t *testing.T) {
+	prepareDB()
+	cases := []struct {
+		url      string
+		status   int
+		response string
+	}{
+		{"/json/mbid/0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11", http.StatusOK,
+			`{"artists":[{"id":1,"name":"BADBADNOTGOOD","mbid":"0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"}],"albums":[],"songs":[]}`},
+		{"/edn/mbid/9F1E2D3C-4B5A-4697-8A8B-7C6D5E4F3A21", http.StatusOK,
+			`{:artists[]:albums[{:id 1 :artist 1 :title"III":year 2011 :num-tracks 20 :num-disks 1 :duration 1688 :blurhash "LEHV6nWB2yk8pyo0adR*.7kCMdnj" :mbid "4b2c8e1f-6a3d-4c7e-b5f9-1d0a2e3c4f56" :release-group-mbid "9f1e2d3c-4b5a-4697-8a8b-7c6d5e4f3a21"}]:songs[]}`},
+		{"/edn/mbid/11111111-2222-4333-8444-555555555555", http.StatusNotFound, ""},
+		{"/edn/mbid/III", http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("%s returned status code %d, expected %d", c.url, rr.Code, c.status)
+			continue
+		}
+		if c.status == http.StatusOK && rr.Body.String() != c.response {
+			t.Errorf("%s returned %s, expected %s", c.url, rr.Body, c.response)
+		}
+	}
+}
+
+// TestSearch ...
+func TestSearch(t *testing.T) {
+	prepareDB()
+	cases := []struct {
+		url      string
+		status   int
+		response string
+	}{
+		{"/json/search?q=ghostface", http.StatusOK,
+			`{"artists":[{"id":2,"name":"BADBADNOTGOOD \u0026 Ghostface Killah","mbid":null}],"albums":[],"songs":[],"genres":[]}`},
+		{"/json/search?q=bädbädnotgood&limit=1", http.StatusOK,
+			`{"artists":[{"id":1,"name":"BADBADNOTGOOD","mbid":"0e7a6e5d-7bd3-4f4a-9a1c-2f3e8c9d0b11"}],"albums":[],"songs":[],"genres":[]}`},
+		{"/edn/search?q=coltrane", http.StatusOK, `{:artists[]:albums[]:songs[]:genres[]}`},
+		{"/edn/search?q=", http.StatusBadRequest, ""},
+		{"/edn/search?q=ghostface&limit=all", http.StatusBadRequest, ""},
+		{"/edn/search?q=ghostface&limit=0", http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("%s returned status code %d, expected %d", c.url, rr.Code, c.status)
+			continue
+		}
+		if c.status == http.StatusOK && rr.Body.String() != c.response {
+			t.Errorf("%s returned %s, expected %s", c.url, rr.Body, c.response)
+		}
+	}
+}
+
+// TestArtwork ...
+func TestArtwork(t *testing.T) {
+	prepareDB()
+
+	dir, err := ioutil.TempDir("", "warbler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the cover of album 1 is moved somewhere that exists
+	cover := []byte("\xff\xd8\xff\xe0 not really a jpeg")
+	coverPath := filepath.Join(dir, "cover.jpg")
+	err = ioutil.WriteFile(coverPath, cover, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = serv.wdb.Exec("UPDATE music.images SET fs_path = $1 WHERE id = 1", coverPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url    string
+		status int
+		body   []byte
+	}{
+		{"/edn/imageFile/1", http.StatusOK, cover},
+		{"/json/albumArt/1", http.StatusOK, cover},
+
+		// the file of image 2 does not exist
+		{"/json/imageFile/2", http.StatusNotFound, nil},
+		{"/edn/albumArt/2", http.StatusNotFound, nil},
+		// album 3 has no images
+		{"/edn/albumArt/3", http.StatusNotFound, nil},
+		{"/edn/imageFile/99", http.StatusNotFound, nil},
+		{"/edn/imageFile/h9h", http.StatusBadRequest, nil},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("%s returned status code %d, expected %d", c.url, rr.Code, c.status)
+			continue
+		}
+		if c.body == nil {
+			continue
+		}
+		if !bytes.Equal(rr.Body.Bytes(), c.body) {
+			t.Errorf("%s returned %q, expected %q", c.url, rr.Body.Bytes(), c.body)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "image/jpeg" {
+			t.Errorf("%s returned content type %q", c.url, ct)
+		}
+	}
+}
+
+// TestResizedArtwork ...
+func TestResizedArtwork(t *testing.T) {
+	prepareDB()
+
+	dir, err := ioutil.TempDir("", "warbler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serv.wdb.CacheDir = dir
+	defer func() { serv.wdb.CacheDir = "" }()
+
+	var cover bytes.Buffer
+	err = png.Encode(&cover, image.NewGray(image.Rect(0, 0, 300, 200)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	coverPath := filepath.Join(dir, "cover.png")
+	err = ioutil.WriteFile(coverPath, cover.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = serv.wdb.Exec("UPDATE music.images SET fs_path = $1, mime_type = $2 WHERE id = 1",
+		coverPath, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const hash = "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	cases := []struct {
+		url         string
+		ifNoneMatch string
+		status      int
+		contentType string
+		etag        string
+		size        image.Point
+	}{
+		{"/edn/albumArt/1", "", http.StatusOK, "image/png", `"` + hash + `"`, image.Pt(300, 200)},
+		{"/edn/albumArt/1?size=100", "", http.StatusOK, "image/jpeg", `"` + hash + `-128.jpg"`, image.Pt(128, 85)},
+		{"/json/imageFile/1?size=64&format=webp", "", http.StatusOK, "image/webp", `"` + hash + `-64.webp"`, image.Pt(64, 42)},
+		{"/json/imageFile/1?size=4000&format=png", "", http.StatusOK, "image/png", `"` + hash + `-2048.png"`, image.Pt(300, 200)},
+
+		// clients with a current copy are told so
+		{"/edn/albumArt/1?size=100", `"` + hash + `-128.jpg"`, http.StatusNotModified, "", "", image.Point{}},
+		{"/edn/albumArt/1", `"` + hash + `"`, http.StatusNotModified, "", "", image.Point{}},
+		{"/edn/albumArt/1?size=100", `"` + hash + `"`, http.StatusOK, "image/jpeg", `"` + hash + `-128.jpg"`, image.Pt(128, 85)},
+
+		{"/edn/albumArt/1?size=0", "", http.StatusBadRequest, "", "", image.Point{}},
+		{"/edn/albumArt/1?size=big", "", http.StatusBadRequest, "", "", image.Point{}},
+		{"/edn/albumArt/1?size=100&format=gif", "", http.StatusBadRequest, "", "", image.Point{}},
+		// the file of image 2 does not exist
+		{"/edn/imageFile/2?size=100", "", http.StatusNotFound, "", "", image.Point{}},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", c.ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		serv.router.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("%s returned status code %d, expected %d", c.url, rr.Code, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != c.contentType {
+			t.Errorf("%s returned content type %q, expected %q", c.url, ct, c.contentType)
+		}
+		if etag := rr.Header().Get("ETag"); etag != c.etag {
+			t.Errorf("%s returned etag %s, expected %s", c.url, etag, c.etag)
+		}
+
+		img, _, err := image.Decode(rr.Body)
+		if err != nil {
+			t.Errorf("%s returned an invalid image: %v", c.url, err)
+			continue
+		}
+		if size := img.Bounds().Size(); size != c.size {
+			t.Errorf("%s returned a %v image, expected %v", c.url, size, c.size)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// Scan job states.
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// finished jobs are forgotten after this long
+const scanJobRetention = time.Hour
+
+// scanJob ...
+// A library scan running in the background.
+type scanJob struct {
+	id      int64
+	library int64
+	started time.Time
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	state    string
+	stats    warblerDB.ScanStats
+	err      error
+	finished time.Time
+}
+
+// scanJobStatus ...
+// The progress of a scan job as reported by the api. ETA is the
+// estimated number of seconds until the scan is done, it is nil when
+// the number of files in the library is not yet known.
+type scanJobStatus struct {
+	ID       int64      `edn:"id"       json:"id"`
+	Library  int64      `edn:"library"  json:"library"`
+	State    string     `edn:"state"    json:"state"`
+	Started  time.Time  `edn:"started"  json:"started"`
+	Finished *time.Time `edn:"finished" json:"finished"`
+	ETA      *float64   `edn:"eta"      json:"eta"`
+	Error    *string    `edn:"error"    json:"error"`
+
+	warblerDB.ScanStats
+}
+
+// setStats ...
+func (job *scanJob) setStats(stats warblerDB.ScanStats) {
+	job.mu.Lock()
+	job.stats = stats
+	job.mu.Unlock()
+}
+
+// finish ...
+// Records the result of the scan.
+func (job *scanJob) finish(stats warblerDB.ScanStats, err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.stats = stats
+	job.finished = time.Now()
+	switch {
+	case err == context.Canceled:
+		job.state = jobCancelled
+	case err != nil:
+		job.state = jobFailed
+		job.err = err
+	default:
+		job.state = jobDone
+	}
+}
+
+// status ...
+func (job *scanJob) status() scanJobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	s := scanJobStatus{
+		ID:        job.id,
+		Library:   job.library,
+		State:     job.state,
+		Started:   job.started,
+		ScanStats: job.stats,
+	}
+	if !job.finished.IsZero() {
+		finished := job.finished
+		s.Finished = &finished
+	}
+	if job.err != nil {
+		msg := job.err.Error()
+		s.Error = &msg
+	}
+	if job.state == jobRunning {
+		s.ETA = job.eta(time.Now())
+	}
+
+	return s
+}
+
+// eta ...
+// Estimates the seconds left in the scan from the rate files have
+// been handled so far and the number of files the previous scan of
+// the library saw. Must be called with the lock held.
+func (job *scanJob) eta(now time.Time) *float64 {
+	st := job.stats
+	handled := st.Skipped + st.Added + st.Updated + st.Errors
+	if st.Expected == 0 || handled == 0 {
+		return nil
+	}
+
+	remaining := st.Expected - handled
+	if remaining < 0 {
+		remaining = 0
+	}
+	elapsed := now.Sub(job.started).Seconds()
+	eta := elapsed / float64(handled) * float64(remaining)
+	return &eta
+}
+
+// scanJobs ...
+// The scan jobs started by the server. The zero value is ready to
+// use.
+type scanJobs struct {
+	mu     sync.Mutex
+	lastID int64
+	jobs   map[int64]*scanJob
+}
+
+// start ...
+// Scans lib in the background and returns its job. If lib is already
+// being scanned the running job is returned instead of starting
+// another.
+func (sj *scanJobs) start(wdb *warblerDB.WarblerDB, lib warblerDB.Library, opts warblerDB.ScanOptions) *scanJob {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+
+	if sj.jobs == nil {
+		sj.jobs = map[int64]*scanJob{}
+	}
+
+	now := time.Now()
+	for id, job := range sj.jobs {
+		job.mu.Lock()
+		state, finished := job.state, job.finished
+		job.mu.Unlock()
+
+		if state == jobRunning && job.library == lib.ID {
+			return job
+		}
+		if state != jobRunning && now.Sub(finished) > scanJobRetention {
+			delete(sj.jobs, id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sj.lastID++
+	job := &scanJob{
+		id:      sj.lastID,
+		library: lib.ID,
+		started: now,
+		cancel:  cancel,
+		state:   jobRunning,
+	}
+	sj.jobs[job.id] = job
+
+	opts.Progress = job.setStats
+	go func() {
+		defer cancel()
+		job.finish(wdb.ScanLibrary(ctx, lib, opts))
+	}()
+
+	return job
+}
+
+// get ...
+// Returns the job with the given id, or nil if there is none.
+func (sj *scanJobs) get(id int64) *scanJob {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+
+	return sj.jobs[id]
+}
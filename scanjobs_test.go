@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// TestScanJobETA ...
+func TestScanJobETA(t *testing.T) {
+	started := time.Now()
+
+	testCases := []struct {
+		name  string
+		stats warblerDB.ScanStats
+		eta   float64
+		known bool
+	}{
+		{"first scan", warblerDB.ScanStats{Seen: 10, Added: 10}, 0, false},
+		{"nothing handled", warblerDB.ScanStats{Expected: 100, Seen: 1}, 0, false},
+		{"quarter done", warblerDB.ScanStats{Expected: 100, Skipped: 20, Added: 4, Errors: 1}, 30, true},
+		{"more than expected", warblerDB.ScanStats{Expected: 10, Skipped: 20}, 0, true},
+	}
+
+	for _, test := range testCases {
+		job := &scanJob{started: started, state: jobRunning, stats: test.stats}
+		eta := job.eta(started.Add(10 * time.Second))
+
+		if (eta != nil) != test.known {
+			t.Errorf("%s: expected eta to be known: %v, received: %v", test.name, test.known, eta)
+			continue
+		}
+		if eta != nil && *eta != test.eta {
+			t.Errorf("%s: expected eta %v, received %v", test.name, test.eta, *eta)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package scrobble
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// retryLastFM are the Last.fm error codes of submissions that may
+// succeed later: an invalid session key, the service being offline or
+// temporarily unavailable, and the rate limit being exceeded.
+var retryLastFM = map[int]bool{9: true, 11: true, 16: true, 29: true}
+
+// signLastFM ...
+// Returns the signature of the parameters of a Last.fm request, the md5
+// of each name and value in order of the names followed by the secret.
+func signLastFM(params url.Values, secret string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if name != "format" && name != "callback" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(params.Get(name))
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// submitLastFM ...
+// Scrobbles a listen to Last.fm with a session key, or updates what the
+// user is playing now when it has no time.
+func (s *Scrobbler) submitLastFM(ctx context.Context, session string, l Listen) error {
+	params := url.Values{}
+	params.Set("method", "track.updateNowPlaying")
+	if l.Listened != 0 {
+		params.Set("method", "track.scrobble")
+		params.Set("timestamp", strconv.FormatInt(l.Listened, 10))
+	}
+	params.Set("artist", l.Artist)
+	params.Set("track", l.Track)
+	if l.Album != "" {
+		params.Set("album", l.Album)
+	}
+	if l.Duration > 0 {
+		params.Set("duration", strconv.Itoa(int(l.Duration)))
+	}
+	if l.MBID != "" {
+		params.Set("mbid", l.MBID)
+	}
+	params.Set("api_key", s.opts.LastFMKey)
+	params.Set("sk", session)
+	params.Set("api_sig", signLastFM(params, s.opts.LastFMSecret))
+	params.Set("format", "json")
+
+	req, err := http.NewRequest(http.MethodPost, s.opts.LastFMURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", client)
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// errors are {"error": 9, "message": "..."}, some with a status of 200
+	var failure struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(data, &failure)
+	if resp.StatusCode == http.StatusOK && failure.Error == 0 {
+		return nil
+	}
+	return &Error{
+		Service: LastFM,
+		Status:  resp.StatusCode,
+		Code:    failure.Error,
+		Message: failure.Message,
+		retry:   retryLastFM[failure.Error] || (failure.Error == 0 && resp.StatusCode >= http.StatusInternalServerError),
+	}
+}
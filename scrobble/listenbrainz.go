@@ -0,0 +1,81 @@
+package scrobble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// listenBrainzListen ...
+// A listen as it is submitted to ListenBrainz.
+type listenBrainzListen struct {
+	ListenedAt int64 `json:"listened_at,omitempty"`
+	Metadata   struct {
+		Artist string `json:"artist_name"`
+		Track  string `json:"track_name"`
+		Album  string `json:"release_name,omitempty"`
+		Info   struct {
+			DurationMS int64  `json:"duration_ms,omitempty"`
+			MBID       string `json:"recording_mbid,omitempty"`
+			Client     string `json:"submission_client"`
+		} `json:"additional_info"`
+	} `json:"track_metadata"`
+}
+
+// submitListenBrainz ...
+// Submits a listen to ListenBrainz, as playing now when it has no time.
+func (s *Scrobbler) submitListenBrainz(ctx context.Context, token string, l Listen) error {
+	var listen listenBrainzListen
+	listen.ListenedAt = l.Listened
+	listen.Metadata.Artist = l.Artist
+	listen.Metadata.Track = l.Track
+	listen.Metadata.Album = l.Album
+	listen.Metadata.Info.DurationMS = int64(l.Duration * 1000)
+	listen.Metadata.Info.MBID = l.MBID
+	listen.Metadata.Info.Client = client
+
+	listenType := "single"
+	if l.Listened == 0 {
+		listenType = "playing_now"
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"listen_type": listenType,
+		"payload":     []listenBrainzListen{listen},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.opts.ListenBrainzURL+"/1/submit-listens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Token "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// errors are {"code": 400, "error": "..."}
+	var failure struct {
+		Error string `json:"error"`
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(data, &failure)
+	return &Error{
+		Service: ListenBrainz,
+		Status:  resp.StatusCode,
+		Message: failure.Error,
+		retry: resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode >= http.StatusInternalServerError,
+	}
+}
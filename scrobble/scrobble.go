@@ -0,0 +1,184 @@
+// Package scrobble submits the songs users listen to, and are
+// listening to now, to ListenBrainz and Last.fm.
+//
+// ListenBrainz users are identified by their user token. Last.fm users
+// by a session key made for the server's API account, which also signs
+// every request with its secret.
+package scrobble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListenBrainzURL is the root of the ListenBrainz API.
+	DefaultListenBrainzURL = "https://api.listenbrainz.org"
+
+	// DefaultLastFMURL is the endpoint of the Last.fm API.
+	DefaultLastFMURL = "https://ws.audioscrobbler.com/2.0/"
+
+	// client names the server to the services.
+	client = "Herald"
+)
+
+// ErrUnsupported is returned when submitting to a service that is not
+// one of ListenBrainz or Last.fm, or to Last.fm without an API account.
+var ErrUnsupported = errors.New("scrobble: unsupported service")
+
+// errNoTime is returned when submitting a listen without a time.
+var errNoTime = errors.New("scrobble: listen has no time")
+
+// Service ...
+// A service listens are submitted to.
+type Service string
+
+const (
+	// ListenBrainz is https://listenbrainz.org.
+	ListenBrainz Service = "listenbrainz"
+
+	// LastFM is https://www.last.fm.
+	LastFM Service = "lastfm"
+)
+
+// Valid ...
+// Reports whether s is one of the services.
+func (s Service) Valid() bool {
+	return s == ListenBrainz || s == LastFM
+}
+
+// Listen ...
+// A song a user listened to, or is listening to when Listened is 0.
+// Listened is the seconds since the unix epoch they started it,
+// Duration the length of the song in seconds and MBID its MusicBrainz
+// recording id. Listens are kept as json until they are submitted.
+type Listen struct {
+	Artist   string  `json:"artist"`
+	Track    string  `json:"track"`
+	Album    string  `json:"album,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	Listened int64   `json:"listened,omitempty"`
+	MBID     string  `json:"mbid,omitempty"`
+}
+
+// Error ...
+// A submission a service did not accept. Status is the http status of
+// its response and Code the Last.fm error code, if any.
+type Error struct {
+	Service Service
+	Status  int
+	Code    int
+	Message string
+
+	retry bool
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("scrobble: %s responded %d", e.Service, e.Status)
+	if e.Code != 0 {
+		msg += fmt.Sprintf(" error %d", e.Code)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Retry ...
+// Reports whether a failed submission may succeed when it is sent
+// again: the service could not be reached, was unavailable, limited the
+// rate of requests, or refused the user's token, which they can change.
+// Submissions the service found invalid are not retried.
+func Retry(err error) bool {
+	if errors.Is(err, ErrUnsupported) || errors.Is(err, errNoTime) {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.retry
+	}
+	return err != nil
+}
+
+// Options ...
+// Configures where listens are submitted. The URLs default to those of
+// the services, and can point at a stand-in when testing.
+type Options struct {
+	ListenBrainzURL string
+	LastFMURL       string
+
+	// the API account of the server on Last.fm, without which listens
+	// are not submitted to it
+	LastFMKey    string
+	LastFMSecret string
+
+	// Client makes the requests, one timing out after 30 seconds when
+	// it is nil.
+	Client *http.Client
+}
+
+// Scrobbler ...
+// Submits listens to the services.
+type Scrobbler struct {
+	opts Options
+}
+
+// New ...
+// Returns a scrobbler submitting listens as the options say.
+func New(opts Options) *Scrobbler {
+	if opts.ListenBrainzURL == "" {
+		opts.ListenBrainzURL = DefaultListenBrainzURL
+	}
+	opts.ListenBrainzURL = strings.TrimSuffix(opts.ListenBrainzURL, "/")
+	if opts.LastFMURL == "" {
+		opts.LastFMURL = DefaultLastFMURL
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Scrobbler{opts: opts}
+}
+
+// Supports ...
+// Reports whether listens can be submitted to a service.
+func (s *Scrobbler) Supports(service Service) bool {
+	switch service {
+	case ListenBrainz:
+		return true
+	case LastFM:
+		return s.opts.LastFMKey != "" && s.opts.LastFMSecret != ""
+	}
+	return false
+}
+
+// NowPlaying ...
+// Tells a service the user with a token is listening to a song.
+func (s *Scrobbler) NowPlaying(ctx context.Context, service Service, token string, l Listen) error {
+	l.Listened = 0
+	return s.submit(ctx, service, token, l)
+}
+
+// Submit ...
+// Adds a listen to the history of the user with a token on a service.
+func (s *Scrobbler) Submit(ctx context.Context, service Service, token string, l Listen) error {
+	if l.Listened == 0 {
+		return errNoTime
+	}
+	return s.submit(ctx, service, token, l)
+}
+
+// submit ...
+// Sends a listen to a service, as playing now when it has no time.
+func (s *Scrobbler) submit(ctx context.Context, service Service, token string, l Listen) error {
+	if !s.Supports(service) {
+		return ErrUnsupported
+	}
+	if service == LastFM {
+		return s.submitLastFM(ctx, token, l)
+	}
+	return s.submitListenBrainz(ctx, token, l)
+}
@@ -0,0 +1,199 @@
+package scrobble
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+var listen = Listen{
+	Artist:   "BADBADNOTGOOD",
+	Track:    "In the Night",
+	Album:    "III",
+	Duration: 1993,
+	Listened: 1577837400,
+	MBID:     "a1b2",
+}
+
+// TestListenBrainz ...
+func TestListenBrainz(t *testing.T) {
+	var received struct {
+		auth string
+		body string
+	}
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/submit-listens" {
+			t.Errorf("received a request for %s", r.URL.Path)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		received.auth, received.body = r.Header.Get("Authorization"), string(data)
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"code":400,"error":"invalid listen"}`))
+		}
+	}))
+	defer ts.Close()
+	s := New(Options{ListenBrainzURL: ts.URL + "/"})
+
+	var tests = []struct {
+		name       string
+		nowPlaying bool
+		status     int
+		expected   string
+		retry      bool
+	}{
+		{"listen", false, http.StatusOK, `{"listen_type":"single","payload":[{"listened_at":1577837400,"track_metadata":` +
+			`{"artist_name":"BADBADNOTGOOD","track_name":"In the Night","release_name":"III","additional_info":` +
+			`{"duration_ms":1993000,"recording_mbid":"a1b2","submission_client":"Herald"}}}]}`, false},
+		{"playing now", true, http.StatusOK, `{"listen_type":"playing_now","payload":[{"track_metadata":` +
+			`{"artist_name":"BADBADNOTGOOD","track_name":"In the Night","release_name":"III","additional_info":` +
+			`{"duration_ms":1993000,"recording_mbid":"a1b2","submission_client":"Herald"}}}]}`, false},
+		{"invalid", false, http.StatusBadRequest, "", false},
+		{"invalid token", false, http.StatusUnauthorized, "", true},
+		{"rate limited", false, http.StatusTooManyRequests, "", true},
+		{"unavailable", false, http.StatusServiceUnavailable, "", true},
+	}
+
+	for _, test := range tests {
+		status = test.status
+		var err error
+		if test.nowPlaying {
+			err = s.NowPlaying(context.Background(), ListenBrainz, "lb-token", listen)
+		} else {
+			err = s.Submit(context.Background(), ListenBrainz, "lb-token", listen)
+		}
+		if received.auth != "Token lb-token" {
+			t.Errorf("%s: expected the token, received %q", test.name, received.auth)
+		}
+		if test.expected != "" && received.body != test.expected {
+			t.Errorf("%s: expected %s, received %s", test.name, test.expected, received.body)
+		}
+		if (err != nil) != (test.status != http.StatusOK) {
+			t.Errorf("%s: received error %v", test.name, err)
+		}
+		if err != nil && Retry(err) != test.retry {
+			t.Errorf("%s: expected retry %v, received %v", test.name, test.retry, Retry(err))
+		}
+	}
+
+	var e *Error
+	status = http.StatusBadRequest
+	err := s.Submit(context.Background(), ListenBrainz, "lb-token", listen)
+	if !errors.As(err, &e) || e.Message != "invalid listen" {
+		t.Errorf("expected the message of the error, received %v", err)
+	}
+}
+
+// TestLastFM ...
+func TestLastFM(t *testing.T) {
+	var received url.Values
+	response := `{"scrobbles":{"@attr":{"accepted":1,"ignored":0}}}`
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = r.PostForm
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer ts.Close()
+	s := New(Options{LastFMURL: ts.URL, LastFMKey: "key", LastFMSecret: "secret"})
+
+	err := s.Submit(context.Background(), LastFM, "session", listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := url.Values{
+		"method":    {"track.scrobble"},
+		"artist":    {"BADBADNOTGOOD"},
+		"track":     {"In the Night"},
+		"album":     {"III"},
+		"duration":  {"1993"},
+		"timestamp": {"1577837400"},
+		"mbid":      {"a1b2"},
+		"api_key":   {"key"},
+		"sk":        {"session"},
+		"format":    {"json"},
+	}
+	expected.Set("api_sig", signLastFM(expected, "secret"))
+	if received.Encode() != expected.Encode() {
+		t.Errorf("expected %s, received %s", expected.Encode(), received.Encode())
+	}
+
+	err = s.NowPlaying(context.Background(), LastFM, "session", listen)
+	if err != nil || received.Get("method") != "track.updateNowPlaying" || received.Get("timestamp") != "" {
+		t.Errorf("expected an update of what is playing, received %v %s", err, received.Encode())
+	}
+
+	var tests = []struct {
+		name     string
+		status   int
+		response string
+		code     int
+		retry    bool
+	}{
+		{"invalid session", http.StatusForbidden, `{"error":9,"message":"Invalid session key"}`, 9, true},
+		{"invalid parameters", http.StatusBadRequest, `{"error":6,"message":"Invalid parameters"}`, 6, false},
+		{"offline", http.StatusOK, `{"error":11,"message":"Service Offline"}`, 11, true},
+		{"unavailable", http.StatusBadGateway, "<html></html>", 0, true},
+	}
+
+	for _, test := range tests {
+		status, response = test.status, test.response
+		err := s.Submit(context.Background(), LastFM, "session", listen)
+		var e *Error
+		if !errors.As(err, &e) || e.Code != test.code {
+			t.Errorf("%s: expected error %d, received %v", test.name, test.code, err)
+			continue
+		}
+		if Retry(err) != test.retry {
+			t.Errorf("%s: expected retry %v, received %v", test.name, test.retry, Retry(err))
+		}
+	}
+}
+
+// TestSignLastFM ...
+func TestSignLastFM(t *testing.T) {
+	params := url.Values{"method": {"auth.getSession"}, "api_key": {"key"}, "token": {"t"}, "format": {"json"}}
+	// md5("api_keykeymethodauth.getSessiontokentsecret")
+	if sig := signLastFM(params, "secret"); sig != "022c06e5d7a088263bb4e617ceb4f587" {
+		t.Errorf("expected 022c06e5d7a088263bb4e617ceb4f587, received %s", sig)
+	}
+}
+
+// TestUnsupported ...
+func TestUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("received a request for %s", r.URL)
+	}))
+	defer ts.Close()
+	s := New(Options{ListenBrainzURL: ts.URL, LastFMURL: ts.URL})
+
+	var tests = []struct {
+		service Service
+		token   string
+		l       Listen
+	}{
+		{LastFM, "session", listen},
+		{Service("librefm"), "token", listen},
+		{ListenBrainz, "lb-token", Listen{Artist: "BADBADNOTGOOD", Track: "In the Night"}},
+	}
+	for _, test := range tests {
+		if err := s.Submit(context.Background(), test.service, test.token, test.l); err == nil {
+			t.Errorf("%s: expected an error", test.service)
+		} else if Retry(err) {
+			t.Errorf("%s: expected %v not to be retried", test.service, err)
+		}
+	}
+
+	// a service that cannot be reached is retried
+	ts.Close()
+	err := s.Submit(context.Background(), ListenBrainz, "lb-token", listen)
+	if err == nil || !Retry(err) {
+		t.Errorf("expected a retry, received %v", err)
+	}
+}
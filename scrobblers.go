@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
+)
+
+// scrobblerRequest ...
+// The token a user's plays are forwarded to a service with: their
+// ListenBrainz user token or Last.fm session key.
+type scrobblerRequest struct {
+	Token string `edn:"token" json:"token"`
+}
+
+// newScrobblerLister ...
+// Lists the services the user's plays are forwarded to and how many
+// are waiting to be.
+func (serv *server) newScrobblerLister(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		scrobblers, err := serv.wdb.Scrobblers(user.ID)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(scrobblers)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newScrobblerSetter ...
+// Forwards the user's plays to a service with the token in the body.
+// Last.fm can only be used when the server has an API account there.
+func (serv *server) newScrobblerSetter(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		var req scrobblerRequest
+		err = enc.dec(data, &req)
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
+
+		service := scrobble.Service(mux.Vars(r)["service"])
+		if service.Valid() && (serv.forwarder == nil || !serv.forwarder.Supports(service)) {
+			badRequestErr(w, errors.New("plays cannot be forwarded to "+string(service)+" by this server"))
+			return
+		}
+
+		err = serv.wdb.SetScrobbler(user.ID, service, req.Token)
+		if err == warblerDB.ErrInvalidScrobbler || err == warblerDB.ErrInvalidScrobbleToken {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+		serv.forwardPlays()
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newScrobblerDeleter ...
+// Stops forwarding the user's plays to a service.
+func (serv *server) newScrobblerDeleter(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		err := serv.wdb.DeleteScrobbler(user.ID, scrobble.Service(mux.Vars(r)["service"]))
+		if err == warblerDB.ErrNotPresent {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+	"gitlab.stergianis.ca/michael/warbler/scrobble"
+)
+
+// TestScrobblers ...
+func TestScrobblers(t *testing.T) {
+	prepareDB()
+
+	// a stand-in for both ListenBrainz and Last.fm
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- r.URL.Path + " " + string(data)
+	}))
+	defer ts.Close()
+	serv.forwarder = serv.wdb.NewForwarder(warblerDB.ForwardOptions{Scrobble: scrobble.Options{
+		ListenBrainzURL: ts.URL,
+		LastFMURL:       ts.URL + "/lastfm",
+		LastFMKey:       "key",
+		LastFMSecret:    "secret",
+	}})
+	defer func() { serv.forwarder = nil }()
+	do := authedRequester(t)
+
+	login := func(name string) map[string]string {
+		rr := do(http.MethodPost, "/json/login", `{"name":"`+name+`","password":"correct horse"}`, nil)
+		var s session
+		err := jsonE.dec(rr.Body.Bytes(), &s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"Authorization": "Bearer " + s.Token}
+	}
+	admin, listener := login("admin"), login("listener")
+	read := map[string]string{"Authorization": "Bearer wbt_listener-read"}
+
+	var tests = []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		headers  map[string]string
+		rCode    int
+		response string
+	}{
+		{"list", http.MethodGet, "/json/scrobbler", "", listener, http.StatusOK,
+			`[{"id":1,"user":2,"service":"listenbrainz","pending":1,"last-error":"scrobble: listenbrainz responded 503"}]`},
+		{"read token", http.MethodGet, "/json/scrobbler", "", read, http.StatusForbidden, ""},
+		{"anonymous", http.MethodGet, "/json/scrobbler", "", nil, http.StatusUnauthorized, ""},
+		{"set", http.MethodPut, "/edn/scrobbler/lastfm", `{:token "lastfm-listener"}`, listener, http.StatusNoContent, ""},
+		{"list set", http.MethodGet, "/edn/scrobbler", "", listener, http.StatusOK,
+			`[{:id 10001 :user 2 :service"lastfm":pending 0 :last-error nil}{:id 1 :user 2 :service"listenbrainz":pending 1 ` +
+				`:last-error "scrobble: listenbrainz responded 503"}]`},
+		{"invalid service", http.MethodPut, "/json/scrobbler/librefm", `{"token":"t"}`, listener, http.StatusBadRequest, ""},
+		{"no token", http.MethodPut, "/json/scrobbler/listenbrainz", `{"token":""}`, listener, http.StatusBadRequest, ""},
+		{"delete", http.MethodDelete, "/json/scrobbler/lastfm", "", admin, http.StatusNoContent, ""},
+		{"delete again", http.MethodDelete, "/json/scrobbler/lastfm", "", admin, http.StatusNotFound, ""},
+		{"now playing", http.MethodPost, "/json/scrobble", `{"song":3,"now-playing":true}`, listener, http.StatusAccepted, ""},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, test.body, test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d %s", test.name, test.rCode, rr.Code, rr.Body)
+		}
+		if test.response != "" && rr.Body.String() != test.response {
+			t.Errorf("%s: expected %s, received %s", test.name, test.response, rr.Body)
+		}
+	}
+
+	// what is playing is sent in the background, to both services
+	var playing []string
+	for len(playing) < 2 {
+		select {
+		case r := <-received:
+			playing = append(playing, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the song playing now to be sent, received %v", playing)
+		}
+	}
+	for _, r := range playing {
+		if !strings.Contains(r, "playing_now") && !strings.Contains(r, "track.updateNowPlaying") {
+			t.Errorf("expected the song playing now, received %s", r)
+		}
+	}
+
+	// plays are queued for each scrobbler until they are forwarded
+	rr := do(http.MethodPost, "/json/scrobble", `{"song":3,"played":1600000000}`, listener)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, received %d %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	sent, err := serv.forwarder.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 3 {
+		t.Errorf("expected 3 plays sent, received %d", sent)
+	}
+	rr = do(http.MethodGet, "/json/scrobbler", "", listener)
+	if !strings.Contains(rr.Body.String(), `"pending":0,"last-error":null}`) ||
+		strings.Contains(rr.Body.String(), `"pending":1`) {
+		t.Errorf("expected nothing pending, received %s", rr.Body)
+	}
+
+	// Last.fm cannot be used without an API account
+	serv.forwarder = serv.wdb.NewForwarder(warblerDB.ForwardOptions{Scrobble: scrobble.Options{ListenBrainzURL: ts.URL}})
+	do = authedRequester(t)
+	rr = do(http.MethodPut, "/json/scrobbler/lastfm", `{"token":"lastfm-listener"}`, listener)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("unconfigured: expected status %d, received %d", http.StatusBadRequest, rr.Code)
+	}
+}
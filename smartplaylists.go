@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// smartPlaylistRequest ...
+// A smart playlist to create, or the changes to one. An empty order
+// and a limit of 0 are removed.
+type smartPlaylistRequest struct {
+	Name    string                    `edn:"name"     json:"name"`
+	Sharing warblerDB.PlaylistSharing `edn:"sharing"  json:"sharing"`
+	Rules   *warblerDB.SongRules      `edn:"rules"    json:"rules"`
+	OrderBy *string                   `edn:"order-by" json:"order-by"`
+	Limit   *int64                    `edn:"limit"    json:"limit"`
+}
+
+// apply ...
+// Changes a smart playlist by what is in the request, leaving the rest
+// as it is.
+func (req smartPlaylistRequest) apply(playlist *warblerDB.SmartPlaylist) {
+	if req.Name != "" {
+		playlist.Name = req.Name
+	}
+	if req.Sharing != "" {
+		playlist.Sharing = req.Sharing
+	}
+	if req.Rules != nil {
+		playlist.Rules = *req.Rules
+	}
+	if req.OrderBy != nil {
+		playlist.OrderBy = warblerDB.NullString{}
+		if *req.OrderBy != "" {
+			playlist.OrderBy = warblerDB.NewNullString(*req.OrderBy)
+		}
+	}
+	if req.Limit != nil {
+		playlist.Limit = warblerDB.NullInt64{}
+		if *req.Limit != 0 {
+			playlist.Limit = warblerDB.NewNullInt64(*req.Limit)
+		}
+	}
+}
+
+// invalidSmartPlaylist ...
+// Reports whether err is the fault of a smart playlist that was asked
+// for.
+func invalidSmartPlaylist(err error) bool {
+	switch err.(type) {
+	case warblerDB.ErrInvalidFilter:
+		return true
+	}
+	switch err {
+	case warblerDB.ErrInvalidPlaylistName, warblerDB.ErrInvalidSmartSharing,
+		warblerDB.ErrInvalidSongOrder, warblerDB.ErrInvalidSongLimit:
+		return true
+	}
+	return false
+}
+
+// requestSmartPlaylist ...
+// Reads the smart playlist of a request if the user can see it, and
+// when manage is true change it, writing an error response when they
+// cannot.
+func (serv *server) requestSmartPlaylist(w http.ResponseWriter, r *http.Request,
+	manage bool) (playlist warblerDB.SmartPlaylist, ok bool) {
+	if !serv.requestRecord(w, r, &playlist) {
+		return playlist, false
+	}
+
+	user := requestUser(r)
+	if manage && !playlist.CanManage(user) {
+		forbidden(w, user)
+		return playlist, false
+	}
+	return playlist, true
+}
+
+// newSmartPlaylistCreator ...
+// Makes the user a smart playlist with the name, sharing, rules, order
+// and limit in the body.
+func (serv *server) newSmartPlaylistCreator(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		var req smartPlaylistRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+		playlist := warblerDB.SmartPlaylist{Owner: user.ID}
+		req.apply(&playlist)
+
+		playlist, err := serv.wdb.CreateSmartPlaylist(playlist)
+		if invalidSmartPlaylist(err) {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(playlist)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(response)
+	}
+}
+
+// newSmartPlaylistUpdater ...
+// Changes what is in the body of one of the user's smart playlists.
+func (serv *server) newSmartPlaylistUpdater(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestSmartPlaylist(w, r, true)
+		if !ok {
+			return
+		}
+
+		var req smartPlaylistRequest
+		if !decodeBody(enc, w, r, &req) {
+			return
+		}
+		req.apply(&playlist)
+
+		err := serv.wdb.UpdateSmartPlaylist(playlist)
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case err == warblerDB.ErrNotPresent:
+			w.WriteHeader(http.StatusNotFound)
+		case invalidSmartPlaylist(err):
+			badRequestErr(w, err)
+		default:
+			internalServerError(w)
+		}
+	}
+}
+
+// newSmartPlaylistDeleter ...
+// Deletes one of the user's smart playlists.
+func (serv *server) newSmartPlaylistDeleter(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestSmartPlaylist(w, r, true)
+		if !ok {
+			return
+		}
+
+		playlistChanged(w, serv.wdb.DeleteSmartPlaylist(playlist.ID))
+	}
+}
+
+// newSmartPlaylistSongsRoute ...
+// Lists the songs the user can see that meet the rules of a smart
+// playlist, as they are now.
+func (serv *server) newSmartPlaylistSongsRoute(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playlist, ok := serv.requestSmartPlaylist(w, r, false)
+		if !ok {
+			return
+		}
+
+		songs, err := serv.wdb.SmartPlaylistSongs(playlist, requestUser(r))
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(songs)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
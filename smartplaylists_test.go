@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// TestSmartPlaylists ...
+func TestSmartPlaylists(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	login := func(name string) map[string]string {
+		rr := do(http.MethodPost, "/json/login", `{"name":"`+name+`","password":"correct horse"}`, nil)
+		var s session
+		err := jsonE.dec(rr.Body.Bytes(), &s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"Authorization": "Bearer " + s.Token}
+	}
+	admin, listener := login("admin"), login("listener")
+
+	var tests = []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		headers  map[string]string
+		rCode    int
+		response string
+	}{
+		{"list", http.MethodGet, "/json/smartPlaylist", "", listener, http.StatusOK,
+			`[[{"id":1,"owner":2,"name":"Short Songs","sharing":"private","rules":{"duration":{"\u003c":240}},"order-by":"title","limit":null},` +
+				`{"id":2,"owner":1,"name":"Longest Grooves","sharing":"read","rules":{"genre":1},"order-by":"-duration","limit":2}]]`},
+		{"edn", http.MethodGet, "/edn/smartPlaylist/1", "", listener, http.StatusOK,
+			`{:id 1 :owner 2 :name"Short Songs":sharing"private":rules {:duration{:< 240}} :order-by "title" :limit nil}`},
+		{"private", http.MethodGet, "/json/smartPlaylist/3/songs", "", listener, http.StatusNotFound, ""},
+		{"queried", http.MethodGet, `/json/smartPlaylist?data={"sharing":"read"}&include=songs`, "", listener, http.StatusOK,
+			`[[{"id":2,"owner":1,"name":"Longest Grooves","sharing":"read","rules":{"genre":1},"order-by":"-duration","limit":2,"songs":[]}]]`},
+
+		{"create", http.MethodPost, "/edn/smartPlaylist",
+			`{:name "Before the Nineties" :rules {:year {:< 1990}} :order-by "-year, title" :limit 50}`, listener, http.StatusCreated,
+			`{:id 10001 :owner 2 :name"Before the Nineties":sharing"private":rules {:year{:< 1990}} :order-by "-year, title" :limit 50}`},
+		{"invalid rules", http.MethodPost, "/json/smartPlaylist", `{"name":"Jazz","rules":{"genre":"Jazz"}}`, listener,
+			http.StatusBadRequest, ""},
+		{"invalid order", http.MethodPost, "/json/smartPlaylist", `{"name":"Jazz","order-by":"loudness"}`, listener,
+			http.StatusBadRequest, ""},
+		{"collaborative", http.MethodPost, "/json/smartPlaylist", `{"name":"Jazz","sharing":"collaborative"}`, listener,
+			http.StatusBadRequest, ""},
+		{"anonymous", http.MethodPost, "/json/smartPlaylist", `{"name":"Jazz"}`, nil, http.StatusUnauthorized, ""},
+
+		{"update", http.MethodPut, "/json/smartPlaylist/10001", `{"sharing":"read","order-by":"random","limit":0}`, listener,
+			http.StatusNoContent, ""},
+		{"updated", http.MethodGet, "/json/smartPlaylist/10001", "", admin, http.StatusOK,
+			`{"id":10001,"owner":2,"name":"Before the Nineties","sharing":"read","rules":{"year":{"\u003c":1990}},"order-by":"random","limit":null}`},
+		{"update another's", http.MethodPut, "/json/smartPlaylist/10001", `{"name":"Mine"}`, admin, http.StatusForbidden, ""},
+		{"invalid limit", http.MethodPut, "/json/smartPlaylist/10001", `{"limit":-1}`, listener, http.StatusBadRequest, ""},
+		{"export", http.MethodGet, "/json/smartPlaylist/1/export.m3u8", "", listener, http.StatusOK, ""},
+		{"delete another's", http.MethodDelete, "/json/smartPlaylist/10001", "", admin, http.StatusForbidden, ""},
+		{"delete", http.MethodDelete, "/json/smartPlaylist/1", "", listener, http.StatusNoContent, ""},
+		{"deleted", http.MethodGet, "/json/smartPlaylist/1", "", listener, http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, test.body, test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d %s", test.name, test.rCode, rr.Code, rr.Body)
+		}
+		if test.response != "" && rr.Body.String() != test.response {
+			t.Errorf("%s: expected %s, received %s", test.name, test.response, rr.Body)
+		}
+	}
+
+	// the songs are those meeting the rules when they are read
+	songs := func(headers map[string]string) []int64 {
+		rr := do(http.MethodGet, "/json/smartPlaylist/10001/songs", "", headers)
+		var found []warblerDB.Song
+		err := jsonE.dec(rr.Body.Bytes(), &found)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, s := range found {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	if received := songs(listener); !reflect.DeepEqual(received, []int64{3}) {
+		t.Errorf("expected the listener's song before the nineties, received %v", received)
+	}
+	if received := songs(admin); len(received) != 2 {
+		t.Errorf("expected both songs before the nineties, received %v", received)
+	}
+}
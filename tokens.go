@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// tokenRequest ...
+// An API token to create.
+type tokenRequest struct {
+	Name  string               `edn:"name"  json:"name"`
+	Scope warblerDB.TokenScope `edn:"scope" json:"scope"`
+}
+
+// newTokenCreator ...
+// Makes the user a token with the name and scope in the body. The
+// token is in the response and cannot be read again.
+func (serv *server) newTokenCreator(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		var req tokenRequest
+		err = enc.dec(data, &req)
+		if err != nil {
+			badRequestErr(w, err)
+			return
+		}
+
+		token, err := serv.wdb.CreateAPIToken(user.ID, req.Name, req.Scope)
+		if err == warblerDB.ErrInvalidTokenName || err == warblerDB.ErrInvalidScope {
+			badRequestErr(w, err)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(token)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(response)
+	}
+}
+
+// newTokenLister ...
+// Lists the user's tokens and when they were last used.
+func (serv *server) newTokenLister(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		tokens, err := serv.wdb.APITokens(user.ID)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		response, err := enc.enc(tokens)
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/"+enc.name)
+		w.Write(response)
+	}
+}
+
+// newTokenRevoker ...
+// Deletes one of the user's tokens.
+func (serv *server) newTokenRevoker(enc encoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			badRequestErr(w, errors.New("invalid id"))
+			return
+		}
+
+		err = serv.wdb.RevokeAPIToken(user.ID, id)
+		if err == warblerDB.ErrNotPresent {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			internalServerError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
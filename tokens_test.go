@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+// TestAPITokens ...
+func TestAPITokens(t *testing.T) {
+	prepareDB()
+	do := authedRequester(t)
+
+	read := map[string]string{"Authorization": "Bearer wbt_listener-read"}
+	stream := map[string]string{"Authorization": "Bearer wbt_listener-stream"}
+
+	var tests = []struct {
+		name    string
+		method  string
+		url     string
+		headers map[string]string
+		rCode   int
+	}{
+		{"read", http.MethodGet, "/json/artist/3", read, http.StatusOK},
+		{"read stream", http.MethodGet, "/json/stream/3", read, http.StatusForbidden},
+		{"read art", http.MethodGet, "/json/albumArt/3", read, http.StatusForbidden},
+		{"read scan", http.MethodPost, "/json/scanLibrary/2", read, http.StatusForbidden},
+		{"read tokens", http.MethodGet, "/json/token", read, http.StatusForbidden},
+		// the song's file is not there, but it may be streamed
+		{"stream", http.MethodGet, "/json/stream/3", stream, http.StatusNotFound},
+		{"stream art", http.MethodGet, "/json/albumArt/3", stream, http.StatusNotFound},
+		{"stream other library", http.MethodGet, "/json/song/1", stream, http.StatusNotFound},
+		{"stream create token", http.MethodPost, "/json/token", stream, http.StatusForbidden},
+		{"unknown token", http.MethodGet, "/json/artist/3", map[string]string{"Authorization": "Bearer wbt_nope"}, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		rr := do(test.method, test.url, "", test.headers)
+		if rr.Code != test.rCode {
+			t.Errorf("%s: expected status %d, received %d", test.name, test.rCode, rr.Code)
+		}
+	}
+
+	rr := do(http.MethodPost, "/json/login", `{"name":"admin","password":"correct horse"}`, nil)
+	var s session
+	err := jsonE.dec(rr.Body.Bytes(), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := map[string]string{"Authorization": "Bearer " + s.Token}
+
+	rr = do(http.MethodPost, "/json/token", `{"name":"backup","scope":"write"}`, admin)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid scope: expected status %d, received %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = do(http.MethodPost, "/edn/token", `{:name "backup" :scope "admin"}`, admin)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected status %d, received %d %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	var token warblerDB.APIToken
+	err = ednE.dec(rr.Body.Bytes(), &token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripted := map[string]string{"Authorization": "Bearer " + token.Token}
+
+	rr = do(http.MethodGet, "/json/token", "", scripted)
+	if rr.Code != http.StatusOK {
+		t.Errorf("list: expected status %d, received %d", http.StatusOK, rr.Code)
+	}
+	var tokens []warblerDB.APIToken
+	err = jsonE.dec(rr.Body.Bytes(), &tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != token.ID || tokens[0].Token != "" || tokens[0].LastUsed == nil {
+		t.Errorf("expected the used token without its token, received %+v", tokens)
+	}
+
+	url := "/json/token/" + strconv.FormatInt(token.ID, 10)
+	if rr := do(http.MethodDelete, "/json/token/1", "", admin); rr.Code != http.StatusNotFound {
+		t.Errorf("revoke another's: expected status %d, received %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := do(http.MethodDelete, url, "", admin); rr.Code != http.StatusNoContent {
+		t.Errorf("revoke: expected status %d, received %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do(http.MethodGet, "/json/song/1", "", scripted); rr.Code != http.StatusUnauthorized {
+		t.Errorf("revoked: expected status %d, received %d", http.StatusUnauthorized, rr.Code)
+	}
+}
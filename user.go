@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	warblerDB "gitlab.stergianis.ca/michael/warbler/db"
+)
+
+const userUsage = "usage: warbler [flags] user add [-admin] NAME EMAIL | grant|revoke NAME LIBRARY | " +
+	"grant|revoke -anonymous LIBRARY"
+
+// userActed is what the grant and revoke actions print they did.
+var userActed = map[string]string{"grant": "granted", "revoke": "revoked"}
+
+// runUser ...
+// Implements the user command. add creates a user, reading its
+// password from the first line of in so that it is not left in the
+// shell's history. grant and revoke let a user see a library, by
+// name, or stop them from seeing it. With -anonymous they let requests
+// made without logging in see it instead.
+func runUser(wdb *warblerDB.WarblerDB, args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		flags := flag.NewFlagSet("user add", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		admin := flags.Bool("admin", false, "")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 2 {
+			return errors.New(userUsage)
+		}
+
+		fmt.Fprint(out, "password: ")
+		password, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		fmt.Fprintln(out)
+		password = strings.TrimRight(password, "\r\n")
+
+		user, err := wdb.CreateUser(flags.Arg(0), flags.Arg(1), password, *admin)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created user %d %s\n", user.ID, user.Name)
+
+	case "grant", "revoke":
+		if len(args) == 3 && args[1] == "-anonymous" {
+			return grantAnonymous(wdb, args[0], args[2], out)
+		}
+		if len(args) != 3 {
+			return errors.New(userUsage)
+		}
+
+		user, err := wdb.UserByName(args[1])
+		if err == warblerDB.ErrNotPresent {
+			return fmt.Errorf("no user named %q", args[1])
+		}
+		if err != nil {
+			return err
+		}
+		libs, err := wdb.GetLibraries()
+		if err != nil {
+			return err
+		}
+		lib, ok := libs[args[2]]
+		if !ok {
+			return fmt.Errorf("no library named %q", args[2])
+		}
+
+		if args[0] == "grant" {
+			err = wdb.GrantLibrary(user.ID, lib.ID)
+		} else {
+			err = wdb.RevokeLibrary(user.ID, lib.ID)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s %s access to %s\n", userActed[args[0]], user.Name, lib.Name)
+
+	default:
+		return errors.New(userUsage)
+	}
+
+	return nil
+}
+
+// grantAnonymous ...
+// Lets requests made without logging in see a library, by name, or
+// stops them from seeing it.
+func grantAnonymous(wdb *warblerDB.WarblerDB, action, library string, out io.Writer) error {
+	libs, err := wdb.GetLibraries()
+	if err != nil {
+		return err
+	}
+	lib, ok := libs[library]
+	if !ok {
+		return fmt.Errorf("no library named %q", library)
+	}
+
+	if action == "grant" {
+		err = wdb.GrantAnonymousLibrary(lib.ID)
+	} else {
+		err = wdb.RevokeAnonymousLibrary(lib.ID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s anonymous access to %s\n", userActed[action], lib.Name)
+	return nil
+}
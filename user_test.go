@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRunUser ...
+func TestRunUser(t *testing.T) {
+	prepareDB()
+
+	var tests = []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"grant", "listener", "Music"}, "granted listener access to Music\n"},
+		{[]string{"revoke", "listener", "Music"}, "revoked listener access to Music\n"},
+		{[]string{"grant", "-anonymous", "Music"}, "granted anonymous access to Music\n"},
+		{[]string{"revoke", "-anonymous", "Music"}, "revoked anonymous access to Music\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := runUser(serv.wdb, test.args, strings.NewReader(""), &out)
+		if err != nil {
+			t.Errorf("%v: %v", test.args, err)
+		}
+		if out.String() != test.expected {
+			t.Errorf("%v: expected %q, received %q", test.args, test.expected, out.String())
+		}
+	}
+
+	err := runUser(serv.wdb, []string{"revoke", "listener", "Nowhere"}, strings.NewReader(""), &bytes.Buffer{})
+	if err == nil || err.Error() != `no library named "Nowhere"` {
+		t.Errorf("expected an unknown library to fail, received %v", err)
+	}
+}